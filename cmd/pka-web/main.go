@@ -1,17 +1,23 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/erwar/pka/internal/book"
+	"github.com/erwar/pka/internal/covers"
 	"github.com/erwar/pka/internal/embedding"
+	"github.com/erwar/pka/internal/kosync"
 	"github.com/erwar/pka/internal/scraper"
 	"github.com/erwar/pka/internal/search"
+	"github.com/erwar/pka/internal/snapshot"
 	"github.com/erwar/pka/internal/storage"
 	"github.com/erwar/pka/internal/web"
 )
@@ -22,6 +28,13 @@ func main() {
 	dbPath := flag.String("db", "", "path to SQLite database")
 	ollamaURL := flag.String("ollama-url", "http://localhost:11434", "Ollama API URL")
 	ollamaModel := flag.String("ollama-model", "nomic-embed-text", "Ollama embedding model")
+	coversDir := flag.String("covers-dir", "", "directory for cached cover images (default: next to the database)")
+	snapshotDir := flag.String("snapshot-dir", "", "directory for database snapshots (default: next to the database)")
+	snapshotInterval := flag.Duration("snapshot-interval", 24*time.Hour, "time between scheduled database snapshots (0 disables)")
+	keepDaily := flag.Int("snapshot-keep-daily", 7, "number of daily snapshots to keep")
+	keepWeekly := flag.Int("snapshot-keep-weekly", 4, "number of weekly snapshots to keep")
+	kosyncRegistration := flag.Bool("kosync-registration", false, "let KOReader devices register sync users (otherwise use pka kosync adduser)")
+	ebookDirs := flag.String("ebook-dirs", "", "comma-separated directories of EPUBs (as given to pka import epub or pka watch) whose linked files can be downloaded")
 	flag.Parse()
 
 	// Default database path
@@ -30,6 +43,13 @@ func main() {
 		*dbPath = filepath.Join(homeDir, ".pka", "books.db")
 	}
 
+	if *coversDir == "" {
+		*coversDir = filepath.Join(filepath.Dir(*dbPath), "covers")
+	}
+	if *snapshotDir == "" {
+		*snapshotDir = filepath.Join(filepath.Dir(*dbPath), "snapshots")
+	}
+
 	// Ensure database directory exists
 	if err := os.MkdirAll(filepath.Dir(*dbPath), 0755); err != nil {
 		log.Fatalf("Failed to create database directory: %v", err)
@@ -54,12 +74,44 @@ func main() {
 	}
 
 	// Create web server
-	server := web.NewServer(bookService, searchEngine, tmdbClient)
+	coverStore := covers.NewStore(*coversDir)
+	server := web.NewServer(bookService, searchEngine, tmdbClient, coverStore)
+
+	// Scheduled snapshots; PKA_ADMIN_TOKEN enables the on-demand endpoint
+	snapshots := snapshot.NewScheduler(repo, *snapshotDir)
+	snapshots.Interval = *snapshotInterval
+	snapshots.KeepDaily = *keepDaily
+	snapshots.KeepWeekly = *keepWeekly
+	go snapshots.Run(context.Background())
+
+	adminToken := os.Getenv("PKA_ADMIN_TOKEN")
+	server.EnableSnapshots(snapshots, adminToken)
+	if adminToken == "" {
+		log.Println("PKA_ADMIN_TOKEN not set - /admin/snapshot is disabled")
+	}
+
+	// Downloads of linked ebook files, only from the given directories
+	if *ebookDirs != "" {
+		if err := server.EnableFiles(strings.Split(*ebookDirs, ",")); err != nil {
+			log.Fatalf("Failed to enable ebook downloads: %v", err)
+		}
+	} else {
+		log.Println("--ebook-dirs not set - linked ebook files can't be downloaded")
+	}
+
+	// KOReader progress sync
+	kosyncHandler := kosync.NewHandler(repo, bookService)
+	kosyncHandler.AllowRegistration = *kosyncRegistration
+	server.EnableKOSync(kosyncHandler)
 
 	// Start server
 	addr := fmt.Sprintf(":%s", *port)
 	log.Printf("Starting PKA web server on http://localhost%s", addr)
 	log.Printf("Database: %s", *dbPath)
+	if *snapshotInterval > 0 {
+		log.Printf("Snapshots: %s every %s", *snapshotDir, *snapshotInterval)
+	}
+	log.Printf("KOReader sync server: http://localhost%s/kosync", addr)
 
 	if err := http.ListenAndServe(addr, server); err != nil {
 		log.Fatalf("Server failed: %v", err)
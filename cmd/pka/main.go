@@ -3,19 +3,28 @@ package main
 import (
 	"bufio"
 	"context"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/erwar/pka/internal/backup"
 	"github.com/erwar/pka/internal/book"
+	"github.com/erwar/pka/internal/covers"
 	"github.com/erwar/pka/internal/embedding"
+	"github.com/erwar/pka/internal/importer"
+	"github.com/erwar/pka/internal/koreader"
+	"github.com/erwar/pka/internal/kosync"
+	"github.com/erwar/pka/internal/report"
 	"github.com/erwar/pka/internal/scraper"
 	"github.com/erwar/pka/internal/search"
+	"github.com/erwar/pka/internal/stats"
 	"github.com/erwar/pka/internal/storage"
 	"github.com/spf13/cobra"
 )
@@ -57,6 +66,21 @@ Search by vibes ("dark thriller with plot twists"), track reading status, and fi
 		scrapeAuthorCmd(),
 		scrapeSubjectCmd(),
 		scrapeTrendingCmd(),
+		dedupeCmd(),
+		mergeCmd(),
+		coversCmd(),
+		backupCmd(),
+		restoreCmd(),
+		watchCmd(),
+		kosyncCmd(),
+		quoteCmd(),
+		sessionCmd(),
+		readCmd(),
+		goalCmd(),
+		wrappedCmd(),
+		seriesCmd(),
+		authorCmd(),
+		editionCmd(),
 	)
 
 	if err := rootCmd.Execute(); err != nil {
@@ -66,13 +90,9 @@ Search by vibes ("dark thriller with plot twists"), track reading status, and fi
 }
 
 func initServices() (*book.Service, *search.Engine, func(), error) {
-	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
-		return nil, nil, nil, fmt.Errorf("create db directory: %w", err)
-	}
-
-	repo, err := storage.NewSQLiteRepository(dbPath)
+	repo, err := openRepository()
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("init repository: %w", err)
+		return nil, nil, nil, err
 	}
 
 	embedder := embedding.NewOllamaClient(ollamaURL, ollamaModel)
@@ -84,10 +104,23 @@ func initServices() (*book.Service, *search.Engine, func(), error) {
 	return svc, searchEngine, cleanup, nil
 }
 
+// openRepository opens the database, creating its directory if needed
+func openRepository() (*storage.SQLiteRepository, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, fmt.Errorf("create db directory: %w", err)
+	}
+
+	repo, err := storage.NewSQLiteRepository(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("init repository: %w", err)
+	}
+	return repo, nil
+}
+
 func addCmd() *cobra.Command {
-	var title, author, genre, description, notes, status string
+	var title, author, genre, description, notes, status, series, format, length string
 	var tags []string
-	var rating int
+	var rating, position float64
 
 	cmd := &cobra.Command{
 		Use:   "add",
@@ -102,14 +135,25 @@ func addCmd() *cobra.Command {
 			if title == "" || author == "" {
 				return fmt.Errorf("title and author are required")
 			}
+			if position < 0 {
+				return fmt.Errorf("series position can't be negative")
+			}
 
 			bookStatus := book.StatusWantToRead
 			if status != "" {
 				bookStatus = book.Status(status)
 				if !bookStatus.IsValid() {
-					return fmt.Errorf("invalid status: %s (use: want_to_read, reading, read)", status)
+					return fmt.Errorf("invalid status: %s (use: %s)", status, statusNames())
 				}
 			}
+			bookFormat, err := parseFormat(format)
+			if err != nil {
+				return err
+			}
+			minutes, err := book.ParseMinutes(length)
+			if err != nil {
+				return err
+			}
 
 			b := &book.Book{
 				Title:       title,
@@ -118,10 +162,19 @@ func addCmd() *cobra.Command {
 				Description: description,
 				Notes:       notes,
 				Tags:        tags,
-				Rating:      rating,
+				Rating:      book.RoundRating(rating),
 				Status:      bookStatus,
+				Format:      bookFormat,
 				DateAdded:   time.Now(),
 			}
+			if bookFormat == book.FormatAudiobook {
+				b.TotalMinutes = minutes
+			} else if minutes > 0 {
+				return fmt.Errorf("--length is for audiobooks (--format %s)", book.FormatAudiobook)
+			}
+			if series != "" {
+				b.Series, b.SeriesPosition = series, position
+			}
 
 			if bookStatus == book.StatusRead {
 				b.DateRead = time.Now()
@@ -143,8 +196,12 @@ func addCmd() *cobra.Command {
 	cmd.Flags().StringVarP(&description, "description", "d", "", "book description")
 	cmd.Flags().StringVarP(&notes, "notes", "n", "", "your personal notes")
 	cmd.Flags().StringSliceVar(&tags, "tags", nil, "comma-separated tags")
-	cmd.Flags().IntVarP(&rating, "rating", "r", 0, "your rating (1-5)")
-	cmd.Flags().StringVarP(&status, "status", "s", "want_to_read", "reading status (want_to_read, reading, read)")
+	cmd.Flags().Float64VarP(&rating, "rating", "r", 0, "your rating (1-5, in quarter stars)")
+	cmd.Flags().StringVarP(&status, "status", "s", "want_to_read", "reading status ("+statusNames()+")")
+	cmd.Flags().StringVar(&series, "series", "", "series the book belongs to")
+	cmd.Flags().Float64Var(&position, "series-position", 0, "place in the series, e.g. 3 or 1.5")
+	cmd.Flags().StringVarP(&format, "format", "f", "", "format ("+formatNames()+")")
+	cmd.Flags().StringVar(&length, "length", "", "audiobook length as hours:minutes, e.g. 12:34")
 
 	return cmd
 }
@@ -301,12 +358,39 @@ func showCmd() *cobra.Command {
 				return fmt.Errorf("invalid book ID: %s", args[0])
 			}
 
-			b, err := svc.Get(context.Background(), id)
+			ctx := context.Background()
+			b, err := svc.Get(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			credits, err := svc.Credits(ctx, id)
+			if err != nil {
+				return err
+			}
+			printBookFull(*b, credits)
+
+			editions, err := svc.Editions(ctx, id)
 			if err != nil {
 				return err
 			}
+			if len(editions) > 1 {
+				fmt.Println("Editions:")
+				for _, e := range editions {
+					printEdition(e, e.ID == b.EditionID)
+				}
+			}
 
-			printBookFull(*b)
+			reads, err := svc.ReadThroughs(ctx, id)
+			if err != nil {
+				return err
+			}
+			if len(reads) > 1 {
+				fmt.Println("Reads:")
+				for _, rt := range reads {
+					printReadThrough(rt)
+				}
+			}
 			return nil
 		},
 	}
@@ -314,13 +398,33 @@ func showCmd() *cobra.Command {
 
 func updateCmd() *cobra.Command {
 	var status string
-	var rating int
+	var rating float64
 	var notes string
+	var reason string
+	var page int
+	var series string
+	var position float64
+	var format, length, listened string
 
 	cmd := &cobra.Command{
 		Use:   "update [book-id]",
 		Short: "Update a book's status, rating, or notes",
-		Args:  cobra.ExactArgs(1),
+		Long: `Update a book's status, rating, or notes.
+
+Statuses: ` + statusNames() + `. A book marked did_not_finish
+records why and where it was abandoned with --reason and --page (the current
+page if not given).
+
+Formats: ` + formatNames() + `. Audiobook progress is kept as time
+listened: set the length with --length and how far you are with --listened,
+both as hours:minutes.`,
+		Example: `  pka update 12 -s read -r 4
+  pka update 12 -s did_not_finish --reason "too slow" --page 140
+  pka update 12 -s paused
+  pka update 12 --series "The Expanse" --series-position 3
+  pka update 12 --format audiobook --length 21:08
+  pka update 12 --listened 5:20`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			svc, _, cleanup, err := initServices()
 			if err != nil {
@@ -338,11 +442,13 @@ func updateCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			before := b.Status
+			was := *b
 
 			if status != "" {
 				s := book.Status(status)
 				if !s.IsValid() {
-					return fmt.Errorf("invalid status: %s", status)
+					return fmt.Errorf("invalid status: %s (use: %s)", status, statusNames())
 				}
 				b.Status = s
 				if s == book.StatusRead && b.DateRead.IsZero() {
@@ -350,26 +456,92 @@ func updateCmd() *cobra.Command {
 				}
 			}
 
+			if cmd.Flags().Changed("reason") || cmd.Flags().Changed("page") {
+				if b.Status != book.StatusDNF {
+					return fmt.Errorf("--reason and --page are for books that weren't finished (-s %s)", book.StatusDNF)
+				}
+				if cmd.Flags().Changed("reason") {
+					b.DNFReason = reason
+				}
+				if cmd.Flags().Changed("page") {
+					b.DNFPage = page
+				}
+			}
+
 			if cmd.Flags().Changed("rating") {
-				b.Rating = rating
+				b.Rating = book.RoundRating(rating)
 			}
 
 			if cmd.Flags().Changed("notes") {
 				b.Notes = notes
 			}
 
+			if cmd.Flags().Changed("series") {
+				b.Series = strings.TrimSpace(series)
+			}
+			if cmd.Flags().Changed("series-position") {
+				if position < 0 {
+					return fmt.Errorf("series position can't be negative")
+				}
+				b.SeriesPosition = position
+			}
+			if b.Series == "" {
+				b.SeriesPosition = 0
+			}
+
+			if cmd.Flags().Changed("format") {
+				if b.Format, err = parseFormat(format); err != nil {
+					return err
+				}
+			}
+			if cmd.Flags().Changed("length") || cmd.Flags().Changed("listened") {
+				if !b.IsAudiobook() {
+					return fmt.Errorf("--length and --listened are for audiobooks (--format %s)", book.FormatAudiobook)
+				}
+				if cmd.Flags().Changed("length") {
+					if b.TotalMinutes, err = book.ParseMinutes(length); err != nil {
+						return err
+					}
+				}
+				if cmd.Flags().Changed("listened") {
+					if b.ListenedMinutes, err = book.ParseMinutes(listened); err != nil {
+						return err
+					}
+				}
+			}
+
 			if err := svc.Update(ctx, b); err != nil {
 				return err
 			}
+			if sess, ok := book.ProgressSession(&was, b); ok {
+				sess.End = time.Now()
+				sess.Source = "cli"
+				if err := svc.RecordProgress(ctx, sess); err != nil {
+					return err
+				}
+			}
 
 			fmt.Printf("Updated: %s by %s\n", b.Title, b.Author)
+			if cmd.Flags().Changed("listened") {
+				printProgress(*b)
+			}
+			if b.Status == book.StatusRead && before != book.StatusRead {
+				return printNextInSeries(ctx, svc, b)
+			}
 			return nil
 		},
 	}
 
 	cmd.Flags().StringVarP(&status, "status", "s", "", "new status")
-	cmd.Flags().IntVarP(&rating, "rating", "r", 0, "new rating (1-5)")
+	cmd.Flags().Float64VarP(&rating, "rating", "r", 0, "new rating (1-5, in quarter stars)")
 	cmd.Flags().StringVarP(&notes, "notes", "n", "", "new notes")
+	cmd.Flags().StringVar(&reason, "reason", "", "why the book wasn't finished")
+	cmd.Flags().IntVar(&page, "page", 0, "page the book was abandoned at")
+	cmd.Flags().StringVar(&series, "series", "", "series the book belongs to (\"\" to take it out)")
+	cmd.Flags().Float64Var(&position, "series-position", 0, "place in the series, e.g. 3 or 1.5")
+	cmd.Flags().StringVarP(&format, "format", "f", "", "format ("+formatNames()+")")
+	cmd.Flags().StringVar(&length, "length", "", "audiobook length as hours:minutes")
+	cmd.Flags().StringVar(&listened, "listened", "", "time listened so far as hours:minutes")
 
 	return cmd
 }
@@ -407,8 +579,188 @@ func deleteCmd() *cobra.Command {
 	}
 }
 
+func dedupeCmd() *cobra.Command {
+	var threshold float32
+	var semantic bool
+
+	cmd := &cobra.Command{
+		Use:   "dedupe",
+		Short: "Report books that look like duplicates",
+		Long: `Find likely duplicate books by ISBN, normalized/fuzzy title and author,
+and (optionally) embedding similarity. Nothing is changed - use "pka merge"
+to combine a pair.
+
+Examples:
+  pka dedupe
+  pka dedupe --semantic --threshold 0.97`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, searchEngine, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			ctx := context.Background()
+
+			pairs, err := svc.FindDuplicates(ctx)
+			if err != nil {
+				return err
+			}
+
+			if semantic {
+				seen := make(map[[2]int64]bool)
+				for _, p := range pairs {
+					seen[[2]int64{p.A.ID, p.B.ID}] = true
+				}
+
+				similar, err := searchEngine.FindNearDuplicates(ctx, threshold)
+				if err != nil {
+					return err
+				}
+				for _, p := range similar {
+					if !seen[[2]int64{p.A.ID, p.B.ID}] && !seen[[2]int64{p.B.ID, p.A.ID}] {
+						pairs = append(pairs, p)
+					}
+				}
+			}
+
+			if len(pairs) == 0 {
+				fmt.Println("No duplicates found.")
+				return nil
+			}
+
+			for _, p := range pairs {
+				fmt.Printf("[%.2f %s]\n", p.Score, p.Reason)
+				fmt.Print("  ")
+				printBookShort(p.A)
+				fmt.Print("  ")
+				printBookShort(p.B)
+			}
+
+			fmt.Printf("\n%d candidate pair(s). Merge with: pka merge [keep-id] [drop-id]\n", len(pairs))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&semantic, "semantic", false, "also report books with near-identical embeddings")
+	cmd.Flags().Float32Var(&threshold, "threshold", 0.95, "minimum embedding similarity for --semantic")
+	return cmd
+}
+
+func mergeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "merge [keep-id] [drop-id]",
+		Short: "Merge a duplicate book into another",
+		Long: `Combine two books into one. The first book is kept; empty fields are filled
+from the second, tags, notes and adaptations are combined, and the second
+book is deleted.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			keepID, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[0])
+			}
+			dropID, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[1])
+			}
+
+			b, err := svc.Merge(context.Background(), keepID, dropID)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Merged book %d into: %s by %s (ID: %d)\n", dropID, b.Title, b.Author, b.ID)
+			return nil
+		},
+	}
+}
+
+func coversCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "covers",
+		Short: "Manage the local cover image cache",
+	}
+
+	cmd.AddCommand(coversSyncCmd())
+	return cmd
+}
+
+func coversSyncCmd() *cobra.Command {
+	var dir string
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Download covers for all books into the local cache",
+		Long: `Download each book's cover from its CoverURL into a local content-addressed
+store, so the web UI can serve covers offline from /covers/{id}.
+
+Examples:
+  pka covers sync
+  pka covers sync --force --dir /data/covers`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			if dir == "" {
+				dir = filepath.Join(filepath.Dir(dbPath), "covers")
+			}
+			store := covers.NewStore(dir)
+			ctx := context.Background()
+
+			books, err := svc.List(ctx)
+			if err != nil {
+				return err
+			}
+
+			var fetched, cached, missing, failed int
+			for _, b := range books {
+				if b.CoverURL == "" {
+					missing++
+					continue
+				}
+				if !force && b.CoverHash != "" && store.Has(b.CoverHash) {
+					cached++
+					continue
+				}
+
+				fmt.Printf("Fetching cover for %s...", b.Title)
+				hash, err := store.Fetch(ctx, b.CoverURL)
+				if err != nil {
+					fmt.Printf(" ERROR: %v\n", err)
+					failed++
+					continue
+				}
+				if err := svc.SetCoverHash(ctx, b.ID, hash); err != nil {
+					return err
+				}
+				fmt.Println(" OK")
+				fetched++
+			}
+
+			fmt.Printf("\nDone! Fetched: %d, Already cached: %d, No cover URL: %d, Failed: %d\n", fetched, cached, missing, failed)
+			fmt.Printf("Cover cache: %s\n", store.Dir())
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dir, "dir", "", "cover cache directory (default: next to the database)")
+	cmd.Flags().BoolVar(&force, "force", false, "re-download covers that are already cached")
+	return cmd
+}
+
 func printBookShort(b book.Book) {
-	stars := strings.Repeat("*", b.Rating)
+	stars := strings.Repeat("*", book.WholeStars(b.Rating))
 	fmt.Printf("[%d] %s by %s", b.ID, b.Title, b.Author)
 	if stars != "" {
 		fmt.Printf(" %s", stars)
@@ -416,10 +768,62 @@ func printBookShort(b book.Book) {
 	fmt.Printf(" (%s)\n", b.Status)
 }
 
-func printBookFull(b book.Book) {
+// statusNames lists the valid statuses for help and error messages
+func statusNames() string {
+	names := make([]string, len(book.Statuses))
+	for i, s := range book.Statuses {
+		names[i] = string(s)
+	}
+	return strings.Join(names, ", ")
+}
+
+func formatNames() string {
+	names := make([]string, len(book.Formats))
+	for i, f := range book.Formats {
+		names[i] = string(f)
+	}
+	return strings.Join(names, ", ")
+}
+
+// parseFormat reads a --format flag, also taking the usual names for a
+// format such as hardcover or kindle
+func parseFormat(s string) (book.Format, error) {
+	f, ok := book.ParseFormat(s)
+	if !ok {
+		return "", fmt.Errorf("invalid format: %s (use: %s)", s, formatNames())
+	}
+	return f, nil
+}
+
+func printDNF(b book.Book) {
+	switch {
+	case b.DNFPage > 0 && b.DNFReason != "":
+		fmt.Printf("Stopped:     page %d, %s\n", b.DNFPage, b.DNFReason)
+	case b.DNFPage > 0:
+		fmt.Printf("Stopped:     page %d\n", b.DNFPage)
+	case b.DNFReason != "":
+		fmt.Printf("Stopped:     %s\n", b.DNFReason)
+	}
+}
+
+func printBookFull(b book.Book, credits []book.Credit) {
 	fmt.Printf("ID:          %d\n", b.ID)
 	fmt.Printf("Title:       %s\n", b.Title)
 	fmt.Printf("Author:      %s\n", b.Author)
+	for _, c := range credits {
+		if c.Role != book.RoleAuthor {
+			fmt.Printf("%-13s%s\n", c.Role.Label()+":", c.Name)
+		}
+	}
+	if b.Series != "" {
+		fmt.Printf("Series:      %s\n", b.SeriesLabel())
+	}
+	if e := b.Edition(); e.Format != "" || e.Publisher != "" || e.PageCount > 0 || e.TotalMinutes > 0 {
+		fmt.Printf("Edition:     %s\n", e.Label())
+	}
+	if b.ISBN != "" {
+		fmt.Printf("ISBN:        %s\n", b.ISBN)
+	}
 	if b.Genre != "" {
 		fmt.Printf("Genre:       %s\n", b.Genre)
 	}
@@ -430,8 +834,14 @@ func printBookFull(b book.Book) {
 		fmt.Printf("Tags:        %s\n", strings.Join(b.Tags, ", "))
 	}
 	fmt.Printf("Status:      %s\n", b.Status)
+	if b.Status.InProgress() && b.HasLength() {
+		fmt.Printf("Progress:    %s (%d%%)\n", b.ProgressLabel(), b.Progress())
+	}
+	if b.Status == book.StatusDNF {
+		printDNF(b)
+	}
 	if b.Rating > 0 {
-		fmt.Printf("Rating:      %s (%d/5)\n", strings.Repeat("*", b.Rating), b.Rating)
+		fmt.Printf("Rating:      %s (%s/5)\n", strings.Repeat("*", book.WholeStars(b.Rating)), book.FormatRating(b.Rating))
 	}
 	if b.Notes != "" {
 		fmt.Printf("Notes:       %s\n", b.Notes)
@@ -440,10 +850,14 @@ func printBookFull(b book.Book) {
 	if !b.DateRead.IsZero() {
 		fmt.Printf("Read:        %s\n", b.DateRead.Format("2006-01-02"))
 	}
+	if b.FilePath != "" {
+		fmt.Printf("File:        %s\n", b.FilePath)
+	}
 }
 
 func importCmd() *cobra.Command {
 	var status string
+	var asEdition bool
 
 	cmd := &cobra.Command{
 		Use:   "import [isbn...]",
@@ -452,7 +866,19 @@ func importCmd() *cobra.Command {
 Examples:
   pka import 9780593135204
   pka import 978-0-593-13520-4
-  pka import 9780593135204 9780316769488 --status read`,
+  pka import 9780593135204 9780316769488 --status read
+  pka import 9780593135211 --edition     # another edition of a book you have
+
+To import a file, use a subcommand:
+  pka import csv books.csv
+  pka import json library.json
+  pka import goodreads goodreads_library_export.csv
+  pka import storygraph storygraph_export.csv
+  pka import librarything librarything_export.tsv
+  pka import calibre ~/Calibre\ Library
+  pka import epub ~/Books
+  pka import kindle "My Clippings.txt"
+  pka import koreader /media/KOBOeReader`,
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			svc, _, cleanup, err := initServices()
@@ -490,6 +916,15 @@ Examples:
 				fmt.Println("  Generating embedding...")
 
 				if err := svc.Add(ctx, b); err != nil {
+					if dupErr, ok := err.(*book.DuplicateError); ok && asEdition {
+						e := b.Edition()
+						if err := svc.AddEdition(ctx, dupErr.Existing.ID, &e); err != nil {
+							fmt.Printf("  Error saving: %v\n", err)
+							continue
+						}
+						fmt.Printf("  Added as edition %d of %s (ID %d)\n", e.ID, dupErr.Existing.Title, dupErr.Existing.ID)
+						continue
+					}
 					fmt.Printf("  Error saving: %v\n", err)
 					continue
 				}
@@ -502,59 +937,2742 @@ Examples:
 	}
 
 	cmd.Flags().StringVarP(&status, "status", "s", "want_to_read", "reading status for imported books")
+	cmd.Flags().BoolVar(&asEdition, "edition", false, "add books already in the library as another edition instead of skipping them")
+
+	cmd.AddCommand(
+		importCSVCmd(),
+		importJSONCmd(),
+		importGoodreadsCmd(),
+		importStoryGraphCmd(),
+		importLibraryThingCmd(),
+		importCalibreCmd(),
+		importEPUBCmd(),
+		importKindleCmd(),
+		importKOReaderCmd(),
+	)
 	return cmd
 }
 
-func discoverCmd() *cobra.Command {
-	var limit int
-	var autoAdd bool
+func importCSVCmd() *cobra.Command {
+	var mapping map[string]string
+
+	cmd := importFileCmd("csv", func(r io.Reader) ([]importer.Record, error) {
+		return importer.ParseCSV(r, mapping)
+	}, "Import a CSV file (PKA export or your own columns)", `Import books from a CSV file with a header row. Columns are matched by name,
+so files written by "pka export -f csv" or the web export import as-is.
+Use --map to point fields at differently named columns.
+
+Fields: title, author, isbn, genre, description, tags, rating, status, notes,
+cover_url, page_count, current_page, date_added, date_read
+
+Examples:
+  pka import csv books.csv
+  pka import csv spreadsheet.csv --map title="Book Name" --map author=Writer`)
+
+	cmd.Flags().StringToStringVar(&mapping, "map", nil, "field=column mappings for non-PKA headers")
+	return cmd
+}
+
+func importJSONCmd() *cobra.Command {
+	return importFileCmd("json", importer.ParseJSON, "Import a PKA JSON export", `Import books from a file written by "pka export" or the web JSON export.
+
+Example:
+  pka import json library.json`)
+}
+
+func importGoodreadsCmd() *cobra.Command {
+	return importFileCmd("goodreads", importer.ParseGoodreads, "Import a Goodreads library export (CSV)", `Import books from a Goodreads library export
+(My Books > Import and export > Export Library).
+
+Shelves map to status (read, currently-reading, to-read), "My Rating" to
+rating, "My Review" and private notes to notes, and other shelves to tags.
+
+Example:
+  pka import goodreads goodreads_library_export.csv`)
+}
+
+func importStoryGraphCmd() *cobra.Command {
+	return importFileCmd("storygraph", importer.ParseStoryGraph, "Import a StoryGraph library export (CSV)", `Import books from a StoryGraph export
+(Manage Account > Manage Your Data > Export StoryGraph Library).
+
+Read status maps to status, star ratings keep their quarter stars, moods
+and tags become tags, and reviews become notes.
+
+Example:
+  pka import storygraph storygraph_export.csv`)
+}
+
+func importLibraryThingCmd() *cobra.Command {
+	return importFileCmd("librarything", importer.ParseLibraryThing, "Import a LibraryThing export (TSV or JSON)", `Import books from a LibraryThing export
+(More > Import/Export > Export your library), as tab-delimited text or JSON.
+
+Collections such as "Currently reading" and "To read" map to status, other
+collections and tags become tags, and reviews and comments become notes.
+
+Example:
+  pka import librarything librarything_export.tsv`)
+}
+
+// importCalibreCmd imports a Calibre library from its metadata.db, linking
+// each book to its Calibre ID so later runs update it
+func importCalibreCmd() *cobra.Command {
+	var status, coversDir string
+	var opts importOptions
 
 	cmd := &cobra.Command{
-		Use:   "discover [query]",
-		Short: "Search OpenLibrary and add books to your collection",
-		Long: `Search OpenLibrary for books and interactively add them.
+		Use:   "calibre [library dir]",
+		Short: "Import or sync books from a Calibre library",
+		Long: `Import books from a Calibre library directory (the one containing
+metadata.db). Titles, authors, tags, series, ISBNs, comments, ratings and
+covers are read; Calibre can stay open.
+
+PKA remembers each book's Calibre ID, so running the import again updates
+the books it imported before with changes made in Calibre instead of adding
+them twice. Status, progress and notes kept in PKA are left alone.
+
 Examples:
-  pka discover "Andy Weir"
-  pka discover "dark fantasy"
-  pka discover "Project Hail Mary" --auto`,
-		Args: cobra.MinimumNArgs(1),
+  pka import calibre ~/Calibre\ Library --dry-run
+  pka import calibre ~/Calibre\ Library -y --status read`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			bookStatus := book.Status(status)
+			if !bookStatus.IsValid() {
+				return fmt.Errorf("invalid status: %s", status)
+			}
+
 			svc, _, cleanup, err := initServices()
 			if err != nil {
 				return err
 			}
 			defer cleanup()
 
-			query := strings.Join(args, " ")
-			client := scraper.NewOpenLibraryClient()
 			ctx := context.Background()
-
-			fmt.Printf("Searching OpenLibrary for: %s\n\n", query)
-
-			books, err := client.Search(ctx, query, limit)
+			records, err := importer.ParseCalibre(ctx, args[0])
 			if err != nil {
 				return err
 			}
-
-			if len(books) == 0 {
-				fmt.Println("No books found.")
-				return nil
+			for i := range records {
+				records[i].Book.Status = bookStatus
 			}
 
-			for i, b := range books {
-				fmt.Printf("[%d] %s by %s", i+1, b.Title, b.Author)
-				if b.ISBN != "" {
-					fmt.Printf(" (ISBN: %s)", b.ISBN)
-				}
-				fmt.Println()
+			if coversDir == "" {
+				coversDir = filepath.Join(filepath.Dir(dbPath), "covers")
+			}
+			store := covers.NewStore(coversDir)
+			opts.onCommit = func(rows []importer.PreviewRow) {
+				storeImportCovers(ctx, svc, store, rows)
 			}
 
-			if autoAdd {
-				// Add first result automatically
-				b := &books[0]
-				fmt.Printf("\nAuto-adding: %s by %s\n", b.Title, b.Author)
-				fmt.Println("Generating embedding...")
-				if err := svc.Add(ctx, b); err != nil {
+			return runImport(ctx, svc, records, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&status, "status", "s", string(book.StatusWantToRead), "reading status for newly imported books")
+	cmd.Flags().StringVar(&coversDir, "covers-dir", "", "cover cache directory (default: next to the database)")
+	opts.register(cmd)
+	return cmd
+}
+
+func importEPUBCmd() *cobra.Command {
+	var status, coversDir string
+	var opts importOptions
+
+	cmd := &cobra.Command{
+		Use:   "epub [file or dir...]",
+		Short: "Import EPUB files, reading their metadata",
+		Long: `Import EPUB files, or every EPUB under a directory. Title, authors,
+identifiers (ISBN), description, subjects and cover are read from each
+file's metadata, and the book is linked to the file.
+
+Importing the same files again updates the books imported from them. To
+pick up new files automatically, use pka watch.
+
+Examples:
+  pka import epub ~/Books --dry-run
+  pka import epub dune.epub --status reading`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bookStatus := book.Status(status)
+			if !bookStatus.IsValid() {
+				return fmt.Errorf("invalid status: %s", status)
+			}
+
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			var files []string
+			for _, arg := range args {
+				found, err := importer.FindEPUBs(arg)
+				if err != nil {
+					return err
+				}
+				files = append(files, found...)
+			}
+			if len(files) == 0 {
+				fmt.Println("No EPUB files found.")
+				return nil
+			}
+
+			records := importer.ParseEPUBs(files)
+			for i := range records {
+				records[i].Book.Status = bookStatus
+			}
+
+			if coversDir == "" {
+				coversDir = filepath.Join(filepath.Dir(dbPath), "covers")
+			}
+			store := covers.NewStore(coversDir)
+			ctx := context.Background()
+			opts.onCommit = func(rows []importer.PreviewRow) {
+				storeImportCovers(ctx, svc, store, rows)
+			}
+
+			return runImport(ctx, svc, records, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&status, "status", "s", string(book.StatusWantToRead), "reading status for newly imported books")
+	cmd.Flags().StringVar(&coversDir, "covers-dir", "", "cover cache directory (default: next to the database)")
+	opts.register(cmd)
+	return cmd
+}
+
+func importKindleCmd() *cobra.Command {
+	var status string
+	var yes, dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "kindle [My Clippings.txt]",
+		Short: "Import highlights and notes from Kindle clippings",
+		Long: `Import highlights and notes from a Kindle's "My Clippings.txt" (in the
+documents folder when the Kindle is connected over USB).
+
+Clippings are matched to books in the library by title and author, or else
+to the closest title once subtitles and series are dropped (shown as
+SIMILAR in the preview); books that aren't found are created. Highlights already saved on a book are
+skipped, so the same file can be imported again as it grows.
+
+Examples:
+  pka import kindle /media/Kindle/documents/My\ Clippings.txt --dry-run
+  pka import kindle clippings.txt -y --status read`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bookStatus := book.Status(status)
+			if !bookStatus.IsValid() {
+				return fmt.Errorf("invalid status: %s", status)
+			}
+
+			file, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("open file: %w", err)
+			}
+			highlights, err := importer.ParseKindleClippings(file)
+			file.Close()
+			if err != nil {
+				return err
+			}
+
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			ctx := context.Background()
+			return runHighlightImport(ctx, svc, highlights, bookStatus, yes, dryRun)
+		},
+	}
+
+	cmd.Flags().StringVarP(&status, "status", "s", string(book.StatusWantToRead), "reading status for books that have to be created")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "import without asking for confirmation")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show the preview without importing anything")
+	return cmd
+}
+
+func importKOReaderCmd() *cobra.Command {
+	var status string
+	var yes, dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "koreader [dir or metadata.lua...]",
+		Short: "Import highlights and notes from KOReader",
+		Long: `Import highlights and notes from KOReader's sidecar files: the
+metadata.<ext>.lua files in the <book>.sdr folder next to each document (or
+in KOReader's docsettings folder). Point it at the device's storage to
+import everything.
+
+Books are matched by their EPUB file (see pka import epub), then by title
+and author; books that aren't found are created. The document is linked to
+the book, so progress synced from KOReader updates it too. Highlights
+already saved are skipped.
+
+Examples:
+  pka import koreader /media/KOBOeReader --dry-run
+  pka import koreader Dune.sdr/metadata.epub.lua`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bookStatus := book.Status(status)
+			if !bookStatus.IsValid() {
+				return fmt.Errorf("invalid status: %s", status)
+			}
+
+			var files []string
+			for _, arg := range args {
+				info, err := os.Stat(arg)
+				if err != nil {
+					return err
+				}
+				if !info.IsDir() {
+					files = append(files, arg)
+					continue
+				}
+				found, err := koreader.FindSidecars(arg)
+				if err != nil {
+					return err
+				}
+				files = append(files, found...)
+			}
+
+			highlights, errs := importer.ParseKOReader(files)
+			for _, err := range errs {
+				fmt.Printf("  Skipped %v\n", err)
+			}
+
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			// Match documents to books by their local files first
+			ctx := context.Background()
+			matcher := kosync.NewMatcher(svc)
+			matches := make(map[string]*book.Book)
+			for i := range highlights {
+				doc := highlights[i].ExternalID
+				if doc == "" {
+					continue
+				}
+				b, ok := matches[doc]
+				if !ok {
+					b, _, err = matcher.Match(ctx, doc)
+					if err != nil {
+						return err
+					}
+					matches[doc] = b
+				}
+				highlights[i].Match = b
+			}
+
+			return runHighlightImport(ctx, svc, highlights, bookStatus, yes, dryRun)
+		},
+	}
+
+	cmd.Flags().StringVarP(&status, "status", "s", string(book.StatusWantToRead), "reading status for books that have to be created")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "import without asking for confirmation")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show the preview without importing anything")
+	return cmd
+}
+
+// runHighlightImport previews highlights by book, asks for confirmation and
+// saves them
+func runHighlightImport(ctx context.Context, svc *book.Service, highlights []importer.Highlight, status book.Status, yes, dryRun bool) error {
+	if len(highlights) == 0 {
+		fmt.Println("No highlights found.")
+		return nil
+	}
+
+	groups, err := importer.GroupHighlights(ctx, svc, highlights)
+	if err != nil {
+		return err
+	}
+
+	var quotes, newBooks int
+	for _, g := range groups {
+		quotes += len(g.Quotes)
+		if g.Match == nil {
+			newBooks++
+			fmt.Printf("  NEW        %s by %s: %d quote(s)\n", g.Title, g.Author, len(g.Quotes))
+		} else if g.Similar != nil {
+			fmt.Printf("  SIMILAR    %s by %s: %d quote(s) -> ID %d %s (%.0f%% match)\n", g.Title, g.Author, len(g.Quotes), g.Similar.ID, g.Similar.Title, g.Score*100)
+		} else {
+			fmt.Printf("  MATCH      %s by %s: %d quote(s) -> ID %d (%s)\n", g.Title, g.Author, len(g.Quotes), g.Match.ID, g.MatchReason)
+		}
+	}
+	fmt.Printf("\n%d quote(s) from %d book(s), %d not in the library\n", quotes, len(groups), newBooks)
+
+	if dryRun {
+		fmt.Println("Dry run, nothing imported.")
+		return nil
+	}
+
+	if !yes {
+		fmt.Print("Proceed? [y/N]: ")
+		input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer := strings.ToLower(strings.TrimSpace(input)); answer != "y" && answer != "yes" {
+			fmt.Println("Import cancelled.")
+			return nil
+		}
+	}
+
+	res, err := importer.CommitHighlights(ctx, svc, groups, status)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if g.Error != "" {
+			fmt.Printf("  FAILED     %s: %s\n", g.Title, g.Error)
+		}
+	}
+
+	fmt.Printf("\nDone! Quotes added: %d, already saved: %d, books created: %d, Failed: %d\n", res.QuotesAdded, res.QuotesKnown, res.BooksCreated, res.Failed)
+	return nil
+}
+
+func kosyncCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "kosync",
+		Short: "Manage KOReader progress sync",
+		Long: `pka-web serves the KOReader sync API at /kosync. In KOReader, open
+Progress sync, set the custom sync server to http://<host>:<port>/kosync and
+log in with a user created here.
+
+Synced documents are matched to books by their local file (see pka import
+epub); others can be linked by hand.`,
+	}
+
+	cmd.AddCommand(kosyncAddUserCmd(), kosyncDocumentsCmd(), kosyncLinkCmd())
+	return cmd
+}
+
+func kosyncAddUserCmd() *cobra.Command {
+	var password string
+
+	cmd := &cobra.Command{
+		Use:   "adduser [username]",
+		Short: "Create a sync user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if password == "" {
+				fmt.Print("Password: ")
+				input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				password = strings.TrimRight(input, "\r\n")
+			}
+			if password == "" {
+				return fmt.Errorf("password is required")
+			}
+
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			if err := kosync.CreateUser(context.Background(), repo, args[0], kosync.Key(password)); err != nil {
+				return err
+			}
+			fmt.Printf("Created sync user %s\n", args[0])
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&password, "password", "p", "", "password (prompted for if not given)")
+	return cmd
+}
+
+func kosyncDocumentsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "documents",
+		Short: "List synced documents and the books they update",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			svc := book.NewService(repo, embedding.NewOllamaClient(ollamaURL, ollamaModel))
+			handler := kosync.NewHandler(repo, svc)
+			ctx := context.Background()
+
+			list, err := repo.ListSyncProgress(ctx)
+			if err != nil {
+				return err
+			}
+			if len(list) == 0 {
+				fmt.Println("No documents synced yet.")
+				return nil
+			}
+
+			for _, p := range list {
+				target := "not matched (pka kosync link)"
+				b, err := handler.FindBook(ctx, p.Document)
+				if err != nil {
+					return err
+				}
+				if b != nil {
+					target = fmt.Sprintf("[%d] %s by %s", b.ID, b.Title, b.Author)
+				}
+				fmt.Printf("%s  %3.0f%%  %-12s %s  %s\n", p.Document, p.Percentage*100, p.Device,
+					time.Unix(p.Timestamp, 0).Format("2006-01-02 15:04"), target)
+			}
+			return nil
+		},
+	}
+}
+
+func kosyncLinkCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "link [document] [book-id]",
+		Short: "Link a synced document to a book",
+		Long: `Link a document (the digest listed by pka kosync documents) to a book, for
+documents whose file isn't in the library. Later syncs update the book.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bookID, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[1])
+			}
+
+			repo, err := openRepository()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			svc := book.NewService(repo, embedding.NewOllamaClient(ollamaURL, ollamaModel))
+			ctx := context.Background()
+			b, err := svc.Get(ctx, bookID)
+			if err != nil {
+				return fmt.Errorf("book not found: %d", bookID)
+			}
+			if err := kosync.Link(ctx, repo, svc, args[0], bookID); err != nil {
+				return err
+			}
+			fmt.Printf("Linked %s to %s by %s\n", args[0], b.Title, b.Author)
+			return nil
+		},
+	}
+}
+
+func quoteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "quote",
+		Short: "Save and search quotes from your books",
+		Long: `Quotes are passages saved from a book, with an optional note. Highlights
+imported from Kindle or KOReader are quotes too, and all of them can be
+searched by meaning:
+  pka quote search "quotes about grief"`,
+	}
+
+	cmd.AddCommand(quoteAddCmd(), quoteListCmd(), quoteSearchCmd(), quoteDeleteCmd())
+	return cmd
+}
+
+func quoteAddCmd() *cobra.Command {
+	var note, chapter string
+	var page int
+
+	cmd := &cobra.Command{
+		Use:   "add [book-id] [text]",
+		Short: "Save a quote from a book",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[0])
+			}
+
+			q := &book.Quote{
+				BookID:  id,
+				Text:    strings.TrimSpace(args[1]),
+				Note:    note,
+				Chapter: chapter,
+				Page:    page,
+			}
+			if err := svc.AddQuote(context.Background(), q); err != nil {
+				if q.ID == 0 {
+					return err
+				}
+				fmt.Printf("Warning: %v (run pka quote search later to embed it)\n", err)
+			}
+
+			fmt.Printf("Saved quote %d\n", q.ID)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&note, "note", "", "your note on the quote")
+	cmd.Flags().StringVar(&chapter, "chapter", "", "chapter the quote is from")
+	cmd.Flags().IntVar(&page, "page", 0, "page the quote is on")
+	return cmd
+}
+
+func quoteListCmd() *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "list [book-id]",
+		Short: "List a book's quotes, or the most recent quotes",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			ctx := context.Background()
+			var quotes []book.Quote
+			if len(args) == 1 {
+				id, err := strconv.ParseInt(args[0], 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid book ID: %s", args[0])
+				}
+				b, err := svc.Get(ctx, id)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%s by %s\n\n", b.Title, b.Author)
+				if quotes, err = svc.Quotes(ctx, id); err != nil {
+					return err
+				}
+			} else {
+				if quotes, err = svc.AllQuotes(ctx); err != nil {
+					return err
+				}
+				if limit > 0 && len(quotes) > limit {
+					quotes = quotes[:limit]
+				}
+			}
+
+			if len(quotes) == 0 {
+				fmt.Println("No quotes found.")
+				return nil
+			}
+
+			books := make(map[int64]*book.Book)
+			for _, q := range quotes {
+				printQuote(q)
+				if len(args) == 0 {
+					if _, ok := books[q.BookID]; !ok {
+						books[q.BookID], _ = svc.Get(ctx, q.BookID)
+					}
+					if b := books[q.BookID]; b != nil {
+						fmt.Printf("    -- %s by %s\n", b.Title, b.Author)
+					}
+				}
+				fmt.Println()
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "l", 20, "max quotes to show without a book ID (0 for all)")
+	return cmd
+}
+
+func quoteSearchCmd() *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "search [query]",
+		Short: "Semantic search your quotes",
+		Long: `Search quotes and highlights by meaning. Examples:
+  pka quote search "quotes about grief"
+  pka quote search "the sea at night"`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, searchEngine, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			ctx := context.Background()
+			// Imported highlights are embedded here if the embedding service
+			// was down when they were saved
+			if n, err := svc.EmbedMissingQuotes(ctx); err != nil {
+				return err
+			} else if n > 0 {
+				fmt.Printf("Embedded %d new quotes\n", n)
+			}
+
+			query := strings.Join(args, " ")
+			fmt.Printf("Searching quotes for: %s\n\n", query)
+
+			results, err := searchEngine.SearchQuotes(ctx, query, limit)
+			if err != nil {
+				return err
+			}
+
+			if len(results) == 0 {
+				fmt.Println("No matching quotes found.")
+				return nil
+			}
+
+			for _, r := range results {
+				fmt.Printf("[%.2f] ", r.Similarity)
+				printQuote(r.Quote)
+				fmt.Printf("    -- %s by %s [%d]\n\n", r.Book.Title, r.Book.Author, r.Book.ID)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "l", 5, "max results to show")
+	return cmd
+}
+
+func quoteDeleteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete [quote-id]",
+		Short: "Delete a quote",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid quote ID: %s", args[0])
+			}
+
+			ctx := context.Background()
+			if _, err := svc.GetQuote(ctx, id); err != nil {
+				return err
+			}
+			if err := svc.DeleteQuote(ctx, id); err != nil {
+				return err
+			}
+
+			fmt.Printf("Deleted quote %d\n", id)
+			return nil
+		},
+	}
+}
+
+func printQuote(q book.Quote) {
+	var where []string
+	if q.Chapter != "" {
+		where = append(where, q.Chapter)
+	}
+	if q.Page > 0 {
+		where = append(where, fmt.Sprintf("p. %d", q.Page))
+	}
+	if q.Location != "" {
+		where = append(where, "loc. "+q.Location)
+	}
+
+	fmt.Printf("[%d]", q.ID)
+	if len(where) > 0 {
+		fmt.Printf(" %s", strings.Join(where, ", "))
+	}
+	fmt.Println()
+	if q.Text != "" {
+		fmt.Printf("    \"%s\"\n", q.Text)
+	}
+	if q.Note != "" {
+		fmt.Printf("    Note: %s\n", q.Note)
+	}
+}
+
+func sessionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "session",
+		Short: "Track reading sessions",
+		Long: `Reading sessions record when you read and how far you got, so pace and
+finish dates can be worked out:
+  pka session start 12
+  pka session stop --page 84
+  pka session log 12 --to-page 120 --minutes 40 --date 2024-03-02
+  pka session stop --listened 6:30        # audiobooks, as hours:minutes
+  pka session list 12
+
+Progress synced from KOReader and current page changes in the web UI are
+recorded as sessions too.`,
+	}
+
+	cmd.AddCommand(sessionStartCmd(), sessionStopCmd(), sessionLogCmd(), sessionListCmd())
+	return cmd
+}
+
+func sessionStartCmd() *cobra.Command {
+	var page int
+	var listened string
+
+	cmd := &cobra.Command{
+		Use:   "start [book-id]",
+		Short: "Start reading a book",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[0])
+			}
+
+			ctx := context.Background()
+			b, err := svc.Get(ctx, id)
+			if err != nil {
+				return err
+			}
+			at := page
+			if cmd.Flags().Changed("listened") {
+				if !b.IsAudiobook() {
+					return fmt.Errorf("--listened is for audiobooks (--format %s)", book.FormatAudiobook)
+				}
+				if at, err = book.ParseMinutes(listened); err != nil {
+					return err
+				}
+			}
+
+			sess, err := svc.StartSession(ctx, id, at, "cli")
+			if err != nil {
+				return err
+			}
+
+			if b.IsAudiobook() {
+				fmt.Printf("Started listening to %s at %.0f%% (%s)\n", b.Title, sess.StartPercent, sess.Start.Format("15:04"))
+			} else {
+				fmt.Printf("Started reading %s at page %d (%s)\n", b.Title, sess.StartPage, sess.Start.Format("15:04"))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&page, "page", "p", 0, "page you're starting from (default: where you left off)")
+	cmd.Flags().StringVar(&listened, "listened", "", "time listened so far as hours:minutes, for audiobooks (default: where you left off)")
+	return cmd
+}
+
+func sessionStopCmd() *cobra.Command {
+	var page int
+	var percent float64
+	var listened, note string
+
+	cmd := &cobra.Command{
+		Use:   "stop",
+		Short: "Stop the running session",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			ctx := context.Background()
+			if cmd.Flags().Changed("listened") {
+				active, err := svc.ActiveSession(ctx)
+				if err != nil {
+					return err
+				}
+				if active == nil {
+					return fmt.Errorf("no session is running")
+				}
+				b, err := svc.Get(ctx, active.BookID)
+				if err != nil {
+					return err
+				}
+				if percent, err = listenedPercent(b, listened); err != nil {
+					return err
+				}
+			}
+
+			sess, b, err := svc.StopSession(ctx, page, percent, note)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Read %s for %s", b.Title, formatDuration(sess.Duration()))
+			if pages := sess.PagesRead(b.PageCount); pages > 0 {
+				fmt.Printf(", %d pages", pages)
+			}
+			fmt.Println()
+			printProgress(*b)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&page, "page", "p", 0, "page you stopped at")
+	cmd.Flags().Float64Var(&percent, "percent", 0, "how far through the book you are, for books without pages (0-100)")
+	cmd.Flags().StringVar(&listened, "listened", "", "time listened so far as hours:minutes, for audiobooks")
+	cmd.Flags().StringVarP(&note, "note", "n", "", "note on the session")
+	return cmd
+}
+
+// listenedPercent converts a --listened time to a percentage of an
+// audiobook's length
+func listenedPercent(b *book.Book, listened string) (float64, error) {
+	if !b.IsAudiobook() {
+		return 0, fmt.Errorf("--listened is for audiobooks (--format %s)", book.FormatAudiobook)
+	}
+	if b.TotalMinutes == 0 {
+		return 0, fmt.Errorf("%s has no length; set it with pka update %d --length hh:mm", b.Title, b.ID)
+	}
+	minutes, err := book.ParseMinutes(listened)
+	if err != nil {
+		return 0, err
+	}
+	return b.PercentAt(minutes), nil
+}
+
+func sessionLogCmd() *cobra.Command {
+	var fromPage, toPage, pages, minutes int
+	var percent float64
+	var listened, date, note string
+
+	cmd := &cobra.Command{
+		Use:   "log [book-id]",
+		Short: "Record a session after the fact",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[0])
+			}
+
+			ctx := context.Background()
+			b, err := svc.Get(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			end := time.Now()
+			if date != "" {
+				day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+				if err != nil {
+					return fmt.Errorf("invalid date %q, want YYYY-MM-DD", date)
+				}
+				if day.Format("2006-01-02") != end.Format("2006-01-02") {
+					end = day.Add(20 * time.Hour) // an evening's reading
+				}
+			}
+
+			sess := &book.Session{
+				BookID:     id,
+				Start:      end.Add(-time.Duration(minutes) * time.Minute),
+				End:        end,
+				StartPage:  fromPage,
+				EndPage:    toPage,
+				EndPercent: percent,
+				Note:       note,
+				Source:     "cli",
+			}
+			if pages > 0 {
+				if sess.StartPage == 0 {
+					sess.StartPage = b.CurrentPage
+				}
+				sess.EndPage = sess.StartPage + pages
+			}
+			if cmd.Flags().Changed("listened") {
+				if sess.EndPercent, err = listenedPercent(b, listened); err != nil {
+					return err
+				}
+			}
+			if sess.EndPage == 0 && sess.EndPercent == 0 {
+				return fmt.Errorf("give --to-page, --pages, --percent or --listened")
+			}
+
+			if b, err = svc.LogSession(ctx, sess); err != nil {
+				return err
+			}
+
+			fmt.Printf("Logged %s", formatDuration(sess.Duration()))
+			if pages := sess.PagesRead(b.PageCount); pages > 0 {
+				fmt.Printf(", %d pages", pages)
+			}
+			fmt.Printf(" of %s on %s\n", b.Title, sess.End.Format("2006-01-02"))
+			printProgress(*b)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&fromPage, "from-page", 0, "page you started from (default: where you left off)")
+	cmd.Flags().IntVar(&toPage, "to-page", 0, "page you stopped at")
+	cmd.Flags().IntVar(&pages, "pages", 0, "pages read, instead of --to-page")
+	cmd.Flags().Float64Var(&percent, "percent", 0, "how far through the book you got, for books without pages (0-100)")
+	cmd.Flags().StringVar(&listened, "listened", "", "time listened by the end as hours:minutes, for audiobooks")
+	cmd.Flags().IntVarP(&minutes, "minutes", "m", 0, "how long you read")
+	cmd.Flags().StringVarP(&date, "date", "d", "", "day you read, YYYY-MM-DD (default: today)")
+	cmd.Flags().StringVarP(&note, "note", "n", "", "note on the session")
+	return cmd
+}
+
+func sessionListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list [book-id]",
+		Short: "Show a book's sessions and reading pace, or the running session",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			ctx := context.Background()
+			if len(args) == 0 {
+				sess, err := svc.ActiveSession(ctx)
+				if err != nil {
+					return err
+				}
+				if sess == nil {
+					fmt.Println("No session is running.")
+					return nil
+				}
+				b, err := svc.Get(ctx, sess.BookID)
+				if err != nil {
+					return err
+				}
+				from := fmt.Sprintf("page %d", sess.StartPage)
+				if b.IsAudiobook() {
+					from = fmt.Sprintf("%.0f%%", sess.StartPercent)
+				}
+				fmt.Printf("Reading %s [%d] since %s (%s), from %s\n", b.Title, b.ID, sess.Start.Format("15:04"), formatDuration(sess.Duration()), from)
+				return nil
+			}
+
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[0])
+			}
+			b, err := svc.Get(ctx, id)
+			if err != nil {
+				return err
+			}
+			sessions, err := svc.Sessions(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s by %s\n\n", b.Title, b.Author)
+			if len(sessions) == 0 {
+				fmt.Println("No reading sessions yet.")
+				return nil
+			}
+
+			for _, sess := range sessions {
+				fmt.Printf("  %s  ", sess.Start.Format("2006-01-02 15:04"))
+				if sess.Active() {
+					fmt.Printf("%-8s", "now")
+				} else {
+					fmt.Printf("%-8s", formatDuration(sess.Duration()))
+				}
+				if sess.StartPage > 0 || sess.EndPage > 0 {
+					fmt.Printf("  p. %d -> %d", sess.StartPage, sess.EndPage)
+				} else {
+					fmt.Printf("  %.0f%% -> %.0f%%", sess.StartPercent, sess.EndPercent)
+				}
+				if sess.Source != "" {
+					fmt.Printf("  (%s)", sess.Source)
+				}
+				if sess.Note != "" {
+					fmt.Printf("  %s", sess.Note)
+				}
+				fmt.Println()
+			}
+
+			pace := book.PaceOf(b, sessions, time.Now())
+			fmt.Printf("\nSessions:    %d over %d day(s), %s read\n", pace.Sessions, pace.Days, formatDuration(pace.TimeRead))
+			if b.PageCount > 0 && !b.IsAudiobook() {
+				fmt.Printf("Pace:        %.1f pages/day\n", pace.PagesPerDay)
+			} else {
+				fmt.Printf("Pace:        %.1f%%/day\n", pace.PercentPerDay)
+			}
+			printProgress(*b)
+			if !pace.EstimatedFinish.IsZero() {
+				fmt.Printf("Est. finish: %s\n", pace.EstimatedFinish.Format("2006-01-02"))
+			}
+			return nil
+		},
+	}
+}
+
+func printProgress(b book.Book) {
+	if b.HasLength() {
+		fmt.Printf("Progress:    %s (%d%%), %s\n", b.ProgressLabel(), b.Progress(), b.Status)
+	} else {
+		fmt.Printf("Status:      %s\n", b.Status)
+	}
+}
+
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%dh %02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+func readCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "read",
+		Short: "Track each read of a book, including re-reads",
+		Long: `Every read of a book is kept as a read-through with its own dates, rating,
+format and notes, so re-reading a book doesn't overwrite the first read. A
+book's status, date read and rating follow its latest read-through.
+  pka read start 12 --format ebook     # start a (re-)read
+  pka read finish 12 --rating 5
+  pka read log 12 --finished 2019-06-01 --rating 4
+  pka read log 12 --dnf --finished 2021-03-10 --page 80 --reason "too slow"
+  pka read list 12`,
+	}
+
+	cmd.AddCommand(readStartCmd(), readFinishCmd(), readLogCmd(), readListCmd(), readDeleteCmd())
+	return cmd
+}
+
+func readStartCmd() *cobra.Command {
+	var date, format string
+
+	cmd := &cobra.Command{
+		Use:   "start [book-id]",
+		Short: "Start reading a book, or re-reading a finished one",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[0])
+			}
+			started, err := parseDay(date)
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			b, err := svc.Get(ctx, id)
+			if err != nil {
+				return err
+			}
+			if _, err := svc.StartReadThrough(ctx, id, started, format); err != nil {
+				return err
+			}
+
+			fmt.Printf("Started reading %s on %s\n", b.Title, started.Format("2006-01-02"))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&date, "date", "d", "", "day you started, YYYY-MM-DD (default: today)")
+	cmd.Flags().StringVarP(&format, "format", "f", "", "format, e.g. paperback, ebook, audiobook")
+	return cmd
+}
+
+func readFinishCmd() *cobra.Command {
+	var date, notes string
+	var rating float64
+
+	cmd := &cobra.Command{
+		Use:   "finish [book-id]",
+		Short: "Finish the current read of a book",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[0])
+			}
+			if rating < 0 || rating > 5 {
+				return fmt.Errorf("rating must be 1-5")
+			}
+			finished, err := parseDay(date)
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			b, err := svc.Get(ctx, id)
+			if err != nil {
+				return err
+			}
+			if _, err := svc.FinishReadThrough(ctx, id, finished, book.RoundRating(rating), notes); err != nil {
+				return err
+			}
+
+			fmt.Printf("Finished %s on %s\n", b.Title, finished.Format("2006-01-02"))
+			return printNextInSeries(ctx, svc, b)
+		},
+	}
+
+	cmd.Flags().StringVarP(&date, "date", "d", "", "day you finished, YYYY-MM-DD (default: today)")
+	cmd.Flags().Float64VarP(&rating, "rating", "r", 0, "rating for this read (1-5, in quarter stars)")
+	cmd.Flags().StringVarP(&notes, "notes", "n", "", "notes on this read")
+	return cmd
+}
+
+func readLogCmd() *cobra.Command {
+	var started, finished, format, notes, reason string
+	var rating float64
+	var page int
+	var dnf bool
+
+	cmd := &cobra.Command{
+		Use:   "log [book-id]",
+		Short: "Record a past read of a book",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[0])
+			}
+			if rating < 0 || rating > 5 {
+				return fmt.Errorf("rating must be 1-5")
+			}
+
+			rt := &book.ReadThrough{BookID: id, Rating: book.RoundRating(rating), Format: format, Notes: notes}
+			if dnf {
+				rt.Status, rt.DNFReason, rt.DNFPage = book.StatusDNF, reason, page
+			} else if reason != "" || page != 0 {
+				return fmt.Errorf("--reason and --page need --dnf")
+			}
+			if started != "" {
+				if rt.Started, err = parseDay(started); err != nil {
+					return err
+				}
+			}
+			if finished != "" {
+				if rt.Finished, err = parseDay(finished); err != nil {
+					return err
+				}
+			}
+
+			if err := svc.AddReadThrough(context.Background(), rt); err != nil {
+				return err
+			}
+			fmt.Printf("Logged read %d\n", rt.ID)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&started, "started", "", "day you started, YYYY-MM-DD")
+	cmd.Flags().StringVar(&finished, "finished", "", "day you finished, YYYY-MM-DD")
+	cmd.Flags().Float64VarP(&rating, "rating", "r", 0, "rating for this read (1-5, in quarter stars)")
+	cmd.Flags().StringVarP(&format, "format", "f", "", "format, e.g. paperback, ebook, audiobook")
+	cmd.Flags().StringVarP(&notes, "notes", "n", "", "notes on this read")
+	cmd.Flags().BoolVar(&dnf, "dnf", false, "the book wasn't finished; --finished is when you stopped")
+	cmd.Flags().StringVar(&reason, "reason", "", "why it wasn't finished")
+	cmd.Flags().IntVar(&page, "page", 0, "page it was abandoned at")
+	return cmd
+}
+
+func readListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list [book-id]",
+		Short: "List the reads of a book",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[0])
+			}
+
+			ctx := context.Background()
+			b, err := svc.Get(ctx, id)
+			if err != nil {
+				return err
+			}
+			reads, err := svc.ReadThroughs(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s by %s\n\n", b.Title, b.Author)
+			if len(reads) == 0 {
+				fmt.Println("Not read yet.")
+				return nil
+			}
+			for _, rt := range reads {
+				printReadThrough(rt)
+			}
+			return nil
+		},
+	}
+}
+
+func readDeleteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete [read-id]",
+		Short: "Delete a read of a book",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid read ID: %s", args[0])
+			}
+
+			rt, err := svc.DeleteReadThrough(context.Background(), id)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Deleted read %d of book %d\n", rt.ID, rt.BookID)
+			return nil
+		},
+	}
+}
+
+func printReadThrough(rt book.ReadThrough) {
+	day := func(t time.Time) string {
+		if t.IsZero() {
+			return "?"
+		}
+		return t.Format("2006-01-02")
+	}
+
+	fmt.Printf("  [%d] %s -> ", rt.ID, day(rt.Started))
+	if rt.Active() {
+		fmt.Print(rt.Status)
+	} else {
+		fmt.Print(day(rt.Finished))
+	}
+	if rt.Status == book.StatusDNF {
+		fmt.Print("  did not finish")
+		if rt.DNFPage > 0 {
+			fmt.Printf(" at page %d", rt.DNFPage)
+		}
+		if rt.DNFReason != "" {
+			fmt.Printf(": %s", rt.DNFReason)
+		}
+	}
+	if rt.Rating > 0 {
+		fmt.Printf("  %s", strings.Repeat("*", book.WholeStars(rt.Rating)))
+	}
+	if rt.Format != "" {
+		fmt.Printf("  (%s)", rt.Format)
+	}
+	if rt.Notes != "" {
+		fmt.Printf("  %s", rt.Notes)
+	}
+	fmt.Println()
+}
+
+// parseDay parses a YYYY-MM-DD flag in local time, defaulting to now
+func parseDay(s string) (time.Time, error) {
+	if s == "" {
+		return time.Now(), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, want YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+func goalCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "goal",
+		Short: "Set reading goals and see how they're going",
+		Long: `Goals are targets for a year or a month: books read, pages read, different
+genres read, or authors read for the first time. Progress counts finished
+reads, so a re-read counts again, and is compared with an even pace through
+the period.
+  pka goal set books 52                # this year
+  pka goal set pages 1500 --month 3    # March this year
+  pka goal set new_authors 10 --year 2025
+  pka goal status`,
+	}
+
+	cmd.AddCommand(goalSetCmd(), goalStatusCmd())
+	return cmd
+}
+
+func goalSetCmd() *cobra.Command {
+	var year, month int
+
+	cmd := &cobra.Command{
+		Use:   "set [books|pages|genres|new_authors] [target]",
+		Short: "Set a goal for a year or month (a target of 0 removes it)",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			target, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid target: %s", args[1])
+			}
+			if year == 0 {
+				year = time.Now().Year()
+			}
+
+			g := &book.Goal{Kind: book.GoalKind(args[0]), Year: year, Month: month, Target: target}
+			if err := svc.SetGoal(context.Background(), g); err != nil {
+				return err
+			}
+			if target == 0 {
+				fmt.Printf("Removed the %s goal for %s\n", g.Kind.Label(), g.Period())
+			} else {
+				fmt.Printf("Goal for %s: %d %s\n", g.Period(), g.Target, g.Kind.Label())
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&year, "year", "y", 0, "year (default: this year)")
+	cmd.Flags().IntVarP(&month, "month", "m", 0, "month 1-12 for a monthly goal")
+	return cmd
+}
+
+func goalStatusCmd() *cobra.Command {
+	var year int
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show progress towards a year's goals",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			if year == 0 {
+				year = time.Now().Year()
+			}
+			progress, err := svc.GoalProgress(context.Background(), year, time.Now())
+			if err != nil {
+				return err
+			}
+			if len(progress) == 0 {
+				fmt.Printf("No goals for %d. Set one with: pka goal set books 24\n", year)
+				return nil
+			}
+
+			period := ""
+			for _, p := range progress {
+				if p.Period() != period {
+					if period != "" {
+						fmt.Println()
+					}
+					period = p.Period()
+					fmt.Printf("%s:\n", period)
+				}
+				printGoal(p)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&year, "year", "y", 0, "year (default: this year)")
+	return cmd
+}
+
+func printGoal(p book.GoalProgress) {
+	fmt.Printf("  %-12s %d of %d (%d%%)", p.Kind.Label(), p.Done, p.Target, p.Percent())
+	switch {
+	case p.Met():
+		fmt.Print("  done!")
+	case p.Elapsed == 0:
+		fmt.Print("  not started yet")
+	case p.Elapsed == 1:
+		fmt.Printf("  missed by %d", p.Left())
+	case p.Ahead() > 0:
+		fmt.Printf("  %d ahead of pace, on track for %d", p.Ahead(), p.Projected)
+	case p.Ahead() < 0:
+		fmt.Printf("  %d behind pace, on track for %d", p.Behind(), p.Projected)
+	default:
+		fmt.Printf("  on pace, on track for %d", p.Projected)
+	}
+	fmt.Println()
+}
+
+func wrappedCmd() *cobra.Command {
+	var year int
+	var format, output string
+
+	cmd := &cobra.Command{
+		Use:   "wrapped",
+		Short: "Review a year of reading",
+		Long: `Review a year of reading: books and pages read, longest and shortest,
+ratings, top genres and authors, month by month, the first and last book of
+the year and the two books most alike. Written as Markdown, or as a
+standalone HTML page with --format html.`,
+		Example: `  pka wrapped
+  pka wrapped --year 2025 -o 2025.md
+  pka wrapped --format html -o wrapped.html`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			if year == 0 {
+				year = time.Now().Year()
+			}
+			if format == "" {
+				format = "md"
+				if ext := strings.ToLower(filepath.Ext(output)); ext == ".html" || ext == ".htm" {
+					format = "html"
+				}
+			}
+			write := report.WriteMarkdown
+			switch format {
+			case "md", "markdown":
+			case "html":
+				write = report.WriteHTML
+			default:
+				return fmt.Errorf("unknown format: %s (use md or html)", format)
+			}
+
+			ctx := context.Background()
+			books, err := svc.List(ctx)
+			if err != nil {
+				return err
+			}
+			reads, err := svc.AllReadThroughs(ctx)
+			if err != nil {
+				return err
+			}
+			w := report.Build(year, books, reads)
+
+			out := os.Stdout
+			if output != "" {
+				out, err = os.Create(output)
+				if err != nil {
+					return fmt.Errorf("create output file: %w", err)
+				}
+				defer out.Close()
+			}
+			if err := write(out, w); err != nil {
+				return fmt.Errorf("write report: %w", err)
+			}
+			if output != "" {
+				fmt.Printf("Wrote your %d in books to %s\n", year, output)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&year, "year", "y", 0, "year (default: this year)")
+	cmd.Flags().StringVarP(&format, "format", "f", "", "md or html (default: from the output file name, else md)")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "output file (default: stdout)")
+	return cmd
+}
+
+func seriesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "series",
+		Short: "Browse series and find the next book to read",
+		Long: `Books can belong to a series, with a place in it (3, or 1.5 for a novella
+between the first two). Imports from Calibre and Goodreads and lookups on
+OpenLibrary and Google Books fill the series in where they know it.
+  pka series list                      # every series, with how far along you are
+  pka series show "The Expanse"        # its books in order
+  pka series next                      # the next unread book of each series started
+  pka series set 12 "The Expanse" 3
+  pka series remove 12`,
+	}
+
+	cmd.AddCommand(seriesListCmd(), seriesShowCmd(), seriesNextCmd(), seriesSetCmd(), seriesRemoveCmd())
+	return cmd
+}
+
+func seriesListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List every series in the library",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			all, err := svc.AllSeries(context.Background())
+			if err != nil {
+				return err
+			}
+			if len(all) == 0 {
+				fmt.Println("No series yet. Put a book in one with: pka series set [book-id] [name] [position]")
+				return nil
+			}
+
+			for _, sr := range all {
+				fmt.Printf("%s: %d of %d read", sr.Name, sr.Read(), len(sr.Books))
+				if next := sr.Next(); next != nil && sr.Read() > 0 {
+					fmt.Printf(", next: %s", seriesEntry(*next))
+				}
+				fmt.Println()
+			}
+			return nil
+		},
+	}
+}
+
+func seriesShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show [name]",
+		Short: "Show a series' books in order",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			sr, err := svc.Series(context.Background(), args[0])
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s (%d of %d read)\n", sr.Name, sr.Read(), len(sr.Books))
+			for _, b := range sr.Books {
+				fmt.Printf("  [%d] %s (%s)\n", b.ID, seriesEntry(b), b.Status.Label())
+			}
+			return nil
+		},
+	}
+}
+
+func seriesNextCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "next",
+		Short: "Show the next unread book of each series you've started",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			all, err := svc.AllSeries(context.Background())
+			if err != nil {
+				return err
+			}
+
+			found := false
+			for _, sr := range all {
+				next := sr.Next()
+				if next == nil || sr.Read() == 0 {
+					continue
+				}
+				found = true
+				fmt.Printf("%s: [%d] %s by %s\n", sr.Name, next.ID, seriesEntry(*next), next.Author)
+			}
+			if !found {
+				fmt.Println("No series in progress.")
+			}
+			return nil
+		},
+	}
+}
+
+func seriesSetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "set [book-id] [name] [position]",
+		Short: "Put a book in a series",
+		Args:  cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[0])
+			}
+			var position float64
+			if len(args) == 3 {
+				if position, err = strconv.ParseFloat(args[2], 64); err != nil {
+					return fmt.Errorf("invalid series position: %s", args[2])
+				}
+			}
+			if strings.TrimSpace(args[1]) == "" {
+				return fmt.Errorf("series name is empty (to take a book out, use: pka series remove %d)", id)
+			}
+
+			b, err := svc.SetSeries(context.Background(), id, args[1], position)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s is now %s\n", b.Title, b.SeriesLabel())
+			return nil
+		},
+	}
+}
+
+func seriesRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove [book-id]",
+		Short: "Take a book out of its series",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[0])
+			}
+			b, err := svc.SetSeries(context.Background(), id, "", 0)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s is no longer in a series\n", b.Title)
+			return nil
+		},
+	}
+}
+
+// seriesEntry is a book as listed in its series, e.g. "#3 Abaddon's Gate"
+func seriesEntry(b book.Book) string {
+	if b.SeriesPosition > 0 {
+		return "#" + book.FormatPosition(b.SeriesPosition) + " " + b.Title
+	}
+	return b.Title
+}
+
+// printNextInSeries suggests what to read after finishing b, if it's in a
+// series with more to read
+func printNextInSeries(ctx context.Context, svc *book.Service, b *book.Book) error {
+	next, err := svc.NextInSeries(ctx, b)
+	if err != nil || next == nil {
+		return err
+	}
+	fmt.Printf("Next in %s: [%d] %s\n", b.Series, next.ID, seriesEntry(*next))
+	return nil
+}
+
+func authorCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "author",
+		Short: "Browse authors, credit translators and narrators, and merge spellings",
+		Long: `Every name in a book's author field is linked to an author, so books by
+"J.R.R. Tolkien" and "Tolkien, J. R. R." count towards the same person and
+co-written books count for each writer. Translators, illustrators and
+narrators can be credited too.
+  pka author list
+  pka author show "Ursula K. Le Guin"           # or by ID
+  pka author credit 12 "Edith Grossman" --role translator
+  pka author uncredit 12 "Edith Grossman" --role translator
+  pka author alias 3 "Ursula Le Guin"           # another spelling; merges an author already by that name
+  pka author merge 3 17                         # fold author 17 into 3
+  pka author link 3                             # find the author on Open Library
+  pka author works 3                            # their books on Open Library`,
+	}
+
+	cmd.AddCommand(authorListCmd(), authorShowCmd(), authorCreditCmd(), authorUncreditCmd(),
+		authorAliasCmd(), authorMergeCmd(), authorLinkCmd(), authorWorksCmd())
+	return cmd
+}
+
+// findAuthor looks an author up by ID or by any spelling of their name
+func findAuthor(ctx context.Context, svc *book.Service, arg string) (*book.Author, error) {
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		a, err := svc.Author(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return &a.Author, nil
+	}
+	return svc.FindAuthor(ctx, arg)
+}
+
+func parseRole(s string) (book.Role, error) {
+	role := book.Role(s)
+	if !role.IsValid() {
+		names := make([]string, len(book.Roles))
+		for i, r := range book.Roles {
+			names[i] = string(r)
+		}
+		return "", fmt.Errorf("invalid role %q (use %s)", s, strings.Join(names, ", "))
+	}
+	return role, nil
+}
+
+func authorListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List every author in the library",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			authors, err := svc.Authors(context.Background())
+			if err != nil {
+				return err
+			}
+			if len(authors) == 0 {
+				fmt.Println("No authors yet.")
+				return nil
+			}
+
+			for _, a := range authors {
+				fmt.Printf("[%d] %s: %d of %d read", a.ID, a.Name, a.Read(), len(a.Books))
+				if len(a.Aliases) > 0 {
+					fmt.Printf(" (also %s)", strings.Join(a.Aliases, "; "))
+				}
+				fmt.Println()
+			}
+			return nil
+		},
+	}
+}
+
+func authorShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show [author]",
+		Short: "Show an author and their books",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			ctx := context.Background()
+			found, err := findAuthor(ctx, svc, args[0])
+			if err != nil {
+				return err
+			}
+			a, err := svc.Author(ctx, found.ID)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("[%d] %s\n", a.ID, a.Name)
+			if len(a.Aliases) > 0 {
+				fmt.Printf("Also:         %s\n", strings.Join(a.Aliases, "; "))
+			}
+			if a.OLKey != "" {
+				fmt.Printf("Open Library: %s\n", a.OpenLibraryURL())
+			}
+			fmt.Printf("%d of %d read\n", a.Read(), len(a.Books))
+			for _, b := range a.Books {
+				title := b.Title
+				if b.Series != "" {
+					title += " (" + b.SeriesLabel() + ")"
+				}
+				fmt.Printf("  [%d] %s (%s)", b.ID, title, b.Status.Label())
+				if b.Role != book.RoleAuthor {
+					fmt.Printf(" as %s", strings.ToLower(b.Role.Label()))
+				}
+				fmt.Println()
+			}
+			return nil
+		},
+	}
+}
+
+func authorCreditCmd() *cobra.Command {
+	var role string
+
+	cmd := &cobra.Command{
+		Use:   "credit [book-id] [name]",
+		Short: "Credit a person on a book, e.g. its translator",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[0])
+			}
+			r, err := parseRole(role)
+			if err != nil {
+				return err
+			}
+
+			a, err := svc.AddCredit(context.Background(), id, args[1], r)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Credited %s [%d] as %s\n", a.Name, a.ID, r)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&role, "role", string(book.RoleAuthor), "author, translator, illustrator or narrator")
+	return cmd
+}
+
+func authorUncreditCmd() *cobra.Command {
+	var role string
+
+	cmd := &cobra.Command{
+		Use:   "uncredit [book-id] [author]",
+		Short: "Take a person's credit off a book",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[0])
+			}
+			r, err := parseRole(role)
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			a, err := findAuthor(ctx, svc, args[1])
+			if err != nil {
+				return err
+			}
+			if err := svc.RemoveCredit(ctx, id, a.ID, r); err != nil {
+				return err
+			}
+			fmt.Printf("%s is no longer credited as %s\n", a.Name, r)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&role, "role", string(book.RoleAuthor), "author, translator, illustrator or narrator")
+	return cmd
+}
+
+func authorAliasCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "alias [author] [other-spelling]",
+		Short: "Record another spelling of an author's name",
+		Long: `Books naming the other spelling are linked to the author from now on. If
+another author already goes by that spelling, they're merged in.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			ctx := context.Background()
+			a, err := findAuthor(ctx, svc, args[0])
+			if err != nil {
+				return err
+			}
+			a, err = svc.AddAlias(ctx, a.ID, args[1])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s is also %s\n", a.Name, strings.Join(a.Aliases, "; "))
+			return nil
+		},
+	}
+}
+
+func authorMergeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "merge [keep] [drop]",
+		Short: "Merge two authors who are the same person",
+		Long: `The second author's books are credited to the first, and their name becomes
+one of the first's aliases.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			ctx := context.Background()
+			keep, err := findAuthor(ctx, svc, args[0])
+			if err != nil {
+				return err
+			}
+			drop, err := findAuthor(ctx, svc, args[1])
+			if err != nil {
+				return err
+			}
+			merged, err := svc.MergeAuthors(ctx, keep.ID, drop.ID)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Merged %s into %s [%d]\n", drop.Name, merged.Name, merged.ID)
+			return nil
+		},
+	}
+}
+
+func authorLinkCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "link [author] [ol-key]",
+		Short: "Link an author to Open Library",
+		Long: `Links the author to their Open Library author key, e.g. OL23919A. Without a
+key, Open Library is searched for the author's name.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			ctx := context.Background()
+			a, err := findAuthor(ctx, svc, args[0])
+			if err != nil {
+				return err
+			}
+
+			key := ""
+			if len(args) == 2 {
+				key = args[1]
+			} else {
+				k, name, err := scraper.NewOpenLibraryClient().SearchAuthor(ctx, a.Name)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Found %s\n", name)
+				key = k
+			}
+
+			a, err = svc.SetAuthorKey(ctx, a.ID, key)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s: %s\n", a.Name, a.OpenLibraryURL())
+			return nil
+		},
+	}
+}
+
+func authorWorksCmd() *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "works [author]",
+		Short: "List an author's books on Open Library, marking those in the library",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			ctx := context.Background()
+			found, err := findAuthor(ctx, svc, args[0])
+			if err != nil {
+				return err
+			}
+			a, err := svc.Author(ctx, found.ID)
+			if err != nil {
+				return err
+			}
+
+			client := scraper.NewOpenLibraryClient()
+			var works []book.Book
+			if a.OLKey != "" {
+				works, err = client.FetchAuthorWorks(ctx, a.OLKey, a.Name, limit)
+			} else {
+				works, err = client.FetchAuthorBooks(ctx, a.Name, limit)
+			}
+			if err != nil {
+				return err
+			}
+
+			owned := 0
+			for _, w := range works {
+				if b := a.Find(w.Title); b != nil {
+					fmt.Printf("  [%d] %s (%s)\n", b.ID, w.Title, b.Status.Label())
+					owned++
+				} else {
+					fmt.Printf("  %s\n", w.Title)
+				}
+			}
+			fmt.Printf("\n%d books on Open Library, %d in the library\n", len(works), owned)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "l", 50, "max books to fetch")
+	return cmd
+}
+
+func editionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "edition",
+		Short: "Keep several editions of a book, e.g. the hardcover and the audiobook",
+		Long: `A book is the work: its status, rating, notes and reading history. Each
+edition has its own ISBN, format, publisher, page count and cover, and the
+book is read in one of them at a time.
+  pka edition list 12
+  pka edition add 12 --isbn 9780441013593           # details from Open Library
+  pka edition add 12 --format audiobook --publisher Macmillan
+  pka edition use 12 31                             # now reading edition 31
+  pka edition remove 12 31`,
+	}
+
+	cmd.AddCommand(editionListCmd(), editionAddCmd(), editionUseCmd(), editionRemoveCmd())
+	return cmd
+}
+
+func printEdition(e book.Edition, current bool) {
+	mark := " "
+	if current {
+		mark = "*"
+	}
+	fmt.Printf("%s [%d] %s", mark, e.ID, e.Label())
+	if e.ISBN != "" && !strings.HasPrefix(e.Label(), "ISBN") {
+		fmt.Printf(" (ISBN %s)", e.ISBN)
+	}
+	fmt.Println()
+}
+
+func editionListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list [book-id]",
+		Short: "List a book's editions, marking the one being read",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[0])
+			}
+
+			ctx := context.Background()
+			b, err := svc.Get(ctx, id)
+			if err != nil {
+				return err
+			}
+			editions, err := svc.Editions(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s by %s\n", b.Title, b.Author)
+			for _, e := range editions {
+				printEdition(e, e.ID == b.EditionID)
+			}
+			return nil
+		},
+	}
+}
+
+func editionAddCmd() *cobra.Command {
+	var e book.Edition
+	var format, length string
+	var use bool
+
+	cmd := &cobra.Command{
+		Use:   "add [book-id]",
+		Short: "Add another edition of a book",
+		Long: `Adds an edition of a book already in the library. Given only an ISBN, the
+edition's details are fetched from Open Library.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[0])
+			}
+
+			if e.Format, err = parseFormat(format); err != nil {
+				return err
+			}
+			if e.TotalMinutes, err = book.ParseMinutes(length); err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			if e.ISBN != "" && e.Format == "" && e.Publisher == "" && e.PageCount == 0 && e.TotalMinutes == 0 && e.CoverURL == "" {
+				fmt.Printf("Fetching ISBN %s...\n", e.ISBN)
+				found, err := scraper.NewOpenLibraryClient().FetchByISBN(ctx, e.ISBN)
+				if err != nil {
+					fmt.Printf("  %v; adding the ISBN alone\n", err)
+				} else {
+					e = found.Edition()
+					e.DateAdded = time.Time{}
+				}
+			}
+
+			if err := svc.AddEdition(ctx, id, &e); err != nil {
+				return err
+			}
+			fmt.Printf("Added edition [%d] %s\n", e.ID, e.Label())
+
+			if use {
+				if _, err := svc.UseEdition(ctx, id, e.ID); err != nil {
+					return err
+				}
+				fmt.Println("Now reading this edition")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&e.ISBN, "isbn", "", "the edition's ISBN")
+	cmd.Flags().StringVarP(&format, "format", "f", "", "format ("+formatNames()+")")
+	cmd.Flags().StringVar(&e.Publisher, "publisher", "", "publisher")
+	cmd.Flags().IntVarP(&e.PageCount, "pages", "p", 0, "page count")
+	cmd.Flags().StringVar(&length, "length", "", "audiobook length as hours:minutes")
+	cmd.Flags().StringVar(&e.CoverURL, "cover", "", "cover image URL")
+	cmd.Flags().BoolVar(&use, "use", false, "read the book in this edition from now on")
+	return cmd
+}
+
+func editionUseCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "use [book-id] [edition-id]",
+		Short: "Switch the edition a book is read in",
+		Long: `Switches the edition a book is read in. Progress moves to the same place
+in the new edition, in pages or time listened.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[0])
+			}
+			editionID, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid edition ID: %s", args[1])
+			}
+
+			b, err := svc.UseEdition(context.Background(), id, editionID)
+			if err != nil {
+				return err
+			}
+			e := b.Edition()
+			fmt.Printf("Reading %s in %s\n", b.Title, e.Label())
+			if b.Progress() > 0 {
+				fmt.Println(b.ProgressLabel())
+			}
+			return nil
+		},
+	}
+}
+
+func editionRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove [book-id] [edition-id]",
+		Short: "Remove one of a book's editions",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid book ID: %s", args[0])
+			}
+			editionID, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid edition ID: %s", args[1])
+			}
+
+			if err := svc.RemoveEdition(context.Background(), id, editionID); err != nil {
+				return err
+			}
+			fmt.Printf("Removed edition %d\n", editionID)
+			return nil
+		},
+	}
+}
+
+func watchCmd() *cobra.Command {
+	var status, coversDir string
+	var interval time.Duration
+	var mergeDuplicates bool
+
+	cmd := &cobra.Command{
+		Use:   "watch [dir]",
+		Short: "Import EPUB files as they appear in a directory",
+		Long: `Watch a directory for EPUB files and import each new or changed file,
+like pka import epub without the confirmation. Books already in the library
+are skipped unless --merge-duplicates is set, which links the file to the
+existing book. Stop with Ctrl+C.
+
+The directory is polled, so it works on network shares and in containers.
+Files are imported once their size stops changing between polls.
+
+Examples:
+  pka watch ~/Books
+  pka watch /data/incoming --interval 1m --merge-duplicates`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bookStatus := book.Status(status)
+			if !bookStatus.IsValid() {
+				return fmt.Errorf("invalid status: %s", status)
+			}
+			if interval <= 0 {
+				return fmt.Errorf("interval must be positive")
+			}
+
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			if coversDir == "" {
+				coversDir = filepath.Join(filepath.Dir(dbPath), "covers")
+			}
+			store := covers.NewStore(coversDir)
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			fmt.Printf("Watching %s every %s (Ctrl+C to stop)\n", args[0], interval)
+
+			type fileState struct {
+				size    int64
+				modTime time.Time
+			}
+			seen := make(map[string]fileState)    // imported
+			pending := make(map[string]fileState) // waiting for the file to settle
+
+			for {
+				files, err := importer.FindEPUBs(args[0])
+				if err != nil {
+					fmt.Printf("  Error: %v\n", err)
+				}
+
+				var ready []string
+				for _, f := range files {
+					info, err := os.Stat(f)
+					if err != nil {
+						continue
+					}
+					state := fileState{size: info.Size(), modTime: info.ModTime()}
+					if seen[f] == state {
+						continue
+					}
+					if pending[f] == state {
+						ready = append(ready, f)
+						delete(pending, f)
+						seen[f] = state
+						continue
+					}
+					pending[f] = state
+				}
+
+				if len(ready) > 0 {
+					if err := watchImport(ctx, svc, store, ready, bookStatus, mergeDuplicates); err != nil {
+						fmt.Printf("  Error: %v\n", err)
+					}
+				}
+
+				select {
+				case <-ctx.Done():
+					fmt.Println("Stopped.")
+					return nil
+				case <-time.After(interval):
+				}
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&status, "status", "s", string(book.StatusWantToRead), "reading status for newly imported books")
+	cmd.Flags().StringVar(&coversDir, "covers-dir", "", "cover cache directory (default: next to the database)")
+	cmd.Flags().DurationVar(&interval, "interval", 30*time.Second, "how often to check the directory")
+	cmd.Flags().BoolVar(&mergeDuplicates, "merge-duplicates", false, "link files to matching books already in the library")
+	return cmd
+}
+
+// watchImport imports EPUB files with the preview's default decisions
+func watchImport(ctx context.Context, svc *book.Service, store *covers.Store, files []string, status book.Status, mergeDuplicates bool) error {
+	records := importer.ParseEPUBs(files)
+	for i := range records {
+		records[i].Book.Status = status
+	}
+
+	rows, err := importer.Preview(ctx, svc, records)
+	if err != nil {
+		return err
+	}
+	for i := range rows {
+		if mergeDuplicates && rows[i].Duplicate != nil && !rows[i].Linked {
+			rows[i].Action = importer.ActionMerge
+		}
+	}
+
+	if _, err := importer.Commit(ctx, svc, rows); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		name := filepath.Base(row.ExternalID)
+		switch row.Outcome {
+		case importer.OutcomeImported:
+			fmt.Printf("  Added %s by %s (ID %d) from %s\n", row.Book.Title, row.Book.Author, row.Book.ID, name)
+		case importer.OutcomeMerged:
+			fmt.Printf("  Linked %s to ID %d\n", name, row.Book.ID)
+		case importer.OutcomeUpdated:
+			fmt.Printf("  Updated ID %d from %s\n", row.Book.ID, name)
+		case importer.OutcomeFailed:
+			fmt.Printf("  Failed %s: %s\n", name, row.Error)
+		default:
+			if row.Invalid != "" {
+				fmt.Printf("  Skipped %s: %s\n", name, row.Invalid)
+			} else if row.IsDuplicate() && !row.Linked {
+				fmt.Printf("  Skipped %s: %s\n", name, row.State())
+			}
+		}
+	}
+	storeImportCovers(ctx, svc, store, rows)
+	return nil
+}
+
+// storeImportCovers copies the local cover files of committed rows into the
+// cover store
+func storeImportCovers(ctx context.Context, svc *book.Service, store *covers.Store, rows []importer.PreviewRow) {
+	var stored int
+	for _, row := range rows {
+		if row.Cover == nil {
+			continue
+		}
+
+		var current *book.Book
+		switch {
+		case row.Outcome == importer.OutcomeImported || row.Outcome == importer.OutcomeMerged || row.Outcome == importer.OutcomeUpdated:
+			current, _ = svc.Get(ctx, row.Book.ID)
+		case row.Linked:
+			current = row.Duplicate
+		}
+		if current == nil {
+			continue
+		}
+
+		data, err := row.Cover()
+		if err != nil {
+			fmt.Printf("  Cover for %s: %v\n", current.Title, err)
+			continue
+		}
+		if data == nil {
+			continue
+		}
+		hash, err := store.Put(data)
+		if err != nil {
+			fmt.Printf("  Cover for %s: %v\n", current.Title, err)
+			continue
+		}
+		if hash == current.CoverHash {
+			continue
+		}
+		if err := svc.SetCoverHash(ctx, current.ID, hash); err != nil {
+			fmt.Printf("  Cover for %s: %v\n", current.Title, err)
+			continue
+		}
+		stored++
+	}
+	if stored > 0 {
+		fmt.Printf("Stored %d cover(s)\n", stored)
+	}
+}
+
+// importFileCmd builds an import subcommand around a file parser. Every
+// import shows a per-row preview before anything is written.
+func importFileCmd(name string, parse func(io.Reader) ([]importer.Record, error), short, long string) *cobra.Command {
+	var opts importOptions
+
+	cmd := &cobra.Command{
+		Use:   name + " [file]",
+		Short: short,
+		Long: long + `
+
+A preview lists each row as new, as a duplicate of a book already in your
+library (or of an earlier row), or as invalid with the reason. Duplicates
+are skipped unless --merge-duplicates is set, which folds them into the
+existing book. New rows that only look like a library book are noted as
+similar and imported. Invalid rows are never imported.
+
+Use --dry-run to see the preview without changing anything, and --report to
+save a per-row CSV of what happened.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			file, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("open file: %w", err)
+			}
+			defer file.Close()
+
+			records, err := parse(file)
+			if err != nil {
+				return err
+			}
+
+			return runImport(context.Background(), svc, records, opts)
+		},
+	}
+
+	opts.register(cmd)
+	return cmd
+}
+
+// importOptions are the flags shared by the commands that import a file
+type importOptions struct {
+	yes             bool
+	dryRun          bool
+	mergeDuplicates bool
+	report          string
+
+	onCommit func(rows []importer.PreviewRow) // called after a commit, if set
+}
+
+func (o *importOptions) register(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&o.yes, "yes", "y", false, "import without asking for confirmation")
+	cmd.Flags().BoolVar(&o.dryRun, "dry-run", false, "show the preview without importing anything")
+	cmd.Flags().BoolVar(&o.mergeDuplicates, "merge-duplicates", false, "merge duplicate rows into the existing books instead of skipping them")
+	cmd.Flags().StringVar(&o.report, "report", "", "write a per-row CSV report to this file")
+}
+
+// runImport previews records, asks for confirmation and commits them
+func runImport(ctx context.Context, svc *book.Service, records []importer.Record, opts importOptions) error {
+	rows, err := importer.Preview(ctx, svc, records)
+	if err != nil {
+		return err
+	}
+
+	var toImport, toMerge, toUpdate, invalid int
+	for i := range rows {
+		if opts.mergeDuplicates && rows[i].Duplicate != nil && !rows[i].Linked {
+			rows[i].Action = importer.ActionMerge
+		}
+		switch {
+		case rows[i].Invalid != "":
+			invalid++
+		case rows[i].Action == importer.ActionImport:
+			toImport++
+		case rows[i].Action == importer.ActionMerge:
+			toMerge++
+		case rows[i].Action == importer.ActionUpdate:
+			toUpdate++
+		}
+		printPreviewRow(rows[i])
+	}
+
+	fmt.Printf("\n%d row(s): %d new, %d to merge, %d to update, %d invalid, %d skipped\n",
+		len(rows), toImport, toMerge, toUpdate, invalid, len(rows)-toImport-toMerge-toUpdate-invalid)
+
+	if opts.dryRun || toImport+toMerge+toUpdate == 0 {
+		if opts.dryRun {
+			fmt.Println("Dry run, nothing imported.")
+		}
+		return writeImportReport(opts.report, rows)
+	}
+
+	if !opts.yes {
+		fmt.Print("Proceed? [y/N]: ")
+		input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer := strings.ToLower(strings.TrimSpace(input)); answer != "y" && answer != "yes" {
+			fmt.Println("Import cancelled.")
+			return nil
+		}
+	}
+
+	res, err := importer.Commit(ctx, svc, rows)
+	if err != nil {
+		return err
+	}
+
+	if opts.onCommit != nil {
+		opts.onCommit(rows)
+	}
+
+	for _, row := range rows {
+		if row.Outcome == importer.OutcomeFailed {
+			fmt.Printf("  line %-4d FAILED     %s: %s\n", row.Line, row.Book.Title, row.Error)
+		}
+	}
+
+	fmt.Printf("\nDone! Imported: %d, Merged: %d, Updated: %d, Skipped: %d, Failed: %d\n", res.Imported, res.Merged, res.Updated, res.Skipped, res.Failed)
+	return writeImportReport(opts.report, rows)
+}
+
+func writeImportReport(path string, rows []importer.PreviewRow) error {
+	if path == "" {
+		return nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create report: %w", err)
+	}
+	defer file.Close()
+
+	if err := importer.WriteReport(file, rows); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+	fmt.Printf("Report written to %s\n", path)
+	return nil
+}
+
+func printPreviewRow(row importer.PreviewRow) {
+	label := "NEW"
+	detail := ""
+	switch {
+	case row.Invalid != "":
+		label = "INVALID"
+		detail = " (" + row.Invalid + ")"
+	case row.Linked && row.Action == importer.ActionUpdate:
+		label = "UPDATE"
+		detail = fmt.Sprintf(" (ID %d)", row.Duplicate.ID)
+	case row.Linked:
+		label = "UNCHANGED"
+		detail = fmt.Sprintf(" (ID %d)", row.Duplicate.ID)
+	case row.Duplicate != nil:
+		label = "DUPLICATE"
+		detail = fmt.Sprintf(" (matches ID %d by %s)", row.Duplicate.ID, row.MatchReason)
+	case row.DuplicateOf > 0:
+		label = "DUPLICATE"
+		detail = fmt.Sprintf(" (same as line %d)", row.DuplicateOf)
+	case row.Similar != nil:
+		detail = fmt.Sprintf(" (similar to ID %d, %.0f%% match)", row.Similar.ID, row.SimilarScore*100)
+	}
+	if row.Action == importer.ActionMerge && row.Invalid == "" {
+		label = "MERGE"
+	}
+	if row.Invalid != "" && row.Book.Title == "" {
+		fmt.Printf("  line %-4d %-9s %s\n", row.Line, label, detail)
+		return
+	}
+	fmt.Printf("  line %-4d %-9s  %s by %s (%s)%s\n", row.Line, label, row.Book.Title, row.Book.Author, row.Book.Status, detail)
+}
+
+func discoverCmd() *cobra.Command {
+	var limit int
+	var autoAdd bool
+
+	cmd := &cobra.Command{
+		Use:   "discover [query]",
+		Short: "Search OpenLibrary and add books to your collection",
+		Long: `Search OpenLibrary for books and interactively add them.
+Examples:
+  pka discover "Andy Weir"
+  pka discover "dark fantasy"
+  pka discover "Project Hail Mary" --auto`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			query := strings.Join(args, " ")
+			client := scraper.NewOpenLibraryClient()
+			ctx := context.Background()
+
+			fmt.Printf("Searching OpenLibrary for: %s\n\n", query)
+
+			books, err := client.Search(ctx, query, limit)
+			if err != nil {
+				return err
+			}
+
+			if len(books) == 0 {
+				fmt.Println("No books found.")
+				return nil
+			}
+
+			for i, b := range books {
+				fmt.Printf("[%d] %s by %s", i+1, b.Title, b.Author)
+				if b.ISBN != "" {
+					fmt.Printf(" (ISBN: %s)", b.ISBN)
+				}
+				fmt.Println()
+			}
+
+			if autoAdd {
+				// Add first result automatically
+				b := &books[0]
+				fmt.Printf("\nAuto-adding: %s by %s\n", b.Title, b.Author)
+				fmt.Println("Generating embedding...")
+				if err := svc.Add(ctx, b); err != nil {
 					return err
 				}
 				fmt.Printf("Added with ID %d\n", b.ID)
@@ -602,6 +3720,7 @@ Examples:
 func bulkImportCmd() *cobra.Command {
 	var status string
 	var skipErrors bool
+	var opts importOptions
 
 	cmd := &cobra.Command{
 		Use:   "bulk-import [file]",
@@ -609,6 +3728,9 @@ func bulkImportCmd() *cobra.Command {
 		Long: `Import books from a text file containing ISBNs (one per line).
 Lines starting with # are treated as comments.
 
+Each ISBN is looked up on OpenLibrary first; ISBNs that can't be fetched show
+up as invalid in the preview. Nothing is saved until you confirm.
+
 Example file (isbns.txt):
   # My reading list
   9780593135204
@@ -617,7 +3739,8 @@ Example file (isbns.txt):
 
 Usage:
   pka bulk-import isbns.txt
-  pka bulk-import isbns.txt --status read`,
+  pka bulk-import isbns.txt --status read
+  pka bulk-import isbns.txt --dry-run --report preview.csv`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			svc, _, cleanup, err := initServices()
@@ -644,9 +3767,11 @@ Usage:
 			ctx := context.Background()
 
 			scanner := bufio.NewScanner(file)
-			var imported, failed int
+			var records []importer.Record
+			lineNo := 0
 
 			for scanner.Scan() {
+				lineNo++
 				line := strings.TrimSpace(scanner.Text())
 
 				// Skip empty lines and comments
@@ -658,11 +3783,15 @@ Usage:
 
 				b, err := client.FetchByISBN(ctx, line)
 				if err != nil {
-					fmt.Printf("  Error: %v\n", err)
-					failed++
 					if !skipErrors {
-						continue
+						return fmt.Errorf("line %d: fetch ISBN %s: %w", lineNo, line, err)
 					}
+					fmt.Printf("  Error: %v\n", err)
+					records = append(records, importer.Record{
+						Line:    lineNo,
+						Book:    book.Book{ISBN: line},
+						Invalid: fmt.Sprintf("fetch ISBN %s: %v", line, err),
+					})
 					continue
 				}
 
@@ -670,29 +3799,168 @@ Usage:
 				if bookStatus == book.StatusRead {
 					b.DateRead = time.Now()
 				}
+				records = append(records, importer.Record{Line: lineNo, Book: *b})
 
-				fmt.Printf("  Found: %s by %s\n", b.Title, b.Author)
+				// Be nice to OpenLibrary API
+				time.Sleep(500 * time.Millisecond)
+			}
+			if err := scanner.Err(); err != nil {
+				return fmt.Errorf("read file: %w", err)
+			}
 
-				if err := svc.Add(ctx, b); err != nil {
-					fmt.Printf("  Error saving: %v\n", err)
-					failed++
-					continue
+			fmt.Println()
+			return runImport(ctx, svc, records, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&status, "status", "s", "want_to_read", "reading status for imported books")
+	cmd.Flags().BoolVar(&skipErrors, "skip-errors", true, "continue past ISBNs that can't be fetched")
+	opts.register(cmd)
+	return cmd
+}
+
+func backupCmd() *cobra.Command {
+	var coversDir string
+
+	cmd := &cobra.Command{
+		Use:   "backup [file]",
+		Short: "Back up the whole library to a zip archive",
+		Long: `Write a backup archive with every book (including reading progress,
+adaptations and embeddings), cached covers and settings. Unlike export, a
+backup restores without re-embedding anything.
+
+Examples:
+  pka backup                       # pka-backup-20240131-120000.zip
+  pka backup ~/backups/books.zip`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			output := "pka-backup-" + time.Now().Format("20060102-150405") + ".zip"
+			if len(args) > 0 {
+				output = args[0]
+			}
+			if coversDir == "" {
+				coversDir = filepath.Join(filepath.Dir(dbPath), "covers")
+			}
+
+			out, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("create backup file: %w", err)
+			}
+			defer out.Close()
+
+			manifest, err := backup.Write(context.Background(), out, svc, covers.NewStore(coversDir))
+			if err != nil {
+				os.Remove(output)
+				return err
+			}
+			if err := out.Close(); err != nil {
+				return fmt.Errorf("write backup file: %w", err)
+			}
+
+			fmt.Printf("Backed up %d books and %d covers to %s\n", manifest.Books, manifest.Covers, output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&coversDir, "covers-dir", "", "cover cache directory (default: next to the database)")
+	return cmd
+}
+
+func restoreCmd() *cobra.Command {
+	var coversDir, conflict string
+	var reembed, yes bool
+
+	cmd := &cobra.Command{
+		Use:   "restore [file]",
+		Short: "Restore a library from a backup archive",
+		Long: `Restore books, covers and settings from a file written by pka backup, into
+an empty library or an existing one.
+
+Books that match one already in the library (by ISBN or title and author)
+are handled by --conflict:
+  skip       keep the library's book (default)
+  replace    overwrite it with the backed-up book
+  merge      fill in and combine fields, as pka merge does
+  keep-both  add the backed-up book as well
+
+Stored embeddings are reused when the backup was made with the same
+Ollama model; otherwise, or with --reembed, books are embedded again.
+
+Examples:
+  pka restore pka-backup-20240131-120000.zip
+  pka restore backup.zip --conflict replace -y`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mode := backup.Conflict(conflict)
+			if !mode.IsValid() {
+				return fmt.Errorf("invalid conflict mode: %s (use skip, replace, merge or keep-both)", conflict)
+			}
+
+			svc, _, cleanup, err := initServices()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			file, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("open backup: %w", err)
+			}
+			defer file.Close()
+			info, err := file.Stat()
+			if err != nil {
+				return fmt.Errorf("stat backup: %w", err)
+			}
+
+			archive, err := backup.Open(file, info.Size())
+			if err != nil {
+				return err
+			}
+
+			m := archive.Manifest
+			fmt.Printf("Backup from %s: %d books, %d covers", m.CreatedAt.Local().Format("Jan 2, 2006 15:04"), m.Books, m.Covers)
+			if m.EmbeddingModel != "" {
+				fmt.Printf(", embeddings by %s", m.EmbeddingModel)
+			}
+			fmt.Printf("\nConflicts: %s\n", mode)
+
+			if !yes {
+				fmt.Print("Proceed? [y/N]: ")
+				input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				if answer := strings.ToLower(strings.TrimSpace(input)); answer != "y" && answer != "yes" {
+					fmt.Println("Restore cancelled.")
+					return nil
 				}
+			}
 
-				fmt.Printf("  Added with ID %d\n", b.ID)
-				imported++
+			if coversDir == "" {
+				coversDir = filepath.Join(filepath.Dir(dbPath), "covers")
+			}
 
-				// Be nice to OpenLibrary API
-				time.Sleep(500 * time.Millisecond)
+			res, err := archive.Restore(context.Background(), svc, covers.NewStore(coversDir), backup.Options{Conflict: mode, Reembed: reembed})
+			for _, w := range res.Warnings {
+				fmt.Printf("  Warning: %s\n", w)
+			}
+			if err != nil {
+				return err
 			}
 
-			fmt.Printf("\nDone! Imported: %d, Failed: %d\n", imported, failed)
+			fmt.Printf("\nDone! Restored: %d, Replaced: %d, Merged: %d, Skipped: %d\n", res.Restored, res.Replaced, res.Merged, res.Skipped)
+			fmt.Printf("Covers: %d, Quotes: %d, Sessions: %d, Read-throughs: %d, Settings: %d, Goals: %d, Authors: %d, Credits: %d, Editions: %d, Re-embedded: %d\n", res.Covers, res.Quotes, res.Sessions, res.Reads, res.Settings, res.Goals, res.Authors, res.Credits, res.Editions, res.Reembedded)
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&status, "status", "s", "want_to_read", "reading status for imported books")
-	cmd.Flags().BoolVar(&skipErrors, "skip-errors", true, "continue on errors")
+	cmd.Flags().StringVar(&coversDir, "covers-dir", "", "cover cache directory (default: next to the database)")
+	cmd.Flags().StringVar(&conflict, "conflict", string(backup.ConflictSkip), "what to do with books already in the library (skip, replace, merge, keep-both)")
+	cmd.Flags().BoolVar(&reembed, "reembed", false, "regenerate embeddings even if the model matches")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "restore without asking for confirmation")
 	return cmd
 }
 
@@ -708,7 +3976,9 @@ func exportCmd() *cobra.Command {
 Examples:
   pka export                     # JSON to stdout
   pka export -f csv -o books.csv # CSV to file
-  pka export -o library.json     # JSON to file`,
+  pka export -o library.json     # JSON to file
+
+Exports leave out embeddings and covers; use pka backup for a full copy.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			svc, _, cleanup, err := initServices()
 			if err != nil {
@@ -746,31 +4016,8 @@ Examples:
 				}
 
 			case "csv":
-				w := csv.NewWriter(out)
-				defer w.Flush()
-
-				// Header
-				w.Write([]string{"ID", "Title", "Author", "ISBN", "Genre", "Description", "Tags", "Rating", "Status", "Notes", "DateAdded", "DateRead"})
-
-				for _, b := range books {
-					dateRead := ""
-					if !b.DateRead.IsZero() {
-						dateRead = b.DateRead.Format("2006-01-02")
-					}
-					w.Write([]string{
-						strconv.FormatInt(b.ID, 10),
-						b.Title,
-						b.Author,
-						b.ISBN,
-						b.Genre,
-						b.Description,
-						strings.Join(b.Tags, ";"),
-						strconv.Itoa(b.Rating),
-						string(b.Status),
-						b.Notes,
-						b.DateAdded.Format("2006-01-02"),
-						dateRead,
-					})
+				if err := importer.WriteCSV(out, books); err != nil {
+					return fmt.Errorf("write CSV: %w", err)
 				}
 
 			default:
@@ -791,132 +4038,150 @@ Examples:
 }
 
 func statsCmd() *cobra.Command {
-	return &cobra.Command{
+	var year int
+	var from, to string
+	var asJSON bool
+
+	cmd := &cobra.Command{
 		Use:   "stats",
 		Short: "Show reading statistics",
+		Long: `Show statistics about the library and the reading done in it.
+
+The library figures (statuses, ratings, genres, authors, tags) describe the
+collection as it is now. The reading figures count the reads finished in the
+chosen range, all time by default; a book read twice counts twice.
+
+Range bounds can be a year, a month or a day, and include the whole of it.`,
+		Example: `  pka stats
+  pka stats --year 2024
+  pka stats --from 2024-03 --to 2024-08
+  pka stats --year 2024 --json`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := stats.ParseRange(from, to)
+			if err != nil {
+				return err
+			}
+			if year != 0 {
+				if from != "" || to != "" {
+					return fmt.Errorf("use either --year or --from/--to")
+				}
+				r = stats.Year(year)
+			}
+
 			svc, _, cleanup, err := initServices()
 			if err != nil {
 				return err
 			}
 			defer cleanup()
 
-			books, err := svc.List(context.Background())
+			st, err := stats.Of(context.Background(), svc, r, time.Now())
 			if err != nil {
 				return err
 			}
 
-			if len(books) == 0 {
-				fmt.Println("No books in your collection yet.")
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(st); err != nil {
+					return fmt.Errorf("encode JSON: %w", err)
+				}
 				return nil
 			}
 
-			// Count by status
-			var wantToRead, reading, read int
-			var totalRating, ratedBooks int
-			genreCount := make(map[string]int)
-			authorCount := make(map[string]int)
-			thisYear := time.Now().Year()
-			var readThisYear int
-
-			for _, b := range books {
-				switch b.Status {
-				case book.StatusWantToRead:
-					wantToRead++
-				case book.StatusReading:
-					reading++
-				case book.StatusRead:
-					read++
-					if !b.DateRead.IsZero() && b.DateRead.Year() == thisYear {
-						readThisYear++
-					}
-				}
-
-				if b.Rating > 0 {
-					totalRating += b.Rating
-					ratedBooks++
-				}
-
-				if b.Genre != "" {
-					genreCount[b.Genre]++
-				}
-
-				authorCount[b.Author]++
+			if st.Total == 0 {
+				fmt.Println("No books in your collection yet.")
+				return nil
 			}
 
 			fmt.Println("=== Library Stats ===")
-			fmt.Printf("Total books: %d\n", len(books))
+			fmt.Printf("Total books: %d\n", st.Total)
 			fmt.Println()
 
 			fmt.Println("By status:")
-			fmt.Printf("  Want to read: %d\n", wantToRead)
-			fmt.Printf("  Reading:      %d\n", reading)
-			fmt.Printf("  Read:         %d\n", read)
-			fmt.Println()
-
-			fmt.Printf("Read this year (%d): %d\n", thisYear, readThisYear)
-
-			if ratedBooks > 0 {
-				avgRating := float64(totalRating) / float64(ratedBooks)
-				fmt.Printf("Average rating: %.1f/5 (%d rated)\n", avgRating, ratedBooks)
+			for _, status := range book.Statuses {
+				n := st.Status(status)
+				if n == 0 && status != book.StatusWantToRead && status != book.StatusReading && status != book.StatusRead {
+					continue
+				}
+				fmt.Printf("  %-15s %d\n", status.Label()+":", n)
 			}
 			fmt.Println()
 
-			// Top genres
-			if len(genreCount) > 0 {
-				fmt.Println("Top genres:")
-				type kv struct {
-					k string
-					v int
-				}
-				var genres []kv
-				for k, v := range genreCount {
-					genres = append(genres, kv{k, v})
-				}
-				// Simple sort (bubble sort for small data)
-				for i := 0; i < len(genres)-1; i++ {
-					for j := i + 1; j < len(genres); j++ {
-						if genres[j].v > genres[i].v {
-							genres[i], genres[j] = genres[j], genres[i]
-						}
-					}
-				}
-				for i, g := range genres {
-					if i >= 5 {
-						break
-					}
-					fmt.Printf("  %s: %d\n", g.k, g.v)
-				}
+			if st.Rated > 0 {
+				fmt.Printf("Average rating: %.1f/5 (%d rated)\n", st.AvgRating, st.Rated)
 				fmt.Println()
 			}
+			printCounts("Top genres", stats.Top(st.Genres, 5), "book")
+			printCounts("Top authors", stats.Top(st.Authors, 5), "book")
+			printCounts("Top tags", stats.Top(st.Tags, 10), "book")
 
-			// Top authors
-			fmt.Println("Top authors:")
-			type kv struct {
-				k string
-				v int
+			fmt.Printf("=== Reading (%s) ===\n", st.Range)
+			if st.Reads == 0 && st.DNF == 0 {
+				fmt.Println("No books finished.")
+				return nil
 			}
-			var authors []kv
-			for k, v := range authorCount {
-				authors = append(authors, kv{k, v})
+			fmt.Printf("Reads: %d", st.Reads)
+			if st.Rereads > 0 {
+				fmt.Printf(" (%d re-reads, %d different books)", st.Rereads, st.Books)
 			}
-			for i := 0; i < len(authors)-1; i++ {
-				for j := i + 1; j < len(authors); j++ {
-					if authors[j].v > authors[i].v {
-						authors[i], authors[j] = authors[j], authors[i]
-					}
-				}
+			fmt.Println()
+			if st.DNF > 0 {
+				fmt.Printf("Not finished: %d\n", st.DNF)
+			}
+			if st.Pages > 0 {
+				fmt.Printf("Pages: %d\n", st.Pages)
 			}
-			for i, a := range authors {
-				if i >= 5 {
-					break
+			if st.Minutes > 0 {
+				fmt.Printf("Listened: %s\n", formatDuration(st.Listened()))
+			}
+			if st.Pace.BooksPerMonth > 0 {
+				fmt.Printf("Pace: %.1f books a month, %.0f pages a day\n", st.Pace.BooksPerMonth, st.Pace.PagesPerDay)
+			}
+			if st.Pace.DaysPerBook > 0 {
+				fmt.Printf("Average time to finish: %.0f days\n", st.Pace.DaysPerBook)
+			}
+			fmt.Println()
+
+			printCounts("Genres read", stats.Top(st.ReadGenres, 5), "read")
+			printCounts("Authors read", stats.Top(st.ReadAuthors, 5), "read")
+
+			if len(st.Months) > 0 {
+				fmt.Println("By month:")
+				for _, m := range st.Months {
+					fmt.Printf("  %s  %3d", m.Month, m.Reads)
+					switch {
+					case m.Pages > 0 && m.Minutes > 0:
+						fmt.Printf("  (%d pages, %s listened)", m.Pages, book.FormatMinutes(m.Minutes))
+					case m.Pages > 0:
+						fmt.Printf("  (%d pages)", m.Pages)
+					case m.Minutes > 0:
+						fmt.Printf("  (%s listened)", book.FormatMinutes(m.Minutes))
+					}
+					fmt.Println()
 				}
-				fmt.Printf("  %s: %d book(s)\n", a.k, a.v)
 			}
 
 			return nil
 		},
 	}
+
+	cmd.Flags().IntVarP(&year, "year", "y", 0, "only count reads finished in this year")
+	cmd.Flags().StringVar(&from, "from", "", "only count reads finished from this date (YYYY, YYYY-MM or YYYY-MM-DD)")
+	cmd.Flags().StringVar(&to, "to", "", "only count reads finished up to this date, inclusive")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the statistics as JSON")
+	return cmd
+}
+
+// printCounts prints a list of names and counts under a heading, if any
+func printCounts(heading string, counts []stats.Count, noun string) {
+	if len(counts) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", heading)
+	for _, c := range counts {
+		fmt.Printf("  %s: %d %s(s)\n", c.Name, c.N, noun)
+	}
+	fmt.Println()
 }
 
 func scrapeAuthorCmd() *cobra.Command {
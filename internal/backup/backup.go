@@ -0,0 +1,233 @@
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+	"github.com/erwar/pka/internal/covers"
+)
+
+// A backup is a zip archive holding:
+//
+//	manifest.json   format, version, embedding model and counts
+//	books.json      every book with its ID, progress, adaptations, embedding,
+//	                editions, translators and narrators, and links to other
+//	                services (e.g. Calibre IDs)
+//	settings.json   the settings table
+//	goals.json      reading goals
+//	authors.json    authors' other spellings and Open Library keys
+//	covers/<hash>   original cover images from the local cover store
+//
+// Unlike `pka export`, nothing is lost: a restored library doesn't need to
+// be re-embedded as long as the embedding model is the same.
+
+// Format identifies PKA backups in the manifest
+const Format = "pka-backup"
+
+// Version is the archive layout written by Write. Restore reads this and
+// older versions.
+const Version = 1
+
+const (
+	manifestFile = "manifest.json"
+	booksFile    = "books.json"
+	settingsFile = "settings.json"
+	goalsFile    = "goals.json"
+	authorsFile  = "authors.json"
+	coversDir    = "covers/"
+)
+
+// Manifest describes a backup archive
+type Manifest struct {
+	Format         string    `json:"format"`
+	Version        int       `json:"version"`
+	CreatedAt      time.Time `json:"created_at"`
+	EmbeddingModel string    `json:"embedding_model,omitempty"`
+	EmbeddingDims  int       `json:"embedding_dims,omitempty"`
+	Books          int       `json:"books"`
+	Covers         int       `json:"covers"`
+}
+
+// entry is a book as stored in books.json. Book hides its embedding from
+// JSON, so it is carried alongside.
+type entry struct {
+	book.Book
+	Embedding   []float32          `json:"embedding,omitempty"`
+	ExternalIDs map[string]string  `json:"external_ids,omitempty"`
+	Quotes      []book.Quote       `json:"quotes,omitempty"`
+	Sessions    []book.Session     `json:"sessions,omitempty"`
+	Reads       []book.ReadThrough `json:"read_throughs,omitempty"`
+	Credits     []book.Credit      `json:"credits,omitempty"`  // other than the authors
+	Editions    []book.Edition     `json:"editions,omitempty"` // other than the one being read
+}
+
+// Write writes a backup of the whole library to w. store may be nil, in
+// which case covers are left out.
+func Write(ctx context.Context, w io.Writer, svc *book.Service, store *covers.Store) (*Manifest, error) {
+	books, err := svc.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list books: %w", err)
+	}
+	settings, err := svc.Settings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get settings: %w", err)
+	}
+	goals, err := svc.AllGoals(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get goals: %w", err)
+	}
+	all, err := svc.Authors(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get authors: %w", err)
+	}
+	// Authors are linked again from the books' author fields on restore,
+	// so only what can't be worked out from those is kept
+	var authors []book.Author
+	for _, a := range all {
+		if len(a.Aliases) > 0 || a.OLKey != "" {
+			authors = append(authors, a.Author)
+		}
+	}
+
+	manifest := &Manifest{
+		Format:         Format,
+		Version:        Version,
+		CreatedAt:      time.Now().UTC(),
+		EmbeddingModel: svc.EmbeddingModel(),
+		Books:          len(books),
+	}
+
+	// Oldest first, so a restore adds books in their original order
+	sort.Slice(books, func(i, j int) bool { return books[i].ID < books[j].ID })
+
+	entries := make([]entry, len(books))
+	hashes := make(map[string]bool)
+	for i, b := range books {
+		ids, err := svc.ExternalIDs(ctx, b.ID)
+		if err != nil {
+			return nil, fmt.Errorf("external IDs for book %d: %w", b.ID, err)
+		}
+		quotes, err := svc.Quotes(ctx, b.ID)
+		if err != nil {
+			return nil, fmt.Errorf("quotes for book %d: %w", b.ID, err)
+		}
+		sessions, err := svc.Sessions(ctx, b.ID)
+		if err != nil {
+			return nil, fmt.Errorf("sessions for book %d: %w", b.ID, err)
+		}
+		reads, err := svc.ReadThroughs(ctx, b.ID)
+		if err != nil {
+			return nil, fmt.Errorf("read-throughs for book %d: %w", b.ID, err)
+		}
+		credits, err := svc.Credits(ctx, b.ID)
+		if err != nil {
+			return nil, fmt.Errorf("credits for book %d: %w", b.ID, err)
+		}
+		editions, err := svc.Editions(ctx, b.ID)
+		if err != nil {
+			return nil, fmt.Errorf("editions for book %d: %w", b.ID, err)
+		}
+		entries[i] = entry{Book: b, Embedding: b.Embedding, Quotes: quotes, Sessions: sessions, Reads: reads}
+		for _, e := range editions {
+			if e.ID != b.EditionID {
+				entries[i].Editions = append(entries[i].Editions, e)
+			}
+		}
+		for _, c := range credits {
+			if c.Role != book.RoleAuthor {
+				entries[i].Credits = append(entries[i].Credits, c)
+			}
+		}
+		if len(ids) > 0 {
+			entries[i].ExternalIDs = ids
+		}
+		if manifest.EmbeddingDims == 0 {
+			manifest.EmbeddingDims = len(b.Embedding)
+		}
+		if b.CoverHash != "" && store != nil && store.Has(b.CoverHash) {
+			hashes[b.CoverHash] = true
+		}
+	}
+	manifest.Covers = len(hashes)
+
+	zw := zip.NewWriter(w)
+
+	created := manifest.CreatedAt
+	if err := writeJSON(zw, manifestFile, created, manifest); err != nil {
+		return nil, err
+	}
+	if err := writeJSON(zw, booksFile, created, entries); err != nil {
+		return nil, err
+	}
+	if err := writeJSON(zw, settingsFile, created, settings); err != nil {
+		return nil, err
+	}
+	if err := writeJSON(zw, goalsFile, created, goals); err != nil {
+		return nil, err
+	}
+	if err := writeJSON(zw, authorsFile, created, authors); err != nil {
+		return nil, err
+	}
+
+	sorted := make([]string, 0, len(hashes))
+	for h := range hashes {
+		sorted = append(sorted, h)
+	}
+	sort.Strings(sorted)
+	for _, hash := range sorted {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := writeCover(zw, store, hash, created); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("finish archive: %w", err)
+	}
+	return manifest, nil
+}
+
+func writeJSON(zw *zip.Writer, name string, modified time.Time, v any) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return fmt.Errorf("add %s: %w", name, err)
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	return nil
+}
+
+func writeCover(zw *zip.Writer, store *covers.Store, hash string, modified time.Time) error {
+	p, err := store.Original(hash)
+	if err != nil {
+		return fmt.Errorf("cover %s: %w", hash, err)
+	}
+	src, err := os.Open(p)
+	if err != nil {
+		return fmt.Errorf("open cover %s: %w", hash, err)
+	}
+	defer src.Close()
+
+	// Images are already compressed, so store them as is
+	dst, err := zw.CreateHeader(&zip.FileHeader{Name: path.Join(coversDir, hash), Method: zip.Store, Modified: modified})
+	if err != nil {
+		return fmt.Errorf("add cover %s: %w", hash, err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		return fmt.Errorf("write cover %s: %w", hash, err)
+	}
+	return nil
+}
@@ -0,0 +1,365 @@
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/erwar/pka/internal/book"
+	"github.com/erwar/pka/internal/covers"
+)
+
+// Conflict is what Restore does with a backed-up book that matches one
+// already in the library
+type Conflict string
+
+const (
+	ConflictSkip     Conflict = "skip"      // keep the library's book
+	ConflictReplace  Conflict = "replace"   // overwrite it with the backed-up book
+	ConflictMerge    Conflict = "merge"     // fill in and combine fields, as `pka merge` does
+	ConflictKeepBoth Conflict = "keep-both" // add the backed-up book as a new one
+)
+
+// Conflicts lists the valid Conflict values
+var Conflicts = []Conflict{ConflictSkip, ConflictReplace, ConflictMerge, ConflictKeepBoth}
+
+func (c Conflict) IsValid() bool {
+	for _, v := range Conflicts {
+		if c == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Options control a restore
+type Options struct {
+	Conflict Conflict
+	Reembed  bool // regenerate embeddings even if the model matches
+}
+
+// Result summarizes a restore
+type Result struct {
+	Restored   int // added as new books
+	Replaced   int
+	Merged     int
+	Skipped    int
+	Reembedded int // books whose stored embedding couldn't be used
+	Covers     int
+	Quotes     int
+	Sessions   int
+	Reads      int // read-throughs
+	Settings   int
+	Goals      int
+	Authors    int // with other spellings or an Open Library key
+	Credits    int // translators, narrators and so on
+	Editions   int // besides the ones being read
+	Warnings   []string
+}
+
+// Archive is an opened backup
+type Archive struct {
+	Manifest Manifest
+	books    []entry
+	settings map[string]string
+	goals    []book.Goal
+	authors  []book.Author
+	covers   []*zip.File
+}
+
+// Open reads and checks a backup archive
+func Open(r io.ReaderAt, size int64) (*Archive, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+
+	a := &Archive{}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		if strings.HasPrefix(f.Name, coversDir) && len(f.Name) > len(coversDir) {
+			a.covers = append(a.covers, f)
+			continue
+		}
+		files[f.Name] = f
+	}
+
+	if err := readJSON(files[manifestFile], manifestFile, &a.Manifest); err != nil {
+		return nil, err
+	}
+	if a.Manifest.Format != Format {
+		return nil, fmt.Errorf("not a PKA backup (format %q)", a.Manifest.Format)
+	}
+	if a.Manifest.Version > Version {
+		return nil, fmt.Errorf("backup version %d is newer than this version of PKA supports (%d)", a.Manifest.Version, Version)
+	}
+
+	if err := readJSON(files[booksFile], booksFile, &a.books); err != nil {
+		return nil, err
+	}
+	if f := files[settingsFile]; f != nil {
+		if err := readJSON(f, settingsFile, &a.settings); err != nil {
+			return nil, err
+		}
+	}
+	if f := files[goalsFile]; f != nil {
+		if err := readJSON(f, goalsFile, &a.goals); err != nil {
+			return nil, err
+		}
+	}
+	if f := files[authorsFile]; f != nil {
+		if err := readJSON(f, authorsFile, &a.authors); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+func readJSON(f *zip.File, name string, v any) error {
+	if f == nil {
+		return fmt.Errorf("backup is missing %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("open %s: %w", name, err)
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("read %s: %w", name, err)
+	}
+	return nil
+}
+
+// Restore adds the archive's books, covers, settings, goals and authors to
+// the library.
+// Books are matched against the library as it was before the restore (by
+// ISBN or title and author), and matches are handled per opts.Conflict.
+// Stored embeddings are reused when the backup was made with the same
+// model as svc uses; otherwise books are re-embedded. store may be nil, in
+// which case covers are not restored.
+func (a *Archive) Restore(ctx context.Context, svc *book.Service, store *covers.Store, opts Options) (Result, error) {
+	var res Result
+	if opts.Conflict == "" {
+		opts.Conflict = ConflictSkip
+	}
+	if !opts.Conflict.IsValid() {
+		return res, fmt.Errorf("invalid conflict mode %q", opts.Conflict)
+	}
+
+	reuseEmbeddings := !opts.Reembed
+	if model := svc.EmbeddingModel(); reuseEmbeddings && a.Manifest.EmbeddingModel != model {
+		reuseEmbeddings = false
+		res.Warnings = append(res.Warnings, fmt.Sprintf(
+			"backup embeddings were made with %q, not %q; books will be re-embedded", a.Manifest.EmbeddingModel, model))
+	}
+
+	existing, err := svc.List(ctx)
+	if err != nil {
+		return res, fmt.Errorf("list books: %w", err)
+	}
+	before := make(map[int64]bool, len(existing))
+	for _, b := range existing {
+		before[b.ID] = true
+	}
+
+	if store != nil {
+		res.Covers, res.Warnings = a.restoreCovers(store, res.Warnings)
+	}
+
+	// Before the books, so their names link to the authors' other spellings
+	for _, au := range a.authors {
+		if err := svc.RestoreAuthor(ctx, au); err != nil {
+			return res, fmt.Errorf("author %q: %w", au.Name, err)
+		}
+		res.Authors++
+	}
+
+	for i := range a.books {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+
+		b := a.books[i].Book
+		b.ID = 0
+		b.EditionID = 0
+		// Linked again by importing the ebook files; a path in a backup may
+		// not be this machine's, or may have been edited
+		b.FilePath = ""
+		b.Format, _ = book.ParseFormat(string(b.Format)) // older backups keep formats as written
+		for j := range a.books[i].Editions {
+			e := &a.books[i].Editions[j]
+			e.Format, _ = book.ParseFormat(string(e.Format))
+		}
+		b.Embedding = nil
+		if reuseEmbeddings {
+			b.Embedding = a.books[i].Embedding
+		}
+		reembed := len(b.Embedding) == 0
+		if store != nil && b.CoverHash != "" && !store.Has(b.CoverHash) {
+			b.CoverHash = "" // fetched again from CoverURL when first shown
+		}
+
+		var match *book.Book
+		if opts.Conflict != ConflictKeepBoth {
+			m, _, err := svc.CheckDuplicate(ctx, &b)
+			if err != nil {
+				return res, fmt.Errorf("book %q: %w", b.Title, err)
+			}
+			// Books restored earlier in this run aren't conflicts, so a
+			// backup restores in full even if it holds duplicates itself
+			if m != nil && before[m.ID] {
+				match = m
+			}
+		}
+
+		switch {
+		case match == nil:
+			if err := svc.Restore(ctx, &b); err != nil {
+				return res, fmt.Errorf("book %q: %w", b.Title, err)
+			}
+			res.Restored++
+			if reembed {
+				res.Reembedded++
+			}
+
+		case opts.Conflict == ConflictReplace:
+			b.ID = match.ID
+			b.EditionID = match.EditionID
+			b.FilePath = match.FilePath
+			if err := svc.Restore(ctx, &b); err != nil {
+				return res, fmt.Errorf("book %q: %w", b.Title, err)
+			}
+			res.Replaced++
+			if reembed {
+				res.Reembedded++
+			}
+
+		case opts.Conflict == ConflictMerge:
+			if _, err := svc.MergeFrom(ctx, match.ID, &b); err != nil {
+				return res, fmt.Errorf("book %q: %w", b.Title, err)
+			}
+			res.Merged++
+
+		default:
+			res.Skipped++
+			continue
+		}
+
+		id := b.ID
+		if match != nil {
+			id = match.ID
+		}
+		for source, externalID := range a.books[i].ExternalIDs {
+			if err := svc.LinkExternalID(ctx, id, source, externalID); err != nil {
+				return res, fmt.Errorf("book %q: link %s ID: %w", b.Title, source, err)
+			}
+		}
+		added, err := svc.AddQuotes(ctx, id, a.books[i].Quotes)
+		res.Quotes += added
+		if err != nil {
+			return res, fmt.Errorf("book %q: %w", b.Title, err)
+		}
+		added, err = svc.AddSessions(ctx, id, a.books[i].Sessions)
+		res.Sessions += added
+		if err != nil {
+			return res, fmt.Errorf("book %q: %w", b.Title, err)
+		}
+		added, err = svc.AddReadThroughs(ctx, id, a.books[i].Reads)
+		res.Reads += added
+		if err != nil {
+			return res, fmt.Errorf("book %q: %w", b.Title, err)
+		}
+		added, err = svc.AddEditions(ctx, id, a.books[i].Editions)
+		res.Editions += added
+		if err != nil {
+			return res, fmt.Errorf("book %q: %w", b.Title, err)
+		}
+		for _, c := range a.books[i].Credits {
+			if _, err := svc.AddCredit(ctx, id, c.Name, c.Role); err != nil {
+				return res, fmt.Errorf("book %q: credit %s: %w", b.Title, c.Name, err)
+			}
+			res.Credits++
+		}
+	}
+
+	current, err := svc.Settings(ctx)
+	if err != nil {
+		return res, fmt.Errorf("get settings: %w", err)
+	}
+	for key, value := range a.settings {
+		if _, ok := current[key]; ok && opts.Conflict != ConflictReplace {
+			continue
+		}
+		if err := svc.SetSetting(ctx, key, value); err != nil {
+			return res, fmt.Errorf("set %s: %w", key, err)
+		}
+		res.Settings++
+	}
+
+	// Like settings, goals already set are only replaced on request
+	for _, g := range a.goals {
+		existing, err := svc.Goals(ctx, g.Year)
+		if err != nil {
+			return res, fmt.Errorf("get goals: %w", err)
+		}
+		set := false
+		for _, e := range existing {
+			if e.Kind == g.Kind && e.Month == g.Month {
+				set = true
+				break
+			}
+		}
+		if set && opts.Conflict != ConflictReplace {
+			continue
+		}
+		g.ID = 0
+		if err := svc.SetGoal(ctx, &g); err != nil {
+			return res, fmt.Errorf("set %s goal for %s: %w", g.Kind, g.Period(), err)
+		}
+		res.Goals++
+	}
+
+	return res, nil
+}
+
+// restoreCovers copies cover images into the store. Unreadable or
+// corrupt covers are reported as warnings; the books fall back to their
+// cover URL.
+func (a *Archive) restoreCovers(store *covers.Store, warnings []string) (int, []string) {
+	var n int
+	for _, f := range a.covers {
+		want := strings.TrimPrefix(f.Name, coversDir)
+		if store.Has(want) {
+			n++
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("cover %s: %v", want, err))
+			continue
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("cover %s: %v", want, err))
+			continue
+		}
+
+		hash, err := store.Put(data)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("cover %s: %v", want, err))
+			continue
+		}
+		if hash != want {
+			warnings = append(warnings, fmt.Sprintf("cover %s: content doesn't match its name", want))
+			continue
+		}
+		n++
+	}
+	return n, warnings
+}
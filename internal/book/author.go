@@ -0,0 +1,543 @@
+package book
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Role is what a person did on a book
+type Role string
+
+const (
+	RoleAuthor      Role = "author"
+	RoleTranslator  Role = "translator"
+	RoleIllustrator Role = "illustrator"
+	RoleNarrator    Role = "narrator"
+)
+
+// Roles lists every valid role, in the order credits are shown
+var Roles = []Role{RoleAuthor, RoleTranslator, RoleIllustrator, RoleNarrator}
+
+func (r Role) IsValid() bool {
+	switch r {
+	case RoleAuthor, RoleTranslator, RoleIllustrator, RoleNarrator:
+		return true
+	}
+	return false
+}
+
+// Label is the role as shown to people, e.g. "Translator"
+func (r Role) Label() string {
+	if r == "" {
+		return ""
+	}
+	return strings.ToUpper(string(r[:1])) + string(r[1:])
+}
+
+// Author is a person credited on books. A book's Author field is kept as
+// written, and each name in it is linked to an Author, so different
+// spellings and co-written books count towards the same person.
+type Author struct {
+	ID      int64    `json:"id"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"` // other spellings of the name
+	OLKey   string   `json:"ol_key,omitempty"`  // Open Library author key, e.g. "OL23919A"
+}
+
+// Credit links a book to a person in a role
+type Credit struct {
+	BookID   int64  `json:"book_id"`
+	AuthorID int64  `json:"author_id"`
+	Name     string `json:"name"` // the author's name
+	Role     Role   `json:"role"`
+}
+
+// AuthorBooks is an author with the books they're credited on
+type AuthorBooks struct {
+	Author
+	Books []CreditedBook `json:"books"`
+}
+
+// CreditedBook is a book and what the author did on it
+type CreditedBook struct {
+	Book
+	Role Role `json:"role"`
+}
+
+// Read is how many of the author's books have been read
+func (a *AuthorBooks) Read() int {
+	n := 0
+	for _, b := range a.Books {
+		if b.Status == StatusRead {
+			n++
+		}
+	}
+	return n
+}
+
+// Find returns the author's book with a title, however it's written, or nil
+func (a *AuthorBooks) Find(title string) *CreditedBook {
+	want := NormalizeTitle(title)
+	for i := range a.Books {
+		if NormalizeTitle(a.Books[i].Title) == want {
+			return &a.Books[i]
+		}
+	}
+	return nil
+}
+
+// Matches reports whether name is the author's name or one of its aliases,
+// however it's spelled or ordered ("Tolkien, J.R.R." is "J. R. R. Tolkien")
+func (a *Author) Matches(name string) bool {
+	key := authorKey(name)
+	if key == "" {
+		return false
+	}
+	if authorKey(a.Name) == key {
+		return true
+	}
+	for _, alias := range a.Aliases {
+		if authorKey(alias) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenLibraryURL is the author's page on Open Library, or "" if the author
+// isn't linked to one
+func (a *Author) OpenLibraryURL() string {
+	if a.OLKey == "" {
+		return ""
+	}
+	return "https://openlibrary.org/authors/" + a.OLKey
+}
+
+// FindAuthor returns the author in authors that name matches, or nil
+func FindAuthor(authors []Author, name string) *Author {
+	for i := range authors {
+		if authors[i].Matches(name) {
+			return &authors[i]
+		}
+	}
+	return nil
+}
+
+// AuthorNames returns the book's authors: the linked ones if loaded, or
+// else the names in its Author field
+func (b *Book) AuthorNames() []string {
+	if len(b.Authors) > 0 {
+		return b.Authors
+	}
+	return SplitAuthors(b.Author)
+}
+
+// SplitAuthors splits an author field into names. Names can be separated by
+// commas, semicolons, "&" or "and"; "Tolkien, J.R.R." is one author and
+// comes back as "J.R.R. Tolkien", as NormalizeAuthor reads it.
+func SplitAuthors(s string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, part := range splitAny(s, ";", " & ", " and ") {
+		commas := strings.Split(part, ",")
+		if len(commas) == 2 && len(tokens(commas[0])) == 1 && len(tokens(commas[1])) > 0 {
+			// "Last, First"
+			commas = []string{strings.TrimSpace(commas[1]) + " " + strings.TrimSpace(commas[0])}
+		}
+		for _, name := range commas {
+			name = strings.Join(strings.Fields(name), " ")
+			key := authorKey(name)
+			if key == "" || seen[key] {
+				continue
+			}
+			if isNameSuffix(name) && len(names) > 0 {
+				names[len(names)-1] += ", " + name // "Martin Luther King, Jr."
+				continue
+			}
+			seen[key] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// JoinAuthors writes names back as an author field
+func JoinAuthors(names []string) string {
+	return strings.Join(names, " & ")
+}
+
+func splitAny(s string, seps ...string) []string {
+	parts := []string{s}
+	for _, sep := range seps {
+		var next []string
+		for _, p := range parts {
+			next = append(next, strings.Split(p, sep)...)
+		}
+		parts = next
+	}
+	return parts
+}
+
+func isNameSuffix(name string) bool {
+	switch strings.ToLower(strings.TrimSuffix(name, ".")) {
+	case "jr", "sr", "ii", "iii", "iv", "phd":
+		return true
+	}
+	return false
+}
+
+// authorKey is what two spellings of one name have in common: their name
+// parts, lowercased and sorted
+func authorKey(name string) string {
+	t := tokens(name)
+	sort.Strings(t)
+	return strings.Join(t, " ")
+}
+
+// linkAuthors links each name in b's Author field to an author, adding the
+// ones not seen before, and unlinks the authors it no longer names
+func (s *Service) linkAuthors(ctx context.Context, b *Book) error {
+	authors, err := s.repo.GetAllAuthors(ctx)
+	if err != nil {
+		return fmt.Errorf("get authors: %w", err)
+	}
+	var ids []int64
+	linked := make(map[int64]bool)
+	for _, name := range SplitAuthors(b.Author) {
+		a := FindAuthor(authors, name)
+		if a == nil {
+			a = &Author{Name: name}
+			if err := s.repo.CreateAuthor(ctx, a); err != nil {
+				return fmt.Errorf("create author: %w", err)
+			}
+			authors = append(authors, *a)
+		}
+		if !linked[a.ID] {
+			linked[a.ID] = true
+			ids = append(ids, a.ID)
+		}
+	}
+
+	before, err := s.repo.GetCredits(ctx, b.ID)
+	if err != nil {
+		return fmt.Errorf("get credits: %w", err)
+	}
+	if err := s.repo.SetCredits(ctx, b.ID, RoleAuthor, ids); err != nil {
+		return fmt.Errorf("link authors: %w", err)
+	}
+	return s.pruneAuthors(ctx, before)
+}
+
+// pruneAuthors deletes the authors of credits that no longer have any
+// books, unless they hold aliases or an Open Library key worth keeping
+func (s *Service) pruneAuthors(ctx context.Context, credits []Credit) error {
+	for _, c := range credits {
+		left, err := s.repo.GetAuthorCredits(ctx, c.AuthorID)
+		if err != nil {
+			return fmt.Errorf("get credits: %w", err)
+		}
+		if len(left) > 0 {
+			continue
+		}
+		a, err := s.repo.GetAuthor(ctx, c.AuthorID)
+		if err != nil {
+			continue // already gone
+		}
+		if len(a.Aliases) > 0 || a.OLKey != "" {
+			continue
+		}
+		if err := s.repo.DeleteAuthor(ctx, a.ID); err != nil {
+			return fmt.Errorf("delete author: %w", err)
+		}
+	}
+	return nil
+}
+
+// Authors returns every author with their books, by name
+func (s *Service) Authors(ctx context.Context) ([]AuthorBooks, error) {
+	authors, err := s.repo.GetAllAuthors(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get authors: %w", err)
+	}
+	books, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list books: %w", err)
+	}
+	credits, err := s.repo.GetAllCredits(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get credits: %w", err)
+	}
+
+	byID := make(map[int64]Book, len(books))
+	for _, b := range books {
+		byID[b.ID] = b
+	}
+	list := make([]AuthorBooks, len(authors))
+	index := make(map[int64]int, len(authors))
+	for i, a := range authors {
+		list[i].Author = a
+		index[a.ID] = i
+	}
+	for _, c := range credits {
+		i, ok := index[c.AuthorID]
+		b, found := byID[c.BookID]
+		if ok && found {
+			list[i].Books = append(list[i].Books, CreditedBook{Book: b, Role: c.Role})
+		}
+	}
+	for i := range list {
+		sortCredited(list[i].Books)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name)
+	})
+	return list, nil
+}
+
+// Author returns an author with their books
+func (s *Service) Author(ctx context.Context, id int64) (*AuthorBooks, error) {
+	a, err := s.repo.GetAuthor(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get author: %w", err)
+	}
+	credits, err := s.repo.GetAuthorCredits(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get credits: %w", err)
+	}
+	ab := &AuthorBooks{Author: *a}
+	for _, c := range credits {
+		b, err := s.repo.GetByID(ctx, c.BookID)
+		if err != nil {
+			return nil, fmt.Errorf("get book %d: %w", c.BookID, err)
+		}
+		ab.Books = append(ab.Books, CreditedBook{Book: *b, Role: c.Role})
+	}
+	sortCredited(ab.Books)
+	return ab, nil
+}
+
+// sortCredited puts books the author wrote first, then by series and title
+func sortCredited(books []CreditedBook) {
+	sort.SliceStable(books, func(i, j int) bool {
+		a, b := &books[i], &books[j]
+		if (a.Role == RoleAuthor) != (b.Role == RoleAuthor) {
+			return a.Role == RoleAuthor
+		}
+		if ka, kb := seriesKey(a.Series), seriesKey(b.Series); ka != kb {
+			return ka < kb
+		}
+		if a.SeriesPosition != b.SeriesPosition {
+			return a.SeriesPosition < b.SeriesPosition
+		}
+		return strings.ToLower(a.Title) < strings.ToLower(b.Title)
+	})
+}
+
+// FindAuthor returns the author a name or alias belongs to
+func (s *Service) FindAuthor(ctx context.Context, name string) (*Author, error) {
+	authors, err := s.repo.GetAllAuthors(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get authors: %w", err)
+	}
+	if a := FindAuthor(authors, name); a != nil {
+		return a, nil
+	}
+	return nil, fmt.Errorf("no author named %q", name)
+}
+
+// Credits returns the people credited on a book, authors first
+func (s *Service) Credits(ctx context.Context, bookID int64) ([]Credit, error) {
+	credits, err := s.repo.GetCredits(ctx, bookID)
+	if err != nil {
+		return nil, fmt.Errorf("get credits: %w", err)
+	}
+	order := make(map[Role]int, len(Roles))
+	for i, r := range Roles {
+		order[r] = i
+	}
+	sort.SliceStable(credits, func(i, j int) bool { return order[credits[i].Role] < order[credits[j].Role] })
+	return credits, nil
+}
+
+// AddCredit credits a person on a book in a role, adding them as an author
+// if they're new. Authors are added to the book's Author field as well.
+func (s *Service) AddCredit(ctx context.Context, bookID int64, name string, role Role) (*Author, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if !role.IsValid() {
+		return nil, fmt.Errorf("invalid role %q", role)
+	}
+	b, err := s.repo.GetByID(ctx, bookID)
+	if err != nil {
+		return nil, fmt.Errorf("get book: %w", err)
+	}
+
+	if role == RoleAuthor {
+		b.Author = JoinAuthors(append(SplitAuthors(b.Author), name))
+		if err := s.Update(ctx, b); err != nil {
+			return nil, err
+		}
+		return s.FindAuthor(ctx, name)
+	}
+
+	authors, err := s.repo.GetAllAuthors(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get authors: %w", err)
+	}
+	a := FindAuthor(authors, name)
+	if a == nil {
+		a = &Author{Name: name}
+		if err := s.repo.CreateAuthor(ctx, a); err != nil {
+			return nil, fmt.Errorf("create author: %w", err)
+		}
+	}
+	if err := s.repo.AddCredit(ctx, Credit{BookID: bookID, AuthorID: a.ID, Role: role}); err != nil {
+		return nil, fmt.Errorf("add credit: %w", err)
+	}
+	return a, nil
+}
+
+// RemoveCredit takes a person's credit in a role off a book. Removing an
+// author takes their name out of the book's Author field too.
+func (s *Service) RemoveCredit(ctx context.Context, bookID, authorID int64, role Role) error {
+	if role == RoleAuthor {
+		b, err := s.repo.GetByID(ctx, bookID)
+		if err != nil {
+			return fmt.Errorf("get book: %w", err)
+		}
+		a, err := s.repo.GetAuthor(ctx, authorID)
+		if err != nil {
+			return fmt.Errorf("get author: %w", err)
+		}
+		var names []string
+		for _, name := range SplitAuthors(b.Author) {
+			if !a.Matches(name) {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("%s is the book's only author", a.Name)
+		}
+		b.Author = JoinAuthors(names)
+		return s.Update(ctx, b)
+	}
+
+	c := Credit{BookID: bookID, AuthorID: authorID, Role: role}
+	if err := s.repo.DeleteCredit(ctx, c); err != nil {
+		return fmt.Errorf("remove credit: %w", err)
+	}
+	return s.pruneAuthors(ctx, []Credit{c})
+}
+
+// MergeAuthors folds author dropID into keepID: dropID's books are credited
+// to keepID, and its name and aliases become keepID's aliases, so books
+// naming either spelling link to keepID from now on
+func (s *Service) MergeAuthors(ctx context.Context, keepID, dropID int64) (*Author, error) {
+	if keepID == dropID {
+		return nil, fmt.Errorf("cannot merge an author into itself")
+	}
+	keep, err := s.repo.GetAuthor(ctx, keepID)
+	if err != nil {
+		return nil, fmt.Errorf("get author %d: %w", keepID, err)
+	}
+	drop, err := s.repo.GetAuthor(ctx, dropID)
+	if err != nil {
+		return nil, fmt.Errorf("get author %d: %w", dropID, err)
+	}
+
+	for _, name := range append([]string{drop.Name}, drop.Aliases...) {
+		addAlias(keep, name)
+	}
+	if keep.OLKey == "" {
+		keep.OLKey = drop.OLKey
+	}
+	if err := s.repo.UpdateAuthor(ctx, keep); err != nil {
+		return nil, fmt.Errorf("update author: %w", err)
+	}
+	if err := s.repo.MoveAuthorCredits(ctx, dropID, keepID); err != nil {
+		return nil, fmt.Errorf("move credits: %w", err)
+	}
+	if err := s.repo.DeleteAuthor(ctx, dropID); err != nil {
+		return nil, fmt.Errorf("delete merged author: %w", err)
+	}
+	return keep, nil
+}
+
+// AddAlias records another spelling of an author's name. If another author
+// goes by it, that author is merged in.
+func (s *Service) AddAlias(ctx context.Context, id int64, alias string) (*Author, error) {
+	alias = strings.TrimSpace(alias)
+	if authorKey(alias) == "" {
+		return nil, fmt.Errorf("alias is required")
+	}
+	authors, err := s.repo.GetAllAuthors(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get authors: %w", err)
+	}
+	if other := FindAuthor(authors, alias); other != nil && other.ID != id {
+		return s.MergeAuthors(ctx, id, other.ID)
+	}
+
+	a, err := s.repo.GetAuthor(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get author: %w", err)
+	}
+	addAlias(a, alias)
+	if err := s.repo.UpdateAuthor(ctx, a); err != nil {
+		return nil, fmt.Errorf("update author: %w", err)
+	}
+	return a, nil
+}
+
+// addAlias adds name to a's aliases unless a already goes by it
+func addAlias(a *Author, name string) {
+	if !a.Matches(name) {
+		a.Aliases = append(a.Aliases, name)
+	}
+}
+
+// SetAuthorKey links an author to their Open Library author key, e.g.
+// "OL23919A"
+func (s *Service) SetAuthorKey(ctx context.Context, id int64, key string) (*Author, error) {
+	a, err := s.repo.GetAuthor(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get author: %w", err)
+	}
+	a.OLKey = strings.TrimPrefix(strings.TrimSpace(key), "/authors/")
+	if err := s.repo.UpdateAuthor(ctx, a); err != nil {
+		return nil, fmt.Errorf("update author: %w", err)
+	}
+	return a, nil
+}
+
+// RestoreAuthor adds a backed-up author's aliases and Open Library key to
+// the library's author of that name, adding the author if there's none
+func (s *Service) RestoreAuthor(ctx context.Context, backup Author) error {
+	authors, err := s.repo.GetAllAuthors(ctx)
+	if err != nil {
+		return fmt.Errorf("get authors: %w", err)
+	}
+	a := FindAuthor(authors, backup.Name)
+	if a == nil {
+		for _, alias := range backup.Aliases {
+			if a = FindAuthor(authors, alias); a != nil {
+				break
+			}
+		}
+	}
+	if a == nil {
+		a = &Author{Name: backup.Name, Aliases: backup.Aliases, OLKey: backup.OLKey}
+		return s.repo.CreateAuthor(ctx, a)
+	}
+	for _, name := range append([]string{backup.Name}, backup.Aliases...) {
+		addAlias(a, name)
+	}
+	if a.OLKey == "" {
+		a.OLKey = backup.OLKey
+	}
+	return s.repo.UpdateAuthor(ctx, a)
+}
@@ -2,36 +2,49 @@ package book
 
 import "time"
 
+// Book is a work in the library. Its status, rating, notes and embedding
+// belong to the work; ISBN, Format, Publisher, PageCount, TotalMinutes and
+// the cover are those of the edition being read, one of the book's Editions.
 type Book struct {
-	ID          int64        `json:"id"`
-	Title       string       `json:"title"`
-	Author      string       `json:"author"`
-	ISBN        string       `json:"isbn,omitempty"`
-	Description string       `json:"description,omitempty"`
-	Genre       string       `json:"genre,omitempty"`
-	Tags        []string     `json:"tags,omitempty"`
-	CoverURL    string       `json:"cover_url,omitempty"`    // book cover image URL
-	PageCount   int          `json:"page_count,omitempty"`   // total pages
-	CurrentPage int          `json:"current_page,omitempty"` // current reading progress
-	Rating      int          `json:"rating,omitempty"`       // 1-5 stars
-	Status      Status       `json:"status"`                 // want_to_read, reading, read
-	Notes       string       `json:"notes,omitempty"`        // personal notes
-	DateAdded   time.Time    `json:"date_added"`
-	DateRead    time.Time    `json:"date_read,omitempty"`
-	Embedding   []float32    `json:"-"`                      // semantic embedding vector
-	Adaptations []Adaptation `json:"adaptations,omitempty"`  // media adaptations (movies, TV, etc)
+	ID              int64        `json:"id"`
+	Title           string       `json:"title"`
+	Author          string       `json:"author"`
+	Authors         []string     `json:"authors,omitempty"` // the people in Author as linked in the authors table, by their main name
+	EditionID       int64        `json:"edition_id,omitempty"`
+	ISBN            string       `json:"isbn,omitempty"`
+	Format          Format       `json:"format,omitempty"` // physical, ebook or audiobook; empty if unknown
+	Publisher       string       `json:"publisher,omitempty"`
+	Description     string       `json:"description,omitempty"`
+	Genre           string       `json:"genre,omitempty"`
+	Tags            []string     `json:"tags,omitempty"`
+	CoverURL        string       `json:"cover_url,omitempty"`        // book cover image URL
+	CoverHash       string       `json:"cover_hash,omitempty"`       // content hash of the locally cached cover
+	FilePath        string       `json:"file_path,omitempty"`        // local ebook file, if any
+	PageCount       int          `json:"page_count,omitempty"`       // total pages
+	CurrentPage     int          `json:"current_page,omitempty"`     // current reading progress
+	TotalMinutes    int          `json:"total_minutes,omitempty"`    // audiobook length
+	ListenedMinutes int          `json:"listened_minutes,omitempty"` // current listening progress
+	Rating          float64      `json:"rating,omitempty"`           // 1-5 stars, see RatingStep
+	Status          Status       `json:"status"`                     // want_to_read, reading, rereading, paused, read, did_not_finish
+	Notes           string       `json:"notes,omitempty"`            // personal notes
+	DateAdded       time.Time    `json:"date_added"`
+	DateRead        time.Time    `json:"date_read,omitempty"`
+	DNFReason       string       `json:"dnf_reason,omitempty"`      // why the book was abandoned
+	DNFPage         int          `json:"dnf_page,omitempty"`        // page it was abandoned at
+	Series          string       `json:"series,omitempty"`          // e.g. "The Expanse"
+	SeriesPosition  float64      `json:"series_position,omitempty"` // place in the series; 0 if unknown, 1.5 for a novella between 1 and 2
+	Embedding       []float32    `json:"-"`                         // semantic embedding vector
+	Adaptations     []Adaptation `json:"adaptations,omitempty"`     // media adaptations (movies, TV, etc)
 }
 
-// Progress returns reading progress as percentage (0-100)
+// Progress returns reading progress as percentage (0-100), by pages read
+// or, for an audiobook, by time listened
 func (b *Book) Progress() int {
-	if b.PageCount == 0 || b.CurrentPage == 0 {
+	done, total := b.Position()
+	if total == 0 || done == 0 {
 		return 0
 	}
-	p := (b.CurrentPage * 100) / b.PageCount
-	if p > 100 {
-		return 100
-	}
-	return p
+	return min(done*100/total, 100)
 }
 
 // HasAdaptations returns true if book has any adaptations
@@ -56,20 +69,51 @@ const (
 	StatusWantToRead Status = "want_to_read"
 	StatusReading    Status = "reading"
 	StatusRead       Status = "read"
+	StatusRereading  Status = "rereading"
+	StatusPaused     Status = "paused"
+	StatusDNF        Status = "did_not_finish"
 )
 
+// Statuses lists every valid status, in the order a reader moves through them
+var Statuses = []Status{StatusWantToRead, StatusReading, StatusRereading, StatusPaused, StatusRead, StatusDNF}
+
 func (s Status) String() string {
 	return string(s)
 }
 
 func (s Status) IsValid() bool {
 	switch s {
-	case StatusWantToRead, StatusReading, StatusRead:
+	case StatusWantToRead, StatusReading, StatusRead, StatusRereading, StatusPaused, StatusDNF:
 		return true
 	}
 	return false
 }
 
+// InProgress reports whether a read has started but not ended: reading,
+// rereading or paused
+func (s Status) InProgress() bool {
+	return s == StatusReading || s == StatusRereading || s == StatusPaused
+}
+
+// Label is the status as shown to people, e.g. "Did Not Finish"
+func (s Status) Label() string {
+	switch s {
+	case StatusWantToRead:
+		return "Want to Read"
+	case StatusReading:
+		return "Reading"
+	case StatusRereading:
+		return "Re-reading"
+	case StatusPaused:
+		return "Paused"
+	case StatusRead:
+		return "Read"
+	case StatusDNF:
+		return "Did Not Finish"
+	}
+	return string(s)
+}
+
 type SearchResult struct {
 	Book       Book    `json:"book"`
 	Similarity float32 `json:"similarity"` // cosine similarity score
@@ -0,0 +1,347 @@
+package book
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DuplicatePair is a candidate pair of books that may describe the same work
+type DuplicatePair struct {
+	A      Book    `json:"a"`
+	B      Book    `json:"b"`
+	Reason string  `json:"reason"` // "ISBN", "title+author", "fuzzy" or "embedding"
+	Score  float64 `json:"score"`  // 0-1, higher means more likely the same book
+}
+
+// Minimum similarity for fuzzy title/author matches
+const (
+	fuzzyTitleThreshold  = 0.9
+	fuzzyAuthorThreshold = 0.85
+)
+
+// subtitleScore is the title score of titles that only match once their
+// subtitles are dropped, e.g. "The Hobbit" and "The Hobbit, or There and
+// Back Again"
+const subtitleScore = 0.9
+
+var leadingArticles = []string{"the ", "a ", "an "}
+
+// NormalizeTitle reduces a title to a comparable key: lowercase, no
+// punctuation, no leading article and no subtitle.
+// "The Hobbit, or There and Back Again" becomes "hobbit".
+func NormalizeTitle(title string) string {
+	t := strings.ToLower(title)
+
+	// Drop subtitles
+	for _, sep := range []string{":", ", or ", " or, ", " (", ";", " - "} {
+		if i := strings.Index(t, sep); i > 0 {
+			t = t[:i]
+		}
+	}
+
+	return dropArticle(strings.Join(tokens(t), " "))
+}
+
+// fullTitle normalizes a title like NormalizeTitle but keeps its subtitle
+func fullTitle(title string) string {
+	return dropArticle(strings.Join(tokens(title), " "))
+}
+
+func dropArticle(t string) string {
+	for _, article := range leadingArticles {
+		if strings.HasPrefix(t, article) {
+			return strings.TrimPrefix(t, article)
+		}
+	}
+	return t
+}
+
+// TitleKey is the key under which two books are certainly the same: the
+// whole normalized title, subtitle included, and the normalized author.
+// "The Hobbit" by "J.R.R. Tolkien" and "Hobbit" by "Tolkien, J. R. R."
+// share a key; "Saga, Volume 1" and "Saga, Volume 2" don't.
+func TitleKey(title, author string) string {
+	return fullTitle(title) + "|" + NormalizeAuthor(author)
+}
+
+// NormalizeAuthor reduces an author name to a comparable key. Initials are
+// split and name parts sorted so "J.R.R. Tolkien", "J. R. R. Tolkien" and
+// "Tolkien, J.R.R." all normalize to "j r r tolkien". Only the first author
+// of a comma or "&" separated list is kept.
+func NormalizeAuthor(author string) string {
+	a := strings.ToLower(author)
+	for _, sep := range []string{" & ", " and ", ";"} {
+		if i := strings.Index(a, sep); i > 0 {
+			a = a[:i]
+		}
+	}
+
+	// "Tolkien, J.R.R." is a single author, "Neil Gaiman, Terry Pratchett" is not
+	if parts := strings.Split(a, ","); len(parts) > 1 {
+		if len(tokens(parts[0])) > 1 {
+			a = parts[0]
+		}
+	}
+
+	t := tokens(a)
+	sort.Strings(t)
+	return strings.Join(t, " ")
+}
+
+// tokens splits s into lowercase letter/digit runs
+func tokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// romanNumerals are the numerals read as volume numbers in titles. "i" is
+// left out, as it's more often the pronoun.
+var romanNumerals = map[string]int{
+	"ii": 2, "iii": 3, "iv": 4, "v": 5, "vi": 6, "vii": 7, "viii": 8, "ix": 9, "x": 10,
+	"xi": 11, "xii": 12, "xiii": 13, "xiv": 14, "xv": 15, "xvi": 16, "xvii": 17, "xviii": 18, "xix": 19, "xx": 20,
+}
+
+var numberWords = map[string]int{
+	"one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+}
+
+// titleNumbers returns the numbers in a title, written as digits, roman
+// numerals or words, so "Volume 2", "Volume II" and "Volume Two" agree
+func titleNumbers(title string) []int {
+	var nums []int
+	for _, t := range tokens(title) {
+		if n, ok := titleNumber(t); ok {
+			nums = append(nums, n)
+		}
+	}
+	return nums
+}
+
+func titleNumber(token string) (int, bool) {
+	if n, err := strconv.Atoi(token); err == nil {
+		return n, true
+	}
+	if n, ok := romanNumerals[token]; ok {
+		return n, true
+	}
+	n, ok := numberWords[token]
+	return n, ok
+}
+
+// numberedTitle normalizes a title like fullTitle with its numbers written
+// as digits, so titles that differ only in how they number compare equal
+func numberedTitle(title string) string {
+	t := tokens(title)
+	for i, token := range t {
+		if n, ok := titleNumber(token); ok {
+			t[i] = strconv.Itoa(n)
+		}
+	}
+	return dropArticle(strings.Join(t, " "))
+}
+
+// MatchScore returns how likely a and b describe the same book based on
+// normalized title and author. Zero means no match. Titles with different
+// numbers ("Saga, Volume 1" and "Saga, Volume 2") or books at different
+// positions in a series never match.
+func MatchScore(a, b *Book) float64 {
+	if a.Title == "" || b.Title == "" {
+		return 0
+	}
+	if a.SeriesPosition != 0 && b.SeriesPosition != 0 && a.SeriesPosition != b.SeriesPosition {
+		return 0
+	}
+	if !slices.Equal(titleNumbers(a.Title), titleNumbers(b.Title)) {
+		return 0
+	}
+
+	titleScore := similarity(numberedTitle(a.Title), numberedTitle(b.Title))
+	if titleScore < fuzzyTitleThreshold && NormalizeTitle(a.Title) == NormalizeTitle(b.Title) {
+		titleScore = subtitleScore
+	}
+	if titleScore < fuzzyTitleThreshold {
+		return 0
+	}
+
+	// Missing authors can't confirm or rule out a match
+	if a.Author == "" || b.Author == "" {
+		return titleScore * 0.8
+	}
+
+	authorScore := similarity(NormalizeAuthor(a.Author), NormalizeAuthor(b.Author))
+	if authorScore < fuzzyAuthorThreshold {
+		return 0
+	}
+
+	return (titleScore + authorScore) / 2
+}
+
+// BestMatch returns the book in books that MatchScore rates closest to b,
+// other than b itself, and its score. It returns nil if none match.
+func BestMatch(b *Book, books []Book) (*Book, float64) {
+	var best *Book
+	var bestScore float64
+	for i := range books {
+		if b.ID != 0 && books[i].ID == b.ID {
+			continue
+		}
+		if score := MatchScore(b, &books[i]); score > bestScore {
+			best, bestScore = &books[i], score
+		}
+	}
+	return best, bestScore
+}
+
+// similarity returns 1 - normalized Levenshtein distance
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// mergeBooks folds src into dst. Fields already set on dst win, except where
+// combining makes more sense (tags, notes, adaptations, progress, dates).
+func mergeBooks(dst, src *Book) {
+	if dst.ISBN == "" {
+		dst.ISBN = src.ISBN
+	}
+	if dst.Format == "" {
+		dst.Format = src.Format
+	}
+	if dst.Publisher == "" {
+		dst.Publisher = src.Publisher
+	}
+	if dst.Description == "" || len(src.Description) > len(dst.Description) {
+		if src.Description != "" {
+			dst.Description = src.Description
+		}
+	}
+	if dst.Genre == "" {
+		dst.Genre = src.Genre
+	}
+	if dst.Series == "" {
+		dst.Series = src.Series
+		dst.SeriesPosition = src.SeriesPosition
+	}
+	if dst.CoverURL == "" && dst.CoverHash == "" {
+		dst.CoverURL = src.CoverURL
+		dst.CoverHash = src.CoverHash
+	}
+	if dst.FilePath == "" {
+		dst.FilePath = src.FilePath
+	}
+	if dst.Rating == 0 {
+		dst.Rating = src.Rating
+	}
+	if src.PageCount > dst.PageCount {
+		dst.PageCount = src.PageCount
+	}
+	if src.CurrentPage > dst.CurrentPage {
+		dst.CurrentPage = src.CurrentPage
+	}
+	if src.TotalMinutes > dst.TotalMinutes {
+		dst.TotalMinutes = src.TotalMinutes
+	}
+	if src.ListenedMinutes > dst.ListenedMinutes {
+		dst.ListenedMinutes = src.ListenedMinutes
+	}
+	if statusRank(src.Status) > statusRank(dst.Status) {
+		dst.Status = src.Status
+	}
+
+	// Keep the earliest add date and the latest read date
+	if !src.DateAdded.IsZero() && (dst.DateAdded.IsZero() || src.DateAdded.Before(dst.DateAdded)) {
+		dst.DateAdded = src.DateAdded
+	}
+	if src.DateRead.After(dst.DateRead) {
+		dst.DateRead = src.DateRead
+	}
+
+	seenTags := make(map[string]bool)
+	for _, t := range dst.Tags {
+		seenTags[strings.ToLower(t)] = true
+	}
+	for _, t := range src.Tags {
+		if !seenTags[strings.ToLower(t)] {
+			dst.Tags = append(dst.Tags, t)
+			seenTags[strings.ToLower(t)] = true
+		}
+	}
+
+	if src.Notes != "" && !strings.Contains(dst.Notes, src.Notes) {
+		if dst.Notes == "" {
+			dst.Notes = src.Notes
+		} else {
+			dst.Notes += "\n\n" + src.Notes
+		}
+	}
+
+	for _, a := range src.Adaptations {
+		if !hasAdaptation(dst.Adaptations, a) {
+			dst.Adaptations = append(dst.Adaptations, a)
+		}
+	}
+}
+
+func hasAdaptation(list []Adaptation, a Adaptation) bool {
+	for _, existing := range list {
+		if a.TMDBID != 0 && existing.TMDBID == a.TMDBID {
+			return true
+		}
+		if existing.Type == a.Type && strings.EqualFold(existing.Title, a.Title) && existing.Year == a.Year {
+			return true
+		}
+	}
+	return false
+}
+
+// statusRank orders statuses by how far along the reader is
+func statusRank(s Status) int {
+	switch s {
+	case StatusPaused:
+		return 1
+	case StatusReading, StatusRereading:
+		return 2
+	case StatusDNF:
+		return 3
+	case StatusRead:
+		return 4
+	}
+	return 0
+}
@@ -0,0 +1,307 @@
+package book
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"The Hobbit", "hobbit"},
+		{"The Hobbit, or There and Back Again", "hobbit"},
+		{"Dune: Deluxe Edition", "dune"},
+		{"Piranesi (Hardcover)", "piranesi"},
+		{"A Wizard of Earthsea", "wizard of earthsea"},
+		{"An Absolutely Remarkable Thing", "absolutely remarkable thing"},
+		{"  Thinking,   Fast and Slow ", "thinking fast and slow"},
+		{"Theory of Everything", "theory of everything"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeTitle(tt.title); got != tt.want {
+			t.Errorf("NormalizeTitle(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeAuthor(t *testing.T) {
+	tests := []struct {
+		author string
+		want   string
+	}{
+		{"J.R.R. Tolkien", "j r r tolkien"},
+		{"J. R. R. Tolkien", "j r r tolkien"},
+		{"Tolkien, J.R.R.", "j r r tolkien"},
+		{"Neil Gaiman & Terry Pratchett", "gaiman neil"},
+		{"Neil Gaiman and Terry Pratchett", "gaiman neil"},
+		{"Neil Gaiman, Terry Pratchett", "gaiman neil"},
+		{"Ursula K. Le Guin", "guin k le ursula"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeAuthor(tt.author); got != tt.want {
+			t.Errorf("NormalizeAuthor(%q) = %q, want %q", tt.author, got, tt.want)
+		}
+	}
+}
+
+func TestTitleKey(t *testing.T) {
+	tests := []struct {
+		a, b [2]string // title, author
+		same bool
+	}{
+		{[2]string{"The Hobbit", "J.R.R. Tolkien"}, [2]string{"Hobbit", "Tolkien, J. R. R."}, true},
+		{[2]string{"Dune", "Frank Herbert"}, [2]string{"DUNE!", "frank herbert"}, true},
+		{[2]string{"Saga, Volume 1", "Brian K. Vaughan"}, [2]string{"Saga, Volume 2", "Brian K. Vaughan"}, false},
+		{[2]string{"The Hobbit", "J.R.R. Tolkien"}, [2]string{"The Hobbit, or There and Back Again", "J.R.R. Tolkien"}, false},
+		{[2]string{"Dune", "Frank Herbert"}, [2]string{"Dune", "Brian Herbert"}, false},
+	}
+	for _, tt := range tests {
+		ka, kb := TitleKey(tt.a[0], tt.a[1]), TitleKey(tt.b[0], tt.b[1])
+		if (ka == kb) != tt.same {
+			t.Errorf("TitleKey(%q, %q) = %q, TitleKey(%q, %q) = %q, want same %v", tt.a[0], tt.a[1], ka, tt.b[0], tt.b[1], kb, tt.same)
+		}
+	}
+}
+
+func TestTitleNumbers(t *testing.T) {
+	tests := []struct {
+		title string
+		want  []int
+	}{
+		{"Saga, Volume 2", []int{2}},
+		{"Saga, Volume II", []int{2}},
+		{"Saga, Volume Two", []int{2}},
+		{"Catch-22", []int{22}},
+		{"I, Robot", nil},
+		{"Dune", nil},
+	}
+	for _, tt := range tests {
+		if got := titleNumbers(tt.title); !slices.Equal(got, tt.want) {
+			t.Errorf("titleNumbers(%q) = %v, want %v", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    Book
+		wantMin float64 // the score must be at least this, or 0 for no match
+		wantMax float64
+	}{
+		{
+			name:    "same title and author",
+			a:       Book{Title: "Dune", Author: "Frank Herbert"},
+			b:       Book{Title: "Dune", Author: "Frank Herbert"},
+			wantMin: 1, wantMax: 1,
+		},
+		{
+			name:    "author written differently",
+			a:       Book{Title: "The Hobbit", Author: "J.R.R. Tolkien"},
+			b:       Book{Title: "Hobbit", Author: "Tolkien, J. R. R."},
+			wantMin: 1, wantMax: 1,
+		},
+		{
+			name:    "subtitle only on one",
+			a:       Book{Title: "Mistborn", Author: "Brandon Sanderson"},
+			b:       Book{Title: "Mistborn: The Final Empire", Author: "Brandon Sanderson"},
+			wantMin: 0.95, wantMax: 0.95,
+		},
+		{
+			name:    "typo in title",
+			a:       Book{Title: "The Silmarillion", Author: "J.R.R. Tolkien"},
+			b:       Book{Title: "The Silmarilion", Author: "J.R.R. Tolkien"},
+			wantMin: 0.9, wantMax: 0.99,
+		},
+		{
+			name: "missing author",
+			a:    Book{Title: "Dune", Author: "Frank Herbert"},
+			b:    Book{Title: "Dune"},
+			// Only the title speaks for the match
+			wantMin: 0.8, wantMax: 0.8,
+		},
+		{
+			name: "different volumes",
+			a:    Book{Title: "Saga, Volume 1", Author: "Brian K. Vaughan"},
+			b:    Book{Title: "Saga, Volume 2", Author: "Brian K. Vaughan"},
+		},
+		{
+			name:    "volume as numeral and digit",
+			a:       Book{Title: "Saga, Volume II", Author: "Brian K. Vaughan"},
+			b:       Book{Title: "Saga, Volume 2", Author: "Brian K. Vaughan"},
+			wantMin: 1, wantMax: 1,
+		},
+		{
+			name: "different series positions",
+			a:    Book{Title: "The Way of Kings", Author: "Brandon Sanderson", SeriesPosition: 1},
+			b:    Book{Title: "The Way of Kings", Author: "Brandon Sanderson", SeriesPosition: 2},
+		},
+		{
+			name:    "series position on one only",
+			a:       Book{Title: "The Way of Kings", Author: "Brandon Sanderson", SeriesPosition: 1},
+			b:       Book{Title: "The Way of Kings", Author: "Brandon Sanderson"},
+			wantMin: 1, wantMax: 1,
+		},
+		{
+			name: "different authors",
+			a:    Book{Title: "Dune", Author: "Frank Herbert"},
+			b:    Book{Title: "Dune", Author: "Brian Herbert"},
+		},
+		{
+			name: "different books by one author",
+			a:    Book{Title: "Stardust", Author: "Neil Gaiman"},
+			b:    Book{Title: "Neverwhere", Author: "Neil Gaiman"},
+		},
+		{
+			name: "empty title",
+			a:    Book{Author: "Neil Gaiman"},
+			b:    Book{Author: "Neil Gaiman"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MatchScore(&tt.a, &tt.b)
+			if got < tt.wantMin || got > tt.wantMax {
+				t.Errorf("MatchScore = %v, want %v-%v", got, tt.wantMin, tt.wantMax)
+			}
+			if back := MatchScore(&tt.b, &tt.a); back != got {
+				t.Errorf("MatchScore is not symmetric: %v one way, %v the other", got, back)
+			}
+		})
+	}
+}
+
+func TestBestMatch(t *testing.T) {
+	books := []Book{
+		{ID: 1, Title: "Saga, Volume 1", Author: "Brian K. Vaughan"},
+		{ID: 2, Title: "Saga, Volume 2", Author: "Brian K. Vaughan"},
+		{ID: 3, Title: "Mistborn: The Final Empire", Author: "Brandon Sanderson"},
+		{ID: 4, Title: "Mistborn", Author: "Brandon Sanderson"},
+	}
+	tests := []struct {
+		name   string
+		b      Book
+		wantID int64 // 0 for no match
+	}{
+		{"exact", Book{Title: "Saga, Volume 2", Author: "Brian K. Vaughan"}, 2},
+		{"numeral", Book{Title: "Saga, Volume II", Author: "Brian K. Vaughan"}, 2},
+		{"closest wins", Book{Title: "Mistborn", Author: "Brandon Sanderson"}, 4},
+		{"skips itself", Book{ID: 4, Title: "Mistborn", Author: "Brandon Sanderson"}, 3},
+		{"no match", Book{Title: "Saga, Volume 3", Author: "Brian K. Vaughan"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, score := BestMatch(&tt.b, books)
+			var gotID int64
+			if got != nil {
+				gotID = got.ID
+			}
+			if gotID != tt.wantID {
+				t.Errorf("BestMatch = %d (score %v), want %d", gotID, score, tt.wantID)
+			}
+			if (got == nil) != (score == 0) {
+				t.Errorf("BestMatch score = %v for match %v", score, got)
+			}
+		})
+	}
+}
+
+func TestMergeBooks(t *testing.T) {
+	added := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := added.AddDate(1, 0, 0)
+
+	tests := []struct {
+		name     string
+		dst, src Book
+		check    func(t *testing.T, b *Book)
+	}{
+		{
+			name: "fills blanks",
+			dst:  Book{Title: "Dune"},
+			src:  Book{ISBN: "9780441172719", Genre: "SF", Publisher: "Ace", Rating: 4.5},
+			check: func(t *testing.T, b *Book) {
+				if b.ISBN != "9780441172719" || b.Genre != "SF" || b.Publisher != "Ace" || b.Rating != 4.5 {
+					t.Errorf("blanks not filled: %+v", b)
+				}
+			},
+		},
+		{
+			name: "keeps what's set",
+			dst:  Book{ISBN: "1", Rating: 3, Series: "Dune", SeriesPosition: 1},
+			src:  Book{ISBN: "2", Rating: 5, Series: "Other", SeriesPosition: 4},
+			check: func(t *testing.T, b *Book) {
+				if b.ISBN != "1" || b.Rating != 3 || b.Series != "Dune" || b.SeriesPosition != 1 {
+					t.Errorf("set fields overwritten: %+v", b)
+				}
+			},
+		},
+		{
+			name: "furthest progress and status",
+			dst:  Book{PageCount: 400, CurrentPage: 120, Status: StatusReading},
+			src:  Book{PageCount: 412, CurrentPage: 80, Status: StatusRead},
+			check: func(t *testing.T, b *Book) {
+				if b.PageCount != 412 || b.CurrentPage != 120 || b.Status != StatusRead {
+					t.Errorf("got pages %d/%d, status %s", b.CurrentPage, b.PageCount, b.Status)
+				}
+			},
+		},
+		{
+			name: "earliest added, latest read",
+			dst:  Book{DateAdded: later, DateRead: added},
+			src:  Book{DateAdded: added, DateRead: later},
+			check: func(t *testing.T, b *Book) {
+				if !b.DateAdded.Equal(added) || !b.DateRead.Equal(later) {
+					t.Errorf("got added %v, read %v", b.DateAdded, b.DateRead)
+				}
+			},
+		},
+		{
+			name: "combines tags and notes",
+			dst:  Book{Tags: []string{"SF", "Classics"}, Notes: "Reread in 2020"},
+			src:  Book{Tags: []string{"sf", "Desert"}, Notes: "Loaned to Sam"},
+			check: func(t *testing.T, b *Book) {
+				if !slices.Equal(b.Tags, []string{"SF", "Classics", "Desert"}) {
+					t.Errorf("tags = %v", b.Tags)
+				}
+				if b.Notes != "Reread in 2020\n\nLoaned to Sam" {
+					t.Errorf("notes = %q", b.Notes)
+				}
+			},
+		},
+		{
+			name: "doesn't repeat notes",
+			dst:  Book{Notes: "Loaned to Sam. Reread in 2020"},
+			src:  Book{Notes: "Loaned to Sam"},
+			check: func(t *testing.T, b *Book) {
+				if b.Notes != "Loaned to Sam. Reread in 2020" {
+					t.Errorf("notes = %q", b.Notes)
+				}
+			},
+		},
+		{
+			name: "adaptations by TMDB ID or title",
+			dst:  Book{Adaptations: []Adaptation{{Title: "Dune", Type: "movie", Year: 2021, TMDBID: 438631}}},
+			src: Book{Adaptations: []Adaptation{
+				{Title: "Dune: Part One", Type: "movie", Year: 2021, TMDBID: 438631},
+				{Title: "dune", Type: "movie", Year: 2021},
+				{Title: "Dune", Type: "movie", Year: 1984},
+			}},
+			check: func(t *testing.T, b *Book) {
+				if len(b.Adaptations) != 2 || b.Adaptations[1].Year != 1984 {
+					t.Errorf("adaptations = %+v", b.Adaptations)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mergeBooks(&tt.dst, &tt.src)
+			tt.check(t, &tt.dst)
+		})
+	}
+}
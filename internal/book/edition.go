@@ -0,0 +1,248 @@
+package book
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Edition is one published form of a book: the hardcover, the paperback,
+// the ebook or the audiobook
+type Edition struct {
+	ID           int64     `json:"id"`
+	BookID       int64     `json:"book_id"`
+	ISBN         string    `json:"isbn,omitempty"`
+	Format       Format    `json:"format,omitempty"`
+	Publisher    string    `json:"publisher,omitempty"`
+	PageCount    int       `json:"page_count,omitempty"`
+	TotalMinutes int       `json:"total_minutes,omitempty"` // audiobook length
+	CoverURL     string    `json:"cover_url,omitempty"`
+	CoverHash    string    `json:"cover_hash,omitempty"`
+	DateAdded    time.Time `json:"date_added"`
+}
+
+// Label describes the edition in a few words, e.g. "Physical, Tor, 592
+// pages" or "Audiobook, Macmillan Audio, 21h 08m"
+func (e Edition) Label() string {
+	var parts []string
+	if e.Format != "" {
+		parts = append(parts, e.Format.Label())
+	}
+	if e.Publisher != "" {
+		parts = append(parts, e.Publisher)
+	}
+	if e.Format == FormatAudiobook && e.TotalMinutes > 0 {
+		parts = append(parts, fmt.Sprintf("%dh %02dm", e.TotalMinutes/60, e.TotalMinutes%60))
+	} else if e.PageCount > 0 {
+		parts = append(parts, fmt.Sprintf("%d pages", e.PageCount))
+	}
+	if len(parts) == 0 {
+		if e.ISBN != "" {
+			return "ISBN " + e.ISBN
+		}
+		return "Unknown edition"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (e *Edition) isEmpty() bool {
+	return e.ISBN == "" && e.Format == "" && e.Publisher == "" && e.PageCount == 0 && e.TotalMinutes == 0 && e.CoverURL == "" && e.CoverHash == ""
+}
+
+// Edition returns the edition the book is being read in. The repository
+// keeps these details only on the edition and saves it with the book.
+func (b *Book) Edition() Edition {
+	return Edition{
+		ID:           b.EditionID,
+		BookID:       b.ID,
+		ISBN:         b.ISBN,
+		Format:       b.Format,
+		Publisher:    b.Publisher,
+		PageCount:    b.PageCount,
+		TotalMinutes: b.TotalMinutes,
+		CoverURL:     b.CoverURL,
+		CoverHash:    b.CoverHash,
+		DateAdded:    b.DateAdded,
+	}
+}
+
+// useEdition makes e the edition the book is read in. Progress is moved to
+// the same place in the new edition when both lengths are known, from pages
+// to minutes listened if need be.
+func (b *Book) useEdition(e *Edition) {
+	done, total := b.Position()
+	b.setEdition(e)
+	if done > 0 {
+		b.setPosition(done, total)
+	}
+}
+
+// setEdition copies an edition's details to the book
+func (b *Book) setEdition(e *Edition) {
+	b.EditionID = e.ID
+	b.ISBN = e.ISBN
+	b.Format = e.Format
+	b.Publisher = e.Publisher
+	b.PageCount = e.PageCount
+	b.TotalMinutes = e.TotalMinutes
+	b.CoverURL = e.CoverURL
+	b.CoverHash = e.CoverHash
+}
+
+// Editions returns a book's editions, oldest first
+func (s *Service) Editions(ctx context.Context, bookID int64) ([]Edition, error) {
+	return s.repo.GetEditions(ctx, bookID)
+}
+
+// AddEdition adds another edition of a book, e.g. the audiobook of a book
+// already owned in hardcover. The book keeps being read in its current
+// edition; see UseEdition.
+func (s *Service) AddEdition(ctx context.Context, bookID int64, e *Edition) error {
+	e.ISBN = strings.TrimSpace(e.ISBN)
+	e.Publisher = strings.TrimSpace(e.Publisher)
+	if e.Format != "" && !e.Format.IsValid() {
+		return fmt.Errorf("invalid format: %s", e.Format)
+	}
+	if e.isEmpty() {
+		return fmt.Errorf("an edition needs an ISBN, format, publisher, length or cover")
+	}
+	if e.PageCount < 0 || e.TotalMinutes < 0 {
+		return fmt.Errorf("length can't be negative")
+	}
+	if _, err := s.repo.GetByID(ctx, bookID); err != nil {
+		return fmt.Errorf("get book: %w", err)
+	}
+
+	if e.ISBN != "" {
+		existing, err := s.repo.FindByISBN(ctx, e.ISBN)
+		if err != nil {
+			return fmt.Errorf("check ISBN: %w", err)
+		}
+		if existing != nil && existing.ID != bookID {
+			return fmt.Errorf("ISBN %s is already an edition of %s (ID: %d)", e.ISBN, existing.Title, existing.ID)
+		}
+		if existing != nil {
+			return fmt.Errorf("the book already has an edition with ISBN %s", e.ISBN)
+		}
+	}
+
+	e.ID = 0
+	e.BookID = bookID
+	if e.DateAdded.IsZero() {
+		e.DateAdded = time.Now()
+	}
+	if err := s.repo.CreateEdition(ctx, e); err != nil {
+		return fmt.Errorf("create edition: %w", err)
+	}
+	return nil
+}
+
+// AddEditions saves editions to a book, skipping any it already has (same
+// ISBN, or same format and publisher when there's no ISBN), e.g. when
+// restoring a backup. It returns how many were added.
+func (s *Service) AddEditions(ctx context.Context, bookID int64, list []Edition) (int, error) {
+	existing, err := s.repo.GetEditions(ctx, bookID)
+	if err != nil {
+		return 0, fmt.Errorf("get editions: %w", err)
+	}
+
+	added := 0
+	for _, e := range list {
+		dup := e.isEmpty()
+		for i := range existing {
+			if sameEdition(&existing[i], &e) {
+				dup = true
+				break
+			}
+		}
+		if dup {
+			continue
+		}
+		e.ID = 0
+		e.BookID = bookID
+		if err := s.repo.CreateEdition(ctx, &e); err != nil {
+			return added, fmt.Errorf("create edition: %w", err)
+		}
+		existing = append(existing, e)
+		added++
+	}
+	return added, nil
+}
+
+func sameEdition(a, b *Edition) bool {
+	if a.ISBN != "" || b.ISBN != "" {
+		return a.ISBN == b.ISBN
+	}
+	return a.Format == b.Format && a.Publisher == b.Publisher
+}
+
+// UseEdition switches the edition a book is read in. Progress carries
+// over to the same place in the new edition.
+func (s *Service) UseEdition(ctx context.Context, bookID, editionID int64) (*Book, error) {
+	b, err := s.repo.GetByID(ctx, bookID)
+	if err != nil {
+		return nil, fmt.Errorf("get book: %w", err)
+	}
+	e, err := s.repo.GetEdition(ctx, editionID)
+	if err != nil || e.BookID != bookID {
+		return nil, fmt.Errorf("book %d has no edition %d", bookID, editionID)
+	}
+	if b.EditionID == e.ID {
+		return b, nil
+	}
+
+	b.useEdition(e)
+	// The embedding doesn't depend on the edition, so it's left alone
+	if err := s.repo.Update(ctx, b); err != nil {
+		return nil, fmt.Errorf("update book: %w", err)
+	}
+	return b, nil
+}
+
+// RemoveEdition deletes one of a book's editions other than the one it's
+// being read in
+func (s *Service) RemoveEdition(ctx context.Context, bookID, editionID int64) error {
+	b, err := s.repo.GetByID(ctx, bookID)
+	if err != nil {
+		return fmt.Errorf("get book: %w", err)
+	}
+	e, err := s.repo.GetEdition(ctx, editionID)
+	if err != nil || e.BookID != bookID {
+		return fmt.Errorf("book %d has no edition %d", bookID, editionID)
+	}
+	if b.EditionID == e.ID {
+		return fmt.Errorf("can't remove the edition the book is read in; switch to another first")
+	}
+	return s.repo.DeleteEdition(ctx, editionID)
+}
+
+// dedupeEditions drops the editions of a book that say nothing or repeat
+// the ISBN of an edition before them, keeping the current one. Merging two
+// books can leave such copies behind.
+func (s *Service) dedupeEditions(ctx context.Context, b *Book) error {
+	editions, err := s.repo.GetEditions(ctx, b.ID)
+	if err != nil {
+		return fmt.Errorf("get editions: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	if b.ISBN != "" {
+		seen[b.ISBN] = true
+	}
+	for _, e := range editions {
+		if e.ID == b.EditionID {
+			continue
+		}
+		if e.isEmpty() || (e.ISBN != "" && seen[e.ISBN]) {
+			if err := s.repo.DeleteEdition(ctx, e.ID); err != nil {
+				return fmt.Errorf("delete edition: %w", err)
+			}
+			continue
+		}
+		if e.ISBN != "" {
+			seen[e.ISBN] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package book
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is how a book is read: on paper, as an ebook or listened to
+type Format string
+
+const (
+	FormatPhysical  Format = "physical"
+	FormatEbook     Format = "ebook"
+	FormatAudiobook Format = "audiobook"
+)
+
+// Formats lists every valid format
+var Formats = []Format{FormatPhysical, FormatEbook, FormatAudiobook}
+
+func (f Format) String() string {
+	return string(f)
+}
+
+func (f Format) IsValid() bool {
+	switch f {
+	case FormatPhysical, FormatEbook, FormatAudiobook:
+		return true
+	}
+	return false
+}
+
+// Label is the format as shown to people, e.g. "Audiobook"
+func (f Format) Label() string {
+	switch f {
+	case FormatPhysical:
+		return "Physical"
+	case FormatEbook:
+		return "Ebook"
+	case FormatAudiobook:
+		return "Audiobook"
+	}
+	return string(f)
+}
+
+// ParseFormat maps the many ways a format is written by sites and exports
+// ("Hardcover", "Kindle Edition", "Audio CD", ...) to a Format. An empty
+// string is the unknown format.
+func ParseFormat(s string) (Format, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return "", true
+	}
+	if f := Format(s); f.IsValid() {
+		return f, true
+	}
+	for _, w := range []string{"audio", "audible", "mp3", "listen"} {
+		if strings.Contains(s, w) {
+			return FormatAudiobook, true
+		}
+	}
+	for _, w := range []string{"ebook", "e-book", "kindle", "epub", "pdf", "digital", "nook", "kobo"} {
+		if strings.Contains(s, w) {
+			return FormatEbook, true
+		}
+	}
+	for _, w := range []string{"hardcover", "hardback", "paperback", "softcover", "mass market", "print", "paper", "board", "library binding", "leather", "spiral"} {
+		if strings.Contains(s, w) {
+			return FormatPhysical, true
+		}
+	}
+	return "", false
+}
+
+// IsAudiobook reports whether the book is listened to, so its progress is
+// kept in minutes rather than pages
+func (b *Book) IsAudiobook() bool {
+	return b.Format == FormatAudiobook
+}
+
+// HasLength reports whether the book's length is known, in pages or, for an
+// audiobook, in minutes
+func (b *Book) HasLength() bool {
+	if b.IsAudiobook() {
+		return b.TotalMinutes > 0
+	}
+	return b.PageCount > 0
+}
+
+// Position returns how far through the book the reader is and its length,
+// in pages or, for an audiobook, in minutes
+func (b *Book) Position() (done, total int) {
+	if b.IsAudiobook() {
+		return b.ListenedMinutes, b.TotalMinutes
+	}
+	return b.CurrentPage, b.PageCount
+}
+
+// PercentAt is the position done, in the units of Position, as a percentage
+// of the book's length, or 0 if the length isn't known
+func (b *Book) PercentAt(done int) float64 {
+	_, total := b.Position()
+	if total <= 0 {
+		return 0
+	}
+	return float64(min(max(done, 0), total)) * 100 / float64(total)
+}
+
+// setPosition moves the reader to the point done of total in another
+// edition's units, when both lengths are known
+func (b *Book) setPosition(done, total int) {
+	mine := &b.CurrentPage
+	length := b.PageCount
+	if b.IsAudiobook() {
+		mine, length = &b.ListenedMinutes, b.TotalMinutes
+	}
+	if total > 0 && length > 0 {
+		*mine = int(math.Round(float64(done) * float64(length) / float64(total)))
+	}
+}
+
+// ProgressLabel describes how far through the book the reader is, e.g.
+// "Page 120 of 400" or "5:20 of 12:34 listened"
+func (b *Book) ProgressLabel() string {
+	if b.IsAudiobook() {
+		if b.TotalMinutes == 0 {
+			return FormatMinutes(b.ListenedMinutes) + " listened"
+		}
+		return fmt.Sprintf("%s of %s listened", FormatMinutes(b.ListenedMinutes), FormatMinutes(b.TotalMinutes))
+	}
+	return fmt.Sprintf("Page %d of %d", b.CurrentPage, b.PageCount)
+}
+
+// FormatMinutes writes a duration in minutes as hours and minutes, e.g.
+// "12:05"
+func FormatMinutes(m int) string {
+	return fmt.Sprintf("%d:%02d", m/60, m%60)
+}
+
+// ParseMinutes reads a duration as hours and minutes ("12:05"), a Go
+// duration ("12h5m") or plain minutes ("725")
+func ParseMinutes(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if h, m, ok := strings.Cut(s, ":"); ok {
+		hours, err1 := strconv.Atoi(h)
+		mins, err2 := strconv.Atoi(m)
+		if err1 != nil || err2 != nil || hours < 0 || mins < 0 || mins >= 60 {
+			return 0, fmt.Errorf("invalid duration %q: want hours:minutes, e.g. 12:05", s)
+		}
+		return hours*60 + mins, nil
+	}
+	if m, err := strconv.Atoi(s); err == nil && m >= 0 {
+		return m, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q: want hours:minutes, e.g. 12:05", s)
+	}
+	return int(d.Round(time.Minute).Minutes()), nil
+}
@@ -0,0 +1,233 @@
+package book
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// GoalKind is what a reading goal counts
+type GoalKind string
+
+const (
+	GoalBooks      GoalKind = "books"       // finished reads
+	GoalPages      GoalKind = "pages"       // pages of finished reads, audiobooks aside
+	GoalGenres     GoalKind = "genres"      // different genres read
+	GoalNewAuthors GoalKind = "new_authors" // authors read for the first time
+)
+
+// GoalKinds lists every goal kind
+var GoalKinds = []GoalKind{GoalBooks, GoalPages, GoalGenres, GoalNewAuthors}
+
+func (k GoalKind) IsValid() bool {
+	switch k {
+	case GoalBooks, GoalPages, GoalGenres, GoalNewAuthors:
+		return true
+	}
+	return false
+}
+
+// Label is the kind as shown to people, e.g. "new authors"
+func (k GoalKind) Label() string {
+	return strings.ReplaceAll(string(k), "_", " ")
+}
+
+// Goal is a target for a year, or for one month of it
+type Goal struct {
+	ID     int64    `json:"id"`
+	Kind   GoalKind `json:"kind"`
+	Year   int      `json:"year"`
+	Month  int      `json:"month,omitempty"` // 1-12, or 0 for the whole year
+	Target int      `json:"target"`
+}
+
+// Period is the goal's year, or year and month, e.g. "2024" or "2024-03"
+func (g *Goal) Period() string {
+	if g.Month == 0 {
+		return fmt.Sprintf("%d", g.Year)
+	}
+	return fmt.Sprintf("%d-%02d", g.Year, g.Month)
+}
+
+// Bounds returns the start of the goal's period and the start of the next
+func (g *Goal) Bounds() (time.Time, time.Time) {
+	if g.Month == 0 {
+		start := time.Date(g.Year, 1, 1, 0, 0, 0, 0, time.Local)
+		return start, start.AddDate(1, 0, 0)
+	}
+	start := time.Date(g.Year, time.Month(g.Month), 1, 0, 0, 0, 0, time.Local)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// Covers reports whether t falls in the goal's period
+func (g *Goal) Covers(t time.Time) bool {
+	start, end := g.Bounds()
+	return !t.Before(start) && t.Before(end)
+}
+
+// GoalProgress is how far along a goal is, and where its pace leads
+type GoalProgress struct {
+	Goal
+	Done      int
+	Elapsed   float64 // share of the period gone, 0-1
+	Expected  float64 // where an even pace towards the target would be by now
+	Projected int     // where the current pace ends up by the end of the period
+}
+
+// Percent is Done as a percentage of the target, at most 100
+func (p GoalProgress) Percent() int {
+	if p.Target <= 0 {
+		return 0
+	}
+	return min(100, p.Done*100/p.Target)
+}
+
+// Ahead is how far Done is ahead of an even pace; negative when behind
+func (p GoalProgress) Ahead() int {
+	return p.Done - int(math.Round(p.Expected))
+}
+
+// Behind is how far Done is behind an even pace, or 0
+func (p GoalProgress) Behind() int {
+	return max(0, -p.Ahead())
+}
+
+// Left is how much of the target is still to go
+func (p GoalProgress) Left() int {
+	return max(0, p.Target-p.Done)
+}
+
+// ExpectedPercent is where an even pace would be by now, as a percentage of
+// the target
+func (p GoalProgress) ExpectedPercent() int {
+	return int(math.Round(p.Elapsed * 100))
+}
+
+func (p GoalProgress) Met() bool {
+	return p.Done >= p.Target
+}
+
+// ProgressOf measures g against the finished reads in reads, oldest first,
+// of the given books. Books count once per read, so re-reads count again;
+// pages use the books' page counts.
+func ProgressOf(g Goal, books map[int64]Book, reads []ReadThrough, now time.Time) GoalProgress {
+	start, end := g.Bounds()
+	p := GoalProgress{Goal: g}
+
+	genres := make(map[string]bool)
+	authorFirstRead := make(map[string]time.Time)
+	for _, rt := range reads {
+		if rt.Status != StatusRead || rt.Finished.IsZero() {
+			continue
+		}
+		b, ok := books[rt.BookID]
+		if !ok {
+			continue
+		}
+		for _, name := range b.AuthorNames() {
+			author := authorKey(name)
+			if first, seen := authorFirstRead[author]; !seen || rt.Finished.Before(first) {
+				authorFirstRead[author] = rt.Finished
+			}
+		}
+		if rt.Finished.Before(start) || !rt.Finished.Before(end) {
+			continue
+		}
+		switch g.Kind {
+		case GoalBooks:
+			p.Done++
+		case GoalPages:
+			if !b.IsAudiobook() {
+				p.Done += b.PageCount
+			}
+		case GoalGenres:
+			if genre := strings.ToLower(strings.TrimSpace(b.Genre)); genre != "" && !genres[genre] {
+				genres[genre] = true
+				p.Done++
+			}
+		}
+	}
+	if g.Kind == GoalNewAuthors {
+		for _, first := range authorFirstRead {
+			if !first.Before(start) && first.Before(end) {
+				p.Done++
+			}
+		}
+	}
+
+	switch {
+	case now.Before(start):
+		p.Elapsed = 0
+	case !now.Before(end):
+		p.Elapsed = 1
+	default:
+		p.Elapsed = float64(now.Sub(start)) / float64(end.Sub(start))
+	}
+	p.Expected = float64(g.Target) * p.Elapsed
+	p.Projected = p.Done
+	if p.Elapsed > 0 && p.Elapsed < 1 {
+		p.Projected = int(math.Round(float64(p.Done) / p.Elapsed))
+	}
+	return p
+}
+
+// Goals returns the goals set for a year, monthly ones included
+func (s *Service) Goals(ctx context.Context, year int) ([]Goal, error) {
+	return s.repo.GetGoals(ctx, year)
+}
+
+// AllGoals returns every goal, e.g. for a backup
+func (s *Service) AllGoals(ctx context.Context) ([]Goal, error) {
+	return s.repo.GetAllGoals(ctx)
+}
+
+// SetGoal sets the target for a kind of goal in a year or month, replacing
+// any target set before. A target of 0 removes the goal.
+func (s *Service) SetGoal(ctx context.Context, g *Goal) error {
+	if !g.Kind.IsValid() {
+		return fmt.Errorf("invalid goal kind: %s", g.Kind)
+	}
+	if g.Month < 0 || g.Month > 12 {
+		return fmt.Errorf("invalid month: %d", g.Month)
+	}
+	if g.Target < 0 {
+		return fmt.Errorf("goal target can't be negative")
+	}
+	if g.Target == 0 {
+		return s.repo.DeleteGoal(ctx, g.Kind, g.Year, g.Month)
+	}
+	return s.repo.SetGoal(ctx, g)
+}
+
+// GoalProgress measures the goals set for a year against the reads
+// finished so far
+func (s *Service) GoalProgress(ctx context.Context, year int, now time.Time) ([]GoalProgress, error) {
+	goals, err := s.repo.GetGoals(ctx, year)
+	if err != nil {
+		return nil, fmt.Errorf("get goals: %w", err)
+	}
+	if len(goals) == 0 {
+		return nil, nil
+	}
+
+	all, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list books: %w", err)
+	}
+	books := make(map[int64]Book, len(all))
+	for _, b := range all {
+		books[b.ID] = b
+	}
+	reads, err := s.repo.GetAllReadThroughs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get read-throughs: %w", err)
+	}
+
+	progress := make([]GoalProgress, len(goals))
+	for i, g := range goals {
+		progress[i] = ProgressOf(g, books, reads, now)
+	}
+	return progress, nil
+}
@@ -0,0 +1,229 @@
+package book
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Quote is a highlighted passage from a book, optionally with the reader's
+// note on it. A note made without a highlight has an empty Text.
+type Quote struct {
+	ID        int64     `json:"id"`
+	BookID    int64     `json:"book_id"`
+	Text      string    `json:"text"`
+	Note      string    `json:"note,omitempty"`
+	Location  string    `json:"location,omitempty"` // e.g. a Kindle location range "1021-1024"
+	Page      int       `json:"page,omitempty"`
+	Chapter   string    `json:"chapter,omitempty"`
+	Source    string    `json:"source,omitempty"` // where it came from, e.g. "kindle"
+	DateAdded time.Time `json:"date_added"`       // when it was highlighted
+	Embedding []float32 `json:"-"`                // semantic embedding of the text and note
+}
+
+// QuoteSearchResult is a quote matched by semantic search, with its book
+type QuoteSearchResult struct {
+	Quote      Quote   `json:"quote"`
+	Book       Book    `json:"book"`
+	Similarity float32 `json:"similarity"`
+}
+
+// SameQuote reports whether a and b are the same passage: the same text,
+// allowing for whitespace and case differences, at the same place in the
+// book. One quote extending the other (re-highlighting a longer span keeps
+// both on most devices) counts only when their locations overlap, so a short
+// highlight that happens to appear inside a longer one is kept.
+func SameQuote(a, b *Quote) bool {
+	ta, tb := quoteKey(a.Text), quoteKey(b.Text)
+	if ta == "" || tb == "" {
+		return ta == tb && quoteKey(a.Note) == quoteKey(b.Note) && a.Location == b.Location
+	}
+	if ta == tb {
+		return samePlace(a, b)
+	}
+	return (strings.Contains(ta, tb) || strings.Contains(tb, ta)) && overlap(a, b)
+}
+
+// samePlace reports whether a and b may be at the same place in the book:
+// their locations overlap and their pages agree, where both are known
+func samePlace(a, b *Quote) bool {
+	_, _, okA := LocationRange(a.Location)
+	_, _, okB := LocationRange(b.Location)
+	if okA && okB && !overlap(a, b) {
+		return false
+	}
+	return a.Page == 0 || b.Page == 0 || a.Page == b.Page
+}
+
+// overlap reports whether a and b both have locations, and they overlap
+func overlap(a, b *Quote) bool {
+	startA, endA, okA := LocationRange(a.Location)
+	startB, endB, okB := LocationRange(b.Location)
+	return okA && okB && startA <= endB && startB <= endA
+}
+
+// LocationRange parses a location such as "1021-1024" or "1021"
+func LocationRange(s string) (int, int, bool) {
+	startStr, endStr, isRange := strings.Cut(s, "-")
+	start, err := strconv.Atoi(strings.TrimSpace(startStr))
+	if err != nil {
+		return 0, 0, false
+	}
+	if !isRange {
+		return start, start, true
+	}
+	end, err := strconv.Atoi(strings.TrimSpace(endStr))
+	if err != nil || end < start {
+		return start, start, true
+	}
+	return start, end, true
+}
+
+func quoteKey(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// Quotes returns a book's quotes in reading order
+func (s *Service) Quotes(ctx context.Context, bookID int64) ([]Quote, error) {
+	return s.repo.GetQuotes(ctx, bookID)
+}
+
+// AllQuotes returns every quote, most recently added first
+func (s *Service) AllQuotes(ctx context.Context) ([]Quote, error) {
+	return s.repo.GetAllQuotes(ctx)
+}
+
+func (s *Service) GetQuote(ctx context.Context, id int64) (*Quote, error) {
+	return s.repo.GetQuote(ctx, id)
+}
+
+// AddQuote saves a single quote to a book and embeds it
+func (s *Service) AddQuote(ctx context.Context, q *Quote) error {
+	if strings.TrimSpace(q.Text) == "" && strings.TrimSpace(q.Note) == "" {
+		return fmt.Errorf("quote text is required")
+	}
+	if _, err := s.repo.GetByID(ctx, q.BookID); err != nil {
+		return fmt.Errorf("book %d not found", q.BookID)
+	}
+	if q.DateAdded.IsZero() {
+		q.DateAdded = time.Now()
+	}
+
+	if err := s.repo.CreateQuote(ctx, q); err != nil {
+		return fmt.Errorf("create quote: %w", err)
+	}
+	return s.embedQuote(ctx, q)
+}
+
+// UpdateQuote saves changes to a quote and re-embeds it
+func (s *Service) UpdateQuote(ctx context.Context, q *Quote) error {
+	if err := s.repo.UpdateQuote(ctx, q); err != nil {
+		return fmt.Errorf("update quote: %w", err)
+	}
+	return s.embedQuote(ctx, q)
+}
+
+func (s *Service) DeleteQuote(ctx context.Context, id int64) error {
+	return s.repo.DeleteQuote(ctx, id)
+}
+
+// EmbedMissingQuotes embeds quotes saved without an embedding, e.g. while
+// the embedding service was unavailable during an import. It returns how
+// many were embedded.
+func (s *Service) EmbedMissingQuotes(ctx context.Context) (int, error) {
+	quotes, err := s.repo.GetQuotesWithoutEmbedding(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("get quotes: %w", err)
+	}
+	for i := range quotes {
+		if err := s.embedQuote(ctx, &quotes[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(quotes), nil
+}
+
+func (s *Service) embedQuote(ctx context.Context, q *Quote) error {
+	embedding, err := s.embedder.Generate(ctx, quoteEmbeddingText(q))
+	if err != nil {
+		return fmt.Errorf("generate embedding: %w", err)
+	}
+	if err := s.repo.UpdateQuoteEmbedding(ctx, q.ID, embedding); err != nil {
+		return fmt.Errorf("update embedding: %w", err)
+	}
+	q.Embedding = embedding
+	return nil
+}
+
+// quoteEmbeddingText is the passage and the reader's note on it; the book
+// is left out so searches find passages by what they say
+func quoteEmbeddingText(q *Quote) string {
+	text := strings.TrimSpace(q.Text)
+	if q.Note != "" {
+		if text != "" {
+			text += ". "
+		}
+		text += "Note: " + strings.TrimSpace(q.Note)
+	}
+	return text
+}
+
+// AddQuotes saves quotes to a book, skipping any it already has (see
+// SameQuote). When a new quote extends a saved one, the saved one is
+// replaced. It returns how many quotes were added. Quotes that can't be
+// embedded are saved anyway and embedded later by EmbedMissingQuotes.
+func (s *Service) AddQuotes(ctx context.Context, bookID int64, quotes []Quote) (int, error) {
+	existing, err := s.repo.GetQuotes(ctx, bookID)
+	if err != nil {
+		return 0, fmt.Errorf("get quotes: %w", err)
+	}
+
+	added := 0
+	for i := range quotes {
+		q := quotes[i]
+		q.ID = 0
+		q.BookID = bookID
+		if q.DateAdded.IsZero() {
+			q.DateAdded = time.Now()
+		}
+
+		dup := -1
+		for j := range existing {
+			if SameQuote(&existing[j], &q) {
+				dup = j
+				break
+			}
+		}
+		if dup >= 0 {
+			old := &existing[dup]
+			if len(q.Text) <= len(old.Text) && (q.Note == "" || q.Note == old.Note) {
+				continue
+			}
+			// Keep the longer passage and any note
+			if len(q.Text) < len(old.Text) {
+				q.Text = old.Text
+			}
+			if q.Note == "" {
+				q.Note = old.Note
+			}
+			q.ID = old.ID
+			if err := s.repo.UpdateQuote(ctx, &q); err != nil {
+				return added, fmt.Errorf("update quote: %w", err)
+			}
+			s.embedQuote(ctx, &q)
+			*old = q
+			continue
+		}
+
+		if err := s.repo.CreateQuote(ctx, &q); err != nil {
+			return added, fmt.Errorf("create quote: %w", err)
+		}
+		s.embedQuote(ctx, &q)
+		existing = append(existing, q)
+		added++
+	}
+
+	return added, nil
+}
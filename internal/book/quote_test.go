@@ -0,0 +1,102 @@
+package book
+
+import "testing"
+
+func TestSameQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Quote
+		want bool
+	}{
+		{
+			name: "same text and place",
+			a:    Quote{Text: "I must not fear.", Location: "170-171"},
+			b:    Quote{Text: "i must  not\nfear.", Location: "170-171"},
+			want: true,
+		},
+		{
+			name: "same text, no locations",
+			a:    Quote{Text: "I must not fear."},
+			b:    Quote{Text: "I must not fear."},
+			want: true,
+		},
+		{
+			name: "same text, one location",
+			a:    Quote{Text: "I must not fear.", Location: "170"},
+			b:    Quote{Text: "I must not fear."},
+			want: true,
+		},
+		{
+			name: "same text elsewhere",
+			a:    Quote{Text: "Fear is the mind-killer.", Location: "170-171"},
+			b:    Quote{Text: "Fear is the mind-killer.", Location: "4100-4101"},
+		},
+		{
+			name: "same text on other pages",
+			a:    Quote{Text: "Fear is the mind-killer.", Page: 12},
+			b:    Quote{Text: "Fear is the mind-killer.", Page: 240},
+		},
+		{
+			name: "extended over the same place",
+			a:    Quote{Text: "I must not fear.", Location: "170"},
+			b:    Quote{Text: "I must not fear. Fear is the mind-killer.", Location: "170-171"},
+			want: true,
+		},
+		{
+			name: "contained, without locations",
+			a:    Quote{Text: "fear"},
+			b:    Quote{Text: "I must not fear."},
+		},
+		{
+			name: "contained elsewhere",
+			a:    Quote{Text: "the mind-killer", Location: "900"},
+			b:    Quote{Text: "Fear is the mind-killer.", Location: "170-171"},
+		},
+		{
+			name: "notes without text",
+			a:    Quote{Note: "Reread this", Location: "300"},
+			b:    Quote{Note: "reread  this", Location: "300"},
+			want: true,
+		},
+		{
+			name: "notes at other locations",
+			a:    Quote{Note: "Reread this", Location: "300"},
+			b:    Quote{Note: "Reread this", Location: "301"},
+		},
+		{
+			name: "note and highlight",
+			a:    Quote{Note: "Reread this", Location: "300"},
+			b:    Quote{Text: "Reread this", Location: "300"},
+		},
+	}
+	for _, tt := range tests {
+		if got := SameQuote(&tt.a, &tt.b); got != tt.want {
+			t.Errorf("%s: SameQuote = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := SameQuote(&tt.b, &tt.a); got != tt.want {
+			t.Errorf("%s: SameQuote reversed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLocationRange(t *testing.T) {
+	tests := []struct {
+		in         string
+		start, end int
+		ok         bool
+	}{
+		{"1021-1024", 1021, 1024, true},
+		{"1021", 1021, 1021, true},
+		{" 12 - 15 ", 12, 15, true},
+		{"15-12", 15, 15, true},
+		{"15-", 15, 15, true},
+		{"", 0, 0, false},
+		{"ch. 3", 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, end, ok := LocationRange(tt.in)
+		if start != tt.start || end != tt.end || ok != tt.ok {
+			t.Errorf("LocationRange(%q) = %d, %d, %v; want %d, %d, %v", tt.in, start, end, ok, tt.start, tt.end, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package book
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Ratings are in stars, 1-5, kept to the quarter star StoryGraph rates in.
+// 0 is unrated.
+const (
+	MaxRating  = 5
+	RatingStep = 0.25
+)
+
+// ParseRating reads a rating in stars, e.g. "4" or "3.75", rounded to the
+// nearest RatingStep. An empty string is no rating.
+func ParseRating(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || !(f >= 0 && f <= MaxRating) {
+		return 0, fmt.Errorf("invalid rating %q (use 0-5)", s)
+	}
+	return RoundRating(f), nil
+}
+
+// RoundRating rounds r to the nearest RatingStep
+func RoundRating(r float64) float64 {
+	return math.Round(r/RatingStep) * RatingStep
+}
+
+// FormatRating writes a rating without trailing zeros, e.g. "4" or "3.75"
+func FormatRating(r float64) string {
+	return strconv.FormatFloat(r, 'f', -1, 64)
+}
+
+// WholeStars rounds a rating to whole stars, 1-5, for star displays and
+// counts per star. Unrated is 0.
+func WholeStars(r float64) int {
+	if r <= 0 {
+		return 0
+	}
+	return min(max(int(math.Round(r)), 1), MaxRating)
+}
@@ -0,0 +1,64 @@
+package book
+
+import "testing"
+
+func TestParseRating(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    float64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"4", 4, false},
+		{" 3.75 ", 3.75, false},
+		{"3.8", 3.75, false},
+		{"4.9", 5, false},
+		{"0", 0, false},
+		{"5.5", 0, true},
+		{"-1", 0, true},
+		{"NaN", 0, true},
+		{"four", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRating(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRating(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestWholeStars(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want int
+	}{
+		{0, 0},
+		{0.25, 1},
+		{2.25, 2},
+		{3.5, 4},
+		{3.75, 4},
+		{5, 5},
+		{7, 5},
+	}
+	for _, tt := range tests {
+		if got := WholeStars(tt.in); got != tt.want {
+			t.Errorf("WholeStars(%v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFormatRating(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want string
+	}{
+		{4, "4"},
+		{3.75, "3.75"},
+		{0.5, "0.5"},
+	}
+	for _, tt := range tests {
+		if got := FormatRating(tt.in); got != tt.want {
+			t.Errorf("FormatRating(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
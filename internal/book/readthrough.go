@@ -0,0 +1,339 @@
+package book
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ReadThrough is one read of a book, so a re-read doesn't overwrite the
+// first. A book's Status, DateRead and Rating follow its latest read-through.
+type ReadThrough struct {
+	ID        int64     `json:"id"`
+	BookID    int64     `json:"book_id"`
+	Status    Status    `json:"status"` // reading, rereading or paused; read or did_not_finish once over
+	Started   time.Time `json:"started,omitempty"`
+	Finished  time.Time `json:"finished,omitempty"` // when it was finished or given up
+	Rating    float64   `json:"rating,omitempty"`
+	Format    string    `json:"format,omitempty"` // e.g. "paperback", "ebook", "audiobook"
+	Notes     string    `json:"notes,omitempty"`
+	DNFReason string    `json:"dnf_reason,omitempty"`
+	DNFPage   int       `json:"dnf_page,omitempty"`
+}
+
+// Active reports whether the read-through is still in progress
+func (r *ReadThrough) Active() bool {
+	return r.Status.InProgress()
+}
+
+// Rereads returns the IDs of the finished read-throughs in list (oldest
+// first) that are re-reads: the book had already been finished before
+func Rereads(list []ReadThrough) map[int64]bool {
+	rereads := make(map[int64]bool)
+	finished := make(map[int64]bool) // by book
+	for _, rt := range list {
+		if rt.Status != StatusRead {
+			continue
+		}
+		if finished[rt.BookID] {
+			rereads[rt.ID] = true
+		}
+		finished[rt.BookID] = true
+	}
+	return rereads
+}
+
+// ReadThroughs returns a book's read-throughs, oldest first
+func (s *Service) ReadThroughs(ctx context.Context, bookID int64) ([]ReadThrough, error) {
+	return s.repo.GetReadThroughs(ctx, bookID)
+}
+
+// AllReadThroughs returns every book's read-throughs, oldest first
+func (s *Service) AllReadThroughs(ctx context.Context) ([]ReadThrough, error) {
+	return s.repo.GetAllReadThroughs(ctx)
+}
+
+// StartReadThrough starts a new read of a book. Reading a book again after
+// finishing it is a re-read.
+func (s *Service) StartReadThrough(ctx context.Context, bookID int64, started time.Time, format string) (*ReadThrough, error) {
+	list, err := s.repo.GetReadThroughs(ctx, bookID)
+	if err != nil {
+		return nil, fmt.Errorf("get read-throughs: %w", err)
+	}
+	if n := len(list); n > 0 && list[n-1].Active() {
+		return nil, fmt.Errorf("book %d is already being read (since %s)", bookID, list[n-1].Started.Format("2006-01-02"))
+	}
+
+	rt := &ReadThrough{BookID: bookID, Status: StatusReading, Started: started, Format: format}
+	for _, prev := range list {
+		if prev.Status == StatusRead {
+			rt.Status = StatusRereading
+		}
+	}
+	if err := s.repo.CreateReadThrough(ctx, rt); err != nil {
+		return nil, fmt.Errorf("create read-through: %w", err)
+	}
+	return rt, s.deriveFromReadThroughs(ctx, bookID)
+}
+
+// FinishReadThrough finishes the book's current read, or records a read
+// without a start date if none is in progress
+func (s *Service) FinishReadThrough(ctx context.Context, bookID int64, finished time.Time, rating float64, notes string) (*ReadThrough, error) {
+	list, err := s.repo.GetReadThroughs(ctx, bookID)
+	if err != nil {
+		return nil, fmt.Errorf("get read-throughs: %w", err)
+	}
+
+	rt := &ReadThrough{BookID: bookID}
+	if n := len(list); n > 0 && list[n-1].Active() {
+		rt = &list[n-1]
+	}
+	rt.Status = StatusRead
+	rt.Finished = finished
+	rt.DNFReason, rt.DNFPage = "", 0
+	if rating > 0 {
+		rt.Rating = rating
+	}
+	if notes != "" {
+		rt.Notes = notes
+	}
+
+	if rt.ID == 0 {
+		err = s.repo.CreateReadThrough(ctx, rt)
+	} else {
+		err = s.repo.UpdateReadThrough(ctx, rt)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("save read-through: %w", err)
+	}
+	return rt, s.deriveFromReadThroughs(ctx, bookID)
+}
+
+// AddReadThrough records a past read
+func (s *Service) AddReadThrough(ctx context.Context, rt *ReadThrough) error {
+	if rt.Status == "" {
+		rt.Status = StatusRead
+	}
+	if !rt.Status.IsValid() || rt.Status == StatusWantToRead {
+		return fmt.Errorf("invalid read-through status: %s", rt.Status)
+	}
+	if !rt.Started.IsZero() && !rt.Finished.IsZero() && rt.Finished.Before(rt.Started) {
+		return fmt.Errorf("read-through must finish after it starts")
+	}
+	if _, err := s.repo.GetByID(ctx, rt.BookID); err != nil {
+		return fmt.Errorf("book %d not found", rt.BookID)
+	}
+
+	if err := s.repo.CreateReadThrough(ctx, rt); err != nil {
+		return fmt.Errorf("create read-through: %w", err)
+	}
+	return s.deriveFromReadThroughs(ctx, rt.BookID)
+}
+
+// DeleteReadThrough deletes a read-through and updates its book to match
+// the ones left
+func (s *Service) DeleteReadThrough(ctx context.Context, id int64) (*ReadThrough, error) {
+	rt, err := s.repo.GetReadThrough(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.DeleteReadThrough(ctx, id); err != nil {
+		return nil, fmt.Errorf("delete read-through: %w", err)
+	}
+	return rt, s.deriveFromReadThroughs(ctx, rt.BookID)
+}
+
+// AddReadThroughs saves read-throughs to a book, skipping any it already
+// has (same status and dates), e.g. when restoring a backup. Given none, as
+// in backups made before read-throughs existed, one is made from the book's
+// status instead. It returns how many were added.
+func (s *Service) AddReadThroughs(ctx context.Context, bookID int64, list []ReadThrough) (int, error) {
+	if len(list) == 0 {
+		b, err := s.repo.GetByID(ctx, bookID)
+		if err != nil {
+			return 0, fmt.Errorf("get book %d: %w", bookID, err)
+		}
+		return 0, s.recordRead(ctx, b)
+	}
+
+	existing, err := s.repo.GetReadThroughs(ctx, bookID)
+	if err != nil {
+		return 0, fmt.Errorf("get read-throughs: %w", err)
+	}
+
+	added := 0
+	for _, rt := range list {
+		dup := false
+		for i := range existing {
+			if sameReadThrough(&existing[i], &rt) {
+				dup = true
+				break
+			}
+		}
+		if dup {
+			continue
+		}
+		rt.ID = 0
+		rt.BookID = bookID
+		if err := s.repo.CreateReadThrough(ctx, &rt); err != nil {
+			return added, fmt.Errorf("create read-through: %w", err)
+		}
+		existing = append(existing, rt)
+		added++
+	}
+	return added, s.deriveFromReadThroughs(ctx, bookID)
+}
+
+// sameReadThrough reports whether a and b record the same read: same status
+// and the same start and finish times
+func sameReadThrough(a, b *ReadThrough) bool {
+	return a.Status == b.Status && a.Started.Equal(b.Started) && a.Finished.Equal(b.Finished)
+}
+
+// dedupeReadThroughs deletes read-throughs of a book that record the same
+// read, e.g. after two copies of a book were merged, keeping the first
+func (s *Service) dedupeReadThroughs(ctx context.Context, bookID int64) error {
+	list, err := s.repo.GetReadThroughs(ctx, bookID)
+	if err != nil {
+		return fmt.Errorf("get read-throughs: %w", err)
+	}
+	for i := range list {
+		for j := 0; j < i; j++ {
+			if list[j].ID != 0 && sameReadThrough(&list[j], &list[i]) {
+				if list[j].Rating == 0 {
+					list[j].Rating = list[i].Rating
+				}
+				if list[j].Format == "" {
+					list[j].Format = list[i].Format
+				}
+				if list[j].Notes == "" {
+					list[j].Notes = list[i].Notes
+				}
+				if err := s.repo.UpdateReadThrough(ctx, &list[j]); err != nil {
+					return fmt.Errorf("update read-through: %w", err)
+				}
+				if err := s.repo.DeleteReadThrough(ctx, list[i].ID); err != nil {
+					return fmt.Errorf("delete read-through: %w", err)
+				}
+				list[i].ID = 0
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// recordRead brings a book's read-throughs in line with a change to its
+// status, date read or rating: starting to read opens a read-through,
+// pausing or resuming changes it, finishing or giving up closes it, and
+// going back to want_to_read drops an unfinished one. b is then updated to
+// match.
+func (s *Service) recordRead(ctx context.Context, b *Book) error {
+	list, err := s.repo.GetReadThroughs(ctx, b.ID)
+	if err != nil {
+		return fmt.Errorf("get read-throughs: %w", err)
+	}
+	var latest *ReadThrough
+	if n := len(list); n > 0 {
+		latest = &list[n-1]
+	}
+
+	switch {
+	case b.Status.InProgress() && latest != nil && latest.Active():
+		if latest.Status == b.Status {
+			return nil
+		}
+		latest.Status = b.Status
+		err = s.repo.UpdateReadThrough(ctx, latest)
+	case b.Status.InProgress():
+		err = s.repo.CreateReadThrough(ctx, &ReadThrough{BookID: b.ID, Status: b.Status, Started: time.Now()})
+	case b.Status == StatusDNF:
+		page := b.DNFPage
+		if page == 0 {
+			page = b.CurrentPage
+		}
+		if latest == nil {
+			err = s.repo.CreateReadThrough(ctx, &ReadThrough{BookID: b.ID, Status: StatusDNF, Finished: time.Now(), DNFReason: b.DNFReason, DNFPage: page})
+			break
+		}
+		if latest.Status == StatusDNF && latest.DNFReason == b.DNFReason && latest.DNFPage == page {
+			return nil
+		}
+		if latest.Active() || latest.Finished.IsZero() {
+			latest.Finished = time.Now()
+		}
+		latest.Status = StatusDNF
+		latest.DNFReason, latest.DNFPage = b.DNFReason, page
+		err = s.repo.UpdateReadThrough(ctx, latest)
+	case b.Status == StatusRead && latest == nil:
+		err = s.repo.CreateReadThrough(ctx, &ReadThrough{BookID: b.ID, Status: StatusRead, Finished: b.DateRead, Rating: b.Rating})
+	case b.Status == StatusRead:
+		finished := b.DateRead
+		if latest.Status != StatusRead && finished.Before(latest.Started) {
+			// The date read is still that of the previous read
+			finished = time.Now()
+		}
+		if latest.Status == StatusRead && latest.Finished.Equal(finished) && (b.Rating == 0 || latest.Rating == b.Rating) {
+			return nil
+		}
+		latest.Status = StatusRead
+		latest.Finished = finished
+		latest.DNFReason, latest.DNFPage = "", 0
+		if b.Rating > 0 {
+			latest.Rating = b.Rating
+		}
+		err = s.repo.UpdateReadThrough(ctx, latest)
+	case latest != nil && latest.Active():
+		err = s.repo.DeleteReadThrough(ctx, latest.ID)
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("save read-through: %w", err)
+	}
+	return s.derive(ctx, b)
+}
+
+func (s *Service) deriveFromReadThroughs(ctx context.Context, bookID int64) error {
+	b, err := s.repo.GetByID(ctx, bookID)
+	if err != nil {
+		return fmt.Errorf("get book %d: %w", bookID, err)
+	}
+	return s.derive(ctx, b)
+}
+
+// derive sets a book's status, date read and DNF details from its latest
+// read-through, and its rating from the latest rated one. A book with no
+// read-throughs left goes back to want_to_read.
+func (s *Service) derive(ctx context.Context, b *Book) error {
+	list, err := s.repo.GetReadThroughs(ctx, b.ID)
+	if err != nil {
+		return fmt.Errorf("get read-throughs: %w", err)
+	}
+
+	status, dateRead, rating := StatusWantToRead, time.Time{}, b.Rating
+	reason, page := "", 0
+	for _, rt := range list {
+		status = rt.Status
+		if rt.Status == StatusRead {
+			dateRead = rt.Finished
+		}
+		if rt.Rating > 0 {
+			rating = rt.Rating
+		}
+		reason, page = rt.DNFReason, rt.DNFPage
+	}
+	if status != StatusDNF {
+		reason, page = "", 0
+	}
+
+	if b.Status == status && b.DateRead.Equal(dateRead) && b.Rating == rating && b.DNFReason == reason && b.DNFPage == page {
+		return nil
+	}
+	b.Status, b.DateRead, b.Rating = status, dateRead, rating
+	b.DNFReason, b.DNFPage = reason, page
+	if err := s.repo.Update(ctx, b); err != nil {
+		return fmt.Errorf("update book: %w", err)
+	}
+	return nil
+}
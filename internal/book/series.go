@@ -0,0 +1,218 @@
+package book
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Series is the books in the library from one series, in reading order
+type Series struct {
+	Name  string `json:"name"`
+	Books []Book `json:"books"` // by position; books without one last
+}
+
+// Read is how many of the series' books have been read
+func (s *Series) Read() int {
+	n := 0
+	for _, b := range s.Books {
+		if b.Status == StatusRead {
+			n++
+		}
+	}
+	return n
+}
+
+// Next returns the first book in the series not yet read or given up, or
+// nil when there's none
+func (s *Series) Next() *Book {
+	for i := range s.Books {
+		if unread(&s.Books[i]) {
+			return &s.Books[i]
+		}
+	}
+	return nil
+}
+
+// NextAfter returns the book to read after b: the first unread one further
+// along the series, or else the first unread one skipped before it
+func (s *Series) NextAfter(b *Book) *Book {
+	var skipped *Book
+	for i := range s.Books {
+		next := &s.Books[i]
+		if next.ID == b.ID || !unread(next) {
+			continue
+		}
+		if b.SeriesPosition > 0 && next.SeriesPosition > 0 && next.SeriesPosition <= b.SeriesPosition {
+			if skipped == nil {
+				skipped = next
+			}
+			continue
+		}
+		return next
+	}
+	return skipped
+}
+
+func unread(b *Book) bool {
+	return b.Status != StatusRead && b.Status != StatusDNF
+}
+
+// SeriesLabel is the series and the book's place in it, e.g. "The Expanse
+// #3", or "" for a book outside any series
+func (b *Book) SeriesLabel() string {
+	if b.Series == "" {
+		return ""
+	}
+	if b.SeriesPosition <= 0 {
+		return b.Series
+	}
+	return b.Series + " #" + FormatPosition(b.SeriesPosition)
+}
+
+// FormatPosition writes a series position without trailing zeros, e.g. "3"
+// or "1.5"
+func FormatPosition(p float64) string {
+	return strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// SameSeries reports whether two books belong to the same series
+func SameSeries(a, b *Book) bool {
+	return a.Series != "" && seriesKey(a.Series) == seriesKey(b.Series)
+}
+
+func seriesKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// seriesPattern matches the ways sources write a series and a position:
+// "The Expanse #3", "The Expanse, #3", "The Expanse ; 3", "The Expanse,
+// Book 3", "The Expanse -- bk. 3", "The Expanse (3)" and "The Expanse 3"
+var seriesPattern = regexp.MustCompile(`(?i)^(.*?)(?:\s*(?:[,;:(]|--)\s*|\s+)(?:#\s*|(?:book|bk\.?|vol\.?|volume|no\.?|part)\s*)?(\d+(?:\.\d+)?)\)?$`)
+
+// ParseSeries splits a series as written by a catalogue into its name and
+// position, 0 if there's none
+func ParseSeries(s string) (string, float64) {
+	s = strings.TrimSpace(s)
+	if m := seriesPattern.FindStringSubmatch(s); m != nil && strings.TrimSpace(m[1]) != "" {
+		if pos, err := strconv.ParseFloat(m[2], 64); err == nil {
+			return strings.TrimSpace(m[1]), pos
+		}
+	}
+	return strings.Trim(s, " ,;:"), 0
+}
+
+// titleSeriesPattern matches a series at the end of a title, as Goodreads
+// and Google Books write it: "Leviathan Wakes (The Expanse, #1)"
+var titleSeriesPattern = regexp.MustCompile(`^(.+?)\s*\(([^()]+?),?\s*#\s*(\d+(?:\.\d+)?)\)$`)
+
+// SplitSeriesTitle takes the series off the end of a title, returning the
+// title alone, the series and the position. Titles without one come back
+// as they are.
+func SplitSeriesTitle(title string) (string, string, float64) {
+	m := titleSeriesPattern.FindStringSubmatch(strings.TrimSpace(title))
+	if m == nil {
+		return title, "", 0
+	}
+	pos, _ := strconv.ParseFloat(m[3], 64)
+	return m[1], strings.TrimSpace(m[2]), pos
+}
+
+// GroupSeries gathers books into their series, sorted by name. Names that
+// differ only in case are the same series, named as its first book has it.
+func GroupSeries(books []Book) []Series {
+	index := make(map[string]int)
+	var list []Series
+	for _, b := range books {
+		if b.Series == "" {
+			continue
+		}
+		key := seriesKey(b.Series)
+		i, ok := index[key]
+		if !ok {
+			i = len(list)
+			index[key] = i
+			list = append(list, Series{})
+		}
+		list[i].Books = append(list[i].Books, b)
+	}
+	for i := range list {
+		sortSeries(list[i].Books)
+		list[i].Name = strings.TrimSpace(list[i].Books[0].Series) // as the first book writes it
+	}
+	sort.Slice(list, func(i, j int) bool { return seriesKey(list[i].Name) < seriesKey(list[j].Name) })
+	return list
+}
+
+func sortSeries(books []Book) {
+	sort.SliceStable(books, func(i, j int) bool {
+		a, b := books[i].SeriesPosition, books[j].SeriesPosition
+		if (a > 0) != (b > 0) {
+			return a > 0
+		}
+		if a != b {
+			return a < b
+		}
+		return strings.ToLower(books[i].Title) < strings.ToLower(books[j].Title)
+	})
+}
+
+// AllSeries returns every series in the library
+func (s *Service) AllSeries(ctx context.Context) ([]Series, error) {
+	books, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list books: %w", err)
+	}
+	return GroupSeries(books), nil
+}
+
+// Series returns the series with the given name, in any case
+func (s *Service) Series(ctx context.Context, name string) (*Series, error) {
+	all, err := s.AllSeries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range all {
+		if seriesKey(all[i].Name) == seriesKey(name) {
+			return &all[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no series named %q", name)
+}
+
+// NextInSeries returns the book to read after b in its series, or nil if
+// b isn't in one or the rest of it has been read
+func (s *Service) NextInSeries(ctx context.Context, b *Book) (*Book, error) {
+	if b.Series == "" {
+		return nil, nil
+	}
+	series, err := s.Series(ctx, b.Series)
+	if err != nil {
+		return nil, err
+	}
+	return series.NextAfter(b), nil
+}
+
+// SetSeries puts a book in a series at a position (0 if unknown), or takes
+// it out of any series when name is empty
+func (s *Service) SetSeries(ctx context.Context, id int64, name string, position float64) (*Book, error) {
+	if position < 0 {
+		return nil, fmt.Errorf("series position can't be negative")
+	}
+	b, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get book: %w", err)
+	}
+	b.Series = strings.TrimSpace(name)
+	b.SeriesPosition = position
+	if b.Series == "" {
+		b.SeriesPosition = 0
+	}
+	if err := s.repo.Update(ctx, b); err != nil {
+		return nil, fmt.Errorf("update book: %w", err)
+	}
+	return b, nil
+}
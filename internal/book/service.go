@@ -3,6 +3,8 @@ package book
 import (
 	"context"
 	"fmt"
+	"sort"
+	"time"
 )
 
 type Repository interface {
@@ -13,9 +15,64 @@ type Repository interface {
 	Update(ctx context.Context, b *Book) error
 	Delete(ctx context.Context, id int64) error
 	UpdateEmbedding(ctx context.Context, id int64, embedding []float32) error
+	UpdateCoverHash(ctx context.Context, id int64, hash string) error
 	GetAllWithEmbeddings(ctx context.Context) ([]Book, error)
 	FindByISBN(ctx context.Context, isbn string) (*Book, error)
 	FindByTitleAuthor(ctx context.Context, title, author string) (*Book, error)
+	FindByExternalID(ctx context.Context, source, externalID string) (*Book, error)
+	SetExternalID(ctx context.Context, bookID int64, source, externalID string) error
+	GetExternalIDs(ctx context.Context, bookID int64) (map[string]string, error)
+	MoveExternalIDs(ctx context.Context, fromID, toID int64) error
+	GetSettings(ctx context.Context) (map[string]string, error)
+	SetSetting(ctx context.Context, key, value string) error
+	CreateQuote(ctx context.Context, q *Quote) error
+	UpdateQuote(ctx context.Context, q *Quote) error
+	GetQuotes(ctx context.Context, bookID int64) ([]Quote, error)
+	GetQuote(ctx context.Context, id int64) (*Quote, error)
+	GetAllQuotes(ctx context.Context) ([]Quote, error)
+	GetQuotesWithoutEmbedding(ctx context.Context) ([]Quote, error)
+	UpdateQuoteEmbedding(ctx context.Context, id int64, embedding []float32) error
+	DeleteQuote(ctx context.Context, id int64) error
+	MoveQuotes(ctx context.Context, fromID, toID int64) error
+	CreateSession(ctx context.Context, sess *Session) error
+	UpdateSession(ctx context.Context, sess *Session) error
+	GetSessions(ctx context.Context, bookID int64) ([]Session, error)
+	GetActiveSession(ctx context.Context) (*Session, error)
+	DeleteSession(ctx context.Context, id int64) error
+	MoveSessions(ctx context.Context, fromID, toID int64) error
+	CreateReadThrough(ctx context.Context, rt *ReadThrough) error
+	UpdateReadThrough(ctx context.Context, rt *ReadThrough) error
+	GetReadThrough(ctx context.Context, id int64) (*ReadThrough, error)
+	GetReadThroughs(ctx context.Context, bookID int64) ([]ReadThrough, error)
+	GetAllReadThroughs(ctx context.Context) ([]ReadThrough, error)
+	DeleteReadThrough(ctx context.Context, id int64) error
+	MoveReadThroughs(ctx context.Context, fromID, toID int64) error
+	SetGoal(ctx context.Context, g *Goal) error
+	GetGoals(ctx context.Context, year int) ([]Goal, error)
+	GetAllGoals(ctx context.Context) ([]Goal, error)
+	DeleteGoal(ctx context.Context, kind GoalKind, year, month int) error
+	CreateAuthor(ctx context.Context, a *Author) error
+	UpdateAuthor(ctx context.Context, a *Author) error
+	GetAuthor(ctx context.Context, id int64) (*Author, error)
+	GetAllAuthors(ctx context.Context) ([]Author, error)
+	DeleteAuthor(ctx context.Context, id int64) error
+	GetCredits(ctx context.Context, bookID int64) ([]Credit, error)
+	GetAuthorCredits(ctx context.Context, authorID int64) ([]Credit, error)
+	GetAllCredits(ctx context.Context) ([]Credit, error)
+	SetCredits(ctx context.Context, bookID int64, role Role, authorIDs []int64) error
+	AddCredit(ctx context.Context, c Credit) error
+	DeleteCredit(ctx context.Context, c Credit) error
+	MoveCredits(ctx context.Context, fromBookID, toBookID int64) error
+	MoveAuthorCredits(ctx context.Context, fromAuthorID, toAuthorID int64) error
+	CreateEdition(ctx context.Context, e *Edition) error
+	UpdateEdition(ctx context.Context, e *Edition) error
+	GetEdition(ctx context.Context, id int64) (*Edition, error)
+	GetEditions(ctx context.Context, bookID int64) ([]Edition, error)
+	DeleteEdition(ctx context.Context, id int64) error
+	MoveEditions(ctx context.Context, fromBookID, toBookID int64) error
+	// InTx runs fn with a repository whose changes are committed together
+	// if fn returns nil, and rolled back otherwise
+	InTx(ctx context.Context, fn func(Repository) error) error
 }
 
 type EmbeddingService interface {
@@ -25,7 +82,7 @@ type EmbeddingService interface {
 // DuplicateError is returned when a book already exists in the library
 type DuplicateError struct {
 	Existing *Book
-	Reason   string // "isbn" or "title_author"
+	Reason   string // "ISBN" or "title+author"
 }
 
 func (e *DuplicateError) Error() string {
@@ -45,7 +102,9 @@ func NewService(repo Repository, embedder EmbeddingService) *Service {
 	}
 }
 
-// CheckDuplicate checks if a book already exists in the library
+// CheckDuplicate checks if a book already exists in the library, by ISBN or
+// by the same normalized title and author (see TitleKey). Books that only
+// look alike are left to FindDuplicates and import previews to report.
 // Returns the existing book and reason if found, nil otherwise
 func (s *Service) CheckDuplicate(ctx context.Context, b *Book) (*Book, string, error) {
 	// Check by ISBN first (most reliable)
@@ -59,7 +118,7 @@ func (s *Service) CheckDuplicate(ctx context.Context, b *Book) (*Book, string, e
 		}
 	}
 
-	// Check by title + author (case-insensitive)
+	// Check by normalized title + author
 	if b.Title != "" && b.Author != "" {
 		existing, err := s.repo.FindByTitleAuthor(ctx, b.Title, b.Author)
 		if err != nil {
@@ -73,6 +132,177 @@ func (s *Service) CheckDuplicate(ctx context.Context, b *Book) (*Book, string, e
 	return nil, "", nil
 }
 
+// FindDuplicates scans the whole library for pairs of books that look like
+// the same work, by ISBN, normalized title and author, or fuzzy title and
+// author
+func (s *Service) FindDuplicates(ctx context.Context) ([]DuplicatePair, error) {
+	books, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list books: %w", err)
+	}
+
+	var pairs []DuplicatePair
+	for i := 0; i < len(books); i++ {
+		for j := i + 1; j < len(books); j++ {
+			a, b := &books[i], &books[j]
+			switch {
+			case a.ISBN != "" && a.ISBN == b.ISBN:
+				pairs = append(pairs, DuplicatePair{A: *a, B: *b, Reason: "ISBN", Score: 1})
+			case a.Author != "" && TitleKey(a.Title, a.Author) == TitleKey(b.Title, b.Author):
+				pairs = append(pairs, DuplicatePair{A: *a, B: *b, Reason: "title+author", Score: 1})
+			default:
+				if score := MatchScore(a, b); score > 0 {
+					pairs = append(pairs, DuplicatePair{A: *a, B: *b, Reason: "fuzzy", Score: score})
+				}
+			}
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Score > pairs[j].Score
+	})
+
+	return pairs, nil
+}
+
+// Merge folds the book dropID into keepID and deletes dropID. Empty fields on
+// the kept book are filled in, and tags, notes and adaptations are combined.
+// The merge is saved in one transaction, so it happens in full or not at all.
+func (s *Service) Merge(ctx context.Context, keepID, dropID int64) (*Book, error) {
+	if keepID == dropID {
+		return nil, fmt.Errorf("cannot merge a book into itself")
+	}
+
+	keep, err := s.repo.GetByID(ctx, keepID)
+	if err != nil {
+		return nil, fmt.Errorf("get book %d: %w", keepID, err)
+	}
+	drop, err := s.repo.GetByID(ctx, dropID)
+	if err != nil {
+		return nil, fmt.Errorf("get book %d: %w", dropID, err)
+	}
+
+	// A different edition keeps its own details rather than filling in the
+	// kept book's
+	other := otherEdition(keep, drop)
+	edition := keep.Edition()
+	mergeBooks(keep, drop)
+	if other {
+		keep.setEdition(&edition)
+	}
+
+	// Generated up front so the transaction doesn't wait on the embedder
+	embedding, err := s.embedder.Generate(ctx, s.buildEmbeddingText(keep))
+	if err != nil {
+		return nil, fmt.Errorf("generate embedding: %w", err)
+	}
+
+	err = s.repo.InTx(ctx, func(repo Repository) error {
+		tx := &Service{repo: repo, embedder: s.embedder}
+
+		// Combine the read histories first, so the kept book's status is
+		// checked against both
+		if err := repo.MoveReadThroughs(ctx, dropID, keepID); err != nil {
+			return fmt.Errorf("move read-throughs: %w", err)
+		}
+		// Translators, narrators and so on carry over; the authors follow
+		// the kept book's Author field when it's updated
+		if err := repo.MoveCredits(ctx, dropID, keepID); err != nil {
+			return fmt.Errorf("move credits: %w", err)
+		}
+		if err := tx.save(ctx, keep); err != nil {
+			return err
+		}
+		if err := repo.UpdateEmbedding(ctx, keepID, embedding); err != nil {
+			return fmt.Errorf("update embedding: %w", err)
+		}
+		// The dropped book's edition becomes another edition of the kept
+		// one, unless it's the same edition
+		if err := repo.MoveEditions(ctx, dropID, keepID); err != nil {
+			return fmt.Errorf("move editions: %w", err)
+		}
+		if err := tx.dedupeEditions(ctx, keep); err != nil {
+			return err
+		}
+		if err := repo.MoveExternalIDs(ctx, dropID, keepID); err != nil {
+			return fmt.Errorf("move external IDs: %w", err)
+		}
+		if err := repo.MoveQuotes(ctx, dropID, keepID); err != nil {
+			return fmt.Errorf("move quotes: %w", err)
+		}
+		if err := repo.MoveSessions(ctx, dropID, keepID); err != nil {
+			return fmt.Errorf("move sessions: %w", err)
+		}
+		if err := tx.dedupeReadThroughs(ctx, keepID); err != nil {
+			return err
+		}
+		if err := tx.derive(ctx, keep); err != nil {
+			return err
+		}
+		if err := tx.Delete(ctx, dropID); err != nil {
+			return fmt.Errorf("delete merged book: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keep, nil
+}
+
+// MergeFrom folds an unsaved book (e.g. an imported row) into the existing
+// book id, with the same rules as Merge. A different edition of the book is
+// added as another edition. Like Merge, it's saved in one transaction.
+func (s *Service) MergeFrom(ctx context.Context, id int64, src *Book) (*Book, error) {
+	existing, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get book %d: %w", id, err)
+	}
+
+	other := otherEdition(existing, src)
+	edition := existing.Edition()
+	mergeBooks(existing, src)
+	if other {
+		existing.setEdition(&edition)
+	}
+
+	embedding, err := s.embedder.Generate(ctx, s.buildEmbeddingText(existing))
+	if err != nil {
+		return nil, fmt.Errorf("generate embedding: %w", err)
+	}
+
+	err = s.repo.InTx(ctx, func(repo Repository) error {
+		tx := &Service{repo: repo, embedder: s.embedder}
+		if err := tx.save(ctx, existing); err != nil {
+			return err
+		}
+		if err := repo.UpdateEmbedding(ctx, id, embedding); err != nil {
+			return fmt.Errorf("update embedding: %w", err)
+		}
+		if !other {
+			return nil
+		}
+		e := src.Edition()
+		e.ID, e.BookID, e.DateAdded = 0, id, time.Now()
+		if err := repo.CreateEdition(ctx, &e); err != nil {
+			return fmt.Errorf("create edition: %w", err)
+		}
+		return tx.dedupeEditions(ctx, existing)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// otherEdition reports whether two records of a book are of different
+// editions, by ISBN or format
+func otherEdition(a, b *Book) bool {
+	return (a.ISBN != "" && b.ISBN != "" && a.ISBN != b.ISBN) ||
+		(a.Format != "" && b.Format != "" && a.Format != b.Format)
+}
+
 // IsDuplicate is a convenience method that returns true if the book already exists
 func (s *Service) IsDuplicate(ctx context.Context, b *Book) bool {
 	existing, _, _ := s.CheckDuplicate(ctx, b)
@@ -92,6 +322,12 @@ func (s *Service) Add(ctx context.Context, b *Book) error {
 	if err := s.repo.Create(ctx, b); err != nil {
 		return fmt.Errorf("create book: %w", err)
 	}
+	if err := s.recordRead(ctx, b); err != nil {
+		return err
+	}
+	if err := s.linkAuthors(ctx, b); err != nil {
+		return err
+	}
 
 	// Generate embedding from combined text
 	text := s.buildEmbeddingText(b)
@@ -113,6 +349,12 @@ func (s *Service) AddSkipDuplicateCheck(ctx context.Context, b *Book) error {
 	if err := s.repo.Create(ctx, b); err != nil {
 		return fmt.Errorf("create book: %w", err)
 	}
+	if err := s.recordRead(ctx, b); err != nil {
+		return err
+	}
+	if err := s.linkAuthors(ctx, b); err != nil {
+		return err
+	}
 
 	text := s.buildEmbeddingText(b)
 	embedding, err := s.embedder.Generate(ctx, text)
@@ -140,8 +382,8 @@ func (s *Service) ListByStatus(ctx context.Context, status Status) ([]Book, erro
 }
 
 func (s *Service) Update(ctx context.Context, b *Book) error {
-	if err := s.repo.Update(ctx, b); err != nil {
-		return fmt.Errorf("update book: %w", err)
+	if err := s.save(ctx, b); err != nil {
+		return err
 	}
 
 	// Regenerate embedding
@@ -154,8 +396,109 @@ func (s *Service) Update(ctx context.Context, b *Book) error {
 	return s.repo.UpdateEmbedding(ctx, b.ID, embedding)
 }
 
+// save writes b with its edition, read history and authors, leaving the
+// embedding alone
+func (s *Service) save(ctx context.Context, b *Book) error {
+	if err := s.repo.Update(ctx, b); err != nil {
+		return fmt.Errorf("update book: %w", err)
+	}
+	if err := s.recordRead(ctx, b); err != nil {
+		return err
+	}
+	return s.linkAuthors(ctx, b)
+}
+
+// SetCoverHash records the locally cached cover for a book. It does not
+// touch the embedding, so it is cheap to call for every book.
+func (s *Service) SetCoverHash(ctx context.Context, id int64, hash string) error {
+	return s.repo.UpdateCoverHash(ctx, id, hash)
+}
+
+// SaveProgress saves a book's reading progress and status. Like
+// SetCoverHash it leaves the embedding alone, as it doesn't depend on them,
+// so it is cheap enough to call on every page sync.
+func (s *Service) SaveProgress(ctx context.Context, b *Book) error {
+	if err := s.repo.Update(ctx, b); err != nil {
+		return fmt.Errorf("update book: %w", err)
+	}
+	return s.recordRead(ctx, b)
+}
+
 func (s *Service) Delete(ctx context.Context, id int64) error {
-	return s.repo.Delete(ctx, id)
+	credits, err := s.repo.GetCredits(ctx, id)
+	if err != nil {
+		return fmt.Errorf("get credits: %w", err)
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	return s.pruneAuthors(ctx, credits)
+}
+
+// Restore saves a book from a backup. Books with an ID are updated in place,
+// others are created. The book's edition is saved with it; EditionID must
+// be one of the book's editions in this library, or 0 for a new one. A
+// stored embedding is kept as is; books without one get a fresh embedding.
+func (s *Service) Restore(ctx context.Context, b *Book) error {
+	if b.ID != 0 {
+		if err := s.repo.Update(ctx, b); err != nil {
+			return fmt.Errorf("update book: %w", err)
+		}
+	} else if err := s.repo.Create(ctx, b); err != nil {
+		return fmt.Errorf("create book: %w", err)
+	}
+	if err := s.linkAuthors(ctx, b); err != nil {
+		return err
+	}
+
+	embedding := b.Embedding
+	if len(embedding) == 0 {
+		var err error
+		embedding, err = s.embedder.Generate(ctx, s.buildEmbeddingText(b))
+		if err != nil {
+			return fmt.Errorf("generate embedding: %w", err)
+		}
+	}
+
+	if err := s.repo.UpdateEmbedding(ctx, b.ID, embedding); err != nil {
+		return fmt.Errorf("update embedding: %w", err)
+	}
+	b.Embedding = embedding
+	return nil
+}
+
+// EmbeddingModel returns the name of the model embeddings are generated
+// with, or "" if the embedder doesn't say
+func (s *Service) EmbeddingModel() string {
+	if m, ok := s.embedder.(interface{ Model() string }); ok {
+		return m.Model()
+	}
+	return ""
+}
+
+// FindByExternalID returns the book linked to externalID in source (e.g. a
+// Calibre book ID), or nil
+func (s *Service) FindByExternalID(ctx context.Context, source, externalID string) (*Book, error) {
+	return s.repo.FindByExternalID(ctx, source, externalID)
+}
+
+// ExternalIDs returns the book's IDs in other services, keyed by source
+func (s *Service) ExternalIDs(ctx context.Context, id int64) (map[string]string, error) {
+	return s.repo.GetExternalIDs(ctx, id)
+}
+
+// LinkExternalID remembers that book id is externalID in source, so later
+// imports from source update it instead of adding a duplicate
+func (s *Service) LinkExternalID(ctx context.Context, id int64, source, externalID string) error {
+	return s.repo.SetExternalID(ctx, id, source, externalID)
+}
+
+func (s *Service) Settings(ctx context.Context) (map[string]string, error) {
+	return s.repo.GetSettings(ctx)
+}
+
+func (s *Service) SetSetting(ctx context.Context, key, value string) error {
+	return s.repo.SetSetting(ctx, key, value)
 }
 
 func (s *Service) buildEmbeddingText(b *Book) string {
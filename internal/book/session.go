@@ -0,0 +1,384 @@
+package book
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Session is a stretch of reading a book, from one position to another.
+// Positions are pages, or percentages for audiobooks and books without a
+// page count.
+type Session struct {
+	ID           int64     `json:"id"`
+	BookID       int64     `json:"book_id"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"` // zero while the session is running
+	StartPage    int       `json:"start_page,omitempty"`
+	EndPage      int       `json:"end_page,omitempty"`
+	StartPercent float64   `json:"start_percent,omitempty"` // 0-100
+	EndPercent   float64   `json:"end_percent,omitempty"`
+	Note         string    `json:"note,omitempty"`
+	Source       string    `json:"source,omitempty"` // e.g. "cli", "web", "koreader"
+}
+
+// Active reports whether the session hasn't been stopped yet
+func (s *Session) Active() bool {
+	return s.End.IsZero()
+}
+
+// Duration is how long the session lasted, or has lasted so far
+func (s *Session) Duration() time.Duration {
+	if s.Active() {
+		return time.Since(s.Start)
+	}
+	return s.End.Sub(s.Start)
+}
+
+// PagesRead is how far the session got. Percentages are converted to pages
+// when the book's page count is known.
+func (s *Session) PagesRead(pageCount int) int {
+	if s.EndPage > 0 || s.StartPage > 0 {
+		return max(0, s.EndPage-s.StartPage)
+	}
+	if pageCount > 0 {
+		return max(0, int(math.Round((s.EndPercent-s.StartPercent)/100*float64(pageCount))))
+	}
+	return 0
+}
+
+// PercentRead is how far the session got as a percentage of the book
+func (s *Session) PercentRead(pageCount int) float64 {
+	if s.EndPercent > 0 || s.StartPercent > 0 {
+		return math.Max(0, s.EndPercent-s.StartPercent)
+	}
+	if pageCount > 0 {
+		return float64(s.PagesRead(pageCount)) / float64(pageCount) * 100
+	}
+	return 0
+}
+
+// SessionGap is how close together progress updates must be to count as one
+// session (see RecordProgress)
+const SessionGap = 30 * time.Minute
+
+// Pace summarizes a book's reading sessions
+type Pace struct {
+	Sessions        int
+	TimeRead        time.Duration
+	PagesRead       int
+	PercentRead     float64
+	Days            int     // calendar days from the first session to the last
+	PagesPerDay     float64 // 0 if the book has no page count
+	PercentPerDay   float64
+	EstimatedFinish time.Time // zero unless the book is being read and a pace is known
+}
+
+// PaceOf works out how fast b is being read from its sessions. The finish
+// date assumes the current pace carries on from now.
+func PaceOf(b *Book, sessions []Session, now time.Time) Pace {
+	// An audiobook is paced by percentages, whatever its print edition's
+	// page count
+	pages := b.PageCount
+	if b.IsAudiobook() {
+		pages = 0
+	}
+
+	var p Pace
+	var first, last time.Time
+	for i := range sessions {
+		s := &sessions[i]
+		p.Sessions++
+		p.PagesRead += s.PagesRead(pages)
+		p.PercentRead += s.PercentRead(pages)
+		end := s.End
+		if s.Active() {
+			end = now
+		} else {
+			p.TimeRead += s.Duration()
+		}
+		if first.IsZero() || s.Start.Before(first) {
+			first = s.Start
+		}
+		if end.After(last) {
+			last = end
+		}
+	}
+	if p.Sessions == 0 {
+		return p
+	}
+
+	y1, m1, d1 := first.Date()
+	y2, m2, d2 := last.Date()
+	days := time.Date(y2, m2, d2, 0, 0, 0, 0, time.UTC).Sub(time.Date(y1, m1, d1, 0, 0, 0, 0, time.UTC))
+	p.Days = int(days.Hours()/24) + 1
+
+	if pages > 0 {
+		p.PagesPerDay = float64(p.PagesRead) / float64(p.Days)
+	}
+	p.PercentPerDay = p.PercentRead / float64(p.Days)
+
+	if b.Status != StatusReading && b.Status != StatusRereading {
+		return p
+	}
+	var remaining float64
+	switch {
+	case pages > 0 && p.PagesPerDay > 0:
+		remaining = float64(b.PageCount-b.CurrentPage) / p.PagesPerDay
+	case p.PercentPerDay > 0:
+		done := 0.0
+		if last := latestSession(sessions); last != nil {
+			done = last.EndPercent
+		}
+		remaining = (100 - done) / p.PercentPerDay
+	default:
+		return p
+	}
+	if remaining >= 0 {
+		p.EstimatedFinish = now.Add(time.Duration(math.Ceil(remaining)) * 24 * time.Hour)
+	}
+	return p
+}
+
+func latestSession(sessions []Session) *Session {
+	var latest *Session
+	for i := range sessions {
+		if latest == nil || sessions[i].Start.After(latest.Start) {
+			latest = &sessions[i]
+		}
+	}
+	return latest
+}
+
+// Sessions returns a book's reading sessions, oldest first
+func (s *Service) Sessions(ctx context.Context, bookID int64) ([]Session, error) {
+	return s.repo.GetSessions(ctx, bookID)
+}
+
+// ActiveSession returns the running session, or nil if there is none
+func (s *Service) ActiveSession(ctx context.Context) (*Session, error) {
+	return s.repo.GetActiveSession(ctx)
+}
+
+// StartSession starts reading a book at the given page, or minutes listened
+// for an audiobook, or where it was left if at is 0. Only one session can
+// run at a time.
+func (s *Service) StartSession(ctx context.Context, bookID int64, at int, source string) (*Session, error) {
+	active, err := s.repo.GetActiveSession(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get active session: %w", err)
+	}
+	if active != nil {
+		return nil, fmt.Errorf("a session for book %d is already running since %s", active.BookID, active.Start.Format("2006-01-02 15:04"))
+	}
+
+	b, err := s.repo.GetByID(ctx, bookID)
+	if err != nil {
+		return nil, fmt.Errorf("book %d not found", bookID)
+	}
+	if at == 0 {
+		at, _ = b.Position()
+	}
+
+	sess := &Session{
+		BookID: bookID,
+		Start:  time.Now(),
+		Source: source,
+	}
+	// Audiobooks are tracked by percentages, as in ProgressSession
+	if b.IsAudiobook() {
+		sess.StartPercent = b.PercentAt(at)
+	} else {
+		sess.StartPage = at
+	}
+	if err := s.repo.CreateSession(ctx, sess); err != nil {
+		return nil, fmt.Errorf("create session: %w", err)
+	}
+	return sess, nil
+}
+
+// StopSession ends the running session at the given page or percentage
+// (either may be 0 if unknown) and moves the book's progress on
+func (s *Service) StopSession(ctx context.Context, page int, percent float64, note string) (*Session, *Book, error) {
+	sess, err := s.repo.GetActiveSession(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get active session: %w", err)
+	}
+	if sess == nil {
+		return nil, nil, fmt.Errorf("no session is running")
+	}
+
+	b, err := s.repo.GetByID(ctx, sess.BookID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get book: %w", err)
+	}
+
+	sess.End = time.Now()
+	sess.EndPage, sess.EndPercent = page, percent
+	if page == 0 && percent == 0 {
+		sess.EndPage, sess.EndPercent = sess.StartPage, sess.StartPercent
+	}
+	sess.Note = note
+	if err := s.repo.UpdateSession(ctx, sess); err != nil {
+		return nil, nil, fmt.Errorf("update session: %w", err)
+	}
+
+	if err := s.advance(ctx, b, sess); err != nil {
+		return nil, nil, err
+	}
+	return sess, b, nil
+}
+
+// LogSession records a session after the fact. A zero start, in pages or
+// percent, is taken to be where the book was left.
+func (s *Service) LogSession(ctx context.Context, sess *Session) (*Book, error) {
+	if sess.End.IsZero() || sess.End.Before(sess.Start) {
+		return nil, fmt.Errorf("session must end after it starts")
+	}
+	b, err := s.repo.GetByID(ctx, sess.BookID)
+	if err != nil {
+		return nil, fmt.Errorf("book %d not found", sess.BookID)
+	}
+	if sess.StartPage == 0 && sess.EndPage > 0 {
+		sess.StartPage = min(b.CurrentPage, sess.EndPage)
+	}
+	if sess.StartPercent == 0 && sess.EndPercent > 0 && sess.EndPage == 0 {
+		done, _ := b.Position()
+		sess.StartPercent = math.Min(b.PercentAt(done), sess.EndPercent)
+	}
+
+	if err := s.repo.CreateSession(ctx, sess); err != nil {
+		return nil, fmt.Errorf("create session: %w", err)
+	}
+	if err := s.advance(ctx, b, sess); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// RecordProgress logs a progress update, such as a page sync or an edit of
+// the current page, as a session from p.StartPage to p.EndPage ending at
+// p.End. Updates from the same source less than SessionGap apart extend one
+// session rather than each making their own.
+func (s *Service) RecordProgress(ctx context.Context, p Session) error {
+	if p.StartPage == p.EndPage && p.StartPercent == p.EndPercent {
+		return nil
+	}
+
+	sessions, err := s.repo.GetSessions(ctx, p.BookID)
+	if err != nil {
+		return fmt.Errorf("get sessions: %w", err)
+	}
+	if last := latestSession(sessions); last != nil && !last.Active() && last.Source == p.Source &&
+		!p.End.Before(last.End) && p.End.Sub(last.End) <= SessionGap {
+		last.End = p.End
+		last.EndPage, last.EndPercent = p.EndPage, p.EndPercent
+		return s.repo.UpdateSession(ctx, last)
+	}
+
+	p.ID = 0
+	if p.Start.IsZero() {
+		p.Start = p.End
+	}
+	return s.repo.CreateSession(ctx, &p)
+}
+
+// ProgressSession is the move of b's progress since before, e.g. an edit of
+// the current page or of the time listened, as a session for
+// RecordProgress. An audiobook's progress is recorded as percentages of its
+// length. It reports false if the progress didn't move or the format
+// changed.
+func ProgressSession(before, b *Book) (Session, bool) {
+	from, _ := before.Position()
+	to, total := b.Position()
+	if from == to || before.IsAudiobook() != b.IsAudiobook() {
+		return Session{}, false
+	}
+	if !b.IsAudiobook() {
+		return Session{BookID: b.ID, StartPage: from, EndPage: to}, true
+	}
+	if total == 0 {
+		return Session{}, false
+	}
+	return Session{
+		BookID:       b.ID,
+		StartPercent: b.PercentAt(from),
+		EndPercent:   b.PercentAt(to),
+	}, true
+}
+
+// AddSessions saves sessions to a book, skipping any it already has (same
+// start time, source and end position). It returns how many were added.
+func (s *Service) AddSessions(ctx context.Context, bookID int64, sessions []Session) (int, error) {
+	existing, err := s.repo.GetSessions(ctx, bookID)
+	if err != nil {
+		return 0, fmt.Errorf("get sessions: %w", err)
+	}
+	known := make(map[string]bool)
+	for _, sess := range existing {
+		known[sessionKey(&sess)] = true
+	}
+
+	added := 0
+	for _, sess := range sessions {
+		if known[sessionKey(&sess)] {
+			continue
+		}
+		sess.ID = 0
+		sess.BookID = bookID
+		if err := s.repo.CreateSession(ctx, &sess); err != nil {
+			return added, fmt.Errorf("create session: %w", err)
+		}
+		known[sessionKey(&sess)] = true
+		added++
+	}
+	return added, nil
+}
+
+func sessionKey(s *Session) string {
+	return fmt.Sprintf("%d\x00%s\x00%d\x00%g", s.Start.Unix(), s.Source, s.EndPage, s.EndPercent)
+}
+
+func (s *Service) DeleteSession(ctx context.Context, id int64) error {
+	return s.repo.DeleteSession(ctx, id)
+}
+
+// advance moves b's progress to where sess ended, if that is further on,
+// and marks it as reading (resuming it if paused), or read once the last
+// page or minute is reached
+func (s *Service) advance(ctx context.Context, b *Book, sess *Session) error {
+	changed := false
+	if b.IsAudiobook() {
+		if m := int(math.Round(sess.EndPercent / 100 * float64(b.TotalMinutes))); m > b.ListenedMinutes {
+			b.ListenedMinutes = m
+			changed = true
+		}
+	} else {
+		page := sess.EndPage
+		if page == 0 && sess.EndPercent > 0 && b.PageCount > 0 {
+			page = int(math.Round(sess.EndPercent / 100 * float64(b.PageCount)))
+		}
+		if page > b.CurrentPage {
+			b.CurrentPage = page
+			changed = true
+		}
+	}
+
+	done, total := b.Position()
+	finished := (total > 0 && done >= total) || sess.EndPercent >= 100
+	switch {
+	case finished && b.Status != StatusRead:
+		b.Status = StatusRead
+		b.DateRead = sess.End
+		changed = true
+	case !finished && (b.Status == StatusWantToRead || b.Status == StatusPaused):
+		b.Status = StatusReading
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return s.SaveProgress(ctx, b)
+}
@@ -0,0 +1,302 @@
+package book_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+	"github.com/erwar/pka/internal/storage"
+)
+
+type fakeEmbedder struct{}
+
+func (fakeEmbedder) Generate(ctx context.Context, text string) ([]float32, error) {
+	return []float32{1, 0, 0}, nil
+}
+
+// newService returns a service on a fresh database holding one book
+func newService(t *testing.T, b *book.Book) *book.Service {
+	t.Helper()
+	repo, err := storage.NewSQLiteRepository(filepath.Join(t.TempDir(), "books.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	svc := book.NewService(repo, fakeEmbedder{})
+	if err := svc.AddSkipDuplicateCheck(context.Background(), b); err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func TestRecordProgress(t *testing.T) {
+	start := time.Date(2024, 3, 4, 21, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	type update struct {
+		minute   int
+		from, to int
+		source   string
+	}
+	type span struct {
+		start, end int // minutes
+		from, to   int
+	}
+	tests := []struct {
+		name    string
+		updates []update
+		want    []span
+	}{
+		{
+			name:    "one update",
+			updates: []update{{0, 10, 20, "koreader"}},
+			want:    []span{{0, 0, 10, 20}},
+		},
+		{
+			name:    "close updates extend one session",
+			updates: []update{{0, 10, 20, "koreader"}, {20, 20, 30, "koreader"}, {45, 30, 42, "koreader"}},
+			want:    []span{{0, 45, 10, 42}},
+		},
+		{
+			name:    "a gap starts a new session",
+			updates: []update{{0, 10, 20, "koreader"}, {31, 20, 30, "koreader"}},
+			want:    []span{{0, 0, 10, 20}, {31, 31, 20, 30}},
+		},
+		{
+			name:    "exactly the gap apart",
+			updates: []update{{0, 10, 20, "koreader"}, {30, 20, 30, "koreader"}},
+			want:    []span{{0, 30, 10, 30}},
+		},
+		{
+			name:    "other sources don't merge",
+			updates: []update{{0, 10, 20, "koreader"}, {5, 20, 25, "web"}},
+			want:    []span{{0, 0, 10, 20}, {5, 5, 20, 25}},
+		},
+		{
+			name:    "out of order updates don't merge",
+			updates: []update{{10, 10, 20, "koreader"}, {5, 20, 25, "koreader"}},
+			want:    []span{{5, 5, 20, 25}, {10, 10, 10, 20}},
+		},
+		{
+			name:    "no movement is not recorded",
+			updates: []update{{0, 10, 10, "koreader"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			b := &book.Book{Title: "Dune", Author: "Frank Herbert", PageCount: 400, Status: book.StatusReading}
+			svc := newService(t, b)
+
+			for _, u := range tt.updates {
+				err := svc.RecordProgress(ctx, book.Session{BookID: b.ID, End: at(u.minute), StartPage: u.from, EndPage: u.to, Source: u.source})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			sessions, err := svc.Sessions(ctx, b.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sessions) != len(tt.want) {
+				t.Fatalf("got %d sessions, want %d: %+v", len(sessions), len(tt.want), sessions)
+			}
+			for i, w := range tt.want {
+				s := sessions[i]
+				if !s.Start.Equal(at(w.start)) || !s.End.Equal(at(w.end)) || s.StartPage != w.from || s.EndPage != w.to {
+					t.Errorf("session %d = %v-%v pages %d-%d, want minutes %d-%d pages %d-%d",
+						i, s.Start, s.End, s.StartPage, s.EndPage, w.start, w.end, w.from, w.to)
+				}
+			}
+		})
+	}
+}
+
+func TestAudiobookSessions(t *testing.T) {
+	ctx := context.Background()
+	b := &book.Book{Title: "Dune", Author: "Frank Herbert", Format: book.FormatAudiobook, TotalMinutes: 600, ListenedMinutes: 300, Status: book.StatusReading}
+	svc := newService(t, b)
+
+	sess, err := svc.StartSession(ctx, b.ID, 0, "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.StartPercent != 50 || sess.StartPage != 0 {
+		t.Errorf("started at page %d, %v%%; want 50%%", sess.StartPage, sess.StartPercent)
+	}
+	sess, got, err := svc.StopSession(ctx, 0, 60, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.StartPercent != 50 || sess.EndPercent != 60 || got.ListenedMinutes != 360 {
+		t.Errorf("stopped %v%% -> %v%% at %d minutes; want 50%% -> 60%% at 360", sess.StartPercent, sess.EndPercent, got.ListenedMinutes)
+	}
+
+	sess, err = svc.StartSession(ctx, b.ID, 420, "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.StartPercent != 70 {
+		t.Errorf("started at %v%%, want 70%%", sess.StartPercent)
+	}
+	if sess, _, err = svc.StopSession(ctx, 0, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if sess.EndPercent != 70 {
+		t.Errorf("stopped without a position at %v%%, want 70%%", sess.EndPercent)
+	}
+
+	end := time.Now()
+	logged := &book.Session{BookID: b.ID, Start: end.Add(-time.Hour), End: end, EndPercent: 80, Source: "cli"}
+	if got, err = svc.LogSession(ctx, logged); err != nil {
+		t.Fatal(err)
+	}
+	if logged.StartPercent != 70 || got.ListenedMinutes != 480 {
+		t.Errorf("logged %v%% -> 80%% to %d minutes; want 70%% -> 80%% to 480", logged.StartPercent, got.ListenedMinutes)
+	}
+}
+
+func TestAddSessions(t *testing.T) {
+	ctx := context.Background()
+	b := &book.Book{Title: "Dune", Author: "Frank Herbert", PageCount: 400, Status: book.StatusReading}
+	svc := newService(t, b)
+
+	start := time.Date(2024, 3, 4, 21, 0, 0, 0, time.UTC)
+	first := book.Session{Start: start, End: start.Add(time.Hour), StartPage: 10, EndPage: 40, Source: "cli"}
+	added, err := svc.AddSessions(ctx, b.ID, []book.Session{first, first})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 1 {
+		t.Errorf("added %d sessions, want 1", added)
+	}
+
+	later := first
+	later.EndPage = 50
+	other := first
+	other.Source = "web"
+	added, err = svc.AddSessions(ctx, b.ID, []book.Session{first, later, other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 2 {
+		t.Errorf("added %d sessions on restore, want 2", added)
+	}
+}
+
+func TestPaceOf(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	day := func(d, hour int) time.Time { return time.Date(2024, 3, d, hour, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name       string
+		book       book.Book
+		sessions   []book.Session
+		want       book.Pace
+		wantFinish time.Time
+	}{
+		{
+			name: "no sessions",
+			book: book.Book{PageCount: 400, Status: book.StatusReading},
+		},
+		{
+			name: "pages over two days",
+			book: book.Book{PageCount: 400, CurrentPage: 100, Status: book.StatusReading},
+			sessions: []book.Session{
+				{Start: day(1, 20), End: day(1, 21), StartPage: 0, EndPage: 60},
+				{Start: day(2, 20), End: day(2, 22), StartPage: 60, EndPage: 100},
+			},
+			want:       book.Pace{Sessions: 2, TimeRead: 3 * time.Hour, PagesRead: 100, PercentRead: 25, Days: 2, PagesPerDay: 50, PercentPerDay: 12.5},
+			wantFinish: now.Add(6 * 24 * time.Hour),
+		},
+		{
+			name: "finished books have no estimate",
+			book: book.Book{PageCount: 400, CurrentPage: 400, Status: book.StatusRead},
+			sessions: []book.Session{
+				{Start: day(1, 20), End: day(1, 21), StartPage: 0, EndPage: 400},
+			},
+			want: book.Pace{Sessions: 1, TimeRead: time.Hour, PagesRead: 400, PercentRead: 100, Days: 1, PagesPerDay: 400, PercentPerDay: 100},
+		},
+		{
+			name: "audiobook by percent",
+			book: book.Book{PageCount: 400, Format: book.FormatAudiobook, Status: book.StatusReading},
+			sessions: []book.Session{
+				{Start: day(1, 8), End: day(1, 9), StartPercent: 0, EndPercent: 10},
+				{Start: day(3, 8), End: day(3, 9), StartPercent: 10, EndPercent: 40},
+			},
+			want:       book.Pace{Sessions: 2, TimeRead: 2 * time.Hour, PercentRead: 40, Days: 3, PercentPerDay: 40.0 / 3},
+			wantFinish: now.Add(5 * 24 * time.Hour),
+		},
+		{
+			name: "audiobook started mid-way",
+			book: book.Book{Format: book.FormatAudiobook, TotalMinutes: 600, ListenedMinutes: 360, Status: book.StatusReading},
+			sessions: []book.Session{
+				{Start: day(8, 8), End: day(8, 9), StartPercent: 50, EndPercent: 60},
+			},
+			want:       book.Pace{Sessions: 1, TimeRead: time.Hour, PercentRead: 10, Days: 1, PercentPerDay: 10},
+			wantFinish: now.Add(4 * 24 * time.Hour),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := book.PaceOf(&tt.book, tt.sessions, now)
+			finish := got.EstimatedFinish
+			got.EstimatedFinish = time.Time{}
+			if got != tt.want {
+				t.Errorf("PaceOf = %+v, want %+v", got, tt.want)
+			}
+			if !finish.Equal(tt.wantFinish) {
+				t.Errorf("estimated finish = %v, want %v", finish, tt.wantFinish)
+			}
+		})
+	}
+}
+
+func TestProgressSession(t *testing.T) {
+	tests := []struct {
+		name           string
+		before, after  book.Book
+		want           book.Session
+		wantRecordable bool
+	}{
+		{
+			name:           "pages",
+			before:         book.Book{ID: 1, PageCount: 400, CurrentPage: 10},
+			after:          book.Book{ID: 1, PageCount: 400, CurrentPage: 50},
+			want:           book.Session{BookID: 1, StartPage: 10, EndPage: 50},
+			wantRecordable: true,
+		},
+		{
+			name:   "unchanged",
+			before: book.Book{ID: 1, PageCount: 400, CurrentPage: 10},
+			after:  book.Book{ID: 1, PageCount: 400, CurrentPage: 10},
+		},
+		{
+			name:           "minutes as percent",
+			before:         book.Book{ID: 1, Format: book.FormatAudiobook, TotalMinutes: 600, ListenedMinutes: 60},
+			after:          book.Book{ID: 1, Format: book.FormatAudiobook, TotalMinutes: 600, ListenedMinutes: 150},
+			want:           book.Session{BookID: 1, StartPercent: 10, EndPercent: 25},
+			wantRecordable: true,
+		},
+		{
+			name:   "audiobook without a length",
+			before: book.Book{ID: 1, Format: book.FormatAudiobook, ListenedMinutes: 60},
+			after:  book.Book{ID: 1, Format: book.FormatAudiobook, ListenedMinutes: 150},
+		},
+		{
+			name:   "format changed",
+			before: book.Book{ID: 1, PageCount: 400, CurrentPage: 200},
+			after:  book.Book{ID: 1, Format: book.FormatAudiobook, TotalMinutes: 600, ListenedMinutes: 300},
+		},
+	}
+	for _, tt := range tests {
+		got, ok := book.ProgressSession(&tt.before, &tt.after)
+		if ok != tt.wantRecordable || got != tt.want {
+			t.Errorf("%s: ProgressSession = %+v, %v; want %+v, %v", tt.name, got, ok, tt.want, tt.wantRecordable)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// Package chart draws small SVG charts on the server, so pages can show
+// them without a JavaScript charting library. Charts scale to the width of
+// their container.
+package chart
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	width      = 600
+	height     = 200
+	top        = 18 // room for value labels
+	bottom     = 20 // room for axis labels
+	maxLabels  = 12 // axis labels before some are skipped
+	maxSlices  = 6  // donut slices before the rest become "Other"
+	labelColor = "#6b7280"
+)
+
+// Palette is the colors donut slices take in turn
+var Palette = []string{"#6366f1", "#22c55e", "#eab308", "#ef4444", "#06b6d4", "#a855f7", "#9ca3af"}
+
+// Point is one labelled value: a bar, a slice or a point on a line
+type Point struct {
+	Label string
+	Value float64
+}
+
+// Bars draws a vertical bar chart, each bar labelled with its value
+func Bars(points []Point, color string) template.HTML {
+	if len(points) == 0 {
+		return ""
+	}
+	most := maxValue(points)
+	slot := float64(width) / float64(len(points))
+	barWidth := slot * 0.7
+	plot := float64(height - top - bottom)
+	every := labelEvery(len(points))
+
+	var b strings.Builder
+	open(&b, width, height)
+	for i, p := range points {
+		x := float64(i) * slot
+		h := 0.0
+		if most > 0 {
+			h = p.Value / most * plot
+		}
+		y := float64(top) + plot - h
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" rx="2" fill="%s"><title>%s: %s</title></rect>`,
+			x+(slot-barWidth)/2, y, barWidth, h, color, esc(p.Label), format(p.Value))
+		if p.Value > 0 {
+			text(&b, x+slot/2, y-4, "middle", format(p.Value))
+		}
+		if i%every == 0 {
+			text(&b, x+slot/2, height-6, "middle", p.Label)
+		}
+	}
+	b.WriteString("</svg>")
+	return template.HTML(b.String())
+}
+
+// Line draws a line chart with the area under it shaded, labelled with its
+// first and last points and its highest value
+func Line(points []Point, color string) template.HTML {
+	if len(points) == 0 {
+		return ""
+	}
+	most := maxValue(points)
+	plot := float64(height - top - bottom)
+	step := 0.0
+	if len(points) > 1 {
+		step = float64(width-20) / float64(len(points)-1)
+	}
+	x := func(i int) float64 { return 10 + float64(i)*step }
+	y := func(v float64) float64 {
+		if most == 0 {
+			return float64(top) + plot
+		}
+		return float64(top) + plot - v/most*plot
+	}
+
+	var path strings.Builder
+	for i, p := range points {
+		cmd := "L"
+		if i == 0 {
+			cmd = "M"
+		}
+		fmt.Fprintf(&path, "%s%.1f %.1f ", cmd, x(i), y(p.Value))
+	}
+	line := strings.TrimSpace(path.String())
+	base := float64(top) + plot
+
+	var b strings.Builder
+	open(&b, width, height)
+	fmt.Fprintf(&b, `<line x1="10" y1="%.1f" x2="%d" y2="%.1f" stroke="#e5e7eb"/>`, base, width-10, base)
+	fmt.Fprintf(&b, `<path d="%s L%.1f %.1f L%.1f %.1f Z" fill="%s" fill-opacity="0.12"/>`, line, x(len(points)-1), base, x(0), base, color)
+	fmt.Fprintf(&b, `<path d="%s" fill="none" stroke="%s" stroke-width="2.5" stroke-linejoin="round"/>`, line, color)
+	every := labelEvery(len(points))
+	for i, p := range points {
+		fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"><title>%s: %s</title></circle>`, x(i), y(p.Value), color, esc(p.Label), format(p.Value))
+		if i%every == 0 || i == len(points)-1 {
+			anchor := "middle"
+			switch {
+			case len(points) == 1, i == 0:
+				anchor = "start"
+			case i == len(points)-1:
+				anchor = "end"
+			}
+			text(&b, x(i), height-6, anchor, p.Label)
+		}
+	}
+	text(&b, 10, top-4, "start", format(most))
+	b.WriteString("</svg>")
+	return template.HTML(b.String())
+}
+
+// Donut draws a donut chart with a legend, from points largest first. Past
+// the first few slices, the rest are put together as "Other".
+func Donut(points []Point) template.HTML {
+	var slices []Point
+	var total float64
+	for _, p := range points {
+		if p.Value <= 0 {
+			continue
+		}
+		total += p.Value
+		if len(slices) < maxSlices {
+			slices = append(slices, p)
+		} else if len(slices) == maxSlices {
+			slices = append(slices, Point{Label: "Other", Value: p.Value})
+		} else {
+			slices[maxSlices].Value += p.Value
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+
+	const cx, cy, r, stroke = 80.0, 80.0, 56.0, 26.0
+	circumference := 2 * math.Pi * r
+	legendHeight := len(slices)*22 + 10
+
+	var b strings.Builder
+	open(&b, width/2+60, max(160, legendHeight))
+	offset := 0.0
+	for i, s := range slices {
+		length := s.Value / total * circumference
+		fmt.Fprintf(&b, `<circle cx="%.0f" cy="%.0f" r="%.0f" fill="none" stroke="%s" stroke-width="%.0f" stroke-dasharray="%.2f %.2f" stroke-dashoffset="%.2f" transform="rotate(-90 %.0f %.0f)"><title>%s: %s</title></circle>`,
+			cx, cy, r, Palette[i%len(Palette)], stroke, length, circumference-length, circumference-offset, cx, cy, esc(s.Label), format(s.Value))
+		offset += length
+	}
+	fmt.Fprintf(&b, `<text x="%.0f" y="%.0f" text-anchor="middle" font-size="22" font-weight="bold" fill="#111827">%s</text>`, cx, cy+8, format(total))
+	for i, s := range slices {
+		y := 20 + i*22
+		fmt.Fprintf(&b, `<rect x="175" y="%d" width="12" height="12" rx="2" fill="%s"/>`, y-10, Palette[i%len(Palette)])
+		fmt.Fprintf(&b, `<text x="194" y="%d" font-size="12" fill="#374151">%s <tspan fill="%s">(%s)</tspan></text>`, y, esc(truncate(s.Label, 22)), labelColor, format(s.Value))
+	}
+	b.WriteString("</svg>")
+	return template.HTML(b.String())
+}
+
+// Cumulative returns the running totals of points, for a line that climbs
+// through a period
+func Cumulative(points []Point) []Point {
+	out := make([]Point, len(points))
+	var sum float64
+	for i, p := range points {
+		sum += p.Value
+		out[i] = Point{Label: p.Label, Value: sum}
+	}
+	return out
+}
+
+func open(b *strings.Builder, w, h int) {
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="100%%" role="img" style="max-width: %dpx" font-family="system-ui, sans-serif">`, w, h, w)
+}
+
+func text(b *strings.Builder, x, y float64, anchor, s string) {
+	fmt.Fprintf(b, `<text x="%.1f" y="%.1f" text-anchor="%s" font-size="11" fill="%s">%s</text>`, x, y, anchor, labelColor, esc(s))
+}
+
+func maxValue(points []Point) float64 {
+	most := 0.0
+	for _, p := range points {
+		most = max(most, p.Value)
+	}
+	return most
+}
+
+// labelEvery is how often to label the axis so labels don't overlap
+func labelEvery(n int) int {
+	return max(1, (n+maxLabels-1)/maxLabels)
+}
+
+// format writes whole values without decimals
+func format(v float64) string {
+	if v == math.Trunc(v) {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
+
+func esc(s string) string {
+	return html.EscapeString(s)
+}
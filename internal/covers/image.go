@@ -0,0 +1,140 @@
+package covers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"image"
+	"image/draw"
+	"strings"
+)
+
+// Resize scales src down to the given width, keeping the aspect ratio.
+// Each destination pixel is the average of the source pixels it covers,
+// which looks much better than nearest-neighbour for large reductions.
+func Resize(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	if width <= 0 || width >= sw {
+		return src
+	}
+	height := sh * width / sw
+	if height < 1 {
+		height = 1
+	}
+
+	// Work on a flat RGBA copy so pixel access is cheap
+	rgba := image.NewRGBA(image.Rect(0, 0, sw, sh))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * sh / height
+		y1 := (y + 1) * sh / height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := x * sw / width
+			x1 := (x + 1) * sw / width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint32(p[0])
+					g += uint32(p[1])
+					b += uint32(p[2])
+					a += uint32(p[3])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// placeholderPalette holds background/accent colour pairs for generated covers
+var placeholderPalette = [][2]string{
+	{"#312e81", "#a5b4fc"},
+	{"#7c2d12", "#fdba74"},
+	{"#14532d", "#86efac"},
+	{"#701a75", "#f0abfc"},
+	{"#1e3a8a", "#93c5fd"},
+	{"#78350f", "#fcd34d"},
+	{"#134e4a", "#5eead4"},
+	{"#881337", "#fda4af"},
+}
+
+// Placeholder generates an SVG cover showing the title and author. The
+// colours are derived from the title so a book always gets the same cover.
+func Placeholder(title, author string) []byte {
+	h := fnv.New32a()
+	h.Write([]byte(title + "\x00" + author))
+	colors := placeholderPalette[h.Sum32()%uint32(len(placeholderPalette))]
+
+	var b strings.Builder
+	b.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 200 300" width="200" height="300">`)
+	fmt.Fprintf(&b, `<rect width="200" height="300" fill="%s"/>`, colors[0])
+	fmt.Fprintf(&b, `<rect x="12" y="12" width="176" height="276" fill="none" stroke="%s" stroke-width="2"/>`, colors[1])
+
+	lines := wrapText(title, 14, 5)
+	y := 90
+	for _, line := range lines {
+		fmt.Fprintf(&b, `<text x="100" y="%d" fill="#ffffff" font-family="Georgia, serif" font-size="18" font-weight="bold" text-anchor="middle">%s</text>`,
+			y, html.EscapeString(line))
+		y += 24
+	}
+
+	for i, line := range wrapText(author, 20, 2) {
+		fmt.Fprintf(&b, `<text x="100" y="%d" fill="%s" font-family="Helvetica, Arial, sans-serif" font-size="13" text-anchor="middle">%s</text>`,
+			250+i*16, colors[1], html.EscapeString(line))
+	}
+
+	b.WriteString(`</svg>`)
+	return []byte(b.String())
+}
+
+// wrapText splits s into lines of at most width runes, truncating after
+// maxLines lines
+func wrapText(s string, width, maxLines int) []string {
+	var lines []string
+	var current string
+
+	for _, word := range strings.Fields(s) {
+		switch {
+		case current == "":
+			current = word
+		case len([]rune(current))+1+len([]rune(word)) <= width:
+			current += " " + word
+		default:
+			lines = append(lines, current)
+			current = word
+		}
+	}
+	if current != "" {
+		lines = append(lines, current)
+	}
+
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+		lines[maxLines-1] += "…"
+	}
+	for i, line := range lines {
+		if r := []rune(line); len(r) > width+1 {
+			lines[i] = string(r[:width]) + "…"
+		}
+	}
+	return lines
+}
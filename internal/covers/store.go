@@ -0,0 +1,227 @@
+package covers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxCoverSize caps downloads so a bad URL can't fill the disk
+const maxCoverSize = 10 << 20
+
+// maxCoverDimension caps a cover's width and height, so a small file that
+// decodes to a huge image can't exhaust memory when thumbnailed
+const maxCoverDimension = 8000
+
+// Thumbnail widths served by the web UI
+var Sizes = map[string]int{
+	"sm": 120,
+	"md": 240,
+	"lg": 480,
+}
+
+// Store is a content-addressed cache of cover images on local disk.
+// Originals live in <dir>/originals/<sha256> and resized thumbnails in
+// <dir>/thumbs/<sha256>-<width>.jpg, generated on first use.
+type Store struct {
+	dir    string
+	client *http.Client
+}
+
+func NewStore(dir string) *Store {
+	return &Store{
+		dir: dir,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Dir returns the root directory of the store
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Fetch downloads an image and stores it, returning its content hash
+func (s *Store) Fetch(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("download cover: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cover returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCoverSize+1))
+	if err != nil {
+		return "", fmt.Errorf("read cover: %w", err)
+	}
+	if len(data) > maxCoverSize {
+		return "", fmt.Errorf("cover larger than %d bytes", maxCoverSize)
+	}
+
+	return s.Put(data)
+}
+
+// Put stores raw image bytes and returns their content hash. The data must
+// decode as a JPEG, PNG or GIF image no larger than maxCoverDimension
+// either way.
+func (s *Store) Put(data []byte) (string, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("decode cover: %w", err)
+	}
+	// OpenLibrary returns a 1x1 GIF for missing covers
+	if cfg.Width < 10 || cfg.Height < 10 {
+		return "", fmt.Errorf("cover too small (%dx%d)", cfg.Width, cfg.Height)
+	}
+	if err := checkDimensions(cfg); err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	path := s.originalPath(hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("create cover directory: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return "", fmt.Errorf("write cover: %w", err)
+	}
+
+	return hash, nil
+}
+
+// Has reports whether the original for hash is in the store
+func (s *Store) Has(hash string) bool {
+	if !validHash(hash) {
+		return false
+	}
+	_, err := os.Stat(s.originalPath(hash))
+	return err == nil
+}
+
+// Original returns the path to the stored original image
+func (s *Store) Original(hash string) (string, error) {
+	if !validHash(hash) {
+		return "", fmt.Errorf("invalid cover hash: %q", hash)
+	}
+	path := s.originalPath(hash)
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Thumbnail returns the path to a JPEG of the cover scaled to width,
+// generating and caching it if needed. Images narrower than width are
+// not upscaled.
+func (s *Store) Thumbnail(hash string, width int) (string, error) {
+	original, err := s.Original(hash)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(s.dir, "thumbs", fmt.Sprintf("%s-%d.jpg", hash, width))
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	f, err := os.Open(original)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// Checked again for covers stored before the limit
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return "", fmt.Errorf("decode cover: %w", err)
+	}
+	if err := checkDimensions(cfg); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return "", fmt.Errorf("decode cover: %w", err)
+	}
+
+	thumb := Resize(src, width)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85}); err != nil {
+		return "", fmt.Errorf("encode thumbnail: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("create thumbnail directory: %w", err)
+	}
+	if err := writeFileAtomic(path, buf.Bytes()); err != nil {
+		return "", fmt.Errorf("write thumbnail: %w", err)
+	}
+
+	return path, nil
+}
+
+func checkDimensions(cfg image.Config) error {
+	if cfg.Width > maxCoverDimension || cfg.Height > maxCoverDimension {
+		return fmt.Errorf("cover too large (%dx%d)", cfg.Width, cfg.Height)
+	}
+	return nil
+}
+
+func (s *Store) originalPath(hash string) string {
+	return filepath.Join(s.dir, "originals", hash[:2], hash)
+}
+
+func validHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,280 @@
+package epub
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// maxCoverSize caps how much of a cover image is read from an archive
+const maxCoverSize = 10 << 20
+
+// Metadata is the Dublin Core metadata from an EPUB's package document
+type Metadata struct {
+	Title       string
+	Creators    []string // authors, in order; editors, illustrators etc. are left out
+	Identifiers []string // raw values, e.g. "urn:isbn:9780441172719" or a UUID
+	ISBNs       []string // identifiers marked or recognizable as ISBNs, digits only
+	Description string   // often HTML
+	Subjects    []string
+	Language    string
+	Publisher   string
+	Date        string
+	CoverPath   string // path of the cover image inside the archive, if any
+}
+
+type container struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type opfPackage struct {
+	Metadata struct {
+		Titles      []string        `xml:"title"`
+		Creators    []opfCreator    `xml:"creator"`
+		Identifiers []opfIdentifier `xml:"identifier"`
+		Description string          `xml:"description"`
+		Subjects    []string        `xml:"subject"`
+		Language    string          `xml:"language"`
+		Publisher   string          `xml:"publisher"`
+		Dates       []string        `xml:"date"`
+		Metas       []opfMeta       `xml:"meta"`
+	} `xml:"metadata"`
+	Manifest []opfItem `xml:"manifest>item"`
+}
+
+type opfCreator struct {
+	ID   string `xml:"id,attr"`
+	Role string `xml:"role,attr"` // EPUB 2 opf:role
+	Name string `xml:",chardata"`
+}
+
+type opfIdentifier struct {
+	Scheme string `xml:"scheme,attr"` // EPUB 2 opf:scheme
+	Value  string `xml:",chardata"`
+}
+
+type opfMeta struct {
+	Name     string `xml:"name,attr"` // EPUB 2 <meta name="cover" content="...">
+	Content  string `xml:"content,attr"`
+	Property string `xml:"property,attr"` // EPUB 3 <meta refines="#id" property="role">
+	Refines  string `xml:"refines,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type opfItem struct {
+	ID         string `xml:"id,attr"`
+	Href       string `xml:"href,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr"`
+}
+
+// Read parses the metadata of the EPUB file at path
+func Read(path string) (*Metadata, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("open epub: %w", err)
+	}
+	defer zr.Close()
+
+	return readMetadata(&zr.Reader)
+}
+
+// ReadCover returns the cover image of the EPUB file at path, or nil if it
+// doesn't declare one
+func ReadCover(path string) ([]byte, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("open epub: %w", err)
+	}
+	defer zr.Close()
+
+	meta, err := readMetadata(&zr.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if meta.CoverPath == "" {
+		return nil, nil
+	}
+
+	f, err := zr.Open(meta.CoverPath)
+	if err != nil {
+		return nil, fmt.Errorf("open cover: %w", err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxCoverSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read cover: %w", err)
+	}
+	if len(data) > maxCoverSize {
+		return nil, fmt.Errorf("cover image too large")
+	}
+	return data, nil
+}
+
+func readMetadata(zr *zip.Reader) (*Metadata, error) {
+	var c container
+	if err := decodeFile(zr, "META-INF/container.xml", &c); err != nil {
+		return nil, err
+	}
+
+	opfPath := ""
+	for _, rf := range c.Rootfiles {
+		if rf.MediaType == "" || rf.MediaType == "application/oebps-package+xml" {
+			opfPath = rf.FullPath
+			break
+		}
+	}
+	if opfPath == "" {
+		return nil, fmt.Errorf("no package document in container.xml")
+	}
+
+	var pkg opfPackage
+	if err := decodeFile(zr, opfPath, &pkg); err != nil {
+		return nil, err
+	}
+
+	md := pkg.Metadata
+	meta := &Metadata{
+		Description: strings.TrimSpace(md.Description),
+		Language:    strings.TrimSpace(md.Language),
+		Publisher:   strings.TrimSpace(md.Publisher),
+	}
+	if len(md.Titles) > 0 {
+		meta.Title = strings.TrimSpace(md.Titles[0])
+	}
+	if len(md.Dates) > 0 {
+		meta.Date = strings.TrimSpace(md.Dates[0])
+	}
+	for _, s := range md.Subjects {
+		if s = strings.TrimSpace(s); s != "" {
+			meta.Subjects = append(meta.Subjects, s)
+		}
+	}
+
+	// EPUB 3 gives creator roles in separate <meta refines="#id"> elements
+	roles := make(map[string]string)
+	for _, m := range md.Metas {
+		if m.Property == "role" && strings.HasPrefix(m.Refines, "#") {
+			roles[strings.TrimPrefix(m.Refines, "#")] = strings.TrimSpace(m.Value)
+		}
+	}
+	for _, c := range md.Creators {
+		role := c.Role
+		if role == "" {
+			role = roles[c.ID]
+		}
+		name := strings.TrimSpace(c.Name)
+		if name != "" && (role == "" || role == "aut") {
+			meta.Creators = append(meta.Creators, name)
+		}
+	}
+
+	for _, id := range md.Identifiers {
+		value := strings.TrimSpace(id.Value)
+		if value == "" {
+			continue
+		}
+		meta.Identifiers = append(meta.Identifiers, value)
+		if isbn, ok := isbnFrom(value, id.Scheme); ok {
+			meta.ISBNs = append(meta.ISBNs, isbn)
+		}
+	}
+
+	if href := coverHref(&pkg); href != "" {
+		if unescaped, err := url.PathUnescape(href); err == nil {
+			href = unescaped
+		}
+		meta.CoverPath = path.Join(path.Dir(opfPath), href)
+	}
+
+	return meta, nil
+}
+
+// coverHref finds the cover image in the manifest: the EPUB 3 cover-image
+// property, then the EPUB 2 cover meta, then an image whose ID says cover
+func coverHref(pkg *opfPackage) string {
+	for _, item := range pkg.Manifest {
+		for _, p := range strings.Fields(item.Properties) {
+			if p == "cover-image" {
+				return item.Href
+			}
+		}
+	}
+
+	for _, m := range pkg.Metadata.Metas {
+		if m.Name != "cover" {
+			continue
+		}
+		for _, item := range pkg.Manifest {
+			if item.ID == m.Content && strings.HasPrefix(item.MediaType, "image/") {
+				return item.Href
+			}
+		}
+	}
+
+	for _, item := range pkg.Manifest {
+		if strings.HasPrefix(item.MediaType, "image/") && strings.Contains(strings.ToLower(item.ID), "cover") {
+			return item.Href
+		}
+	}
+	return ""
+}
+
+// isbnFrom extracts an ISBN from an identifier such as "urn:isbn:978-..."
+// or one with opf:scheme="ISBN"
+func isbnFrom(value, scheme string) (string, bool) {
+	lower := strings.ToLower(value)
+	switch {
+	case strings.HasPrefix(lower, "urn:isbn:"):
+		value = value[len("urn:isbn:"):]
+	case strings.HasPrefix(lower, "isbn:"):
+		value = value[len("isbn:"):]
+	case strings.EqualFold(scheme, "isbn"):
+	default:
+		return "", false
+	}
+
+	var digits strings.Builder
+	for _, c := range value {
+		switch {
+		case c >= '0' && c <= '9':
+			digits.WriteRune(c)
+		case c == 'X' || c == 'x':
+			digits.WriteRune('X')
+		case c == '-' || c == ' ':
+		default:
+			return "", false
+		}
+	}
+	isbn := digits.String()
+	if len(isbn) != 10 && len(isbn) != 13 {
+		return "", false
+	}
+	return isbn, true
+}
+
+func decodeFile(zr *zip.Reader, name string, v any) error {
+	f, err := zr.Open(name)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	dec := xml.NewDecoder(f)
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		// Non-UTF-8 package documents are rare; read them as-is rather than fail
+		return input, nil
+	}
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("parse %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const containerXML = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`
+
+// writeEPUB zips files into an EPUB in a temporary directory
+func writeEPUB(t *testing.T, files map[string]string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "book.epub")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name string
+		opf  string
+		want Metadata
+	}{
+		{
+			name: "EPUB 2",
+			opf: `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata>
+    <dc:title> Dune </dc:title>
+    <dc:creator opf:role="aut">Frank Herbert</dc:creator>
+    <dc:creator opf:role="ill">John Schoenherr</dc:creator>
+    <dc:identifier opf:scheme="ISBN">978-0-441-17271-9</dc:identifier>
+    <dc:identifier opf:scheme="UUID">urn:uuid:0c0f7d2e-1111</dc:identifier>
+    <dc:description>&lt;p&gt;Desert planet&lt;/p&gt;</dc:description>
+    <dc:subject>Science Fiction</dc:subject>
+    <dc:subject> </dc:subject>
+    <dc:language>en</dc:language>
+    <dc:publisher>Ace</dc:publisher>
+    <dc:date>1965-08-01</dc:date>
+    <meta name="cover" content="cover-img"/>
+  </metadata>
+  <manifest>
+    <item id="cover-img" href="images/cover%20art.jpg" media-type="image/jpeg"/>
+  </manifest>
+</package>`,
+			want: Metadata{
+				Title:       "Dune",
+				Creators:    []string{"Frank Herbert"},
+				Identifiers: []string{"978-0-441-17271-9", "urn:uuid:0c0f7d2e-1111"},
+				ISBNs:       []string{"9780441172719"},
+				Description: "<p>Desert planet</p>",
+				Subjects:    []string{"Science Fiction"},
+				Language:    "en",
+				Publisher:   "Ace",
+				Date:        "1965-08-01",
+				CoverPath:   "OEBPS/images/cover art.jpg",
+			},
+		},
+		{
+			name: "EPUB 3",
+			opf: `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Good Omens</dc:title>
+    <dc:title>The Nice and Accurate Prophecies of Agnes Nutter</dc:title>
+    <dc:creator id="c1">Neil Gaiman</dc:creator>
+    <dc:creator id="c2">Terry Pratchett</dc:creator>
+    <dc:creator id="c3">Stephen Briggs</dc:creator>
+    <meta refines="#c1" property="role" scheme="marc:relators">aut</meta>
+    <meta refines="#c3" property="role" scheme="marc:relators">nrt</meta>
+    <dc:identifier>urn:isbn:006085398X</dc:identifier>
+    <dc:identifier>urn:isbn:12345</dc:identifier>
+  </metadata>
+  <manifest>
+    <item id="img" href="../cover.png" media-type="image/png" properties="cover-image"/>
+  </manifest>
+</package>`,
+			want: Metadata{
+				Title:       "Good Omens",
+				Creators:    []string{"Neil Gaiman", "Terry Pratchett"},
+				Identifiers: []string{"urn:isbn:006085398X", "urn:isbn:12345"},
+				ISBNs:       []string{"006085398X"},
+				CoverPath:   "cover.png",
+			},
+		},
+		{
+			name: "cover by manifest ID",
+			opf: `<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Untitled</dc:title></metadata>
+  <manifest>
+    <item id="chapter1" href="ch1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="CoverImage" href="cover.jpg" media-type="image/jpeg"/>
+  </manifest>
+</package>`,
+			want: Metadata{Title: "Untitled", CoverPath: "OEBPS/cover.jpg"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeEPUB(t, map[string]string{
+				"META-INF/container.xml": containerXML,
+				"OEBPS/content.opf":      tt.opf,
+			})
+			got, err := Read(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Title != tt.want.Title || got.Description != tt.want.Description || got.Language != tt.want.Language ||
+				got.Publisher != tt.want.Publisher || got.Date != tt.want.Date || got.CoverPath != tt.want.CoverPath {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+			for _, list := range []struct {
+				name      string
+				got, want []string
+			}{
+				{"creators", got.Creators, tt.want.Creators},
+				{"identifiers", got.Identifiers, tt.want.Identifiers},
+				{"ISBNs", got.ISBNs, tt.want.ISBNs},
+				{"subjects", got.Subjects, tt.want.Subjects},
+			} {
+				if !slices.Equal(list.got, list.want) {
+					t.Errorf("%s = %q, want %q", list.name, list.got, list.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"no container", map[string]string{"OEBPS/content.opf": "<package/>"}},
+		{"no rootfile", map[string]string{"META-INF/container.xml": "<container><rootfiles/></container>"}},
+		{"missing package", map[string]string{"META-INF/container.xml": containerXML}},
+		{"broken package", map[string]string{"META-INF/container.xml": containerXML, "OEBPS/content.opf": "<package><metadata>"}},
+	}
+	for _, tt := range tests {
+		if _, err := Read(writeEPUB(t, tt.files)); err == nil {
+			t.Errorf("%s: Read succeeded", tt.name)
+		}
+	}
+
+	notZip := filepath.Join(t.TempDir(), "book.epub")
+	if err := os.WriteFile(notZip, []byte("not a zip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(notZip); err == nil {
+		t.Error("read a file that isn't a zip")
+	}
+}
+
+func TestReadCover(t *testing.T) {
+	opf := `<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata/>
+  <manifest><item id="c" href="cover.jpg" media-type="image/jpeg" properties="cover-image"/></manifest>
+</package>`
+	path := writeEPUB(t, map[string]string{
+		"META-INF/container.xml": containerXML,
+		"OEBPS/content.opf":      opf,
+		"OEBPS/cover.jpg":        "jpeg bytes",
+	})
+	data, err := ReadCover(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "jpeg bytes" {
+		t.Errorf("cover = %q", data)
+	}
+
+	path = writeEPUB(t, map[string]string{
+		"META-INF/container.xml": containerXML,
+		"OEBPS/content.opf":      `<package><metadata/><manifest/></package>`,
+	})
+	if data, err := ReadCover(path); data != nil || err != nil {
+		t.Errorf("ReadCover without a cover = %q, %v", data, err)
+	}
+}
+
+func TestISBNFrom(t *testing.T) {
+	tests := []struct {
+		value, scheme string
+		want          string
+		ok            bool
+	}{
+		{"urn:isbn:9780441172719", "", "9780441172719", true},
+		{"URN:ISBN:978-0-441-17271-9", "", "9780441172719", true},
+		{"isbn:0 441 17271 7", "", "0441172717", true},
+		{"080442957x", "ISBN", "080442957X", true},
+		{"9780441172719", "", "", false},
+		{"urn:isbn:97804411727", "", "", false},
+		{"urn:isbn:978044117271a", "", "", false},
+		{"urn:uuid:0c0f7d2e", "UUID", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := isbnFrom(tt.value, tt.scheme)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("isbnFrom(%q, %q) = %q, %v; want %q, %v", tt.value, tt.scheme, got, ok, tt.want, tt.ok)
+		}
+	}
+}
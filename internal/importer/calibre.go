@@ -0,0 +1,138 @@
+package importer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// CalibreSource names Calibre in external ID links
+const CalibreSource = "calibre"
+
+// ParseCalibre reads the books in a Calibre library directory (the one
+// holding metadata.db). The database is opened read-only, so Calibre may be
+// running. Records carry their Calibre ID, so importing again updates the
+// books imported last time.
+func ParseCalibre(ctx context.Context, dir string) ([]Record, error) {
+	dbPath := filepath.Join(dir, "metadata.db")
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("not a Calibre library: %w", err)
+	}
+
+	dsn := (&url.URL{Scheme: "file", Path: dbPath, RawQuery: "mode=ro"}).String()
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open Calibre database: %w", err)
+	}
+	defer db.Close()
+
+	authors, err := calibreLinks(ctx, db, `
+		SELECT l.book, a.name FROM books_authors_link l
+		JOIN authors a ON a.id = l.author ORDER BY l.id`)
+	if err != nil {
+		return nil, fmt.Errorf("read authors: %w", err)
+	}
+	tags, err := calibreLinks(ctx, db, `
+		SELECT l.book, t.name FROM books_tags_link l
+		JOIN tags t ON t.id = l.tag ORDER BY t.name`)
+	if err != nil {
+		return nil, fmt.Errorf("read tags: %w", err)
+	}
+	isbns, err := calibreLinks(ctx, db, `
+		SELECT book, val FROM identifiers WHERE LOWER(type) = 'isbn'`)
+	if err != nil {
+		return nil, fmt.Errorf("read identifiers: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT b.id, b.title, CAST(b.timestamp AS TEXT), b.path, b.has_cover, b.series_index,
+			COALESCE((SELECT text FROM comments WHERE book = b.id), ''),
+			COALESCE((SELECT r.rating FROM ratings r JOIN books_ratings_link l ON l.rating = r.id WHERE l.book = b.id), 0),
+			COALESCE((SELECT s.name FROM series s JOIN books_series_link l ON l.series = s.id WHERE l.book = b.id), '')
+		FROM books b ORDER BY b.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("read books: %w", err)
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var (
+			id                 int64
+			title, added, path string
+			hasCover           bool
+			seriesIndex        float64
+			comments, series   string
+			rating             int
+		)
+		if err := rows.Scan(&id, &title, &added, &path, &hasCover, &seriesIndex, &comments, &rating, &series); err != nil {
+			return nil, fmt.Errorf("read books: %w", err)
+		}
+
+		b := book.Book{
+			Title:       title,
+			Author:      strings.Join(authors[id], ", "),
+			Description: stripHTML(comments),
+			Tags:        tags[id],
+			Status:      book.StatusWantToRead,
+			DateAdded:   parseDate(added),
+			Rating:      float64(rating) / 2, // Calibre rates 0-10, in half stars
+		}
+		if b.DateAdded.IsZero() {
+			b.DateAdded = time.Now()
+		}
+		for _, isbn := range isbns[id] {
+			if isbn = cleanISBN(isbn); isISBN(isbn) {
+				b.ISBN = isbn
+				break
+			}
+		}
+		if series != "" {
+			b.Series = series
+			b.SeriesPosition = seriesIndex
+		}
+
+		rec := newRecord(int(id), b)
+		rec.Source = CalibreSource
+		rec.ExternalID = strconv.FormatInt(id, 10)
+		if hasCover {
+			cover := filepath.Join(dir, filepath.FromSlash(path), "cover.jpg")
+			if _, err := os.Stat(cover); err == nil {
+				rec.Cover = func() ([]byte, error) { return os.ReadFile(cover) }
+			}
+		}
+		records = append(records, rec)
+	}
+
+	return records, rows.Err()
+}
+
+// calibreLinks runs a (book id, value) query and groups values by book
+func calibreLinks(ctx context.Context, db *sql.DB, query string) (map[int64][]string, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make(map[int64][]string)
+	for rows.Next() {
+		var id int64
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			return nil, err
+		}
+		links[id] = append(links[id], value)
+	}
+	return links, rows.Err()
+}
@@ -0,0 +1,98 @@
+package importer
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+	"github.com/erwar/pka/internal/epub"
+)
+
+// EPUBSource names local EPUB files in external ID links; the ID is the
+// file's absolute path
+const EPUBSource = "epub"
+
+// FindEPUBs returns the .epub files at path: the file itself, or every EPUB
+// under a directory, sorted
+func FindEPUBs(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && strings.HasPrefix(d.Name(), ".") && p != path {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && strings.EqualFold(filepath.Ext(p), ".epub") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan %s: %w", path, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// ParseEPUBs reads the metadata of each EPUB file into a record linked to
+// the file. Files that can't be read become invalid records.
+func ParseEPUBs(paths []string) []Record {
+	records := make([]Record, 0, len(paths))
+	for i, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			abs = p
+		}
+
+		var rec Record
+		meta, err := epub.Read(abs)
+		if err != nil {
+			rec = Record{Line: i + 1, Book: book.Book{Title: filepath.Base(abs), FilePath: abs}, Invalid: err.Error()}
+		} else {
+			rec = newRecord(i+1, epubBook(abs, meta))
+			rec.Cover = func() ([]byte, error) { return epub.ReadCover(abs) }
+		}
+		rec.Source = EPUBSource
+		rec.ExternalID = abs
+		records = append(records, rec)
+	}
+	return records
+}
+
+func epubBook(path string, meta *epub.Metadata) book.Book {
+	b := book.Book{
+		Title:       meta.Title,
+		Author:      strings.Join(meta.Creators, ", "),
+		Description: stripHTML(meta.Description),
+		Tags:        meta.Subjects,
+		Format:      book.FormatEbook,
+		Status:      book.StatusWantToRead,
+		FilePath:    path,
+		DateAdded:   time.Now(),
+	}
+	if b.Title == "" {
+		b.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	// Prefer an ISBN-13
+	for _, isbn := range meta.ISBNs {
+		if isISBN(isbn) && (b.ISBN == "" || len(isbn) == 13 && len(b.ISBN) != 13) {
+			b.ISBN = isbn
+		}
+	}
+	return b
+}
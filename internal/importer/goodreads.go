@@ -0,0 +1,129 @@
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+// Goodreads exclusive shelves that map onto PKA statuses: the built-in ones
+// and the usual names of custom shelves for abandoned and paused books.
+// Other custom exclusive shelves fall back to want_to_read.
+var goodreadsShelves = map[string]book.Status{
+	"read":              book.StatusRead,
+	"currently-reading": book.StatusReading,
+	"to-read":           book.StatusWantToRead,
+	"did-not-finish":    book.StatusDNF,
+	"dnf":               book.StatusDNF,
+	"abandoned":         book.StatusDNF,
+	"paused":            book.StatusPaused,
+	"on-hold":           book.StatusPaused,
+}
+
+// ParseGoodreads reads a Goodreads library export
+// (My Books > Import and export > Export Library).
+func ParseGoodreads(r io.Reader) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	index := headerIndex(header)
+	if err := missingColumns(index, "title", "author"); err != nil {
+		return nil, fmt.Errorf("not a Goodreads export: %w", err)
+	}
+
+	var records []Record
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			rec, err := rowError(line, err)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, rec)
+			continue
+		}
+
+		b := goodreadsBook(row{record: record, index: index})
+		records = append(records, newRecord(line, b))
+	}
+
+	return records, nil
+}
+
+func goodreadsBook(r row) book.Book {
+	b := book.Book{
+		Title:     r.get("title"),
+		Author:    r.get("author"),
+		Status:    book.StatusWantToRead,
+		DateAdded: parseDate(r.get("date added")),
+	}
+	if b.DateAdded.IsZero() {
+		b.DateAdded = time.Now()
+	}
+
+	// Goodreads puts the series after the title: "Leviathan Wakes (The
+	// Expanse, #1)"
+	b.Title, b.Series, b.SeriesPosition = book.SplitSeriesTitle(b.Title)
+
+	if extra := r.get("additional authors"); extra != "" {
+		b.Author = strings.Join(append([]string{b.Author}, splitList(extra, ",")...), ", ")
+	}
+
+	// Prefer ISBN-13; Goodreads wraps both in ="..." to stop spreadsheets
+	// from mangling them
+	if isbn := cleanISBN(r.get("isbn13")); isbn != "" {
+		b.ISBN = isbn
+	} else {
+		b.ISBN = cleanISBN(r.get("isbn"))
+	}
+
+	// "My Rating" is 0 when unrated
+	b.Rating, _ = strconv.ParseFloat(r.get("my rating"), 64)
+	b.PageCount, _ = strconv.Atoi(r.get("number of pages"))
+	b.Format, _ = book.ParseFormat(r.get("binding"))
+
+	shelf := r.get("exclusive shelf")
+	if status, ok := goodreadsShelves[shelf]; ok {
+		b.Status = status
+	}
+	if readCount, _ := strconv.Atoi(r.get("read count")); readCount > 1 && b.Status == book.StatusReading {
+		b.Status = book.StatusRereading
+	}
+
+	b.DateRead = parseDate(r.get("date read"))
+	if b.Status == book.StatusRead && b.DateRead.IsZero() {
+		// Read without a date: the best we know is when it was shelved
+		b.DateRead = b.DateAdded
+	}
+
+	// Other shelves become tags, including custom exclusive shelves so
+	// states PKA doesn't know aren't lost
+	for _, s := range splitList(r.get("bookshelves"), ",") {
+		if _, builtin := goodreadsShelves[s]; !builtin {
+			b.Tags = append(b.Tags, s)
+		}
+	}
+	if _, builtin := goodreadsShelves[shelf]; !builtin && shelf != "" && !containsTag(b.Tags, shelf) {
+		b.Tags = append(b.Tags, shelf)
+	}
+
+	b.Notes = appendNote(b.Notes, "", stripHTML(r.get("my review")))
+	b.Notes = appendNote(b.Notes, "Private notes", r.get("private notes"))
+
+	return b
+}
@@ -0,0 +1,102 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+const goodreadsHeader = "Book Id,Title,Author,Author l-f,Additional Authors,ISBN,ISBN13,My Rating,Average Rating,Publisher,Binding,Number of Pages,Year Published,Original Publication Year,Date Read,Date Added,Bookshelves,Bookshelves with positions,Exclusive Shelf,My Review,Spoiler,Private Notes,Read Count,Owned Copies\n"
+
+func TestParseGoodreads(t *testing.T) {
+	tests := []struct {
+		name    string
+		row     string
+		want    book.Book
+		invalid string
+	}{
+		{
+			name: "read with series, review and notes",
+			row:  `8855321,"Leviathan Wakes (The Expanse, #1)",James S.A. Corey,"Corey, James S.A.",,"=""0316129089""","=""9780316129084""",4,4.27,Orbit,Paperback,592,2011,2011,2023/05/10,2023/01/02,"sci-fi, favorites","sci-fi (#3), favorites (#1)",read,"Great fun.<br/>Holden!",,Borrowed from Ana,1,0`,
+			want: book.Book{
+				Title: "Leviathan Wakes", Author: "James S.A. Corey",
+				Series: "The Expanse", SeriesPosition: 1,
+				ISBN: "9780316129084", Rating: 4, PageCount: 592, Format: book.FormatPhysical,
+				Status: book.StatusRead, DateAdded: date(2023, 1, 2), DateRead: date(2023, 5, 10),
+				Tags:  []string{"sci-fi", "favorites"},
+				Notes: "Great fun.\nHolden!\n\nPrivate notes: Borrowed from Ana",
+			},
+		},
+		{
+			name: "ISBN-10 only",
+			row:  `1,Dune,Frank Herbert,"Herbert, Frank",,"=""0441172717""","=""""",0,4.25,Ace,Kindle Edition,,1965,1965,,2024/03/01,,,to-read,,,,0,0`,
+			want: book.Book{
+				Title: "Dune", Author: "Frank Herbert", ISBN: "0441172717", Format: book.FormatEbook,
+				Status: book.StatusWantToRead, DateAdded: date(2024, 3, 1),
+			},
+		},
+		{
+			name: "second read in progress",
+			row:  `2,Good Omens,Neil Gaiman,"Gaiman, Neil",Terry Pratchett,,,5,4.25,,Hardcover,412,1990,1990,,2020/06/01,currently-reading,currently-reading (#1),currently-reading,,,,2,1`,
+			want: book.Book{
+				Title: "Good Omens", Author: "Neil Gaiman, Terry Pratchett", Rating: 5, PageCount: 412,
+				Format: book.FormatPhysical, Status: book.StatusRereading, DateAdded: date(2020, 6, 1),
+			},
+		},
+		{
+			name: "read without a date",
+			row:  `3,Piranesi,Susanna Clarke,"Clarke, Susanna",,,,0,4.2,,,,2020,2020,,2021/02/03,,,read,,,,1,0`,
+			want: book.Book{
+				Title: "Piranesi", Author: "Susanna Clarke",
+				Status: book.StatusRead, DateAdded: date(2021, 2, 3), DateRead: date(2021, 2, 3),
+			},
+		},
+		{
+			name: "abandoned shelf",
+			row:  `4,Ulysses,James Joyce,"Joyce, James",,,,0,3.7,,,,1922,1922,,2022/07/04,"abandoned, classics",,abandoned,,,,0,0`,
+			want: book.Book{
+				Title: "Ulysses", Author: "James Joyce",
+				Status: book.StatusDNF, DateAdded: date(2022, 7, 4), Tags: []string{"classics"},
+			},
+		},
+		{
+			name: "custom exclusive shelf kept as a tag",
+			row:  `5,Hyperion,Dan Simmons,"Simmons, Dan",,,,0,4.2,,,482,1989,1989,,2019/11/11,,,owned-unread,,,,0,1`,
+			want: book.Book{
+				Title: "Hyperion", Author: "Dan Simmons", PageCount: 482,
+				Status: book.StatusWantToRead, DateAdded: date(2019, 11, 11), Tags: []string{"owned-unread"},
+			},
+		},
+		{
+			name:    "missing title",
+			row:     `6,,Anonymous,,,,,0,0,,,,,,,2019/11/11,,,to-read,,,,0,0`,
+			want:    book.Book{Author: "Anonymous", Status: book.StatusWantToRead, DateAdded: date(2019, 11, 11)},
+			invalid: "missing title",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := ParseGoodreads(strings.NewReader(goodreadsHeader + tt.row + "\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("got %d records, want 1", len(records))
+			}
+			if records[0].Line != 2 || records[0].Invalid != tt.invalid {
+				t.Errorf("line %d invalid %q, want line 2 invalid %q", records[0].Line, records[0].Invalid, tt.invalid)
+			}
+			checkBook(t, records[0].Book, tt.want)
+		})
+	}
+}
+
+func TestParseGoodreadsErrors(t *testing.T) {
+	if _, err := ParseGoodreads(strings.NewReader("Name,Rating\nDune,5\n")); err == nil {
+		t.Error("parsed a file without title and author columns")
+	}
+	if _, err := ParseGoodreads(strings.NewReader("")); err == nil {
+		t.Error("parsed an empty file")
+	}
+}
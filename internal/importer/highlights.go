@@ -0,0 +1,189 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+// Highlight is a quote read from a reading device or app, with the title
+// and author of the book it was made in
+type Highlight struct {
+	Title  string
+	Author string
+	Quote  book.Quote
+
+	// The book's ID on the device, if it has one, linked to the library
+	// book on import
+	Source     string
+	ExternalID string
+	Match      *book.Book // library book, if already known
+}
+
+// HighlightBook is the highlights made in one book, and the library book
+// they will be added to
+type HighlightBook struct {
+	Title       string
+	Author      string
+	Source      string
+	ExternalID  string
+	Quotes      []book.Quote
+	Match       *book.Book // nil if the book will be created
+	MatchReason string
+	Similar     *book.Book // set when Match is only a close title and author
+	Score       float64    // MatchScore of Similar
+	Added       int        // quotes added by CommitHighlights
+	Error       string
+}
+
+// HighlightResult summarizes CommitHighlights
+type HighlightResult struct {
+	BooksCreated int
+	BooksMatched int
+	QuotesAdded  int
+	QuotesKnown  int // already saved on the book
+	Failed       int // books that couldn't be created or updated
+}
+
+// GroupHighlights groups highlights by book, drops repeated highlights and
+// matches each book against the library: by the highlight's Match or
+// external ID, or else with the same rules as other imports (ISBN, or
+// normalized title and author). Devices keep subtitles and series in the
+// title, so a book without an exact match goes to the closest library book
+// by title without its subtitle, which is noted as Similar.
+func GroupHighlights(ctx context.Context, svc *book.Service, highlights []Highlight) ([]HighlightBook, error) {
+	var groups []HighlightBook
+	index := make(map[string]int)
+	for _, h := range highlights {
+		key := book.TitleKey(h.Title, h.Author)
+		switch {
+		case h.Match != nil:
+			key = fmt.Sprintf("#%d", h.Match.ID)
+		case h.ExternalID != "":
+			key = h.Source + ":" + h.ExternalID
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, HighlightBook{Title: h.Title, Author: h.Author, Match: h.Match})
+			if h.Match != nil {
+				groups[i].MatchReason = "document"
+			}
+		}
+		if groups[i].ExternalID == "" && h.ExternalID != "" {
+			groups[i].Source, groups[i].ExternalID = h.Source, h.ExternalID
+		}
+		groups[i].Quotes = addHighlight(groups[i].Quotes, h.Quote)
+	}
+
+	var library []book.Book
+	for i := range groups {
+		g := &groups[i]
+		if g.Match != nil {
+			continue
+		}
+		if g.ExternalID != "" {
+			linked, err := svc.FindByExternalID(ctx, g.Source, g.ExternalID)
+			if err != nil {
+				return nil, fmt.Errorf("match %q: %w", g.Title, err)
+			}
+			if linked != nil {
+				g.Match, g.MatchReason = linked, g.Source+" ID"
+				continue
+			}
+		}
+		match, reason, err := svc.CheckDuplicate(ctx, &book.Book{Title: g.Title, Author: g.Author})
+		if err != nil {
+			return nil, fmt.Errorf("match %q: %w", g.Title, err)
+		}
+		if match != nil {
+			g.Match, g.MatchReason = match, reason
+			continue
+		}
+
+		if library == nil {
+			if library, err = svc.List(ctx); err != nil {
+				return nil, fmt.Errorf("list books: %w", err)
+			}
+		}
+		similar, score := book.BestMatch(&book.Book{Title: book.NormalizeTitle(g.Title), Author: g.Author}, library)
+		if similar != nil {
+			g.Match, g.MatchReason = similar, "similar title"
+			g.Similar, g.Score = similar, score
+		}
+	}
+
+	return groups, nil
+}
+
+// addHighlight appends q unless quotes already has it. A highlight that
+// extends an earlier one replaces it, keeping the earlier note if q has none.
+func addHighlight(quotes []book.Quote, q book.Quote) []book.Quote {
+	for i := range quotes {
+		if !book.SameQuote(&quotes[i], &q) {
+			continue
+		}
+		if len(q.Text) > len(quotes[i].Text) {
+			if q.Note == "" {
+				q.Note = quotes[i].Note
+			}
+			quotes[i] = q
+		} else if quotes[i].Note == "" {
+			quotes[i].Note = q.Note
+		}
+		return quotes
+	}
+	return append(quotes, q)
+}
+
+// CommitHighlights creates the unmatched books with the given status and
+// adds each group's quotes to its book, skipping quotes the book already has
+func CommitHighlights(ctx context.Context, svc *book.Service, groups []HighlightBook, status book.Status) (HighlightResult, error) {
+	var res HighlightResult
+	for i := range groups {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		g := &groups[i]
+
+		if g.Match == nil {
+			b := &book.Book{
+				Title:     g.Title,
+				Author:    g.Author,
+				Status:    status,
+				DateAdded: time.Now(),
+			}
+			if err := svc.AddSkipDuplicateCheck(ctx, b); err != nil {
+				g.Error = err.Error()
+				res.Failed++
+				continue
+			}
+			g.Match = b
+			res.BooksCreated++
+		} else {
+			res.BooksMatched++
+		}
+
+		if g.ExternalID != "" {
+			if err := svc.LinkExternalID(ctx, g.Match.ID, g.Source, g.ExternalID); err != nil {
+				g.Error = err.Error()
+				res.Failed++
+				continue
+			}
+		}
+
+		added, err := svc.AddQuotes(ctx, g.Match.ID, g.Quotes)
+		g.Added = added
+		res.QuotesAdded += added
+		if err != nil {
+			g.Error = err.Error()
+			res.Failed++
+			continue
+		}
+		res.QuotesKnown += len(g.Quotes) - added
+	}
+	return res, nil
+}
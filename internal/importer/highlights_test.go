@@ -0,0 +1,79 @@
+package importer
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/erwar/pka/internal/book"
+	"github.com/erwar/pka/internal/storage"
+)
+
+type fakeEmbedder struct{}
+
+func (fakeEmbedder) Generate(ctx context.Context, text string) ([]float32, error) {
+	return []float32{1, 0, 0}, nil
+}
+
+func TestGroupHighlights(t *testing.T) {
+	ctx := context.Background()
+	repo, err := storage.NewSQLiteRepository(filepath.Join(t.TempDir(), "books.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	svc := book.NewService(repo, fakeEmbedder{})
+
+	library := map[string]*book.Book{}
+	for _, b := range []book.Book{
+		{Title: "Dune", Author: "Frank Herbert"},
+		{Title: "Dune Messiah", Author: "Frank Herbert"},
+		{Title: "Sapiens", Author: "Yuval Noah Harari"},
+		{Title: "Saga, Volume 1", Author: "Brian K. Vaughan"},
+	} {
+		b := b
+		if err := svc.AddSkipDuplicateCheck(ctx, &b); err != nil {
+			t.Fatal(err)
+		}
+		library[b.Title] = &b
+	}
+
+	tests := []struct {
+		title, author string
+		want          string // library title, "" for a new book
+		similar       bool
+	}{
+		{"Dune", "Herbert, Frank", "Dune", false},
+		{"Dune (Dune Chronicles, Book 1)", "Frank Herbert", "Dune", true},
+		{"Dune Messiah", "Frank Herbert", "Dune Messiah", false},
+		{"Sapiens: A Brief History of Humankind", "Yuval Noah Harari", "Sapiens", true},
+		{"Sapiens: A Brief History of Humankind", "Someone Else", "", false},
+		{"Saga: Volume 2", "Brian K. Vaughan", "", false},
+		{"Piranesi", "Susanna Clarke", "", false},
+	}
+	var highlights []Highlight
+	for _, tt := range tests {
+		highlights = append(highlights, Highlight{Title: tt.title, Author: tt.author, Quote: book.Quote{Text: "a quote"}})
+	}
+
+	groups, err := GroupHighlights(ctx, svc, highlights)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != len(tests) {
+		t.Fatalf("got %d groups, want %d", len(groups), len(tests))
+	}
+	for i, tt := range tests {
+		g := groups[i]
+		switch {
+		case tt.want == "":
+			if g.Match != nil {
+				t.Errorf("%q by %s matched #%d %q, want a new book", tt.title, tt.author, g.Match.ID, g.Match.Title)
+			}
+		case g.Match == nil || g.Match.ID != library[tt.want].ID:
+			t.Errorf("%q by %s matched %+v, want %q", tt.title, tt.author, g.Match, tt.want)
+		case (g.Similar != nil) != tt.similar:
+			t.Errorf("%q by %s: similar = %v, want %v", tt.title, tt.author, g.Similar != nil, tt.similar)
+		}
+	}
+}
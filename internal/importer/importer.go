@@ -0,0 +1,201 @@
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+// Record is one book parsed from an import file
+type Record struct {
+	Line    int       // line or entry number in the source file, for messages
+	Book    book.Book // parsed book, not yet saved
+	Invalid string    // why the row can't be imported, empty if valid
+
+	// Set by sources that can be imported again to sync changes
+	Source     string                 // e.g. "calibre"
+	ExternalID string                 // the book's ID in Source
+	Cover      func() ([]byte, error) // loads a local cover image, stored by the caller after Commit
+}
+
+// newRecord wraps a parsed book, flagging it invalid if it fails validation
+func newRecord(line int, b book.Book) Record {
+	return Record{Line: line, Book: b, Invalid: validate(&b)}
+}
+
+// validate returns why b can't be saved, or "" if it can
+func validate(b *book.Book) string {
+	switch {
+	case strings.TrimSpace(b.Title) == "":
+		return "missing title"
+	case !b.Status.IsValid():
+		return fmt.Sprintf("invalid status %q", b.Status)
+	case b.Rating < 0 || b.Rating > 5:
+		return fmt.Sprintf("invalid rating %s (use 0-5)", book.FormatRating(b.Rating))
+	}
+	return ""
+}
+
+// rowError turns a malformed CSV row into an invalid record so the rest of
+// the file can still be imported. Other read errors are returned.
+func rowError(line int, err error) (Record, error) {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return Record{Line: line, Invalid: parseErr.Err.Error()}, nil
+	}
+	return Record{}, fmt.Errorf("line %d: %w", line, err)
+}
+
+// Result summarizes an import run
+type Result struct {
+	Imported int
+	Merged   int // folded into an existing book
+	Updated  int // linked books synced from their source
+	Skipped  int // duplicates or rows the user skipped
+	Failed   int
+}
+
+// Parsers maps other services' export formats to their parser. PKA's own
+// formats are read by ParseJSON and ParseCSV.
+var Parsers = map[string]func(io.Reader) ([]Record, error){
+	"goodreads":    ParseGoodreads,
+	"storygraph":   ParseStoryGraph,
+	"librarything": ParseLibraryThing,
+}
+
+// Import adds each record to the library, skipping duplicates. It is
+// Preview followed by Commit with the default decisions.
+func Import(ctx context.Context, svc *book.Service, records []Record) (Result, error) {
+	rows, err := Preview(ctx, svc, records)
+	if err != nil {
+		return Result{}, err
+	}
+	return Commit(ctx, svc, rows)
+}
+
+// Date layouts seen in the export formats we read
+var dateLayouts = []string{
+	"2006/01/02",
+	"2006-01-02",
+	time.RFC3339,
+	"2006-01-02 15:04:05.999999999-07:00", // Calibre
+	"2006-01-02 15:04:05",
+	"2006/01",
+	"2006-01",
+	"2006",
+}
+
+func parseDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+var (
+	brTag   = regexp.MustCompile(`(?i)<br\s*/?>`)
+	htmlTag = regexp.MustCompile(`<[^>]*>`)
+)
+
+// stripHTML turns the light HTML used in reviews into plain text
+func stripHTML(s string) string {
+	s = brTag.ReplaceAllString(s, "\n")
+	s = htmlTag.ReplaceAllString(s, "")
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+// appendNote joins note sections with a blank line
+func appendNote(notes, label, text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return notes
+	}
+	if label != "" {
+		text = label + ": " + text
+	}
+	if notes == "" {
+		return text
+	}
+	return notes + "\n\n" + text
+}
+
+// cleanISBN strips spreadsheet quoting (="0441172717") and separators
+func cleanISBN(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "=")
+	s = strings.Trim(s, `"`)
+	s = strings.ReplaceAll(s, "-", "")
+	s = strings.ReplaceAll(s, " ", "")
+	return s
+}
+
+// splitList splits a separated list, trimming and dropping empty entries
+func splitList(s, sep string) []string {
+	var out []string
+	for _, part := range strings.Split(s, sep) {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerIndex maps lowercased, trimmed header names to column indexes
+func headerIndex(header []string) map[string]int {
+	idx := make(map[string]int, len(header))
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		idx[h] = i
+	}
+	return idx
+}
+
+// row gives access to a CSV record by header name
+type row struct {
+	record []string
+	index  map[string]int
+}
+
+func (r row) get(name string) string {
+	i, ok := r.index[name]
+	if !ok || i >= len(r.record) {
+		return ""
+	}
+	return strings.TrimSpace(r.record[i])
+}
+
+func missingColumns(index map[string]int, required ...string) error {
+	var missing []string
+	for _, name := range required {
+		if _, ok := index[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing column(s): %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package importer
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+// checkBook compares the fields importers fill in. DateAdded is only
+// compared when want has one, as rows without it get the time of import.
+func checkBook(t *testing.T, got, want book.Book) {
+	t.Helper()
+	if got.Title != want.Title || got.Author != want.Author {
+		t.Errorf("got %q by %q, want %q by %q", got.Title, got.Author, want.Title, want.Author)
+	}
+	if got.Series != want.Series || got.SeriesPosition != want.SeriesPosition {
+		t.Errorf("series = %q #%v, want %q #%v", got.Series, got.SeriesPosition, want.Series, want.SeriesPosition)
+	}
+	if got.ISBN != want.ISBN {
+		t.Errorf("ISBN = %q, want %q", got.ISBN, want.ISBN)
+	}
+	if got.Rating != want.Rating {
+		t.Errorf("rating = %v, want %v", got.Rating, want.Rating)
+	}
+	if got.PageCount != want.PageCount || got.Format != want.Format || got.Publisher != want.Publisher {
+		t.Errorf("edition = %d pages, %q, %q; want %d pages, %q, %q", got.PageCount, got.Format, got.Publisher, want.PageCount, want.Format, want.Publisher)
+	}
+	if got.Status != want.Status {
+		t.Errorf("status = %s, want %s", got.Status, want.Status)
+	}
+	if !want.DateAdded.IsZero() && !got.DateAdded.Equal(want.DateAdded) {
+		t.Errorf("added = %v, want %v", got.DateAdded, want.DateAdded)
+	}
+	if !got.DateRead.Equal(want.DateRead) {
+		t.Errorf("read = %v, want %v", got.DateRead, want.DateRead)
+	}
+	if !slices.Equal(got.Tags, want.Tags) {
+		t.Errorf("tags = %q, want %q", got.Tags, want.Tags)
+	}
+	if got.Notes != want.Notes {
+		t.Errorf("notes = %q, want %q", got.Notes, want.Notes)
+	}
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2023/05/10", date(2023, 5, 10)},
+		{"2023-05-10", date(2023, 5, 10)},
+		{" 2023-05-10 ", date(2023, 5, 10)},
+		{"2023-05-10T08:30:00Z", time.Date(2023, 5, 10, 8, 30, 0, 0, time.UTC)},
+		{"2023/05", date(2023, 5, 1)},
+		{"2023", date(2023, 1, 1)},
+		{"", time.Time{}},
+		{"May 10, 2023", time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := parseDate(tt.in); !got.Equal(tt.want) {
+			t.Errorf("parseDate(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCleanISBN(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`="0441172717"`, "0441172717"},
+		{`=""`, ""},
+		{"978-0-441-17271-9", "9780441172719"},
+		{" 978 0441172719 ", "9780441172719"},
+	}
+	for _, tt := range tests {
+		if got := cleanISBN(tt.in); got != tt.want {
+			t.Errorf("cleanISBN(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStripHTML(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Loved it.<br/><br/>Would <b>reread</b>.", "Loved it.\n\nWould reread."},
+		{"Fish &amp; chips<BR>", "Fish & chips"},
+		{"plain", "plain"},
+	}
+	for _, tt := range tests {
+		if got := stripHTML(tt.in); got != tt.want {
+			t.Errorf("stripHTML(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		b    book.Book
+		want string
+	}{
+		{"valid", book.Book{Title: "Dune", Status: book.StatusRead, Rating: 4.75}, ""},
+		{"no title", book.Book{Title: " ", Status: book.StatusRead}, "missing title"},
+		{"bad status", book.Book{Title: "Dune", Status: "lost"}, `invalid status "lost"`},
+		{"bad rating", book.Book{Title: "Dune", Status: book.StatusRead, Rating: 6}, "invalid rating 6 (use 0-5)"},
+	}
+	for _, tt := range tests {
+		if got := validate(&tt.b); got != tt.want {
+			t.Errorf("%s: validate = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
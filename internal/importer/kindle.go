@@ -0,0 +1,233 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+// KindleSource marks quotes imported from Kindle clippings
+const KindleSource = "kindle"
+
+// kindleSeparator ends each entry in My Clippings.txt
+const kindleSeparator = "=========="
+
+// kindleDateLayouts are the "Added on" formats of English-language Kindles
+var kindleDateLayouts = []string{
+	"Monday, January 2, 2006 3:04:05 PM",
+	"Monday, 2 January 2006 15:04:05",
+	"Monday, January 2, 2006, 3:04:05 PM",
+	"Monday, 2 January 2006, 15:04:05",
+}
+
+// kindleClipping is one entry of My Clippings.txt
+type kindleClipping struct {
+	title, author string
+	kind          string // "highlight", "note", "bookmark" or "clip"
+	page          int
+	location      string
+	added         time.Time
+	text          string
+}
+
+// ParseKindleClippings reads a Kindle "My Clippings.txt" file. Highlights
+// become quotes, and notes are attached to the highlight they were made on
+// (or kept as notes without a passage). Bookmarks are ignored, as are
+// entries that can't be read.
+func ParseKindleClippings(r io.Reader) ([]Highlight, error) {
+	var clippings []kindleClipping
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(strings.TrimPrefix(scanner.Text(), "\ufeff"), "\r")
+		if strings.TrimSpace(line) != kindleSeparator {
+			lines = append(lines, line)
+			continue
+		}
+		if c, ok := parseKindleClipping(lines); ok {
+			clippings = append(clippings, c)
+		}
+		lines = lines[:0]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read clippings: %w", err)
+	}
+	if c, ok := parseKindleClipping(lines); ok {
+		clippings = append(clippings, c)
+	}
+
+	var highlights []Highlight
+	for _, c := range clippings {
+		switch c.kind {
+		case "highlight", "clip":
+			highlights = append(highlights, Highlight{
+				Title:  c.title,
+				Author: c.author,
+				Quote: book.Quote{
+					Text:      c.text,
+					Location:  c.location,
+					Page:      c.page,
+					Source:    KindleSource,
+					DateAdded: c.added,
+				},
+			})
+		case "note":
+			if i := kindleNoteTarget(highlights, c); i >= 0 {
+				highlights[i].Quote.Note = appendNote(highlights[i].Quote.Note, "", c.text)
+				continue
+			}
+			highlights = append(highlights, Highlight{
+				Title:  c.title,
+				Author: c.author,
+				Quote: book.Quote{
+					Note:      c.text,
+					Location:  c.location,
+					Page:      c.page,
+					Source:    KindleSource,
+					DateAdded: c.added,
+				},
+			})
+		}
+	}
+
+	return highlights, nil
+}
+
+// kindleNoteTarget finds the latest highlight in the note's book whose
+// location range contains the note's location; Kindle stores a note at the
+// end of the highlight it was made on
+func kindleNoteTarget(highlights []Highlight, note kindleClipping) int {
+	loc, _, ok := book.LocationRange(note.location)
+	if !ok {
+		return -1
+	}
+	for i := len(highlights) - 1; i >= 0; i-- {
+		h := highlights[i]
+		if h.Title != note.title || h.Author != note.author || h.Quote.Text == "" {
+			continue
+		}
+		if start, end, ok := book.LocationRange(h.Quote.Location); ok && start <= loc && loc <= end {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseKindleClipping reads one entry: a "Title (Author)" line, a
+// "- Your Highlight on page 12 | Location 170-171 | Added on ..." line, a
+// blank line and the text
+func parseKindleClipping(lines []string) (kindleClipping, bool) {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	if len(lines) < 2 {
+		return kindleClipping{}, false
+	}
+
+	var c kindleClipping
+	c.title, c.author = splitKindleTitle(strings.TrimSpace(lines[0]))
+	if c.title == "" {
+		return c, false
+	}
+
+	for i, part := range strings.Split(strings.TrimPrefix(strings.TrimSpace(lines[1]), "- "), "|") {
+		part = strings.TrimSpace(part)
+		lower := strings.ToLower(part)
+		if i == 0 {
+			for _, kind := range []string{"highlight", "note", "bookmark", "clip"} {
+				if strings.Contains(lower, kind) {
+					c.kind = kind
+					break
+				}
+			}
+		}
+		switch {
+		case strings.HasPrefix(lower, "added on "):
+			c.added = parseKindleDate(part[len("added on "):])
+		default:
+			if v, ok := valueAfter(lower, part, "page "); ok {
+				c.page, _ = strconv.Atoi(v)
+			}
+			for _, prefix := range []string{"location ", "loc. "} {
+				if v, ok := valueAfter(lower, part, prefix); ok {
+					c.location = v
+				}
+			}
+		}
+	}
+	if c.kind == "" {
+		return c, false
+	}
+
+	c.text = strings.TrimSpace(strings.Join(lines[2:], "\n"))
+	if c.text == "" && c.kind != "bookmark" {
+		return c, false
+	}
+	return c, true
+}
+
+// valueAfter returns the word following prefix in part, matched on its
+// lowercase form
+func valueAfter(lower, part, prefix string) (string, bool) {
+	i := strings.Index(lower, prefix)
+	if i < 0 {
+		return "", false
+	}
+	fields := strings.Fields(part[i+len(prefix):])
+	if len(fields) == 0 {
+		return "", false
+	}
+	return fields[0], true
+}
+
+// splitKindleTitle splits "Dune (Herbert, Frank)" into title and author.
+// The author is the last parenthesized group; "Last, First" is turned
+// around and several authors ("A; B") are joined with commas.
+func splitKindleTitle(line string) (string, string) {
+	if !strings.HasSuffix(line, ")") {
+		return line, ""
+	}
+	depth := 0
+	for i := len(line) - 1; i >= 0; i-- {
+		switch line[i] {
+		case ')':
+			depth++
+		case '(':
+			depth--
+		}
+		if depth == 0 {
+			title := strings.TrimSpace(line[:i])
+			if title == "" {
+				return line, ""
+			}
+			var authors []string
+			for _, a := range strings.Split(line[i+1:len(line)-1], ";") {
+				if last, first, ok := strings.Cut(a, ","); ok && !strings.Contains(first, ",") {
+					a = strings.TrimSpace(first) + " " + strings.TrimSpace(last)
+				}
+				if a = strings.TrimSpace(a); a != "" {
+					authors = append(authors, a)
+				}
+			}
+			return title, strings.Join(authors, ", ")
+		}
+	}
+	return line, ""
+}
+
+func parseKindleDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range kindleDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,183 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+func TestParseKindleClippings(t *testing.T) {
+	clippings := "\ufeffDune (Herbert, Frank)\r\n" +
+		"- Your Highlight on page 12 | Location 170-172 | Added on Monday, March 4, 2024 9:15:02 PM\r\n" +
+		"\r\n" +
+		"I must not fear.\r\n" +
+		"==========\r\n" +
+		"Dune (Herbert, Frank)\r\n" +
+		"- Your Note on page 12 | Location 172 | Added on Monday, March 4, 2024 9:16:00 PM\r\n" +
+		"\r\n" +
+		"The litany\r\n" +
+		"==========\r\n" +
+		"Dune (Herbert, Frank)\r\n" +
+		"- Your Bookmark on page 40 | Location 600 | Added on Monday, March 4, 2024 10:00:00 PM\r\n" +
+		"\r\n" +
+		"\r\n" +
+		"==========\r\n" +
+		"Good Omens (Gaiman, Neil; Pratchett, Terry)\r\n" +
+		"- Your Note at location 900 | Added on Tuesday, 5 March 2024 08:00:00\r\n" +
+		"\r\n" +
+		"Read this aloud\r\n" +
+		"==========\r\n" +
+		"The Hobbit (J.R.R. Tolkien)\r\n" +
+		"- Highlight Loc. 45-46 | Added on Wednesday, March 6, 2024, 7:30:00 AM\r\n" +
+		"\r\n" +
+		"In a hole in the ground\r\n" +
+		"there lived a hobbit.\r\n" +
+		"==========\r\n" +
+		"Broken entry without a header line\r\n" +
+		"==========\r\n" +
+		"Piranesi (Susanna Clarke)\r\n" +
+		"- Your Highlight on page 3 | Location 50-51 | Added on Thursday, March 7, 2024 1:00:00 PM\r\n" +
+		"\r\n" +
+		"The Beauty of the House is immeasurable\r\n"
+
+	got, err := ParseKindleClippings(strings.NewReader(clippings))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Highlight{
+		{Title: "Dune", Author: "Frank Herbert", Quote: book.Quote{
+			Text: "I must not fear.", Note: "The litany", Location: "170-172", Page: 12,
+			DateAdded: time.Date(2024, 3, 4, 21, 15, 2, 0, time.Local),
+		}},
+		{Title: "Good Omens", Author: "Neil Gaiman, Terry Pratchett", Quote: book.Quote{
+			Note: "Read this aloud", Location: "900",
+			DateAdded: time.Date(2024, 3, 5, 8, 0, 0, 0, time.Local),
+		}},
+		{Title: "The Hobbit", Author: "J.R.R. Tolkien", Quote: book.Quote{
+			Text: "In a hole in the ground\nthere lived a hobbit.", Location: "45-46",
+			DateAdded: time.Date(2024, 3, 6, 7, 30, 0, 0, time.Local),
+		}},
+		{Title: "Piranesi", Author: "Susanna Clarke", Quote: book.Quote{
+			Text: "The Beauty of the House is immeasurable", Location: "50-51", Page: 3,
+			DateAdded: time.Date(2024, 3, 7, 13, 0, 0, 0, time.Local),
+		}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d highlights, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Title != w.Title || g.Author != w.Author {
+			t.Errorf("%d: got %q by %q, want %q by %q", i, g.Title, g.Author, w.Title, w.Author)
+		}
+		q, wq := g.Quote, w.Quote
+		if q.Text != wq.Text || q.Note != wq.Note || q.Location != wq.Location || q.Page != wq.Page {
+			t.Errorf("%d: got quote %+v, want %+v", i, q, wq)
+		}
+		if !q.DateAdded.Equal(wq.DateAdded) {
+			t.Errorf("%d: added %v, want %v", i, q.DateAdded, wq.DateAdded)
+		}
+		if q.Source != KindleSource {
+			t.Errorf("%d: source %q", i, q.Source)
+		}
+	}
+}
+
+func TestKindleNoteTarget(t *testing.T) {
+	highlights := []Highlight{
+		{Title: "Dune", Author: "Frank Herbert", Quote: book.Quote{Text: "first", Location: "100-110"}},
+		{Title: "Dune", Author: "Frank Herbert", Quote: book.Quote{Text: "second", Location: "105-120"}},
+		{Title: "Dune", Author: "Frank Herbert", Quote: book.Quote{Note: "a note", Location: "130"}},
+		{Title: "Dune Messiah", Author: "Frank Herbert", Quote: book.Quote{Text: "other book", Location: "140-150"}},
+	}
+	tests := []struct {
+		name     string
+		title    string
+		location string
+		want     int
+	}{
+		{"end of a highlight", "Dune", "110", 1},
+		{"latest of two", "Dune", "108", 1},
+		{"only the first", "Dune", "101", 0},
+		{"not on a highlight", "Dune", "125", -1},
+		{"not on a note", "Dune", "130", -1},
+		{"other book", "Dune", "145", -1},
+		{"no location", "Dune", "", -1},
+	}
+	for _, tt := range tests {
+		note := kindleClipping{title: tt.title, author: "Frank Herbert", kind: "note", location: tt.location}
+		if got := kindleNoteTarget(highlights, note); got != tt.want {
+			t.Errorf("%s: kindleNoteTarget = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSplitKindleTitle(t *testing.T) {
+	tests := []struct {
+		line, title, author string
+	}{
+		{"Dune (Herbert, Frank)", "Dune", "Frank Herbert"},
+		{"Dune (Frank Herbert)", "Dune", "Frank Herbert"},
+		{"Good Omens (Gaiman, Neil; Pratchett, Terry)", "Good Omens", "Neil Gaiman, Terry Pratchett"},
+		{"The Expanse (Book 1) (Corey, James S. A.)", "The Expanse (Book 1)", "James S. A. Corey"},
+		{"Notes (2024 (draft))", "Notes", "2024 (draft)"},
+		{"Untitled", "Untitled", ""},
+		{"(Anonymous)", "(Anonymous)", ""},
+	}
+	for _, tt := range tests {
+		title, author := splitKindleTitle(tt.line)
+		if title != tt.title || author != tt.author {
+			t.Errorf("splitKindleTitle(%q) = %q, %q; want %q, %q", tt.line, title, author, tt.title, tt.author)
+		}
+	}
+}
+
+func TestAddHighlight(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []book.Quote
+		add      book.Quote
+		want     []book.Quote
+	}{
+		{
+			name:     "new passage",
+			existing: []book.Quote{{Text: "Fear is the mind-killer.", Location: "170-171"}},
+			add:      book.Quote{Text: "I must not fear.", Location: "169-170"},
+			want:     []book.Quote{{Text: "Fear is the mind-killer.", Location: "170-171"}, {Text: "I must not fear.", Location: "169-170"}},
+		},
+		{
+			name:     "extended highlight keeps the note",
+			existing: []book.Quote{{Text: "I must not fear.", Note: "litany", Location: "170"}},
+			add:      book.Quote{Text: "I must not fear. Fear is the mind-killer.", Location: "170-171"},
+			want:     []book.Quote{{Text: "I must not fear. Fear is the mind-killer.", Note: "litany", Location: "170-171"}},
+		},
+		{
+			name:     "repeat fills in the note",
+			existing: []book.Quote{{Text: "I must not fear.", Location: "170"}},
+			add:      book.Quote{Text: "i must not fear.", Note: "litany", Location: "170"},
+			want:     []book.Quote{{Text: "I must not fear.", Note: "litany", Location: "170"}},
+		},
+		{
+			name:     "same words elsewhere in the book",
+			existing: []book.Quote{{Text: "Fear is the mind-killer.", Location: "170-171"}},
+			add:      book.Quote{Text: "Fear is the mind-killer.", Location: "4100-4101"},
+			want:     []book.Quote{{Text: "Fear is the mind-killer.", Location: "170-171"}, {Text: "Fear is the mind-killer.", Location: "4100-4101"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := addHighlight(tt.existing, tt.add)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].Text != tt.want[i].Text || got[i].Note != tt.want[i].Note || got[i].Location != tt.want[i].Location {
+					t.Errorf("%d: got %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package importer
+
+import (
+	"strings"
+
+	"github.com/erwar/pka/internal/book"
+	"github.com/erwar/pka/internal/koreader"
+	"github.com/erwar/pka/internal/kosync"
+)
+
+// ParseKOReader reads the highlights and notes in KOReader sidecar files
+// (see koreader.FindSidecars). Highlights carry the document's digest, so
+// the book they are added to also receives progress synced for it. Files
+// that can't be read are returned as errors alongside the rest.
+func ParseKOReader(paths []string) ([]Highlight, []error) {
+	var highlights []Highlight
+	var errs []error
+	for _, p := range paths {
+		s, err := koreader.ReadSidecar(p)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		author := strings.Join(splitList(s.Authors, "\n"), ", ")
+		for _, a := range s.Annotations {
+			highlights = append(highlights, Highlight{
+				Title:  s.Title,
+				Author: author,
+				Quote: book.Quote{
+					Text:      a.Text,
+					Note:      a.Note,
+					Page:      a.Page,
+					Chapter:   a.Chapter,
+					Source:    kosync.Source,
+					DateAdded: a.Datetime,
+				},
+				Source:     kosync.Source,
+				ExternalID: strings.ToLower(s.Document),
+			})
+		}
+	}
+	return highlights, errs
+}
@@ -0,0 +1,319 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+// LibraryThing collections that map onto PKA statuses
+var libraryThingCollections = map[string]book.Status{
+	"currently reading": book.StatusReading,
+	"read but unowned":  book.StatusRead,
+	"did not finish":    book.StatusDNF,
+	"abandoned":         book.StatusDNF,
+	"on hold":           book.StatusPaused,
+	"to read":           book.StatusWantToRead,
+	"wishlist":          book.StatusWantToRead,
+}
+
+// ParseLibraryThing reads a LibraryThing export in either tab-separated or
+// JSON format (More > Import/Export > Export your library)
+func ParseLibraryThing(r io.Reader) ([]Record, error) {
+	br := bufio.NewReader(r)
+	for {
+		c, _, err := br.ReadRune()
+		if err != nil {
+			return nil, fmt.Errorf("empty file")
+		}
+		if c == '\ufeff' || c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			continue
+		}
+		br.UnreadRune()
+		if c == '{' || c == '[' {
+			return parseLibraryThingJSON(br)
+		}
+		return parseLibraryThingTSV(br)
+	}
+}
+
+func parseLibraryThingTSV(r io.Reader) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = '\t'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	index := headerIndex(header)
+	if err := missingColumns(index, "title", "primary author"); err != nil {
+		return nil, fmt.Errorf("not a LibraryThing export: %w", err)
+	}
+
+	var records []Record
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			rec, err := rowError(line, err)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, rec)
+			continue
+		}
+
+		rw := row{record: record, index: index}
+		lt := ltEntry{
+			Title:          rw.get("title"),
+			Author:         rw.get("primary author"),
+			Rating:         rw.get("rating"),
+			Review:         rw.get("review"),
+			Comment:        rw.get("comment"),
+			PrivateComment: rw.get("private comment"),
+			Summary:        rw.get("summary"),
+			Pages:          rw.get("page count"),
+			EntryDate:      rw.get("entry date"),
+			DateRead:       rw.get("date read"),
+			DateStarted:    rw.get("date started"),
+			ISBNs:          splitList(strings.Trim(rw.get("isbns"), "[]"), ","),
+			Tags:           splitList(rw.get("tags"), ","),
+			Collections:    splitList(rw.get("collections"), ","),
+		}
+		if isbn := strings.Trim(rw.get("isbn"), "[]"); isbn != "" {
+			lt.ISBNs = append([]string{isbn}, lt.ISBNs...)
+		}
+
+		records = append(records, newRecord(line, lt.book()))
+	}
+
+	return records, nil
+}
+
+// ltJSONEntry is one book in LibraryThing's JSON export. Several fields
+// change type between books (strings vs numbers, arrays vs objects).
+type ltJSONEntry struct {
+	Title       string          `json:"title"`
+	Author      string          `json:"primaryauthor"`
+	Authors     []ltJSONAuthor  `json:"authors"`
+	Rating      any             `json:"rating"`
+	Review      string          `json:"review"`
+	Comment     string          `json:"comment"`
+	Private     string          `json:"privatecomment"`
+	Summary     string          `json:"summary"`
+	Pages       any             `json:"pages"`
+	EntryDate   string          `json:"entrydate"`
+	DateRead    string          `json:"dateread"`
+	DateStarted string          `json:"datestarted"`
+	ISBN        json.RawMessage `json:"isbn"`
+	OrigISBN    string          `json:"originalisbn"`
+	Tags        []string        `json:"tags"`
+	Collections []string        `json:"collections"`
+}
+
+type ltJSONAuthor struct {
+	FL string `json:"fl"` // first-last
+	LF string `json:"lf"` // last, first
+}
+
+func parseLibraryThingJSON(r io.Reader) ([]Record, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// The export is an object keyed by book ID; accept a plain array too
+	var entries []ltJSONEntry
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("invalid LibraryThing JSON: %w", err)
+		}
+	} else {
+		var byID map[string]ltJSONEntry
+		if err := json.Unmarshal(data, &byID); err != nil {
+			return nil, fmt.Errorf("invalid LibraryThing JSON: %w", err)
+		}
+		ids := make([]string, 0, len(byID))
+		for id := range byID {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			a, _ := strconv.Atoi(ids[i])
+			b, _ := strconv.Atoi(ids[j])
+			return a < b
+		})
+		for _, id := range ids {
+			entries = append(entries, byID[id])
+		}
+	}
+
+	var records []Record
+	for i, e := range entries {
+		lt := ltEntry{
+			Title:          e.Title,
+			Author:         e.Author,
+			Rating:         anyString(e.Rating),
+			Review:         e.Review,
+			Comment:        e.Comment,
+			PrivateComment: e.Private,
+			Summary:        e.Summary,
+			Pages:          anyString(e.Pages),
+			EntryDate:      e.EntryDate,
+			DateRead:       e.DateRead,
+			DateStarted:    e.DateStarted,
+			ISBNs:          jsonISBNs(e.ISBN),
+			Tags:           e.Tags,
+			Collections:    e.Collections,
+		}
+		if len(e.Authors) > 0 && e.Authors[0].FL != "" {
+			lt.Author = e.Authors[0].FL
+		}
+		if e.OrigISBN != "" {
+			lt.ISBNs = append(lt.ISBNs, e.OrigISBN)
+		}
+
+		records = append(records, newRecord(i+1, lt.book()))
+	}
+
+	return records, nil
+}
+
+// ltEntry is the common shape of TSV and JSON rows
+type ltEntry struct {
+	Title          string
+	Author         string
+	Rating         string
+	Review         string
+	Comment        string
+	PrivateComment string
+	Summary        string
+	Pages          string
+	EntryDate      string
+	DateRead       string
+	DateStarted    string
+	ISBNs          []string
+	Tags           []string
+	Collections    []string
+}
+
+func (e ltEntry) book() book.Book {
+	b := book.Book{
+		Title:       e.Title,
+		Author:      flipName(e.Author),
+		Description: e.Summary,
+		Status:      book.StatusWantToRead,
+		Tags:        e.Tags,
+		DateAdded:   parseDate(e.EntryDate),
+	}
+	if b.DateAdded.IsZero() {
+		b.DateAdded = time.Now()
+	}
+
+	// Prefer an ISBN-13
+	for _, isbn := range e.ISBNs {
+		isbn = cleanISBN(isbn)
+		if !isISBN(isbn) {
+			continue
+		}
+		if b.ISBN == "" || len(isbn) == 13 && len(b.ISBN) != 13 {
+			b.ISBN = isbn
+		}
+	}
+
+	b.Rating = parseStarRating(e.Rating)
+	b.PageCount, _ = strconv.Atoi(strings.TrimSpace(e.Pages))
+
+	for _, c := range e.Collections {
+		status, ok := libraryThingCollections[strings.ToLower(c)]
+		if !ok {
+			// "Your library" is the default collection; keep custom ones as tags
+			if !strings.EqualFold(c, "your library") && !containsTag(b.Tags, c) {
+				b.Tags = append(b.Tags, c)
+			}
+			continue
+		}
+		// Reading, paused and did-not-finish collections say more than
+		// "read but unowned" or a wishlist
+		if b.Status == book.StatusWantToRead || (status != book.StatusRead && status != book.StatusWantToRead) {
+			b.Status = status
+		}
+	}
+
+	b.DateRead = parseDate(e.DateRead)
+	if !b.DateRead.IsZero() && b.Status != book.StatusDNF {
+		b.Status = book.StatusRead
+	} else if b.Status == book.StatusWantToRead && !parseDate(e.DateStarted).IsZero() {
+		b.Status = book.StatusReading
+	}
+
+	b.Notes = appendNote(b.Notes, "", stripHTML(e.Review))
+	b.Notes = appendNote(b.Notes, "Comment", e.Comment)
+	b.Notes = appendNote(b.Notes, "Private comment", e.PrivateComment)
+
+	return b
+}
+
+// flipName turns "Herbert, Frank" into "Frank Herbert"
+func flipName(name string) string {
+	parts := strings.SplitN(name, ",", 2)
+	if len(parts) != 2 {
+		return strings.TrimSpace(name)
+	}
+	last, first := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	if first == "" {
+		return last
+	}
+	return first + " " + last
+}
+
+func anyString(v any) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	}
+	return ""
+}
+
+// jsonISBNs accepts the isbn field as a string, array or index-keyed object
+func jsonISBNs(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var one string
+	if json.Unmarshal(raw, &one) == nil {
+		return []string{one}
+	}
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		return list
+	}
+	var byKey map[string]string
+	if json.Unmarshal(raw, &byKey) == nil {
+		keys := make([]string, 0, len(byKey))
+		for k := range byKey {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			list = append(list, byKey[k])
+		}
+	}
+	return list
+}
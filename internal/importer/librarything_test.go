@@ -0,0 +1,138 @@
+package importer
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+func TestParseLibraryThingTSV(t *testing.T) {
+	header := "Book Id\tTitle\tPrimary Author\tRating\tReview\tSummary\tPage Count\tEntry Date\tDate Started\tDate Read\tISBN\tISBNs\tTags\tCollections\tComment\tPrivate Comment\n"
+	tests := []struct {
+		name string
+		row  string
+		want book.Book
+	}{
+		{
+			name: "read, ISBN-13 preferred",
+			row:  "1\tDune\tHerbert, Frank\t4.5\tA classic.\tDesert planet\t412\t2019-03-01\t2019-03-02\t2019-04-01\t[0441172717]\t0441172717, 9780441172719\tsf, classics\tYour library\tFirst edition\tSigned",
+			want: book.Book{
+				Title: "Dune", Author: "Frank Herbert", ISBN: "9780441172719", Rating: 4.5, PageCount: 412,
+				Status: book.StatusRead, DateAdded: date(2019, 3, 1), DateRead: date(2019, 4, 1),
+				Tags:  []string{"sf", "classics"},
+				Notes: "A classic.\n\nComment: First edition\n\nPrivate comment: Signed",
+			},
+		},
+		{
+			name: "started but not read",
+			row:  "2\tHyperion\tSimmons, Dan\t\t\t\t\t2020-01-01\t2020-02-01\t\t\t\t\tYour library\t\t",
+			want: book.Book{Title: "Hyperion", Author: "Dan Simmons", Status: book.StatusReading, DateAdded: date(2020, 1, 1)},
+		},
+		{
+			name: "collections",
+			row:  "3\tUlysses\tJoyce, James\t2\t\t\t\t2020-01-01\t\t\t\t\t\tRead but unowned, Did not finish, Book club\t\t",
+			want: book.Book{
+				Title: "Ulysses", Author: "James Joyce", Rating: 2,
+				Status: book.StatusDNF, DateAdded: date(2020, 1, 1), Tags: []string{"Book club"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := ParseLibraryThing(strings.NewReader("\ufeff" + header + tt.row + "\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 || records[0].Invalid != "" {
+				t.Fatalf("got records %+v, want one valid", records)
+			}
+			checkBook(t, records[0].Book, tt.want)
+		})
+	}
+}
+
+func TestParseLibraryThingJSON(t *testing.T) {
+	dune := book.Book{
+		Title: "Dune", Author: "Frank Herbert", ISBN: "0441172717", Rating: 5, PageCount: 412,
+		Status: book.StatusRead, DateAdded: date(2019, 3, 1), DateRead: date(2019, 4, 1),
+		Tags: []string{"sf"}, Notes: "Loved it",
+	}
+	hyperion := book.Book{
+		Title: "Hyperion", Author: "Dan Simmons", ISBN: "9780553283686", Rating: 3.5, PageCount: 482,
+		Status: book.StatusReading, DateAdded: date(2020, 1, 1),
+	}
+	duneJSON := `{"title": "Dune", "primaryauthor": "Herbert, Frank", "rating": 5, "pages": 412, "entrydate": "2019-03-01",
+		"dateread": "2019-04-01", "isbn": "0441172717", "tags": ["sf"], "review": "Loved it<br>"}`
+	hyperionJSON := `{"title": "Hyperion", "primaryauthor": "Simmons, Dan", "authors": [{"fl": "Dan Simmons", "lf": "Simmons, Dan"}],
+		"rating": "3.5", "pages": "482 ", "entrydate": "2020-01-01", "isbn": {"0": "0553283685", "2": "9780553283686"},
+		"collections": ["Currently reading"]}`
+
+	tests := []struct {
+		name  string
+		input string
+		want  []book.Book
+	}{
+		{"object in ID order", `{"20": ` + hyperionJSON + `, "3": ` + duneJSON + `}`, []book.Book{dune, hyperion}},
+		{"array", "\n[" + hyperionJSON + ", " + duneJSON + "]", []book.Book{hyperion, dune}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := ParseLibraryThing(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != len(tt.want) {
+				t.Fatalf("got %d records, want %d", len(records), len(tt.want))
+			}
+			for i, r := range records {
+				if r.Line != i+1 {
+					t.Errorf("record %d has line %d", i, r.Line)
+				}
+				checkBook(t, r.Book, tt.want[i])
+			}
+		})
+	}
+
+	if _, err := ParseLibraryThing(strings.NewReader("{not json")); err == nil {
+		t.Error("parsed invalid JSON")
+	}
+	if _, err := ParseLibraryThing(strings.NewReader(" \n")); err == nil {
+		t.Error("parsed an empty file")
+	}
+}
+
+func TestFlipName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Herbert, Frank", "Frank Herbert"},
+		{"Le Guin, Ursula K.", "Ursula K. Le Guin"},
+		{"Plato", "Plato"},
+		{"Homer,", "Homer"},
+	}
+	for _, tt := range tests {
+		if got := flipName(tt.in); got != tt.want {
+			t.Errorf("flipName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestJSONISBNs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{`"0441172717"`, []string{"0441172717"}},
+		{`["0441172717", "9780441172719"]`, []string{"0441172717", "9780441172719"}},
+		{`{"2": "9780441172719", "0": "0441172717"}`, []string{"0441172717", "9780441172719"}},
+		{``, nil},
+	}
+	for _, tt := range tests {
+		if got := jsonISBNs(json.RawMessage(tt.in)); !slices.Equal(got, tt.want) {
+			t.Errorf("jsonISBNs(%s) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
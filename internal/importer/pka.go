@@ -0,0 +1,299 @@
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+// The PKA CSV format lives here, next to its parser, so that what
+// `pka export -f csv` and the web export write can always be read back.
+
+// CSVHeader is the column order written by WriteCSV
+var CSVHeader = []string{
+	"ID", "Title", "Author", "ISBN", "Genre", "Description", "Tags", "Rating", "Status",
+	"Notes", "CoverURL", "PageCount", "CurrentPage", "DateAdded", "DateRead",
+	"DNFReason", "DNFPage", "Series", "SeriesPosition", "Format", "Publisher",
+	"TotalMinutes", "ListenedMinutes",
+}
+
+// CSVFields are the field names accepted in a column mapping
+var CSVFields = []string{
+	"title", "author", "isbn", "genre", "description", "tags", "rating", "status",
+	"notes", "cover_url", "page_count", "current_page", "date_added", "date_read",
+	"dnf_reason", "dnf_page", "series", "series_position", "format", "publisher",
+	"total_minutes", "listened_minutes",
+}
+
+// WriteCSV writes books in PKA's CSV format. Tags are separated by "|".
+func WriteCSV(w io.Writer, books []book.Book) error {
+	writer := csv.NewWriter(w)
+	writer.Write(CSVHeader)
+
+	for _, b := range books {
+		dateRead := ""
+		if !b.DateRead.IsZero() {
+			dateRead = b.DateRead.Format(time.RFC3339)
+		}
+		writer.Write([]string{
+			strconv.FormatInt(b.ID, 10),
+			b.Title,
+			b.Author,
+			b.ISBN,
+			b.Genre,
+			b.Description,
+			strings.Join(b.Tags, "|"),
+			book.FormatRating(b.Rating),
+			string(b.Status),
+			b.Notes,
+			b.CoverURL,
+			strconv.Itoa(b.PageCount),
+			strconv.Itoa(b.CurrentPage),
+			b.DateAdded.Format(time.RFC3339),
+			dateRead,
+			b.DNFReason,
+			strconv.Itoa(b.DNFPage),
+			b.Series,
+			book.FormatPosition(b.SeriesPosition),
+			string(b.Format),
+			b.Publisher,
+			strconv.Itoa(b.TotalMinutes),
+			strconv.Itoa(b.ListenedMinutes),
+		})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// ParseCSV reads a CSV file by its header row. Columns are matched to
+// fields by name ("CoverURL", "cover_url" and "Cover URL" all work); mapping
+// overrides this with field -> header name pairs, e.g. {"title": "Book Name"}.
+// Columns that match no field are ignored. Tags may be separated by "|" or
+// ";" (older CLI exports).
+func ParseCSV(r io.Reader, mapping map[string]string) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	columns, err := resolveColumns(header, mapping)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, fmt.Errorf("no title column found (columns: %s)", strings.Join(header, ", "))
+	}
+
+	var records []Record
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			rec, err := rowError(line, err)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, rec)
+			continue
+		}
+
+		get := func(field string) string {
+			i, ok := columns[field]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		b, err := csvBook(get)
+		if err != nil {
+			records = append(records, Record{Line: line, Book: b, Invalid: err.Error()})
+			continue
+		}
+		records = append(records, newRecord(line, b))
+	}
+
+	return records, nil
+}
+
+// resolveColumns maps field names to column indexes
+func resolveColumns(header []string, mapping map[string]string) (map[string]int, error) {
+	byName := make(map[string]int, len(header))
+	for i, h := range header {
+		byName[columnKey(h)] = i
+	}
+
+	columns := make(map[string]int)
+	for _, field := range CSVFields {
+		if i, ok := byName[columnKey(field)]; ok {
+			columns[field] = i
+		}
+	}
+
+	// Explicit mappings win over name matching
+	fields := make([]string, 0, len(mapping))
+	for field := range mapping {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		f := strings.ToLower(strings.TrimSpace(field))
+		if !isCSVField(f) {
+			return nil, fmt.Errorf("unknown field in column mapping: %q (use: %s)", field, strings.Join(CSVFields, ", "))
+		}
+		i, ok := byName[columnKey(mapping[field])]
+		if !ok {
+			return nil, fmt.Errorf("column %q mapped to %s not found in header", mapping[field], f)
+		}
+		columns[f] = i
+	}
+
+	return columns, nil
+}
+
+// columnKey normalizes a header or field name for matching
+func columnKey(s string) string {
+	s = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(s, "\ufeff")))
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(s)
+}
+
+func isCSVField(f string) bool {
+	for _, field := range CSVFields {
+		if field == f {
+			return true
+		}
+	}
+	return false
+}
+
+func csvBook(get func(string) string) (book.Book, error) {
+	b := book.Book{
+		Title:       get("title"),
+		Author:      get("author"),
+		ISBN:        cleanISBN(get("isbn")),
+		Genre:       get("genre"),
+		Description: get("description"),
+		Notes:       get("notes"),
+		CoverURL:    get("cover_url"),
+		Status:      book.StatusWantToRead,
+		DateAdded:   parseDate(get("date_added")),
+		DateRead:    parseDate(get("date_read")),
+		DNFReason:   get("dnf_reason"),
+		Series:      get("series"),
+		Publisher:   get("publisher"),
+	}
+	if b.DateAdded.IsZero() {
+		b.DateAdded = time.Now()
+	}
+
+	if tags := get("tags"); tags != "" {
+		sep := "|"
+		if !strings.Contains(tags, "|") && strings.Contains(tags, ";") {
+			sep = ";"
+		}
+		b.Tags = splitList(tags, sep)
+	}
+
+	if s := get("status"); s != "" {
+		status, ok := ParseStatus(s)
+		if !ok {
+			return b, fmt.Errorf("invalid status %q", s)
+		}
+		b.Status = status
+	}
+
+	if s := get("rating"); s != "" {
+		rating, err := book.ParseRating(s)
+		if err != nil {
+			return b, err
+		}
+		b.Rating = rating
+	}
+
+	// Formats that can't be placed are left unknown rather than failing the row
+	b.Format, _ = book.ParseFormat(get("format"))
+
+	for field, dst := range map[string]*int{"page_count": &b.PageCount, "current_page": &b.CurrentPage, "dnf_page": &b.DNFPage, "total_minutes": &b.TotalMinutes, "listened_minutes": &b.ListenedMinutes} {
+		if s := get(field); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return b, fmt.Errorf("invalid %s %q", field, s)
+			}
+			*dst = n
+		}
+	}
+
+	if s := get("series_position"); s != "" {
+		pos, err := strconv.ParseFloat(s, 64)
+		if err != nil || pos < 0 {
+			return b, fmt.Errorf("invalid series_position %q", s)
+		}
+		b.SeriesPosition = pos
+	}
+
+	return b, nil
+}
+
+// ParseStatus accepts a status in PKA form or a common variant such as
+// "Want to read" or "currently-reading"
+func ParseStatus(s string) (book.Status, bool) {
+	key := strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(s)))
+	switch key {
+	case "to_read", "tbr":
+		return book.StatusWantToRead, true
+	case "currently_reading":
+		return book.StatusReading, true
+	case "re_reading", "currently_rereading":
+		return book.StatusRereading, true
+	case "on_hold":
+		return book.StatusPaused, true
+	case "finished":
+		return book.StatusRead, true
+	case "dnf", "abandoned":
+		return book.StatusDNF, true
+	}
+	status := book.Status(key)
+	return status, status.IsValid()
+}
+
+// ParseJSON reads a PKA JSON export (an array of books). Linked ebook
+// files are dropped: a path from another machine, or a crafted one, isn't
+// a file of this library.
+func ParseJSON(r io.Reader) ([]Record, error) {
+	var books []book.Book
+	if err := json.NewDecoder(r).Decode(&books); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	records := make([]Record, 0, len(books))
+	for i, b := range books {
+		b.ID = 0 // reset ID for new insert
+		b.EditionID = 0
+		b.FilePath = ""
+		b.Format, _ = book.ParseFormat(string(b.Format))
+		if b.DateAdded.IsZero() {
+			b.DateAdded = time.Now()
+		}
+		if b.Status == "" {
+			b.Status = book.StatusWantToRead
+		}
+		records = append(records, newRecord(i+1, b))
+	}
+
+	return records, nil
+}
@@ -0,0 +1,325 @@
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+// Action is what Commit does with a previewed row
+type Action string
+
+const (
+	ActionImport Action = "import" // add as a new book
+	ActionSkip   Action = "skip"   // leave the library untouched
+	ActionMerge  Action = "merge"  // fold into the matching library book
+	ActionUpdate Action = "update" // sync the linked library book from its source
+)
+
+// Outcome is what Commit did with a row
+type Outcome string
+
+const (
+	OutcomeImported Outcome = "imported"
+	OutcomeMerged   Outcome = "merged"
+	OutcomeUpdated  Outcome = "updated"
+	OutcomeSkipped  Outcome = "skipped"
+	OutcomeFailed   Outcome = "failed"
+)
+
+// PreviewRow is a parsed record together with how it matches the library
+type PreviewRow struct {
+	Record
+	Duplicate   *book.Book // matching book already in the library
+	DuplicateOf int        // line of an earlier row for the same book
+	MatchReason string     // how the duplicate was matched
+	Linked      bool       // Duplicate was imported from this row's source before
+	Action      Action
+
+	// A library book that looks like the same one but isn't certainly it.
+	// The row is still imported unless its Action is changed.
+	Similar      *book.Book
+	SimilarScore float64
+
+	// Set by Commit
+	Outcome Outcome
+	Error   string // why the row failed or was skipped
+}
+
+// IsDuplicate reports whether the row matches the library or an earlier row
+func (r *PreviewRow) IsDuplicate() bool {
+	return r.Duplicate != nil || r.DuplicateOf > 0
+}
+
+// MergeTarget returns the library book ActionMerge folds the row into: its
+// duplicate, or else the book it's similar to
+func (r *PreviewRow) MergeTarget() *book.Book {
+	if r.Duplicate != nil {
+		return r.Duplicate
+	}
+	return r.Similar
+}
+
+// State describes the row for previews and reports: "new", "invalid",
+// "linked to #ID", "duplicate of #ID", "duplicate of line N" or "similar
+// to #ID"
+func (r *PreviewRow) State() string {
+	switch {
+	case r.Invalid != "":
+		return "invalid"
+	case r.Linked:
+		return fmt.Sprintf("linked to #%d", r.Duplicate.ID)
+	case r.Duplicate != nil:
+		return fmt.Sprintf("duplicate of #%d", r.Duplicate.ID)
+	case r.DuplicateOf > 0:
+		return fmt.Sprintf("duplicate of line %d", r.DuplicateOf)
+	case r.Similar != nil:
+		return fmt.Sprintf("similar to #%d", r.Similar.ID)
+	}
+	return "new"
+}
+
+// Preview checks each record against the library and the rest of the file.
+// New books default to ActionImport, duplicates and invalid rows to
+// ActionSkip. Rows linked to a library book by an earlier import from the
+// same source default to ActionUpdate, or ActionSkip if nothing changed.
+// New books that only look like a library book (see book.MatchScore) are
+// noted as Similar but still imported by default. Nothing is written.
+func Preview(ctx context.Context, svc *book.Service, records []Record) ([]PreviewRow, error) {
+	rows := make([]PreviewRow, len(records))
+	seen := make(map[string]int) // match key -> line
+
+	library, err := svc.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list books: %w", err)
+	}
+
+	for i, rec := range records {
+		rows[i] = PreviewRow{Record: rec, Action: ActionImport}
+		if rec.Invalid != "" {
+			rows[i].Action = ActionSkip
+			continue
+		}
+
+		if rec.ExternalID != "" {
+			linked, err := svc.FindByExternalID(ctx, rec.Source, rec.ExternalID)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", rec.Line, err)
+			}
+			if linked != nil {
+				rows[i].Duplicate = linked
+				rows[i].MatchReason = rec.Source + " ID"
+				rows[i].Linked = true
+				rows[i].Action = ActionSkip
+				updated := *linked
+				if syncBook(&updated, &rec.Book) {
+					rows[i].Action = ActionUpdate
+				}
+				continue
+			}
+		}
+
+		existing, reason, err := svc.CheckDuplicate(ctx, &rec.Book)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", rec.Line, err)
+		}
+		if existing != nil {
+			rows[i].Duplicate = existing
+			rows[i].MatchReason = reason
+			rows[i].Action = ActionSkip
+			continue
+		}
+
+		for _, key := range matchKeys(&rec.Book) {
+			if line, ok := seen[key]; ok {
+				rows[i].DuplicateOf = line
+				rows[i].MatchReason = "earlier row"
+				rows[i].Action = ActionSkip
+				break
+			}
+		}
+		for _, key := range matchKeys(&rec.Book) {
+			if _, ok := seen[key]; !ok {
+				seen[key] = rec.Line
+			}
+		}
+		if rows[i].DuplicateOf == 0 {
+			rows[i].Similar, rows[i].SimilarScore = book.BestMatch(&rec.Book, library)
+		}
+	}
+
+	return rows, nil
+}
+
+// matchKeys returns keys under which two rows in one file count as the same book
+func matchKeys(b *book.Book) []string {
+	var keys []string
+	if b.ISBN != "" {
+		keys = append(keys, "isbn:"+b.ISBN)
+	}
+	if b.Title != "" {
+		keys = append(keys, "title:"+book.TitleKey(b.Title, b.Author))
+	}
+	return keys
+}
+
+// Commit applies each row's Action and records its Outcome. Row IDs are
+// filled in for imported and merged books. Invalid rows are never written,
+// whatever their Action.
+func Commit(ctx context.Context, svc *book.Service, rows []PreviewRow) (Result, error) {
+	var res Result
+	for i := range rows {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+
+		row := &rows[i]
+		switch {
+		case row.Invalid != "":
+			row.Outcome, row.Error = OutcomeSkipped, row.Invalid
+
+		case row.Action == ActionImport:
+			b := row.Book
+			if err := svc.AddSkipDuplicateCheck(ctx, &b); err != nil {
+				row.Outcome, row.Error = OutcomeFailed, err.Error()
+				break
+			}
+			row.Book.ID = b.ID
+			row.Outcome = OutcomeImported
+
+		case row.Action == ActionMerge && row.MergeTarget() != nil:
+			merged, err := svc.MergeFrom(ctx, row.MergeTarget().ID, &row.Book)
+			if err != nil {
+				row.Outcome, row.Error = OutcomeFailed, err.Error()
+				break
+			}
+			row.Book.ID = merged.ID
+			row.Outcome = OutcomeMerged
+
+		case row.Action == ActionUpdate && row.Linked:
+			updated := *row.Duplicate
+			syncBook(&updated, &row.Book)
+			if err := svc.Update(ctx, &updated); err != nil {
+				row.Outcome, row.Error = OutcomeFailed, err.Error()
+				break
+			}
+			row.Book.ID = updated.ID
+			row.Outcome = OutcomeUpdated
+
+		case row.Action == ActionMerge:
+			row.Outcome, row.Error = OutcomeSkipped, "nothing to merge into"
+
+		default:
+			row.Outcome = OutcomeSkipped
+		}
+
+		if row.ExternalID != "" && (row.Outcome == OutcomeImported || row.Outcome == OutcomeMerged) {
+			if err := svc.LinkExternalID(ctx, row.Book.ID, row.Source, row.ExternalID); err != nil {
+				row.Error = "link " + row.Source + " ID: " + err.Error()
+			}
+		}
+
+		switch row.Outcome {
+		case OutcomeImported:
+			res.Imported++
+		case OutcomeMerged:
+			res.Merged++
+		case OutcomeUpdated:
+			res.Updated++
+		case OutcomeFailed:
+			res.Failed++
+		default:
+			res.Skipped++
+		}
+	}
+	return res, nil
+}
+
+// syncBook copies the fields a source owns from src onto dst, leaving
+// what's tracked in PKA (status, progress, notes, dates read) alone. Tags
+// are added, never removed. It reports whether dst changed.
+func syncBook(dst, src *book.Book) bool {
+	before := *dst
+	before.Tags = append([]string(nil), dst.Tags...)
+
+	for _, f := range []struct{ dst, src *string }{
+		{&dst.Title, &src.Title},
+		{&dst.Author, &src.Author},
+		{&dst.ISBN, &src.ISBN},
+		{&dst.Description, &src.Description},
+		{&dst.Genre, &src.Genre},
+		{&dst.CoverURL, &src.CoverURL},
+		{&dst.FilePath, &src.FilePath},
+	} {
+		if *f.src != "" {
+			*f.dst = *f.src
+		}
+	}
+	if src.PageCount > 0 {
+		dst.PageCount = src.PageCount
+	}
+	if src.Rating > 0 {
+		dst.Rating = src.Rating
+	}
+	if src.Series != "" {
+		dst.Series, dst.SeriesPosition = src.Series, src.SeriesPosition
+	}
+	for _, t := range src.Tags {
+		if !containsTag(dst.Tags, t) {
+			dst.Tags = append(dst.Tags, t)
+		}
+	}
+
+	if dst.CoverURL != before.CoverURL {
+		dst.CoverHash = ""
+	}
+
+	return dst.Title != before.Title || dst.Author != before.Author || dst.ISBN != before.ISBN ||
+		dst.Description != before.Description || dst.Genre != before.Genre || dst.CoverURL != before.CoverURL ||
+		dst.FilePath != before.FilePath || dst.PageCount != before.PageCount || dst.Rating != before.Rating ||
+		dst.Series != before.Series || dst.SeriesPosition != before.SeriesPosition || len(dst.Tags) != len(before.Tags)
+}
+
+// ReportHeader is the column order written by WriteReport
+var ReportHeader = []string{"Line", "Title", "Author", "State", "Action", "Outcome", "BookID", "Detail"}
+
+// WriteReport writes one CSV line per row. Outcome and BookID are empty for
+// rows that haven't been committed, so the same report serves as a dry run.
+func WriteReport(w io.Writer, rows []PreviewRow) error {
+	writer := csv.NewWriter(w)
+	writer.Write(ReportHeader)
+
+	for _, row := range rows {
+		id := ""
+		if row.Book.ID > 0 {
+			id = strconv.FormatInt(row.Book.ID, 10)
+		}
+		detail := row.Error
+		if detail == "" {
+			detail = row.Invalid
+		}
+		if detail == "" && row.MatchReason != "" {
+			detail = "matched by " + row.MatchReason
+		}
+		if detail == "" && row.Similar != nil {
+			detail = fmt.Sprintf("%.0f%% match", row.SimilarScore*100)
+		}
+		writer.Write([]string{
+			strconv.Itoa(row.Line),
+			row.Book.Title,
+			row.Book.Author,
+			row.State(),
+			string(row.Action),
+			string(row.Outcome),
+			id,
+			detail,
+		})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,55 @@
+package importer
+
+import (
+	"testing"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+func TestSyncBook(t *testing.T) {
+	linked := book.Book{Title: "Leviathan Wakes", Author: "James S. A. Corey", Series: "The Expanse", SeriesPosition: 1, Rating: 4}
+	tests := []struct {
+		name        string
+		src         book.Book
+		want        book.Book
+		wantChanged bool
+	}{
+		{
+			name: "unchanged",
+			src:  book.Book{Title: "Leviathan Wakes", Author: "James S. A. Corey", Series: "The Expanse", SeriesPosition: 1},
+			want: linked,
+		},
+		{
+			name:        "series renamed",
+			src:         book.Book{Title: "Leviathan Wakes", Series: "Expanse", SeriesPosition: 1},
+			want:        book.Book{Title: "Leviathan Wakes", Author: "James S. A. Corey", Series: "Expanse", SeriesPosition: 1, Rating: 4},
+			wantChanged: true,
+		},
+		{
+			name:        "series reordered",
+			src:         book.Book{Title: "Leviathan Wakes", Series: "The Expanse", SeriesPosition: 0.5},
+			want:        book.Book{Title: "Leviathan Wakes", Author: "James S. A. Corey", Series: "The Expanse", SeriesPosition: 0.5, Rating: 4},
+			wantChanged: true,
+		},
+		{
+			name: "no series in the source",
+			src:  book.Book{Title: "Leviathan Wakes"},
+			want: linked,
+		},
+		{
+			name:        "rated",
+			src:         book.Book{Rating: 5},
+			want:        book.Book{Title: "Leviathan Wakes", Author: "James S. A. Corey", Series: "The Expanse", SeriesPosition: 1, Rating: 5},
+			wantChanged: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := linked
+			if changed := syncBook(&got, &tt.src); changed != tt.wantChanged {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+			checkBook(t, got, tt.want)
+		})
+	}
+}
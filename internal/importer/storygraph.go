@@ -0,0 +1,150 @@
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+var storyGraphStatuses = map[string]book.Status{
+	"read":              book.StatusRead,
+	"currently-reading": book.StatusReading,
+	"to-read":           book.StatusWantToRead,
+	"did-not-finish":    book.StatusDNF,
+	"paused":            book.StatusPaused,
+}
+
+// ParseStoryGraph reads a StoryGraph export (Manage Account > Export StoryGraph Library)
+func ParseStoryGraph(r io.Reader) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	index := headerIndex(header)
+	if err := missingColumns(index, "title", "authors", "read status"); err != nil {
+		return nil, fmt.Errorf("not a StoryGraph export: %w", err)
+	}
+
+	var records []Record
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			rec, err := rowError(line, err)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, rec)
+			continue
+		}
+
+		b := storyGraphBook(row{record: record, index: index})
+		records = append(records, newRecord(line, b))
+	}
+
+	return records, nil
+}
+
+func storyGraphBook(r row) book.Book {
+	b := book.Book{
+		Title:     r.get("title"),
+		Author:    r.get("authors"),
+		ISBN:      cleanISBN(r.get("isbn/uid")),
+		Status:    book.StatusWantToRead,
+		DateAdded: parseDate(r.get("date added")),
+	}
+	if b.DateAdded.IsZero() {
+		b.DateAdded = time.Now()
+	}
+
+	// Books without an ISBN get a StoryGraph UID instead
+	if !isISBN(b.ISBN) {
+		b.ISBN = ""
+	}
+
+	readStatus := strings.ToLower(r.get("read status"))
+	if status, ok := storyGraphStatuses[readStatus]; ok {
+		b.Status = status
+	} else if readStatus != "" {
+		b.Tags = append(b.Tags, readStatus)
+	}
+	if readCount, _ := strconv.Atoi(r.get("read count")); readCount > 1 && b.Status == book.StatusReading {
+		b.Status = book.StatusRereading
+	}
+
+	b.Rating = parseStarRating(r.get("star rating"))
+	b.Format, _ = book.ParseFormat(r.get("format"))
+
+	b.DateRead = parseDate(r.get("last date read"))
+	if b.DateRead.IsZero() {
+		// "Dates Read" holds ranges like "2023/01/02-2023/01/20, 2024/03/01-2024/03/09"
+		ranges := splitList(r.get("dates read"), ",")
+		if len(ranges) > 0 {
+			last := ranges[len(ranges)-1]
+			if i := strings.LastIndex(last, "-"); i >= 0 {
+				last = last[i+1:]
+			}
+			b.DateRead = parseDate(last)
+		}
+	}
+	if b.Status == book.StatusRead && b.DateRead.IsZero() {
+		b.DateRead = b.DateAdded
+	}
+
+	for _, t := range splitList(r.get("moods"), ",") {
+		if !containsTag(b.Tags, t) {
+			b.Tags = append(b.Tags, t)
+		}
+	}
+	for _, t := range splitList(r.get("tags"), ",") {
+		if !containsTag(b.Tags, t) {
+			b.Tags = append(b.Tags, t)
+		}
+	}
+
+	b.Notes = appendNote(b.Notes, "", stripHTML(r.get("review")))
+	b.Notes = appendNote(b.Notes, "Pace", r.get("pace"))
+	b.Notes = appendNote(b.Notes, "Content warnings", r.get("content warnings"))
+
+	return b
+}
+
+// parseStarRating reads fractional star ratings ("4.25", "3.5"), keeping
+// them to the nearest quarter star
+func parseStarRating(s string) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || !(f > 0) {
+		return 0
+	}
+	return min(max(book.RoundRating(f), book.RatingStep), book.MaxRating)
+}
+
+// isISBN reports whether s looks like an ISBN-10 or ISBN-13
+func isISBN(s string) bool {
+	if len(s) != 10 && len(s) != 13 {
+		return false
+	}
+	for i, c := range s {
+		if c >= '0' && c <= '9' {
+			continue
+		}
+		if i == 9 && len(s) == 10 && (c == 'X' || c == 'x') {
+			continue
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+const storyGraphHeader = "Title,Authors,Contributors,ISBN/UID,Format,Read Status,Date Added,Last Date Read,Dates Read,Read Count,Moods,Pace,Character- or Plot-Driven?,Strong Character Development?,Loveable Characters?,Diverse Characters?,Flawed Characters?,Star Rating,Review,Content Warnings,Content Warning Description,Tags,Owned?\n"
+
+func TestParseStoryGraph(t *testing.T) {
+	tests := []struct {
+		name string
+		row  string
+		want book.Book
+	}{
+		{
+			name: "read with quarter star rating",
+			row:  `Piranesi,Susanna Clarke,,9781635575637,hardcover,read,2021/01/05,2021/02/01,2021/01/20-2021/02/01,1,"mysterious, reflective",slow,,,,,,3.75,<p>Strange and lovely.</p>,Death,,"fantasy, favorites",Yes`,
+			want: book.Book{
+				Title: "Piranesi", Author: "Susanna Clarke", ISBN: "9781635575637",
+				Format: book.FormatPhysical, Rating: 3.75, Status: book.StatusRead,
+				DateAdded: date(2021, 1, 5), DateRead: date(2021, 2, 1),
+				Tags:  []string{"mysterious", "reflective", "fantasy", "favorites"},
+				Notes: "Strange and lovely.\n\nPace: slow\n\nContent warnings: Death",
+			},
+		},
+		{
+			name: "last of several read dates",
+			row:  `Dune,Frank Herbert,,0441172717,paperback,read,2019/03/01,,"2019/03/02-2019/04/01, 2023/06/01-2023/06/20",2,,,,,,,,4.25,,,,,No`,
+			want: book.Book{
+				Title: "Dune", Author: "Frank Herbert", ISBN: "0441172717", Format: book.FormatPhysical,
+				Rating: 4.25, Status: book.StatusRead, DateAdded: date(2019, 3, 1), DateRead: date(2023, 6, 20),
+			},
+		},
+		{
+			name: "reread in progress, UID instead of ISBN",
+			row:  `Hyperion,Dan Simmons,,e7f2a1c4-3b5d,audio,currently-reading,2022/08/09,,,3,,,,,,,,,,,,,No`,
+			want: book.Book{
+				Title: "Hyperion", Author: "Dan Simmons", Format: book.FormatAudiobook,
+				Status: book.StatusRereading, DateAdded: date(2022, 8, 9),
+			},
+		},
+		{
+			name: "did not finish",
+			row:  `Ulysses,James Joyce,,,digital,did-not-finish,2020/02/02,,,0,,,,,,,,1.5,,,,,No`,
+			want: book.Book{
+				Title: "Ulysses", Author: "James Joyce", Format: book.FormatEbook,
+				Rating: 1.5, Status: book.StatusDNF, DateAdded: date(2020, 2, 2),
+			},
+		},
+		{
+			name: "unknown status kept as a tag",
+			row:  `Stardust,Neil Gaiman,,,,borrowed,2020/02/02,,,0,,,,,,,,,,,,,No`,
+			want: book.Book{
+				Title: "Stardust", Author: "Neil Gaiman",
+				Status: book.StatusWantToRead, DateAdded: date(2020, 2, 2), Tags: []string{"borrowed"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := ParseStoryGraph(strings.NewReader(storyGraphHeader + tt.row + "\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 || records[0].Invalid != "" {
+				t.Fatalf("got records %+v, want one valid", records)
+			}
+			checkBook(t, records[0].Book, tt.want)
+		})
+	}
+
+	if _, err := ParseStoryGraph(strings.NewReader(goodreadsHeader)); err == nil {
+		t.Error("parsed a Goodreads export as StoryGraph")
+	}
+}
+
+func TestParseStarRating(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"", 0},
+		{"0", 0},
+		{"4", 4},
+		{"3.25", 3.25},
+		{"3.75", 3.75},
+		{"4.1", 4},
+		{"0.1", 0.25},
+		{"6", 5},
+		{"-2", 0},
+		{"NaN", 0},
+		{"five", 0},
+	}
+	for _, tt := range tests {
+		if got := parseStarRating(tt.in); got != tt.want {
+			t.Errorf("parseStarRating(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsISBN(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"0441172717", true},
+		{"080442957X", true},
+		{"9780441172719", true},
+		{"978044117271X", false},
+		{"X441172717", false},
+		{"e7f2a1c4-3b5d", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isISBN(tt.in); got != tt.want {
+			t.Errorf("isISBN(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package koreader
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// table is a Lua table literal. Keys are strings or, for array items and
+// numeric keys, int64.
+type table map[any]any
+
+// parseLua reads a file of the form `return <value>`, as KOReader writes
+// its settings. Only literals are understood (tables, strings, numbers,
+// booleans and nil), so nothing is ever executed.
+func parseLua(src string) (any, error) {
+	p := &luaParser{src: src}
+	p.skipSpace()
+	if p.consumeWord("return") {
+		p.skipSpace()
+	}
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos])
+	}
+	return v, nil
+}
+
+type luaParser struct {
+	src string
+	pos int
+}
+
+func (p *luaParser) errorf(format string, args ...any) error {
+	line := 1 + strings.Count(p.src[:min(p.pos, len(p.src))], "\n")
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *luaParser) peek(offset int) byte {
+	if p.pos+offset < len(p.src) {
+		return p.src[p.pos+offset]
+	}
+	return 0
+}
+
+// skipSpace skips whitespace and comments
+func (p *luaParser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			p.pos++
+		case c == '-' && p.peek(1) == '-':
+			p.pos += 2
+			if level, ok := p.longBracket(); ok {
+				p.skipLong(level)
+				continue
+			}
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// longBracket reports whether a long bracket ([[ or [==[) starts at pos,
+// and its level
+func (p *luaParser) longBracket() (int, bool) {
+	if p.peek(0) != '[' {
+		return 0, false
+	}
+	level := 0
+	for p.peek(1+level) == '=' {
+		level++
+	}
+	return level, p.peek(1+level) == '['
+}
+
+// skipLong consumes a long bracket of the given level and returns its
+// contents
+func (p *luaParser) skipLong(level int) (string, error) {
+	p.pos += level + 2
+	// A newline straight after the opening bracket is not part of the string
+	if p.peek(0) == '\r' {
+		p.pos++
+	}
+	if p.peek(0) == '\n' {
+		p.pos++
+	}
+	closing := "]" + strings.Repeat("=", level) + "]"
+	end := strings.Index(p.src[p.pos:], closing)
+	if end < 0 {
+		p.pos = len(p.src)
+		return "", p.errorf("unfinished long string")
+	}
+	s := p.src[p.pos : p.pos+end]
+	p.pos += end + len(closing)
+	return s, nil
+}
+
+func (p *luaParser) consumeWord(word string) bool {
+	if !strings.HasPrefix(p.src[p.pos:], word) || isIdentChar(p.peek(len(word))) {
+		return false
+	}
+	p.pos += len(word)
+	return true
+}
+
+func (p *luaParser) value() (any, error) {
+	p.skipSpace()
+	c := p.peek(0)
+	switch {
+	case c == '{':
+		return p.table()
+	case c == '"' || c == '\'':
+		return p.quoted()
+	case c == '[':
+		level, ok := p.longBracket()
+		if !ok {
+			return nil, p.errorf("unexpected '['")
+		}
+		return p.skipLong(level)
+	case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return p.number()
+	case p.consumeWord("true"):
+		return true, nil
+	case p.consumeWord("false"):
+		return false, nil
+	case p.consumeWord("nil"):
+		return nil, nil
+	case c == 0:
+		return nil, p.errorf("unexpected end of file")
+	}
+	return nil, p.errorf("unexpected %q", c)
+}
+
+func (p *luaParser) table() (table, error) {
+	p.pos++ // {
+	t := make(table)
+	next := int64(1)
+	for {
+		p.skipSpace()
+		if p.peek(0) == '}' {
+			p.pos++
+			return t, nil
+		}
+
+		var key any
+		switch {
+		case p.peek(0) == '[' && p.peek(1) != '[' && p.peek(1) != '=':
+			p.pos++
+			k, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace()
+			if p.peek(0) != ']' {
+				return nil, p.errorf("expected ']'")
+			}
+			p.pos++
+			if err := p.expectAssign(); err != nil {
+				return nil, err
+			}
+			key = tableKey(k)
+		case isIdentStart(p.peek(0)) && p.identAssign():
+			start := p.pos
+			for isIdentChar(p.peek(0)) {
+				p.pos++
+			}
+			key = p.src[start:p.pos]
+			if err := p.expectAssign(); err != nil {
+				return nil, err
+			}
+		default:
+			key = next
+			next++
+		}
+
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if key != nil && v != nil {
+			t[key] = v
+		}
+
+		p.skipSpace()
+		switch p.peek(0) {
+		case ',', ';':
+			p.pos++
+		case '}':
+		default:
+			return nil, p.errorf("expected ',' or '}'")
+		}
+	}
+}
+
+// identAssign reports whether the identifier at pos is followed by '='
+// (a name = value field) rather than being a value such as true
+func (p *luaParser) identAssign() bool {
+	i := p.pos
+	for i < len(p.src) && isIdentChar(p.src[i]) {
+		i++
+	}
+	for i < len(p.src) && (p.src[i] == ' ' || p.src[i] == '\t') {
+		i++
+	}
+	return i < len(p.src) && p.src[i] == '=' && (i+1 >= len(p.src) || p.src[i+1] != '=')
+}
+
+func (p *luaParser) expectAssign() error {
+	p.skipSpace()
+	if p.peek(0) != '=' {
+		return p.errorf("expected '='")
+	}
+	p.pos++
+	return nil
+}
+
+// tableKey stores integral numbers as int64, so [1] and 1.0 are one key
+func tableKey(k any) any {
+	if f, ok := k.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return int64(f)
+	}
+	return k
+}
+
+func (p *luaParser) number() (float64, error) {
+	start := p.pos
+	if p.peek(0) == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if isIdentChar(c) || c == '.' || ((c == '-' || c == '+') && (p.src[p.pos-1] == 'e' || p.src[p.pos-1] == 'E')) {
+			p.pos++
+			continue
+		}
+		break
+	}
+	text := p.src[start:p.pos]
+	if f, err := strconv.ParseFloat(text, 64); err == nil {
+		return f, nil
+	}
+	// Hexadecimal integers such as 0x1F
+	n, err := strconv.ParseInt(text, 0, 64)
+	if err != nil {
+		return 0, p.errorf("invalid number %q", text)
+	}
+	return float64(n), nil
+}
+
+func (p *luaParser) quoted() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) {
+			return "", p.errorf("unfinished string")
+		}
+		c := p.src[p.pos]
+		p.pos++
+		switch c {
+		case quote:
+			return b.String(), nil
+		case '\n':
+			return "", p.errorf("unfinished string")
+		case '\\':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+func (p *luaParser) escape(b *strings.Builder) error {
+	c := p.peek(0)
+	p.pos++
+	switch c {
+	case 'n', '\n':
+		b.WriteByte('\n')
+		if c == '\n' && p.peek(0) == '\r' {
+			p.pos++
+		}
+	case '\r':
+		b.WriteByte('\n')
+		if p.peek(0) == '\n' {
+			p.pos++
+		}
+	case 't':
+		b.WriteByte('\t')
+	case 'r':
+		b.WriteByte('\r')
+	case 'a':
+		b.WriteByte('\a')
+	case 'b':
+		b.WriteByte('\b')
+	case 'f':
+		b.WriteByte('\f')
+	case 'v':
+		b.WriteByte('\v')
+	case '\\', '"', '\'':
+		b.WriteByte(c)
+	case 'z':
+		for p.pos < len(p.src) && strings.IndexByte(" \t\r\n\f\v", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+	case 'x':
+		if p.pos+2 > len(p.src) {
+			return p.errorf("invalid escape")
+		}
+		n, err := strconv.ParseUint(p.src[p.pos:p.pos+2], 16, 8)
+		if err != nil {
+			return p.errorf("invalid escape")
+		}
+		b.WriteByte(byte(n))
+		p.pos += 2
+	case 'u':
+		end := strings.IndexByte(p.src[p.pos:], '}')
+		if p.peek(0) != '{' || end < 0 {
+			return p.errorf("invalid escape")
+		}
+		n, err := strconv.ParseUint(p.src[p.pos+1:p.pos+end], 16, 32)
+		if err != nil || n > utf8.MaxRune {
+			return p.errorf("invalid escape")
+		}
+		b.WriteRune(rune(n))
+		p.pos += end + 1
+	default:
+		if c < '0' || c > '9' {
+			return p.errorf("invalid escape")
+		}
+		start := p.pos - 1
+		for p.pos-start < 3 && p.peek(0) >= '0' && p.peek(0) <= '9' {
+			p.pos++
+		}
+		n, err := strconv.Atoi(p.src[start:p.pos])
+		if err != nil || n > 255 {
+			return p.errorf("invalid escape")
+		}
+		b.WriteByte(byte(n))
+	}
+	return nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
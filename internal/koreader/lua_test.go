@@ -0,0 +1,103 @@
+package koreader
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLua(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want any
+	}{
+		{"string", `return "Dune"`, "Dune"},
+		{"single quotes", `return 'it\'s "quoted"'`, `it's "quoted"`},
+		{"number", `return 42`, 42.0},
+		{"negative float", `return -0.25`, -0.25},
+		{"exponent", `return 1.5e-3`, 0.0015},
+		{"hex", `return 0x1F`, 31.0},
+		{"booleans", `return { true, false }`, table{int64(1): true, int64(2): false}},
+		{"without return", `{ a = 1 }`, table{"a": 1.0}},
+		{
+			name: "escapes",
+			src:  `return "tab\there\nnew \"quoted\" \\ \65\066\x43 \u{E9} \z   joined"`,
+			want: "tab\there\nnew \"quoted\" \\ ABC é joined",
+		},
+		{"long string", "return [[\nfirst line\nsecond line]]", "first line\nsecond line"},
+		{"leveled long string", "return [==[has ]] inside]==]", "has ]] inside"},
+		{
+			name: "KOReader settings",
+			src: `-- we can read Lua syntax here!
+return {
+    ["doc_props"] = {
+        ["authors"] = "Frank Herbert",
+        ["title"] = "Dune",
+    },
+    ["percent_finished"] = 0.25,
+    [3] = "three",
+    [2.0] = "two",
+    ["skipped"] = nil,
+    plain_name = 'x';
+    --[[ a long
+    comment ]]
+    "first",
+}`,
+			want: table{
+				"doc_props":        table{"authors": "Frank Herbert", "title": "Dune"},
+				"percent_finished": 0.25,
+				int64(3):           "three",
+				int64(2):           "two",
+				"plain_name":       "x",
+				int64(1):           "first",
+			},
+		},
+		{
+			name: "identifier values",
+			src:  `return { highlighted = true, true, nil, false }`,
+			want: table{"highlighted": true, int64(1): true, int64(3): false},
+		},
+		{"empty table", `return {}`, table{}},
+		{"nil", `return nil`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLua(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLuaErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // in the error message
+	}{
+		{"empty", ``, "unexpected end of file"},
+		{"trailing", `return 1 2`, "unexpected '2'"},
+		{"unfinished string", "return \"Dune\n\"", "unfinished string"},
+		{"unfinished long string", `return [[Dune`, "unfinished long string"},
+		{"unfinished table", "return {\n  a = 1,\n", "line 3: unexpected end of file"},
+		{"missing comma", `return { 1 2 }`, "expected ',' or '}'"},
+		{"missing bracket", `return { ["a" = 1 }`, "expected ']'"},
+		{"missing assign", `return { ["a"] 1 }`, "expected '='"},
+		{"bad escape", `return "\q"`, "invalid escape"},
+		{"escape too large", `return "\256"`, "invalid escape"},
+		{"bad number", `return 12abc`, "invalid number"},
+		{"code", `return os.execute("rm -rf /")`, "unexpected 'o'"},
+		{"concatenation", `return "a" .. "b"`, "unexpected '.'"},
+	}
+	for _, tt := range tests {
+		_, err := parseLua(tt.src)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want one containing %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package koreader
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sidecar is what KOReader remembers about a document in its
+// metadata.<ext>.lua file, inside the <document>.sdr directory next to it
+type Sidecar struct {
+	Path        string // of the sidecar file
+	Title       string
+	Authors     string // as KOReader shows them; several are separated by newlines
+	Document    string // partial MD5 of the document, as used by progress sync
+	DocPath     string // where the document was on the device
+	Pages       int
+	Annotations []Annotation
+}
+
+// Annotation is a highlight, with the note made on it if any
+type Annotation struct {
+	Text     string
+	Note     string
+	Chapter  string
+	Page     int
+	Datetime time.Time
+}
+
+// datetimeLayout is how KOReader writes annotation times, in local time
+const datetimeLayout = "2006-01-02 15:04:05"
+
+// FindSidecars returns the metadata.*.lua files under dir, sorted
+func FindSidecars(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && strings.HasPrefix(d.Name(), ".") && p != dir && !strings.HasSuffix(d.Name(), ".sdr") {
+			return filepath.SkipDir
+		}
+		name := d.Name()
+		if !d.IsDir() && strings.HasPrefix(name, "metadata.") && strings.HasSuffix(name, ".lua") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan %s: %w", dir, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// ReadSidecar parses a KOReader metadata.<ext>.lua file. Both the current
+// "annotations" list and the older "highlight" and "bookmarks" tables are
+// understood.
+func ReadSidecar(path string) (*Sidecar, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	v, err := parseLua(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filepath.Base(path), err)
+	}
+	root, ok := v.(table)
+	if !ok {
+		return nil, fmt.Errorf("parse %s: not a settings table", filepath.Base(path))
+	}
+
+	s := &Sidecar{
+		Path:     path,
+		Document: str(root["partial_md5_checksum"]),
+		DocPath:  str(root["doc_path"]),
+	}
+
+	// doc_props holds the document's own metadata, stats what KOReader
+	// shows (possibly edited by the reader)
+	props, _ := root["doc_props"].(table)
+	stats, _ := root["stats"].(table)
+	s.Title = firstNonEmpty(str(props["title"]), str(stats["title"]))
+	s.Authors = firstNonEmpty(str(props["authors"]), str(stats["authors"]))
+	s.Pages = num(stats["pages"])
+	if s.Pages == 0 {
+		s.Pages = num(root["doc_pages"])
+	}
+	if s.Title == "" && s.DocPath != "" {
+		base := filepath.Base(s.DocPath)
+		s.Title = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+
+	if annotations, ok := root["annotations"].(table); ok {
+		for _, v := range items(annotations) {
+			a, ok := v.(table)
+			if !ok {
+				continue
+			}
+			// Highlights span pos0 to pos1; page bookmarks have no range
+			text, note := strings.TrimSpace(str(a["text"])), strings.TrimSpace(str(a["note"]))
+			if _, ok := a["pos0"]; !ok || text == "" && note == "" {
+				continue
+			}
+			s.Annotations = append(s.Annotations, Annotation{
+				Text:     text,
+				Note:     note,
+				Chapter:  strings.TrimSpace(str(a["chapter"])),
+				Page:     firstPositive(num(a["pageno"]), num(a["page"])),
+				Datetime: parseDatetime(str(a["datetime"])),
+			})
+		}
+	} else {
+		s.Annotations = legacyAnnotations(root)
+	}
+
+	return s, nil
+}
+
+// legacyAnnotations reads the pre-2024 format: highlight[page][i] holds the
+// highlights, and the note on one is the "text" of the bookmark whose
+// "notes" is the highlighted text
+func legacyAnnotations(root table) []Annotation {
+	notes := make(map[string]string)
+	if bookmarks, ok := root["bookmarks"].(table); ok {
+		for _, v := range items(bookmarks) {
+			b, ok := v.(table)
+			if !ok || b["highlighted"] != true {
+				continue
+			}
+			note := strings.TrimSpace(str(b["text"]))
+			// Without a note, KOReader fills in "Page 12 <text> @ <datetime>"
+			if note == "" || strings.HasPrefix(note, "Page ") && strings.Contains(note, " @ ") {
+				continue
+			}
+			notes[str(b["datetime"])+"\x00"+strings.TrimSpace(str(b["notes"]))] = note
+		}
+	}
+
+	highlights, ok := root["highlight"].(table)
+	if !ok {
+		return nil
+	}
+	pages := make([]int64, 0, len(highlights))
+	for k := range highlights {
+		if page, ok := k.(int64); ok {
+			pages = append(pages, page)
+		}
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i] < pages[j] })
+
+	var annotations []Annotation
+	for _, page := range pages {
+		list, _ := highlights[page].(table)
+		for _, v := range items(list) {
+			h, ok := v.(table)
+			if !ok {
+				continue
+			}
+			text := strings.TrimSpace(str(h["text"]))
+			if text == "" {
+				continue
+			}
+			annotations = append(annotations, Annotation{
+				Text:     text,
+				Note:     notes[str(h["datetime"])+"\x00"+text],
+				Chapter:  strings.TrimSpace(str(h["chapter"])),
+				Page:     int(page),
+				Datetime: parseDatetime(str(h["datetime"])),
+			})
+		}
+	}
+	return annotations
+}
+
+// items returns a table's array part in order
+func items(t table) []any {
+	var list []any
+	for i := int64(1); ; i++ {
+		v, ok := t[i]
+		if !ok {
+			return list
+		}
+		list = append(list, v)
+	}
+}
+
+func str(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// num returns v as a whole number, or 0 if it isn't one (EPUB positions are
+// strings such as "/body/DocFragment[12].0")
+func num(v any) int {
+	switch v := v.(type) {
+	case float64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+	return 0
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func firstPositive(values ...int) int {
+	for _, v := range values {
+		if v > 0 {
+			return v
+		}
+	}
+	return 0
+}
+
+func parseDatetime(s string) time.Time {
+	t, err := time.ParseInLocation(datetimeLayout, strings.TrimSpace(s), time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,184 @@
+package koreader
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReadSidecar(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want Sidecar
+	}{
+		{
+			name: "annotations",
+			src: `-- ./Dune.sdr/metadata.epub.lua
+return {
+    ["annotations"] = {
+        [1] = {
+            ["chapter"] = "Book One",
+            ["datetime"] = "2024-03-04 21:15:02",
+            ["note"] = "The litany",
+            ["pageno"] = 12,
+            ["pos0"] = "/body/DocFragment[5]/body/p[3]/text().0",
+            ["pos1"] = "/body/DocFragment[5]/body/p[3]/text().16",
+            ["text"] = "I must not fear.",
+        },
+        [2] = {
+            ["datetime"] = "2024-03-05 08:00:00",
+            ["page"] = "/body/DocFragment[9]",
+            ["text"] = "A page bookmark",
+        },
+        [3] = {
+            ["datetime"] = "2024-03-06 07:30:00",
+            ["page"] = 40,
+            ["pos0"] = "/body/DocFragment[9]/body/p[1]/text().0",
+            ["text"] = "  Fear is the mind-killer.  ",
+        },
+    },
+    ["doc_pages"] = 700,
+    ["doc_path"] = "/mnt/onboard/Books/Dune.epub",
+    ["doc_props"] = {
+        ["authors"] = "Frank Herbert",
+        ["title"] = "Dune",
+    },
+    ["partial_md5_checksum"] = "5f4dcc3b5aa765d61d8327deb882cf99",
+    ["stats"] = {
+        ["pages"] = 412,
+        ["title"] = "Dune (edited)",
+    },
+}`,
+			want: Sidecar{
+				Title: "Dune", Authors: "Frank Herbert", Pages: 412,
+				Document: "5f4dcc3b5aa765d61d8327deb882cf99", DocPath: "/mnt/onboard/Books/Dune.epub",
+				Annotations: []Annotation{
+					{Text: "I must not fear.", Note: "The litany", Chapter: "Book One", Page: 12, Datetime: time.Date(2024, 3, 4, 21, 15, 2, 0, time.Local)},
+					{Text: "Fear is the mind-killer.", Page: 40, Datetime: time.Date(2024, 3, 6, 7, 30, 0, 0, time.Local)},
+				},
+			},
+		},
+		{
+			name: "legacy highlights and bookmarks",
+			src: `return {
+    ["bookmarks"] = {
+        [1] = {
+            ["datetime"] = "2021-05-01 10:00:00",
+            ["highlighted"] = true,
+            ["notes"] = "Second highlight",
+            ["text"] = "Page 30 Second highlight @ 2021-05-01 10:00:00",
+        },
+        [2] = {
+            ["datetime"] = "2021-04-30 09:00:00",
+            ["highlighted"] = true,
+            ["notes"] = "First highlight",
+            ["text"] = "My note",
+        },
+    },
+    ["doc_pages"] = 300,
+    ["doc_path"] = "/sdcard/Books/Piranesi.pdf",
+    ["highlight"] = {
+        [30] = {
+            [1] = {
+                ["datetime"] = "2021-05-01 10:00:00",
+                ["text"] = "Second highlight",
+            },
+        },
+        [4] = {
+            [1] = {
+                ["chapter"] = "Part 1",
+                ["datetime"] = "2021-04-30 09:00:00",
+                ["text"] = "First highlight",
+            },
+            [2] = {
+                ["datetime"] = "2021-04-30 09:05:00",
+                ["text"] = "",
+            },
+        },
+    },
+}`,
+			want: Sidecar{
+				Title: "Piranesi", Pages: 300, DocPath: "/sdcard/Books/Piranesi.pdf",
+				Annotations: []Annotation{
+					{Text: "First highlight", Note: "My note", Chapter: "Part 1", Page: 4, Datetime: time.Date(2021, 4, 30, 9, 0, 0, 0, time.Local)},
+					{Text: "Second highlight", Page: 30, Datetime: time.Date(2021, 5, 1, 10, 0, 0, 0, time.Local)},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "metadata.epub.lua")
+			if err := os.WriteFile(path, []byte(tt.src), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadSidecar(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Path != path || got.Title != tt.want.Title || got.Authors != tt.want.Authors || got.Pages != tt.want.Pages ||
+				got.Document != tt.want.Document || got.DocPath != tt.want.DocPath {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+			if !slices.EqualFunc(got.Annotations, tt.want.Annotations, func(a, b Annotation) bool {
+				return a.Text == b.Text && a.Note == b.Note && a.Chapter == b.Chapter && a.Page == b.Page && a.Datetime.Equal(b.Datetime)
+			}) {
+				t.Errorf("annotations = %+v, want %+v", got.Annotations, tt.want.Annotations)
+			}
+		})
+	}
+}
+
+func TestReadSidecarErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, src := range map[string]string{
+		"not a table": `return "Dune"`,
+		"invalid":     `return { ["title"] = }`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadSidecar(path); err == nil {
+			t.Errorf("%s: ReadSidecar succeeded", name)
+		}
+	}
+	if _, err := ReadSidecar(filepath.Join(dir, "missing")); err == nil {
+		t.Error("ReadSidecar of a missing file succeeded")
+	}
+}
+
+func TestFindSidecars(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"Books/Dune.sdr/metadata.epub.lua",
+		"Books/Dune.sdr/metadata.epub.lua.old",
+		"Books/Dune.epub",
+		"Books/Piranesi.sdr/metadata.pdf.lua",
+		".hidden/X.sdr/metadata.epub.lua",
+		"settings.lua",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("return {}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := FindSidecars(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "Books", "Dune.sdr", "metadata.epub.lua"),
+		filepath.Join(dir, "Books", "Piranesi.sdr", "metadata.pdf.lua"),
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("FindSidecars = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,144 @@
+package kosync
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+// Source names KOReader documents in external ID links; the ID is the
+// document digest KOReader syncs by
+const Source = "koreader"
+
+// finishedPercentage is how far into a document a book counts as read;
+// KOReader rarely reports exactly 1 on the last page
+const finishedPercentage = 0.99
+
+// ErrUserExists is returned by Store.CreateUser for a taken username
+var ErrUserExists = errors.New("username is already registered")
+
+// Progress is a reading position as KOReader syncs it
+type Progress struct {
+	Username   string  `json:"-"`
+	Document   string  `json:"document"`   // MD5 digest of the file or its name
+	Progress   string  `json:"progress"`   // page number or EPUB position (xpointer)
+	Percentage float64 `json:"percentage"` // 0-1
+	Device     string  `json:"device"`
+	DeviceID   string  `json:"device_id"`
+	Timestamp  int64   `json:"timestamp"` // Unix seconds
+}
+
+// Store persists sync users and their latest progress per document
+type Store interface {
+	CreateSyncUser(ctx context.Context, username, keyHash string) error
+	GetSyncUserKey(ctx context.Context, username string) (string, error) // "" if no such user
+	SaveSyncProgress(ctx context.Context, p *Progress) error
+	GetSyncProgress(ctx context.Context, username, document string) (*Progress, error)
+	ListSyncProgress(ctx context.Context) ([]Progress, error)
+}
+
+// Key returns the key KOReader authenticates with for a password: its
+// hex MD5 digest
+func Key(password string) string {
+	sum := md5.Sum([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// HashKey salts and hashes a user's key for storage
+func HashKey(key string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generate salt: %w", err)
+	}
+	return hashWithSalt(hex.EncodeToString(salt), key), nil
+}
+
+// CheckKey reports whether key matches a hash from HashKey
+func CheckKey(hash, key string) bool {
+	salt, _, ok := strings.Cut(hash, "$")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(hashWithSalt(salt, key))) == 1
+}
+
+func hashWithSalt(salt, key string) string {
+	sum := sha256.Sum256([]byte(salt + key))
+	return salt + "$" + hex.EncodeToString(sum[:])
+}
+
+// PartialMD5 computes KOReader's "binary" document digest: the MD5 of 1 KiB
+// samples taken at offsets 0, 1 KiB, 4 KiB, 16 KiB and so on up to 1 GiB
+func PartialMD5(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	const step, size = 1024, 1024
+	h := md5.New()
+	buf := make([]byte, size)
+	for i := -1; i <= 10; i++ {
+		offset := int64(0)
+		if i >= 0 {
+			offset = int64(step) << (2 * i)
+		}
+		n, err := f.ReadAt(buf, offset)
+		if n == 0 {
+			break
+		}
+		h.Write(buf[:n])
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FilenameMD5 computes KOReader's "filename" document digest
+func FilenameMD5(path string) string {
+	sum := md5.Sum([]byte(filepath.Base(path)))
+	return hex.EncodeToString(sum[:])
+}
+
+// ApplyProgress moves b to the reading position percentage (0-1) and
+// reports whether anything changed. Books start reading when progress is
+// first synced, resume if paused, and are marked read at the end of the
+// document. The current page is only set for books with a page count.
+func ApplyProgress(b *book.Book, percentage float64, now time.Time) bool {
+	percentage = math.Max(0, math.Min(1, percentage))
+	changed := false
+
+	if b.PageCount > 0 {
+		page := int(math.Round(percentage * float64(b.PageCount)))
+		if page != b.CurrentPage {
+			b.CurrentPage = page
+			changed = true
+		}
+	}
+
+	switch {
+	case percentage >= finishedPercentage && b.Status != book.StatusRead:
+		b.Status = book.StatusRead
+		b.DateRead = now
+		changed = true
+	case percentage > 0 && percentage < finishedPercentage && (b.Status == book.StatusWantToRead || b.Status == book.StatusPaused):
+		b.Status = book.StatusReading
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,205 @@
+package kosync
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		password, want string
+	}{
+		{"password", "5f4dcc3b5aa765d61d8327deb882cf99"},
+		{"", "d41d8cd98f00b204e9800998ecf8427e"},
+	}
+	for _, tt := range tests {
+		if got := Key(tt.password); got != tt.want {
+			t.Errorf("Key(%q) = %q, want %q", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestCheckKey(t *testing.T) {
+	key := Key("secret")
+	hash, err := HashKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := HashKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == other {
+		t.Error("two hashes of one key are equal; the salt isn't random")
+	}
+
+	tests := []struct {
+		name string
+		hash string
+		key  string
+		want bool
+	}{
+		{"right key", hash, key, true},
+		{"other salt", other, key, true},
+		{"wrong key", hash, Key("guess"), false},
+		{"empty key", hash, "", false},
+		{"no salt", hash[len(hash)-64:], key, false},
+		{"empty hash", "", key, false},
+	}
+	for _, tt := range tests {
+		if got := CheckKey(tt.hash, tt.key); got != tt.want {
+			t.Errorf("%s: CheckKey = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPartialMD5(t *testing.T) {
+	md5Of := func(parts ...[]byte) string {
+		h := md5.New()
+		for _, p := range parts {
+			h.Write(p)
+		}
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	data := make([]byte, 20000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	tests := []struct {
+		name string
+		size int
+		want string
+	}{
+		{"empty", 0, md5Of()},
+		{"under a sample", 700, md5Of(data[:700])},
+		{"two samples", 2048, md5Of(data[:1024], data[1024:2048])},
+		// Samples at 0, 1 KiB, 4 KiB and 16 KiB, the last two cut short
+		{"cut short", 5000, md5Of(data[:1024], data[1024:2048], data[4096:5000])},
+		{"four samples", 20000, md5Of(data[:1024], data[1024:2048], data[4096:5120], data[16384:17408])},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, data[:tt.size], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := PartialMD5(path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: PartialMD5 = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := PartialMD5(filepath.Join(dir, "missing")); err == nil {
+		t.Error("PartialMD5 of a missing file succeeded")
+	}
+}
+
+func TestFilenameMD5(t *testing.T) {
+	want := Key("Dune.epub")
+	for _, path := range []string{"Dune.epub", "/books/sf/Dune.epub"} {
+		if got := FilenameMD5(path); got != want {
+			t.Errorf("FilenameMD5(%q) = %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestApplyProgress(t *testing.T) {
+	now := time.Date(2024, 3, 4, 21, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		book        book.Book
+		percentage  float64
+		wantPage    int
+		wantStatus  book.Status
+		wantRead    bool // DateRead set to now
+		wantChanged bool
+	}{
+		{
+			name:       "starts reading",
+			book:       book.Book{PageCount: 400, Status: book.StatusWantToRead},
+			percentage: 0.25, wantPage: 100, wantStatus: book.StatusReading, wantChanged: true,
+		},
+		{
+			name:       "resumes a paused book",
+			book:       book.Book{PageCount: 400, CurrentPage: 100, Status: book.StatusPaused},
+			percentage: 0.25, wantPage: 100, wantStatus: book.StatusReading, wantChanged: true,
+		},
+		{
+			name:       "same page",
+			book:       book.Book{PageCount: 400, CurrentPage: 100, Status: book.StatusReading},
+			percentage: 0.2501, wantPage: 100, wantStatus: book.StatusReading,
+		},
+		{
+			name:       "rereading stays rereading",
+			book:       book.Book{PageCount: 400, CurrentPage: 100, Status: book.StatusRereading},
+			percentage: 0.5, wantPage: 200, wantStatus: book.StatusRereading, wantChanged: true,
+		},
+		{
+			name:       "finished near the end",
+			book:       book.Book{PageCount: 400, CurrentPage: 390, Status: book.StatusReading},
+			percentage: 0.995, wantPage: 398, wantStatus: book.StatusRead, wantRead: true, wantChanged: true,
+		},
+		{
+			name:       "already read",
+			book:       book.Book{PageCount: 400, CurrentPage: 400, Status: book.StatusRead},
+			percentage: 1, wantPage: 400, wantStatus: book.StatusRead,
+		},
+		{
+			name:       "no page count",
+			book:       book.Book{Status: book.StatusWantToRead},
+			percentage: 0.3, wantStatus: book.StatusReading, wantChanged: true,
+		},
+		{
+			name:       "clamped",
+			book:       book.Book{PageCount: 200, Status: book.StatusReading},
+			percentage: 1.7, wantPage: 200, wantStatus: book.StatusRead, wantRead: true, wantChanged: true,
+		},
+		{
+			name:       "nothing read yet",
+			book:       book.Book{PageCount: 200, Status: book.StatusWantToRead},
+			percentage: 0, wantStatus: book.StatusWantToRead,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.book
+			changed := ApplyProgress(&b, tt.percentage, now)
+			if changed != tt.wantChanged {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if b.CurrentPage != tt.wantPage || b.Status != tt.wantStatus {
+				t.Errorf("got page %d, %s; want page %d, %s", b.CurrentPage, b.Status, tt.wantPage, tt.wantStatus)
+			}
+			if b.DateRead.Equal(now) != tt.wantRead {
+				t.Errorf("date read = %v", b.DateRead)
+			}
+		})
+	}
+}
+
+func TestValidField(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"reader", true},
+		{"a b", true},
+		{"", false},
+		{"user:name", false},
+	}
+	for _, tt := range tests {
+		if got := validField(tt.in); got != tt.want {
+			t.Errorf("validField(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
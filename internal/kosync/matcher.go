@@ -0,0 +1,81 @@
+package kosync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+// Matcher finds the book a KOReader document digest belongs to: the book
+// linked to it, or else the book whose local file has that digest (by
+// content or by file name, KOReader's two methods)
+type Matcher struct {
+	books *book.Service
+
+	mu      sync.Mutex
+	digests map[string]fileDigest // by file path
+}
+
+// fileDigest caches a file's partial MD5 until the file changes
+type fileDigest struct {
+	size    int64
+	modTime time.Time
+	partial string
+}
+
+func NewMatcher(books *book.Service) *Matcher {
+	return &Matcher{books: books, digests: make(map[string]fileDigest)}
+}
+
+// Match returns the book for document, or nil, and whether it was found
+// through a link rather than by file
+func (m *Matcher) Match(ctx context.Context, document string) (*book.Book, bool, error) {
+	document = strings.ToLower(document)
+	b, err := m.books.FindByExternalID(ctx, Source, document)
+	if err != nil || b != nil {
+		return b, b != nil, err
+	}
+
+	books, err := m.books.List(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("list books: %w", err)
+	}
+	for i := range books {
+		if books[i].FilePath == "" {
+			continue
+		}
+		if FilenameMD5(books[i].FilePath) == document || m.partialMD5(books[i].FilePath) == document {
+			return &books[i], false, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// partialMD5 returns the cached PartialMD5 of path, or "" if it can't be read
+func (m *Matcher) partialMD5(path string) string {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return ""
+	}
+
+	m.mu.Lock()
+	d, ok := m.digests[path]
+	m.mu.Unlock()
+	if ok && d.size == info.Size() && d.modTime.Equal(info.ModTime()) {
+		return d.partial
+	}
+
+	partial, err := PartialMD5(path)
+	if err != nil {
+		return ""
+	}
+	m.mu.Lock()
+	m.digests[path] = fileDigest{size: info.Size(), modTime: info.ModTime(), partial: partial}
+	m.mu.Unlock()
+	return partial
+}
@@ -0,0 +1,270 @@
+package kosync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+// Handler serves the KOReader sync API (the protocol of
+// koreader-sync-server). Progress synced for a document that matches a
+// book in the library also moves that book's progress and status.
+type Handler struct {
+	AllowRegistration bool // let devices create users with POST /users/create
+
+	store   Store
+	books   *book.Service
+	matcher *Matcher
+}
+
+func NewHandler(store Store, books *book.Service) *Handler {
+	return &Handler{
+		store:   store,
+		books:   books,
+		matcher: NewMatcher(books),
+	}
+}
+
+// Error codes of the sync protocol
+const (
+	codeUnknown         = 2000
+	codeUnauthorized    = 2001
+	codeUserExists      = 2002
+	codeInvalidFields   = 2003
+	codeDocumentMissing = 2004
+	codeRegistrationOff = 2005
+)
+
+const (
+	progressPath   = "/syncs/progress"
+	maxRequestBody = 64 << 10
+)
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+
+	switch {
+	case r.URL.Path == "/healthcheck" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]string{"state": "OK"})
+	case r.URL.Path == "/users/create" && r.Method == http.MethodPost:
+		h.handleCreateUser(w, r)
+	case r.URL.Path == "/users/auth" && r.Method == http.MethodGet:
+		if _, ok := h.authorize(w, r); ok {
+			writeJSON(w, http.StatusOK, map[string]string{"authorized": "OK"})
+		}
+	case r.URL.Path == progressPath && r.Method == http.MethodPut:
+		h.handlePutProgress(w, r)
+	case strings.HasPrefix(r.URL.Path, progressPath+"/") && r.Method == http.MethodGet:
+		h.handleGetProgress(w, r, strings.TrimPrefix(r.URL.Path, progressPath+"/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	if !h.AllowRegistration {
+		writeError(w, http.StatusPaymentRequired, codeRegistrationOff, "This server does not allow user registration.")
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"` // already the MD5 key
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !validField(req.Username) || !validField(req.Password) {
+		writeError(w, http.StatusForbidden, codeInvalidFields, "Invalid request")
+		return
+	}
+
+	if err := CreateUser(r.Context(), h.store, req.Username, req.Password); err != nil {
+		if errors.Is(err, ErrUserExists) {
+			writeError(w, http.StatusPaymentRequired, codeUserExists, "Username is already registered.")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeUnknown, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"username": req.Username})
+}
+
+func (h *Handler) handlePutProgress(w http.ResponseWriter, r *http.Request) {
+	username, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	var p Progress
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		writeError(w, http.StatusForbidden, codeInvalidFields, "Invalid request")
+		return
+	}
+	if !validField(p.Document) {
+		writeError(w, http.StatusForbidden, codeDocumentMissing, "Field 'document' not provided.")
+		return
+	}
+	if p.Percentage < 0 || p.Percentage > 1 || p.Progress == "" || p.Device == "" {
+		writeError(w, http.StatusForbidden, codeInvalidFields, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	p.Username = username
+	p.Timestamp = time.Now().Unix()
+	prev, err := h.store.GetSyncProgress(ctx, username, p.Document)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeUnknown, err.Error())
+		return
+	}
+	if err := h.store.SaveSyncProgress(ctx, &p); err != nil {
+		writeError(w, http.StatusInternalServerError, codeUnknown, err.Error())
+		return
+	}
+
+	if err := h.updateBook(ctx, &p, prev); err != nil {
+		// The device only cares that its position was stored
+		log.Printf("kosync: update book for %s: %v", p.Document, err)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"document": p.Document, "timestamp": p.Timestamp})
+}
+
+func (h *Handler) handleGetProgress(w http.ResponseWriter, r *http.Request, document string) {
+	username, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	if !validField(document) {
+		writeError(w, http.StatusForbidden, codeDocumentMissing, "Field 'document' not provided.")
+		return
+	}
+
+	p, err := h.store.GetSyncProgress(r.Context(), username, document)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeUnknown, err.Error())
+		return
+	}
+	if p == nil {
+		writeJSON(w, http.StatusOK, struct{}{})
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// authorize checks the x-auth-user and x-auth-key headers, writing the
+// error response if they don't match a user
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request) (string, bool) {
+	username, key := r.Header.Get("x-auth-user"), r.Header.Get("x-auth-key")
+	if validField(username) && validField(key) {
+		hash, err := h.store.GetSyncUserKey(r.Context(), username)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeUnknown, err.Error())
+			return "", false
+		}
+		if hash != "" && CheckKey(hash, key) {
+			return username, true
+		}
+	}
+	writeError(w, http.StatusUnauthorized, codeUnauthorized, "Unauthorized")
+	return "", false
+}
+
+// updateBook applies synced progress to the matching book, if any, and
+// records it as reading from the previously synced position (prev may be nil)
+func (h *Handler) updateBook(ctx context.Context, p, prev *Progress) error {
+	b, err := h.FindBook(ctx, p.Document)
+	if err != nil || b == nil {
+		return err
+	}
+
+	at := time.Unix(p.Timestamp, 0)
+	sess := book.Session{
+		BookID:       b.ID,
+		End:          at,
+		StartPage:    b.CurrentPage,
+		StartPercent: p.Percentage * 100,
+		EndPercent:   p.Percentage * 100,
+		Source:       Source,
+	}
+	if prev != nil {
+		sess.StartPercent = prev.Percentage * 100
+	}
+
+	if ApplyProgress(b, p.Percentage, at) {
+		if err := h.books.SaveProgress(ctx, b); err != nil {
+			return err
+		}
+	}
+	sess.EndPage = b.CurrentPage
+	return h.books.RecordProgress(ctx, sess)
+}
+
+// FindBook returns the book a document digest belongs to, or nil (see
+// Matcher). A match by file is remembered as a link.
+func (h *Handler) FindBook(ctx context.Context, document string) (*book.Book, error) {
+	b, linked, err := h.matcher.Match(ctx, document)
+	if err != nil || b == nil || linked {
+		return b, err
+	}
+	if err := Link(ctx, h.store, h.books, document, b.ID); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// CreateUser registers a sync user with the key KOReader will send (see Key)
+func CreateUser(ctx context.Context, store Store, username, key string) error {
+	hash, err := HashKey(key)
+	if err != nil {
+		return err
+	}
+	return store.CreateSyncUser(ctx, username, hash)
+}
+
+// Link ties a document digest to a book, for documents that can't be
+// matched by file, and applies the latest progress synced for it
+func Link(ctx context.Context, store Store, books *book.Service, document string, bookID int64) error {
+	document = strings.ToLower(document)
+	if err := books.LinkExternalID(ctx, bookID, Source, document); err != nil {
+		return fmt.Errorf("link document: %w", err)
+	}
+
+	list, err := store.ListSyncProgress(ctx)
+	if err != nil {
+		return fmt.Errorf("list progress: %w", err)
+	}
+	for _, p := range list {
+		if strings.ToLower(p.Document) != document {
+			continue
+		}
+		b, err := books.Get(ctx, bookID)
+		if err != nil {
+			return fmt.Errorf("get book %d: %w", bookID, err)
+		}
+		if ApplyProgress(b, p.Percentage, time.Unix(p.Timestamp, 0)) {
+			return books.SaveProgress(ctx, b)
+		}
+		break // newest first
+	}
+	return nil
+}
+
+func validField(s string) bool {
+	return s != "" && !strings.ContainsAny(s, ":")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status, code int, message string) {
+	writeJSON(w, status, map[string]any{"code": code, "message": message})
+}
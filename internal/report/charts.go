@@ -0,0 +1,77 @@
+package report
+
+import (
+	"html/template"
+	"strconv"
+	"time"
+
+	"github.com/erwar/pka/internal/chart"
+	"github.com/erwar/pka/internal/stats"
+)
+
+// Charts are statistics drawn as SVG, for the stats page and the year in
+// review
+type Charts struct {
+	Reads   template.HTML // reads per month in the range
+	Pages   template.HTML // pages read so far through the range
+	Ratings template.HTML // books per star rating
+	Genres  template.HTML // books per genre
+}
+
+// StatsCharts draws the library's statistics
+func StatsCharts(s *stats.Stats) Charts {
+	var reads, pages []chart.Point
+	long := len(s.Months) > 12
+	for _, m := range s.Months {
+		label := m.Month
+		if t, err := time.Parse("2006-01", m.Month); err == nil {
+			label = t.Format("Jan")
+			if long {
+				label = t.Format("Jan 06")
+			}
+		}
+		reads = append(reads, chart.Point{Label: label, Value: float64(m.Reads)})
+		pages = append(pages, chart.Point{Label: label, Value: float64(m.Pages)})
+	}
+	return Charts{
+		Reads:   chart.Bars(reads, "#6366f1"),
+		Pages:   chart.Line(chart.Cumulative(pages), "#22c55e"),
+		Ratings: chart.Bars(ratingPoints(s.Ratings), "#eab308"),
+		Genres:  chart.Donut(countPoints(s.Genres)),
+	}
+}
+
+// Charts draws the review's reads and pages per month, ratings and genres
+func (w *Wrapped) Charts() Charts {
+	reads := make([]chart.Point, 12)
+	pages := make([]chart.Point, 12)
+	for i := range w.Months {
+		name := time.Month(i + 1).String()[:3]
+		reads[i] = chart.Point{Label: name, Value: float64(w.Months[i])}
+		pages[i] = chart.Point{Label: name, Value: float64(w.MonthPages[i])}
+	}
+	return Charts{
+		Reads:   chart.Bars(reads, "#6366f1"),
+		Pages:   chart.Line(chart.Cumulative(pages), "#22c55e"),
+		Ratings: chart.Bars(ratingPoints(w.Ratings), "#eab308"),
+		Genres:  chart.Donut(countPoints(w.Genres)),
+	}
+}
+
+// ratingPoints turns counts per star rating into chart points, 1 star first
+func ratingPoints(ratings [6]int) []chart.Point {
+	points := make([]chart.Point, 5)
+	for stars := 1; stars <= 5; stars++ {
+		points[stars-1] = chart.Point{Label: strconv.Itoa(stars) + "★", Value: float64(ratings[stars])}
+	}
+	return points
+}
+
+// countPoints turns counts into chart points
+func countPoints(counts []stats.Count) []chart.Point {
+	points := make([]chart.Point, len(counts))
+	for i, c := range counts {
+		points[i] = chart.Point{Label: c.Name, Value: float64(c.N)}
+	}
+	return points
+}
@@ -0,0 +1,119 @@
+package report
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+//go:embed wrapped.html
+var wrappedHTML string
+
+var htmlTemplate = template.Must(template.New("wrapped").Funcs(template.FuncMap{
+	"stars": func(r float64) string {
+		return strings.Repeat("★", book.WholeStars(r))
+	},
+}).Parse(wrappedHTML))
+
+// WriteHTML writes the review as a standalone HTML page, with no scripts
+// or outside stylesheets
+func WriteHTML(out io.Writer, w *Wrapped) error {
+	return htmlTemplate.Execute(out, w)
+}
+
+// WriteMarkdown writes the review as Markdown
+func WriteMarkdown(out io.Writer, w *Wrapped) error {
+	bw := bufio.NewWriter(out)
+	p := func(format string, args ...any) {
+		fmt.Fprintf(bw, format, args...)
+	}
+
+	p("# %d in books\n\n", w.Year)
+	if len(w.Reads) == 0 {
+		p("No books finished in %d.\n", w.Year)
+		return bw.Flush()
+	}
+
+	p("- **%d** books read", len(w.Reads))
+	if w.Rereads > 0 {
+		p(" (%d re-reads)", w.Rereads)
+	}
+	p("\n- **%d** pages read\n", w.Pages)
+	if w.Minutes > 0 {
+		p("- **%.1f** hours listened\n", w.Hours())
+	}
+	if w.Rated > 0 {
+		p("- **%.1f** average rating from %d rated\n", w.AvgRating, w.Rated)
+	}
+	if w.DNF > 0 {
+		p("- %d not finished\n", w.DNF)
+	}
+	p("\n")
+
+	if w.First != nil {
+		p("**First book of the year:** %s (%s)  \n", readLine(w.First), w.First.Finished.Format("Jan 2"))
+		p("**Last book of the year:** %s (%s)\n\n", readLine(w.Last), w.Last.Finished.Format("Jan 2"))
+	}
+	if w.Longest != nil {
+		p("**Longest:** %s, %d pages  \n", readLine(w.Longest), w.Longest.Book.PageCount)
+		p("**Shortest:** %s, %d pages\n\n", readLine(w.Shortest), w.Shortest.Book.PageCount)
+	}
+	if w.MostSimilar != nil {
+		p("**Most alike:** *%s* and *%s* (%.0f%% similar)\n\n", w.MostSimilar.A.Title, w.MostSimilar.B.Title, w.MostSimilar.Score*100)
+	}
+
+	p("## Month by month\n\n")
+	for _, m := range w.Chart() {
+		p("    %s %-20s %d\n", m.Name, strings.Repeat("█", m.Percent/5), m.Reads)
+	}
+	p("\n")
+
+	if w.Rated > 0 {
+		p("## Ratings\n\n")
+		for _, bar := range w.RatingChart() {
+			p("    %-5s %-20s %d\n", strings.Repeat("*", bar.Stars), strings.Repeat("█", bar.Percent/5), bar.Reads)
+		}
+		p("\n")
+	}
+
+	if len(w.TopGenres) > 0 {
+		p("## Top genres\n\n")
+		for i, c := range w.TopGenres {
+			p("%d. %s (%d)\n", i+1, c.Name, c.N)
+		}
+		p("\n")
+	}
+	p("## Top authors\n\n")
+	for i, c := range w.TopAuthors {
+		p("%d. %s (%d)\n", i+1, c.Name, c.N)
+	}
+	p("\n")
+
+	p("## Everything read\n\n")
+	p("| Finished | Title | Author | Length | Rating |\n")
+	p("|---|---|---|---|---|\n")
+	for i := range w.Reads {
+		r := &w.Reads[i]
+		title := mdEscape(r.Book.Title)
+		if r.Reread {
+			title += " (re-read)"
+		}
+		p("| %s | %s | %s | %s | %s |\n", r.Finished.Format("2006-01-02"), title, mdEscape(r.Book.Author), r.Length(), strings.Repeat("★", book.WholeStars(r.Rating)))
+	}
+
+	return bw.Flush()
+}
+
+func readLine(r *Read) string {
+	return fmt.Sprintf("*%s* by %s", r.Book.Title, r.Book.Author)
+}
+
+// mdEscape keeps a value from breaking a Markdown table row
+func mdEscape(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
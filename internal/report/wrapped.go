@@ -0,0 +1,206 @@
+// Package report builds a year in review of the library, and writes it out
+// as Markdown or a standalone HTML page.
+package report
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+	"github.com/erwar/pka/internal/search"
+	"github.com/erwar/pka/internal/stats"
+)
+
+// topN is how many genres and authors a report lists
+const topN = 5
+
+// Read is one finished read in the year
+type Read struct {
+	Book     book.Book
+	Finished time.Time
+	Rating   float64 // the read's rating, or the book's if the read has none
+	Reread   bool    // the book had been finished before
+}
+
+// Length is how long the book read is, e.g. "592 pages" or "21:08
+// listened"; empty if unknown
+func (r *Read) Length() string {
+	switch {
+	case r.Book.IsAudiobook() && r.Book.TotalMinutes > 0:
+		return book.FormatMinutes(r.Book.TotalMinutes) + " listened"
+	case !r.Book.IsAudiobook() && r.Book.PageCount > 0:
+		return fmt.Sprintf("%d pages", r.Book.PageCount)
+	}
+	return ""
+}
+
+// Count is a genre or author and how many reads it had
+type Count = stats.Count
+
+// Wrapped is a year in review. Books read twice in the year count twice,
+// except in Books.
+type Wrapped struct {
+	Year        int
+	Reads       []Read // oldest first
+	Books       int    // different books finished
+	Rereads     int
+	Pages       int // of books read on paper or as ebooks
+	Minutes     int // of audiobooks listened to
+	DNF         int // reads given up in the year
+	Longest     *Read
+	Shortest    *Read
+	AvgRating   float64
+	Rated       int
+	Ratings     [6]int  // reads per star rating; index 0 is unused
+	Genres      []Count // reads per genre, most first
+	TopGenres   []Count
+	TopAuthors  []Count
+	Months      [12]int // reads finished per month
+	MonthPages  [12]int // pages of the reads finished per month
+	First       *Read
+	Last        *Read
+	MostSimilar *book.DuplicatePair // the two books read most alike in meaning
+}
+
+// Build works out the review of year from the library's books and their
+// read-throughs (oldest first, as returned by AllReadThroughs)
+func Build(year int, books []book.Book, reads []book.ReadThrough) *Wrapped {
+	w := &Wrapped{Year: year}
+
+	byID := make(map[int64]book.Book, len(books))
+	for _, b := range books {
+		byID[b.ID] = b
+	}
+
+	rereads := book.Rereads(reads)
+	for _, rt := range reads {
+		if rt.Finished.Year() != year {
+			continue
+		}
+		b, ok := byID[rt.BookID]
+		if !ok {
+			continue
+		}
+		switch rt.Status {
+		case book.StatusRead:
+			rating := rt.Rating
+			if rating == 0 {
+				rating = b.Rating
+			}
+			w.Reads = append(w.Reads, Read{Book: b, Finished: rt.Finished, Rating: rating, Reread: rereads[rt.ID]})
+		case book.StatusDNF:
+			w.DNF++
+		}
+	}
+	sort.SliceStable(w.Reads, func(i, j int) bool { return w.Reads[i].Finished.Before(w.Reads[j].Finished) })
+
+	var totalRating float64
+	genres := make(map[string]int)
+	authors := make(map[string]int)
+	seen := make(map[int64]bool)
+	var distinct []book.Book
+	for i := range w.Reads {
+		r := &w.Reads[i]
+		if !seen[r.Book.ID] {
+			seen[r.Book.ID] = true
+			distinct = append(distinct, r.Book)
+		}
+		if r.Reread {
+			w.Rereads++
+		}
+		w.Months[r.Finished.Month()-1]++
+		if r.Book.IsAudiobook() {
+			w.Minutes += r.Book.TotalMinutes
+		} else {
+			w.Pages += r.Book.PageCount
+			w.MonthPages[r.Finished.Month()-1] += r.Book.PageCount
+		}
+
+		if r.Book.PageCount > 0 && !r.Book.IsAudiobook() {
+			if w.Longest == nil || r.Book.PageCount > w.Longest.Book.PageCount {
+				w.Longest = r
+			}
+			if w.Shortest == nil || r.Book.PageCount < w.Shortest.Book.PageCount {
+				w.Shortest = r
+			}
+		}
+		if r.Rating > 0 {
+			totalRating += r.Rating
+			w.Rated++
+			w.Ratings[book.WholeStars(r.Rating)]++
+		}
+		if r.Book.Genre != "" {
+			genres[r.Book.Genre]++
+		}
+		for _, name := range r.Book.AuthorNames() {
+			authors[name]++
+		}
+	}
+	w.Books = len(distinct)
+
+	if w.Rated > 0 {
+		w.AvgRating = totalRating / float64(w.Rated)
+	}
+	if n := len(w.Reads); n > 0 {
+		w.First, w.Last = &w.Reads[0], &w.Reads[n-1]
+	}
+	w.Genres = stats.Sorted(genres)
+	w.TopGenres = w.Genres[:min(len(w.Genres), topN)]
+	w.TopAuthors = stats.Sorted(authors)
+	w.TopAuthors = w.TopAuthors[:min(len(w.TopAuthors), topN)]
+	w.MostSimilar = search.ClosestPair(distinct)
+	return w
+}
+
+// Hours is the time spent listening to audiobooks, in hours
+func (w *Wrapped) Hours() float64 {
+	return float64(w.Minutes) / 60
+}
+
+// Month is one bar of the month-by-month chart
+type Month struct {
+	Name    string // e.g. "Jan"
+	Reads   int
+	Percent int // of the busiest month
+}
+
+// Chart returns the month-by-month reads scaled to the busiest month
+func (w *Wrapped) Chart() []Month {
+	busiest := 0
+	for _, n := range w.Months {
+		busiest = max(busiest, n)
+	}
+	months := make([]Month, 12)
+	for i, n := range w.Months {
+		months[i] = Month{Name: time.Month(i + 1).String()[:3], Reads: n}
+		if busiest > 0 {
+			months[i].Percent = n * 100 / busiest
+		}
+	}
+	return months
+}
+
+// RatingBar is one bar of the rating distribution
+type RatingBar struct {
+	Stars   int
+	Reads   int
+	Percent int // of the most common rating
+}
+
+// RatingChart returns the rating distribution, 5 stars first
+func (w *Wrapped) RatingChart() []RatingBar {
+	most := 0
+	for _, n := range w.Ratings[1:] {
+		most = max(most, n)
+	}
+	var bars []RatingBar
+	for stars := 5; stars >= 1; stars-- {
+		bar := RatingBar{Stars: stars, Reads: w.Ratings[stars]}
+		if most > 0 {
+			bar.Percent = bar.Reads * 100 / most
+		}
+		bars = append(bars, bar)
+	}
+	return bars
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -40,6 +42,7 @@ type gbItem struct {
 
 type gbVolumeInfo struct {
 	Title               string       `json:"title"`
+	Subtitle            string       `json:"subtitle"`
 	Authors             []string     `json:"authors"`
 	Publisher           string       `json:"publisher"`
 	PublishedDate       string       `json:"publishedDate"`
@@ -51,6 +54,11 @@ type gbVolumeInfo struct {
 	PageCount           int          `json:"pageCount"`
 	Language            string       `json:"language"`
 	ImageLinks          gbImageLinks `json:"imageLinks"`
+	SeriesInfo          gbSeriesInfo `json:"seriesInfo"`
+}
+
+type gbSeriesInfo struct {
+	BookDisplayNumber string `json:"bookDisplayNumber"`
 }
 
 type gbImageLinks struct {
@@ -222,23 +230,48 @@ func (c *GoogleBooksClient) itemsToBooks(items []gbItem) []book.Book {
 			coverURL = "https://" + coverURL[7:]
 		}
 
+		title, series, position := gbSeries(vi)
+
 		books = append(books, book.Book{
-			Title:       vi.Title,
-			Author:      author,
-			ISBN:        isbn,
-			Description: truncateGB(vi.Description, 500),
-			Genre:       genre,
-			Tags:        tags,
-			CoverURL:    coverURL,
-			PageCount:   vi.PageCount,
-			Status:      book.StatusWantToRead,
-			DateAdded:   time.Now(),
+			Title:          title,
+			Series:         series,
+			SeriesPosition: position,
+			Author:         author,
+			ISBN:           isbn,
+			Description:    truncateGB(vi.Description, 500),
+			Genre:          genre,
+			Tags:           tags,
+			CoverURL:       coverURL,
+			PageCount:      vi.PageCount,
+			Status:         book.StatusWantToRead,
+			DateAdded:      time.Now(),
 		})
 	}
 
 	return books
 }
 
+// gbSubtitleSeries matches a series given as a subtitle, e.g. "Book 1 of
+// the Expanse"
+var gbSubtitleSeries = regexp.MustCompile(`(?i)^(?:book|volume|vol\.)\s+(\d+(?:\.\d+)?)\s+(?:of|in)\s+(.+?)(?:\s+series)?$`)
+
+// gbSeries finds a volume's series, which Google Books only names in the
+// title or subtitle. seriesInfo has the position without the name, so it
+// only fills in a missing position.
+func gbSeries(vi gbVolumeInfo) (string, string, float64) {
+	title, series, position := book.SplitSeriesTitle(vi.Title)
+	if series == "" {
+		if m := gbSubtitleSeries.FindStringSubmatch(strings.TrimSpace(vi.Subtitle)); m != nil {
+			series = m[2]
+			position, _ = strconv.ParseFloat(m[1], 64)
+		}
+	}
+	if series != "" && position == 0 {
+		position, _ = strconv.ParseFloat(vi.SeriesInfo.BookDisplayNumber, 64)
+	}
+	return title, series, position
+}
+
 func truncateGB(s string, maxLen int) string {
 	if len(s) <= maxLen {
 		return s
@@ -53,6 +53,10 @@ type olEdition struct {
 	ISBN13     []string `json:"isbn_13"`
 	Publishers []string `json:"publishers"`
 	Works      []olRef2 `json:"works"`
+	Series     []string `json:"series"`          // e.g. "The Expanse ; 1"
+	Format     string   `json:"physical_format"` // e.g. "Hardcover", "Audio CD"
+	Pages      int      `json:"number_of_pages"`
+	Covers     []int    `json:"covers"`
 }
 
 type olRef2 struct {
@@ -139,14 +143,36 @@ func (c *OpenLibraryClient) FetchByISBN(ctx context.Context, isbn string) (*book
 		finalISBN = edition.ISBN10[0]
 	}
 
+	var series string
+	var position float64
+	if len(edition.Series) > 0 {
+		series, position = book.ParseSeries(edition.Series[0])
+	}
+
+	var publisher, coverURL string
+	if len(edition.Publishers) > 0 {
+		publisher = edition.Publishers[0]
+	}
+	if len(edition.Covers) > 0 && edition.Covers[0] > 0 {
+		coverURL = fmt.Sprintf("https://covers.openlibrary.org/b/id/%d-M.jpg", edition.Covers[0])
+	}
+
+	format, _ := book.ParseFormat(edition.Format)
+
 	return &book.Book{
-		Title:       edition.Title,
-		Author:      strings.Join(authorNames, ", "),
-		ISBN:        finalISBN,
-		Description: truncate(description, 500),
-		Tags:        tags,
-		Status:      book.StatusWantToRead,
-		DateAdded:   time.Now(),
+		Title:          edition.Title,
+		Series:         series,
+		SeriesPosition: position,
+		Author:         strings.Join(authorNames, ", "),
+		ISBN:           finalISBN,
+		Format:         format,
+		Publisher:      publisher,
+		PageCount:      edition.Pages,
+		CoverURL:       coverURL,
+		Description:    truncate(description, 500),
+		Tags:           tags,
+		Status:         book.StatusWantToRead,
+		DateAdded:      time.Now(),
 	}, nil
 }
 
@@ -388,16 +414,22 @@ func (c *OpenLibraryClient) SearchAuthor(ctx context.Context, name string) (stri
 
 // FetchAuthorBooks fetches all books by an author
 func (c *OpenLibraryClient) FetchAuthorBooks(ctx context.Context, authorName string, limit int) ([]book.Book, error) {
-	if limit <= 0 {
-		limit = 50
-	}
-
 	// First, find the author
 	authorKey, resolvedName, err := c.SearchAuthor(ctx, authorName)
 	if err != nil {
 		return nil, err
 	}
 
+	return c.FetchAuthorWorks(ctx, authorKey, resolvedName, limit)
+}
+
+// FetchAuthorWorks fetches the books of the author with an Open Library
+// key, e.g. "OL23919A", credited to name
+func (c *OpenLibraryClient) FetchAuthorWorks(ctx context.Context, authorKey, name string, limit int) ([]book.Book, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
 	// Fetch author's works
 	// authorKey may be just "OL123A" or "/authors/OL123A" depending on API response
 	if !strings.HasPrefix(authorKey, "/") {
@@ -415,6 +447,9 @@ func (c *OpenLibraryClient) FetchAuthorBooks(ctx context.Context, authorName str
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == 404 {
+		return nil, fmt.Errorf("author not found: %s", authorKey)
+	}
 	if resp.StatusCode != 200 {
 		return nil, fmt.Errorf("OpenLibrary returned status %d", resp.StatusCode)
 	}
@@ -436,11 +471,17 @@ func (c *OpenLibraryClient) FetchAuthorBooks(ctx context.Context, authorName str
 			tags = append(tags, s)
 		}
 
+		coverURL := ""
+		if len(entry.Covers) > 0 && entry.Covers[0] > 0 {
+			coverURL = fmt.Sprintf("https://covers.openlibrary.org/b/id/%d-M.jpg", entry.Covers[0])
+		}
+
 		books = append(books, book.Book{
 			Title:       entry.Title,
-			Author:      resolvedName,
+			Author:      name,
 			Description: truncate(description, 500),
 			Tags:        tags,
+			CoverURL:    coverURL,
 			Status:      book.StatusWantToRead,
 			DateAdded:   time.Now(),
 		})
@@ -4,6 +4,7 @@ import (
 	"context"
 	"math"
 	"sort"
+	"strings"
 
 	"github.com/erwar/pka/internal/book"
 )
@@ -14,6 +15,8 @@ type EmbeddingService interface {
 
 type Repository interface {
 	GetAllWithEmbeddings(ctx context.Context) ([]book.Book, error)
+	GetQuotesWithEmbeddings(ctx context.Context) ([]book.Quote, error)
+	GetByID(ctx context.Context, id int64) (*book.Book, error)
 }
 
 type Engine struct {
@@ -82,7 +85,7 @@ func (e *Engine) FindSimilar(ctx context.Context, bookID int64, limit int) ([]bo
 
 	results := make([]book.SearchResult, 0, len(books)-1)
 	for _, b := range books {
-		if b.ID == bookID || len(b.Embedding) == 0 {
+		if b.ID == bookID || len(b.Embedding) == 0 || book.SameSeries(targetBook, &b) {
 			continue
 		}
 		similarity := cosineSimilarity(targetBook.Embedding, b.Embedding)
@@ -95,6 +98,7 @@ func (e *Engine) FindSimilar(ctx context.Context, bookID int64, limit int) ([]bo
 	sort.Slice(results, func(i, j int) bool {
 		return results[i].Similarity > results[j].Similarity
 	})
+	results = onePerSeries(results)
 
 	if limit > 0 && len(results) > limit {
 		results = results[:limit]
@@ -103,6 +107,130 @@ func (e *Engine) FindSimilar(ctx context.Context, bookID int64, limit int) ([]bo
 	return results, nil
 }
 
+// onePerSeries keeps only the closest book of each series in results,
+// sorted closest first, so one series can't fill a list of similar books
+func onePerSeries(results []book.SearchResult) []book.SearchResult {
+	seen := make(map[string]bool)
+	kept := results[:0]
+	for _, r := range results {
+		if r.Book.Series != "" {
+			key := strings.ToLower(strings.TrimSpace(r.Book.Series))
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		kept = append(kept, r)
+	}
+	return kept
+}
+
+// SearchQuotes returns the quotes closest in meaning to query, each with the
+// book it is from
+func (e *Engine) SearchQuotes(ctx context.Context, query string, limit int) ([]book.QuoteSearchResult, error) {
+	queryEmbedding, err := e.embedder.Generate(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	quotes, err := e.repo.GetQuotesWithEmbeddings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]book.QuoteSearchResult, 0, len(quotes))
+	for _, q := range quotes {
+		if len(q.Embedding) == 0 {
+			continue
+		}
+		results = append(results, book.QuoteSearchResult{
+			Quote:      q,
+			Similarity: cosineSimilarity(queryEmbedding, q.Embedding),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Similarity > results[j].Similarity
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	books := make(map[int64]*book.Book)
+	for i := range results {
+		id := results[i].Quote.BookID
+		if _, ok := books[id]; !ok {
+			b, err := e.repo.GetByID(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			books[id] = b
+		}
+		results[i].Book = *books[id]
+	}
+
+	return results, nil
+}
+
+// FindNearDuplicates returns pairs of books whose embeddings are at least
+// threshold similar. These are candidates only - translations, box sets and
+// sequels can score high without being the same book.
+func (e *Engine) FindNearDuplicates(ctx context.Context, threshold float32) ([]book.DuplicatePair, error) {
+	books, err := e.repo.GetAllWithEmbeddings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pairs []book.DuplicatePair
+	for i := 0; i < len(books); i++ {
+		if len(books[i].Embedding) == 0 {
+			continue
+		}
+		for j := i + 1; j < len(books); j++ {
+			if len(books[j].Embedding) == 0 {
+				continue
+			}
+			similarity := cosineSimilarity(books[i].Embedding, books[j].Embedding)
+			if similarity >= threshold {
+				pairs = append(pairs, book.DuplicatePair{
+					A:      books[i],
+					B:      books[j],
+					Reason: "embedding",
+					Score:  float64(similarity),
+				})
+			}
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Score > pairs[j].Score
+	})
+
+	return pairs, nil
+}
+
+// ClosestPair returns the two books among books whose embeddings are most
+// alike, or nil if fewer than two have embeddings
+func ClosestPair(books []book.Book) *book.DuplicatePair {
+	var best *book.DuplicatePair
+	for i := 0; i < len(books); i++ {
+		if len(books[i].Embedding) == 0 {
+			continue
+		}
+		for j := i + 1; j < len(books); j++ {
+			if len(books[j].Embedding) == 0 {
+				continue
+			}
+			similarity := float64(cosineSimilarity(books[i].Embedding, books[j].Embedding))
+			if best == nil || similarity > best.Score {
+				best = &book.DuplicatePair{A: books[i], B: books[j], Reason: "embedding", Score: similarity}
+			}
+		}
+	}
+	return best
+}
+
 func cosineSimilarity(a, b []float32) float32 {
 	if len(a) != len(b) {
 		return 0
@@ -0,0 +1,197 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Snapshotter writes a consistent copy of a live database to a new file
+type Snapshotter interface {
+	Snapshot(ctx context.Context, path string) error
+}
+
+// Snapshots are named pka-<time>.db so they sort by age and the time can be
+// read back for retention
+const (
+	filePrefix = "pka-"
+	fileSuffix = ".db"
+	timeLayout = "20060102-150405"
+)
+
+// Snapshot is a database copy on disk
+type Snapshot struct {
+	Path string    `json:"path"`
+	Time time.Time `json:"time"`
+	Size int64     `json:"size"`
+}
+
+// Scheduler takes snapshots into a directory and prunes old ones. Of the
+// snapshots present, it keeps the newest one of each of the last KeepDaily
+// days and of each of the last KeepWeekly ISO weeks, plus the latest.
+type Scheduler struct {
+	Dir        string
+	Interval   time.Duration // time between scheduled snapshots; 0 disables Run
+	KeepDaily  int
+	KeepWeekly int
+
+	db Snapshotter
+	mu sync.Mutex // one snapshot at a time
+}
+
+func NewScheduler(db Snapshotter, dir string) *Scheduler {
+	return &Scheduler{
+		Dir:        dir,
+		Interval:   24 * time.Hour,
+		KeepDaily:  7,
+		KeepWeekly: 4,
+		db:         db,
+	}
+}
+
+// Take writes a new snapshot and prunes old ones
+func (s *Scheduler) Take(ctx context.Context) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("create snapshot directory: %w", err)
+	}
+
+	now := time.Now()
+	path := filepath.Join(s.Dir, filePrefix+now.Format(timeLayout)+fileSuffix)
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("snapshot %s already exists", filepath.Base(path))
+	}
+
+	// Write under a temporary name so a half-written file is never mistaken
+	// for a snapshot
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if err := s.db.Snapshot(ctx, tmp); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("rename snapshot: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.prune(); err != nil {
+		return nil, fmt.Errorf("prune snapshots: %w", err)
+	}
+
+	return &Snapshot{Path: path, Time: now, Size: info.Size()}, nil
+}
+
+// List returns the snapshots in Dir, newest first
+func (s *Scheduler) List() ([]Snapshot, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var snaps []Snapshot
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		t, err := time.ParseInLocation(timeLayout, strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix), time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		snaps = append(snaps, Snapshot{Path: filepath.Join(s.Dir, name), Time: t, Size: info.Size()})
+	}
+
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].Time.After(snaps[j].Time) })
+	return snaps, nil
+}
+
+// prune deletes snapshots outside the retention policy and returns them
+func (s *Scheduler) prune() ([]Snapshot, error) {
+	snaps, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	var removed []Snapshot
+	for i, snap := range snaps {
+		keep := i == 0
+
+		day := snap.Time.Format("2006-01-02")
+		if !days[day] && len(days) < s.KeepDaily {
+			days[day] = true
+			keep = true
+		}
+
+		year, week := snap.Time.ISOWeek()
+		wk := fmt.Sprintf("%d-W%02d", year, week)
+		if !weeks[wk] && len(weeks) < s.KeepWeekly {
+			weeks[wk] = true
+			keep = true
+		}
+
+		if keep {
+			continue
+		}
+		if err := os.Remove(snap.Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, snap)
+	}
+	return removed, nil
+}
+
+// Run takes a snapshot every Interval until ctx is done. The first one is
+// taken straight away unless the latest snapshot is recent enough.
+func (s *Scheduler) Run(ctx context.Context) {
+	if s.Interval <= 0 {
+		return
+	}
+
+	wait := time.Duration(0)
+	if snaps, err := s.List(); err == nil && len(snaps) > 0 {
+		if age := time.Since(snaps[0].Time); age < s.Interval {
+			wait = s.Interval - age
+		}
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		if snap, err := s.Take(ctx); err != nil {
+			log.Printf("Snapshot failed: %v", err)
+		} else {
+			log.Printf("Snapshot written to %s", snap.Path)
+		}
+		timer.Reset(s.Interval)
+	}
+}
@@ -0,0 +1,121 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Range is the span of time the reading figures cover, From inclusive and
+// To exclusive. A zero bound is open, so the zero Range is all time.
+type Range struct {
+	From time.Time
+	To   time.Time
+}
+
+// Year returns the range covering a calendar year
+func Year(year int) Range {
+	from := time.Date(year, 1, 1, 0, 0, 0, 0, time.Local)
+	return Range{From: from, To: from.AddDate(1, 0, 0)}
+}
+
+// ParseRange reads a range from two bounds, each a year ("2024"), a month
+// ("2024-03") or a day ("2024-03-15"), and either may be empty. The range
+// covers all of both bounds, so "2024" to "2024" is the whole year.
+func ParseRange(from, to string) (Range, error) {
+	var r Range
+	if from != "" {
+		start, _, err := parsePeriod(from)
+		if err != nil {
+			return Range{}, err
+		}
+		r.From = start
+	}
+	if to != "" {
+		_, end, err := parsePeriod(to)
+		if err != nil {
+			return Range{}, err
+		}
+		r.To = end
+	}
+	if !r.From.IsZero() && !r.To.IsZero() && !r.From.Before(r.To) {
+		return Range{}, fmt.Errorf("range starts after it ends: %s to %s", from, to)
+	}
+	return r, nil
+}
+
+// parsePeriod returns the start of the period s names and the start of the
+// next one
+func parsePeriod(s string) (time.Time, time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, t.AddDate(0, 0, 1), nil
+	}
+	if t, err := time.ParseInLocation("2006-01", s, time.Local); err == nil {
+		return t, t.AddDate(0, 1, 0), nil
+	}
+	if y, err := strconv.Atoi(s); err == nil && y > 0 && y < 10000 {
+		r := Year(y)
+		return r.From, r.To, nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q, want YYYY, YYYY-MM or YYYY-MM-DD", s)
+}
+
+// Contains reports whether t falls in the range
+func (r Range) Contains(t time.Time) bool {
+	if !r.From.IsZero() && t.Before(r.From) {
+		return false
+	}
+	if !r.To.IsZero() && !t.Before(r.To) {
+		return false
+	}
+	return true
+}
+
+// IsZero reports whether the range is all time
+func (r Range) IsZero() bool {
+	return r.From.IsZero() && r.To.IsZero()
+}
+
+// MarshalJSON writes the range as its first and last days, left out when
+// open, e.g. {"from": "2024-01-01", "to": "2024-12-31", "label": "2024"}
+func (r Range) MarshalJSON() ([]byte, error) {
+	v := struct {
+		From  string `json:"from,omitempty"`
+		To    string `json:"to,omitempty"`
+		Label string `json:"label"`
+	}{Label: r.String()}
+	if !r.From.IsZero() {
+		v.From = r.From.Format("2006-01-02")
+	}
+	if !r.To.IsZero() {
+		v.To = r.last()
+	}
+	return json.Marshal(v)
+}
+
+// String describes the range, e.g. "2024", "2024-03-01 to 2024-06-30" or
+// "all time"
+func (r Range) String() string {
+	switch {
+	case r.IsZero():
+		return "all time"
+	case r.isYear():
+		return strconv.Itoa(r.From.Year())
+	case r.From.IsZero():
+		return "until " + r.last()
+	case r.To.IsZero():
+		return "since " + r.From.Format("2006-01-02")
+	}
+	return r.From.Format("2006-01-02") + " to " + r.last()
+}
+
+func (r Range) isYear() bool {
+	y := Year(r.From.Year())
+	return r.From.Equal(y.From) && r.To.Equal(y.To)
+}
+
+// last is the last day in the range
+func (r Range) last() string {
+	return r.To.AddDate(0, 0, -1).Format("2006-01-02")
+}
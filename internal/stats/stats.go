@@ -0,0 +1,311 @@
+// Package stats works out the library's statistics, for the CLI, the web
+// pages and the JSON API alike.
+package stats
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/erwar/pka/internal/book"
+)
+
+const (
+	topRated   = 5  // books in TopRated
+	recentRead = 5  // reads in Recent
+	cloudSize  = 40 // tags in the tag cloud
+)
+
+// Count is a genre, author or tag and how many books or reads it has
+type Count struct {
+	Name string `json:"name"`
+	N    int    `json:"count"`
+}
+
+// Month is the reads finished in one month
+type Month struct {
+	Month   string `json:"month"` // e.g. "2024-03"
+	Reads   int    `json:"reads"`
+	Pages   int    `json:"pages"`
+	Minutes int    `json:"minutes"` // listened, of audiobooks
+}
+
+// Read is one finished read
+type Read struct {
+	Book     book.Book `json:"book"`
+	Finished time.Time `json:"finished"`
+	Reread   bool      `json:"reread,omitempty"`
+}
+
+// Pace is how fast reads were finished over the range
+type Pace struct {
+	DaysPerBook   float64 `json:"days_per_book"` // start to finish, of reads with a start date
+	PagesPerDay   float64 `json:"pages_per_day"`
+	BooksPerMonth float64 `json:"books_per_month"`
+}
+
+// Stats is everything there is to count about the library. The library
+// figures describe the collection as it is now; the reading figures only
+// count read-throughs finished in Range, so a book read twice counts twice,
+// except in Books.
+type Stats struct {
+	Range Range `json:"range"`
+
+	// The library
+	Total     int            `json:"total"`
+	Statuses  map[string]int `json:"statuses"` // books per status, every status present
+	Rated     int            `json:"rated"`
+	AvgRating float64        `json:"avg_rating"`
+	Ratings   [6]int         `json:"ratings"` // books per star rating; index 0 is unused
+	Genres    []Count        `json:"genres"`  // books per genre, most first
+	Authors   []Count        `json:"authors"`
+	Tags      []Count        `json:"tags"`
+	TopRated  []book.Book    `json:"top_rated"`
+
+	// Reading in the range
+	Reads       int     `json:"reads"`
+	Books       int     `json:"books"` // different books finished
+	Rereads     int     `json:"rereads"`
+	DNF         int     `json:"dnf"`     // reads given up
+	Pages       int     `json:"pages"`   // of books read on paper or as ebooks
+	Minutes     int     `json:"minutes"` // of audiobooks listened to
+	Months      []Month `json:"months"`  // every month of the range, oldest first
+	ReadGenres  []Count `json:"read_genres"`
+	ReadAuthors []Count `json:"read_authors"`
+	Pace        Pace    `json:"pace"`
+	Recent      []Read  `json:"recent"` // newest first
+}
+
+// Listened is the time spent on the audiobooks finished in the range
+func (s *Stats) Listened() time.Duration {
+	return time.Duration(s.Minutes) * time.Minute
+}
+
+// Status is the number of books with a status, e.g. "reading"
+func (s *Stats) Status(status book.Status) int {
+	return s.Statuses[string(status)]
+}
+
+// Of loads the library and works out its statistics
+func Of(ctx context.Context, svc *book.Service, r Range, now time.Time) (*Stats, error) {
+	books, err := svc.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list books: %w", err)
+	}
+	reads, err := svc.AllReadThroughs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get read-throughs: %w", err)
+	}
+	return Compute(books, reads, r, now), nil
+}
+
+// Compute works out the statistics of books and their read-throughs
+// (oldest first, as returned by AllReadThroughs)
+func Compute(books []book.Book, reads []book.ReadThrough, r Range, now time.Time) *Stats {
+	s := &Stats{Range: r, Statuses: make(map[string]int, len(book.Statuses))}
+	for _, status := range book.Statuses {
+		s.Statuses[string(status)] = 0
+	}
+
+	byID := make(map[int64]book.Book, len(books))
+	var totalRating float64
+	genres := make(map[string]int)
+	authors := make(map[string]int)
+	tags := make(map[string]int)
+	for _, b := range books {
+		byID[b.ID] = b
+		s.Total++
+		s.Statuses[string(b.Status)]++
+		if b.Rating > 0 {
+			totalRating += b.Rating
+			s.Rated++
+			s.Ratings[book.WholeStars(b.Rating)]++
+		}
+		if b.Genre != "" {
+			genres[b.Genre]++
+		}
+		for _, name := range b.AuthorNames() {
+			authors[name]++
+		}
+		for _, tag := range b.Tags {
+			tags[tag]++
+		}
+	}
+	if s.Rated > 0 {
+		s.AvgRating = totalRating / float64(s.Rated)
+	}
+	s.Genres = Sorted(genres)
+	s.Authors = Sorted(authors)
+	s.Tags = Sorted(tags)
+
+	rated := make([]book.Book, 0, len(books))
+	for _, b := range books {
+		if b.Rating >= 4 {
+			rated = append(rated, b)
+		}
+	}
+	sort.SliceStable(rated, func(i, j int) bool { return rated[i].Rating > rated[j].Rating })
+	s.TopRated = rated[:min(len(rated), topRated)]
+
+	rereads := book.Rereads(reads)
+	var finished []Read
+	var readDays, timedReads int
+	readGenres := make(map[string]int)
+	readAuthors := make(map[string]int)
+	distinct := make(map[int64]bool)
+	for _, rt := range reads {
+		if rt.Finished.IsZero() || !r.Contains(rt.Finished) {
+			continue
+		}
+		b, ok := byID[rt.BookID]
+		if !ok {
+			continue
+		}
+		if rt.Status == book.StatusDNF {
+			s.DNF++
+		}
+		if rt.Status != book.StatusRead {
+			continue
+		}
+
+		finished = append(finished, Read{Book: b, Finished: rt.Finished, Reread: rereads[rt.ID]})
+		distinct[b.ID] = true
+		if rereads[rt.ID] {
+			s.Rereads++
+		}
+		pages, minutes := length(b)
+		s.Pages += pages
+		s.Minutes += minutes
+		if b.Genre != "" {
+			readGenres[b.Genre]++
+		}
+		for _, name := range b.AuthorNames() {
+			readAuthors[name]++
+		}
+		if !rt.Started.IsZero() && !rt.Finished.Before(rt.Started) {
+			readDays += int(rt.Finished.Sub(rt.Started).Hours()/24) + 1
+			timedReads++
+		}
+	}
+	sort.SliceStable(finished, func(i, j int) bool { return finished[i].Finished.Before(finished[j].Finished) })
+	s.Reads = len(finished)
+	s.Books = len(distinct)
+	s.ReadGenres = Sorted(readGenres)
+	s.ReadAuthors = Sorted(readAuthors)
+	s.Months = months(r, finished)
+
+	for i := len(finished) - 1; i >= 0 && len(s.Recent) < recentRead; i-- {
+		s.Recent = append(s.Recent, finished[i])
+	}
+
+	if timedReads > 0 {
+		s.Pace.DaysPerBook = float64(readDays) / float64(timedReads)
+	}
+	if len(finished) > 0 {
+		start, end := r.From, r.To
+		if start.IsZero() {
+			start = finished[0].Finished
+		}
+		if end.IsZero() || end.After(now) {
+			end = now
+		}
+		if days := end.Sub(start).Hours() / 24; days >= 1 {
+			s.Pace.PagesPerDay = float64(s.Pages) / days
+			s.Pace.BooksPerMonth = float64(s.Reads) / (days / 365.25 * 12)
+		}
+	}
+	return s
+}
+
+// months buckets reads by month, from the start of the range (or the first
+// read) to its end (or the last read), empty months included
+func months(r Range, reads []Read) []Month {
+	first, last := r.From, r.To.AddDate(0, 0, -1)
+	if len(reads) > 0 {
+		if r.From.IsZero() {
+			first = reads[0].Finished
+		}
+		if r.To.IsZero() {
+			last = reads[len(reads)-1].Finished
+		}
+	}
+	if first.IsZero() || r.To.IsZero() && len(reads) == 0 {
+		return nil
+	}
+
+	start := time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, time.Local)
+	end := time.Date(last.Year(), last.Month(), 1, 0, 0, 0, 0, time.Local)
+	var list []Month
+	index := make(map[string]int)
+	for m := start; !m.After(end); m = m.AddDate(0, 1, 0) {
+		key := m.Format("2006-01")
+		index[key] = len(list)
+		list = append(list, Month{Month: key})
+	}
+	for _, read := range reads {
+		if i, ok := index[read.Finished.Format("2006-01")]; ok {
+			list[i].Reads++
+			pages, minutes := length(read.Book)
+			list[i].Pages += pages
+			list[i].Minutes += minutes
+		}
+	}
+	return list
+}
+
+// length is what a finished read of b adds up to: its pages, or its
+// minutes if it was listened to
+func length(b book.Book) (pages, minutes int) {
+	if b.IsAudiobook() {
+		return 0, b.TotalMinutes
+	}
+	return b.PageCount, 0
+}
+
+// Sorted returns counts most first, ties alphabetically
+func Sorted(counts map[string]int) []Count {
+	list := make([]Count, 0, len(counts))
+	for name, n := range counts {
+		list = append(list, Count{Name: name, N: n})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].N != list[j].N {
+			return list[i].N > list[j].N
+		}
+		return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name)
+	})
+	return list
+}
+
+// Top returns at most the first n counts
+func Top(counts []Count, n int) []Count {
+	return counts[:min(len(counts), n)]
+}
+
+// CloudTag is a tag sized by how many books have it
+type CloudTag struct {
+	Name string
+	N    int
+	Size int // 1-5
+}
+
+// TagCloud returns the most used tags in alphabetical order, each sized
+// between the least and most used of them
+func (s *Stats) TagCloud() []CloudTag {
+	tags := Top(s.Tags, cloudSize)
+	if len(tags) == 0 {
+		return nil
+	}
+	most, least := tags[0].N, tags[len(tags)-1].N
+	cloud := make([]CloudTag, len(tags))
+	for i, t := range tags {
+		cloud[i] = CloudTag{Name: t.Name, N: t.N, Size: 3}
+		if most > least {
+			cloud[i].Size = 1 + (t.N-least)*4/(most-least)
+		}
+	}
+	sort.Slice(cloud, func(i, j int) bool { return strings.ToLower(cloud[i].Name) < strings.ToLower(cloud[j].Name) })
+	return cloud
+}
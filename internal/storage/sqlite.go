@@ -9,11 +9,44 @@ import (
 	"time"
 
 	"github.com/erwar/pka/internal/book"
+	"github.com/erwar/pka/internal/kosync"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// bookColumns is the column list scanBook expects, in order. The edition
+// details come from the book's current edition, see bookTables.
+const bookColumns = `books.id, books.title, books.author, COALESCE(e.isbn, ''), books.description, books.genre, books.tags, COALESCE(e.cover_url, ''), COALESCE(e.cover_hash, ''), books.file_path, COALESCE(e.page_count, 0), books.current_page, books.rating, books.status, books.notes, books.date_added, books.date_read, books.embedding, books.adaptations, COALESCE(books.dnf_reason, ''), COALESCE(books.dnf_page, 0), COALESCE(books.series, ''), COALESCE(books.series_position, 0), COALESCE(books.edition_id, 0), COALESCE(e.format, ''), COALESCE(e.publisher, ''), COALESCE(e.total_minutes, 0), COALESCE(books.listened_minutes, 0), ` + bookAuthorsColumn
+
+// bookTables joins each book to the edition it's read in
+const bookTables = `books LEFT JOIN editions e ON e.id = books.edition_id`
+
+// bookAuthorsColumn is the names of a book's linked authors, in order,
+// separated by authorSeparator
+const bookAuthorsColumn = `(SELECT group_concat(a.name, char(31) ORDER BY ba.position) FROM book_authors ba JOIN authors a ON a.id = ba.author_id WHERE ba.book_id = books.id AND ba.role = 'author')`
+
+const authorSeparator = "\x1f"
+
+const sessionColumns = `id, book_id, started_at, ended_at, COALESCE(start_page, 0), COALESCE(end_page, 0), COALESCE(start_percent, 0), COALESCE(end_percent, 0), COALESCE(note, ''), COALESCE(source, '')`
+
+const readThroughColumns = `id, book_id, status, started_at, finished_at, COALESCE(rating, 0), COALESCE(format, ''), COALESCE(notes, ''), COALESCE(dnf_reason, ''), COALESCE(dnf_page, 0)`
+
+const editionColumns = `id, book_id, COALESCE(isbn, ''), COALESCE(format, ''), COALESCE(publisher, ''), COALESCE(page_count, 0), COALESCE(total_minutes, 0), COALESCE(cover_url, ''), COALESCE(cover_hash, ''), date_added`
+
+const quoteColumns = `id, book_id, text, COALESCE(note, ''), COALESCE(location, ''), COALESCE(page, 0), COALESCE(chapter, ''), COALESCE(source, ''), date_added, embedding`
+
 type SQLiteRepository struct {
-	db *sql.DB
+	db dbtx
+}
+
+// dbtx is what the repository runs statements on: the database itself, or
+// a transaction for a repository handed out by InTx
+type dbtx interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 }
 
 func NewSQLiteRepository(dbPath string) (*SQLiteRepository, error) {
@@ -31,16 +64,26 @@ func NewSQLiteRepository(dbPath string) (*SQLiteRepository, error) {
 }
 
 func (r *SQLiteRepository) migrate() error {
+	// Read-throughs are backfilled from the books the first time the table
+	// is created
+	var hasReadThroughs int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'read_throughs'").Scan(&hasReadThroughs); err != nil {
+		return err
+	}
+
+	var hasAuthors int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'authors'").Scan(&hasAuthors); err != nil {
+		return err
+	}
+
 	schema := `
 	CREATE TABLE IF NOT EXISTS books (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		title TEXT NOT NULL,
 		author TEXT NOT NULL,
-		isbn TEXT,
 		description TEXT,
 		genre TEXT,
 		tags TEXT,
-		cover_url TEXT,
 		rating INTEGER,
 		status TEXT NOT NULL DEFAULT 'want_to_read',
 		notes TEXT,
@@ -51,50 +94,404 @@ func (r *SQLiteRepository) migrate() error {
 
 	CREATE INDEX IF NOT EXISTS idx_books_status ON books(status);
 	CREATE INDEX IF NOT EXISTS idx_books_author ON books(author);
+
+	CREATE TABLE IF NOT EXISTS settings (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS external_ids (
+		source TEXT NOT NULL,
+		external_id TEXT NOT NULL,
+		book_id INTEGER NOT NULL,
+		PRIMARY KEY (source, external_id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_external_ids_book ON external_ids(book_id);
+
+	CREATE TABLE IF NOT EXISTS quotes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		book_id INTEGER NOT NULL,
+		text TEXT NOT NULL,
+		note TEXT,
+		location TEXT,
+		page INTEGER,
+		source TEXT,
+		date_added DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_quotes_book ON quotes(book_id);
+
+	CREATE TABLE IF NOT EXISTS reading_sessions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		book_id INTEGER NOT NULL,
+		started_at DATETIME NOT NULL,
+		ended_at DATETIME,
+		start_page INTEGER,
+		end_page INTEGER,
+		start_percent REAL,
+		end_percent REAL,
+		note TEXT,
+		source TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_reading_sessions_book ON reading_sessions(book_id);
+
+	CREATE TABLE IF NOT EXISTS read_throughs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		book_id INTEGER NOT NULL,
+		status TEXT NOT NULL,
+		started_at DATETIME,
+		finished_at DATETIME,
+		rating INTEGER,
+		format TEXT,
+		notes TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_read_throughs_book ON read_throughs(book_id);
+
+	CREATE TABLE IF NOT EXISTS goals (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		year INTEGER NOT NULL,
+		month INTEGER NOT NULL DEFAULT 0,
+		target INTEGER NOT NULL,
+		UNIQUE(kind, year, month)
+	);
+
+	CREATE TABLE IF NOT EXISTS authors (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		aliases TEXT,
+		ol_key TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS book_authors (
+		book_id INTEGER NOT NULL,
+		author_id INTEGER NOT NULL,
+		role TEXT NOT NULL DEFAULT 'author',
+		position INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (book_id, author_id, role)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_book_authors_author ON book_authors(author_id);
+
+	CREATE TABLE IF NOT EXISTS editions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		book_id INTEGER NOT NULL,
+		isbn TEXT,
+		format TEXT,
+		publisher TEXT,
+		page_count INTEGER,
+		cover_url TEXT,
+		cover_hash TEXT,
+		date_added DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_editions_book ON editions(book_id);
+	CREATE INDEX IF NOT EXISTS idx_editions_isbn ON editions(isbn);
+
+	CREATE TABLE IF NOT EXISTS kosync_users (
+		username TEXT PRIMARY KEY,
+		key_hash TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS kosync_progress (
+		username TEXT NOT NULL,
+		document TEXT NOT NULL,
+		progress TEXT NOT NULL,
+		percentage REAL NOT NULL,
+		device TEXT,
+		device_id TEXT,
+		timestamp INTEGER NOT NULL,
+		PRIMARY KEY (username, document)
+	);
 	`
-	_, err := r.db.Exec(schema)
-	if err != nil {
+	if _, err := r.db.Exec(schema); err != nil {
 		return err
 	}
 
 	// Add columns if they don't exist (for existing databases)
-	r.db.Exec("ALTER TABLE books ADD COLUMN cover_url TEXT")
-	r.db.Exec("ALTER TABLE books ADD COLUMN page_count INTEGER")
 	r.db.Exec("ALTER TABLE books ADD COLUMN current_page INTEGER")
 	r.db.Exec("ALTER TABLE books ADD COLUMN adaptations TEXT")
+	r.db.Exec("ALTER TABLE books ADD COLUMN file_path TEXT")
+	r.db.Exec("ALTER TABLE quotes ADD COLUMN chapter TEXT")
+	r.db.Exec("ALTER TABLE quotes ADD COLUMN embedding BLOB")
+	r.db.Exec("ALTER TABLE books ADD COLUMN dnf_reason TEXT")
+	r.db.Exec("ALTER TABLE books ADD COLUMN dnf_page INTEGER")
+	r.db.Exec("ALTER TABLE read_throughs ADD COLUMN dnf_reason TEXT")
+	r.db.Exec("ALTER TABLE read_throughs ADD COLUMN dnf_page INTEGER")
+	r.db.Exec("ALTER TABLE books ADD COLUMN series TEXT")
+	r.db.Exec("ALTER TABLE books ADD COLUMN series_position REAL")
+	r.db.Exec("ALTER TABLE books ADD COLUMN edition_id INTEGER")
+	r.db.Exec("ALTER TABLE books ADD COLUMN listened_minutes INTEGER")
+	r.db.Exec("ALTER TABLE editions ADD COLUMN total_minutes INTEGER")
+	r.db.Exec("ALTER TABLE books ADD COLUMN title_key TEXT")
+	if _, err := r.db.Exec("CREATE INDEX IF NOT EXISTS idx_books_title_key ON books(title_key)"); err != nil {
+		return err
+	}
+
+	if hasReadThroughs == 0 {
+		_, err := r.db.Exec(`
+			INSERT INTO read_throughs (book_id, status, finished_at, rating)
+			SELECT id, status, CASE WHEN status = 'read' THEN date_read END, rating
+			FROM books WHERE status IN ('reading', 'read')
+		`)
+		if err != nil {
+			return fmt.Errorf("backfill read-throughs: %w", err)
+		}
+	}
+	if hasAuthors == 0 {
+		if err := r.backfillAuthors(); err != nil {
+			return fmt.Errorf("backfill authors: %w", err)
+		}
+	}
+	legacy, err := r.hasColumn("books", "isbn")
+	if err != nil {
+		return err
+	}
+	if legacy {
+		// In one transaction, so a failed drop leaves the copies in place
+		// for the next start to move
+		if err := r.inTx(context.Background(), (*SQLiteRepository).moveEditionColumns); err != nil {
+			return fmt.Errorf("move edition details: %w", err)
+		}
+	}
+	if err := r.normalizeFormats(); err != nil {
+		return fmt.Errorf("normalize formats: %w", err)
+	}
+	if err := r.backfillTitleKeys(); err != nil {
+		return fmt.Errorf("backfill title keys: %w", err)
+	}
 	return nil
 }
 
-func (r *SQLiteRepository) Close() error {
-	return r.db.Close()
+// editionColumnsOnBooks are the edition details older versions kept on the
+// books table as well
+var editionColumnsOnBooks = []string{"isbn", "cover_url", "cover_hash", "page_count", "format", "publisher", "total_minutes"}
+
+// moveEditionColumns gives every book saved by an older version an edition
+// holding its details, then drops the copies from the books table so the
+// editions are the only place they're kept
+func (r *SQLiteRepository) moveEditionColumns() error {
+	// The oldest databases lack some of them
+	r.db.Exec("ALTER TABLE books ADD COLUMN cover_url TEXT")
+	r.db.Exec("ALTER TABLE books ADD COLUMN page_count INTEGER")
+	r.db.Exec("ALTER TABLE books ADD COLUMN cover_hash TEXT")
+	r.db.Exec("ALTER TABLE books ADD COLUMN format TEXT")
+	r.db.Exec("ALTER TABLE books ADD COLUMN publisher TEXT")
+	r.db.Exec("ALTER TABLE books ADD COLUMN total_minutes INTEGER")
+
+	const noEdition = "edition_id IS NULL OR edition_id NOT IN (SELECT id FROM editions)"
+	_, err := r.db.Exec(`
+		INSERT INTO editions (book_id, isbn, format, publisher, page_count, total_minutes, cover_url, cover_hash, date_added)
+		SELECT id, isbn, format, publisher, page_count, total_minutes, cover_url, cover_hash, date_added FROM books
+		WHERE ` + noEdition)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec("UPDATE books SET edition_id = (SELECT MAX(e.id) FROM editions e WHERE e.book_id = books.id) WHERE " + noEdition)
+	if err != nil {
+		return err
+	}
+
+	for _, column := range editionColumnsOnBooks {
+		if _, err := r.db.Exec("ALTER TABLE books DROP COLUMN " + column); err != nil {
+			return fmt.Errorf("drop %s: %w", column, err)
+		}
+	}
+	return nil
 }
 
-func (r *SQLiteRepository) Create(ctx context.Context, b *book.Book) error {
-	tags, _ := json.Marshal(b.Tags)
-	adaptations, _ := json.Marshal(b.Adaptations)
+// hasColumn reports whether a table has a column
+func (r *SQLiteRepository) hasColumn(table, column string) (bool, error) {
+	var n int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&n)
+	return n > 0, err
+}
 
-	result, err := r.db.ExecContext(ctx, `
-		INSERT INTO books (title, author, isbn, description, genre, tags, cover_url, page_count, current_page, rating, status, notes, date_added, date_read, adaptations)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, b.Title, b.Author, b.ISBN, b.Description, b.Genre, string(tags), b.CoverURL, b.PageCount, b.CurrentPage, b.Rating, b.Status, b.Notes, b.DateAdded, nullTime(b.DateRead), string(adaptations))
+// backfillTitleKeys sets the duplicate lookup key of books saved before it
+// was kept, or with an older normalization
+func (r *SQLiteRepository) backfillTitleKeys() error {
+	rows, err := r.db.Query("SELECT id, title, author, COALESCE(title_key, '') FROM books")
+	if err != nil {
+		return err
+	}
+	keys := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var title, author, key string
+		if err := rows.Scan(&id, &title, &author, &key); err != nil {
+			rows.Close()
+			return err
+		}
+		if want := book.TitleKey(title, author); key != want {
+			keys[id] = want
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, key := range keys {
+		if _, err := r.db.Exec("UPDATE books SET title_key = ? WHERE id = ?", key, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// normalizeFormats turns formats saved as free text ("Hardcover", "Kindle
+// Edition") into physical, ebook or audiobook, dropping those it can't place
+func (r *SQLiteRepository) normalizeFormats() error {
+	rows, err := r.db.Query("SELECT DISTINCT format FROM editions WHERE format NOT IN ('', 'physical', 'ebook', 'audiobook')")
 	if err != nil {
-		return fmt.Errorf("insert: %w", err)
+		return err
+	}
+	var formats []string
+	for rows.Next() {
+		var f string
+		if err := rows.Scan(&f); err != nil {
+			rows.Close()
+			return err
+		}
+		formats = append(formats, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
-	id, err := result.LastInsertId()
+	for _, f := range formats {
+		format, _ := book.ParseFormat(f)
+		if _, err := r.db.Exec("UPDATE editions SET format = ? WHERE format = ?", format, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillAuthors links the names in every book's author field to authors,
+// as the book service does when a book is saved
+func (r *SQLiteRepository) backfillAuthors() error {
+	rows, err := r.db.Query("SELECT id, author FROM books ORDER BY id")
 	if err != nil {
-		return fmt.Errorf("get last insert id: %w", err)
+		return err
+	}
+	type row struct {
+		id     int64
+		author string
+	}
+	var books []row
+	for rows.Next() {
+		var b row
+		if err := rows.Scan(&b.id, &b.author); err != nil {
+			rows.Close()
+			return err
+		}
+		books = append(books, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
 	}
-	b.ID = id
 
+	var authors []book.Author
+	for _, b := range books {
+		for i, name := range book.SplitAuthors(b.author) {
+			a := book.FindAuthor(authors, name)
+			if a == nil {
+				res, err := r.db.Exec("INSERT INTO authors (name) VALUES (?)", name)
+				if err != nil {
+					return err
+				}
+				id, _ := res.LastInsertId()
+				authors = append(authors, book.Author{ID: id, Name: name})
+				a = &authors[len(authors)-1]
+			}
+			_, err := r.db.Exec("INSERT OR IGNORE INTO book_authors (book_id, author_id, role, position) VALUES (?, ?, 'author', ?)", b.id, a.ID, i)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) Close() error {
+	if db, ok := r.db.(*sql.DB); ok {
+		return db.Close()
+	}
+	return nil
+}
+
+// InTx runs fn with a repository whose statements all run in one
+// transaction, committed if fn returns nil and rolled back otherwise.
+// Called on a repository that's already in a transaction, fn joins it.
+func (r *SQLiteRepository) InTx(ctx context.Context, fn func(book.Repository) error) error {
+	return r.inTx(ctx, func(tx *SQLiteRepository) error {
+		return fn(tx)
+	})
+}
+
+func (r *SQLiteRepository) inTx(ctx context.Context, fn func(*SQLiteRepository) error) error {
+	db, ok := r.db.(*sql.DB)
+	if !ok {
+		return fn(r)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&SQLiteRepository{db: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Snapshot writes a consistent copy of the database to path with VACUUM
+// INTO, which is safe while the database is in use. path must not exist.
+func (r *SQLiteRepository) Snapshot(ctx context.Context, path string) error {
+	if _, err := r.db.ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("vacuum into: %w", err)
+	}
 	return nil
 }
 
+// Create inserts a book along with the edition it's read in, which is
+// created too when EditionID is 0
+func (r *SQLiteRepository) Create(ctx context.Context, b *book.Book) error {
+	tags, _ := json.Marshal(b.Tags)
+	adaptations, _ := json.Marshal(b.Adaptations)
+
+	return r.inTx(ctx, func(tx *SQLiteRepository) error {
+		result, err := tx.db.ExecContext(ctx, `
+			INSERT INTO books (title, author, description, genre, tags, file_path, current_page, rating, status, notes, date_added, date_read, adaptations, dnf_reason, dnf_page, series, series_position, listened_minutes, title_key)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, b.Title, b.Author, b.Description, b.Genre, string(tags), b.FilePath, b.CurrentPage, b.Rating, b.Status, b.Notes, b.DateAdded, nullTime(b.DateRead), string(adaptations), b.DNFReason, b.DNFPage, b.Series, b.SeriesPosition, b.ListenedMinutes, book.TitleKey(b.Title, b.Author))
+
+		if err != nil {
+			return fmt.Errorf("insert: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("get last insert id: %w", err)
+		}
+		b.ID = id
+
+		return tx.saveEdition(ctx, b)
+	})
+}
+
 func (r *SQLiteRepository) GetByID(ctx context.Context, id int64) (*book.Book, error) {
 	row := r.db.QueryRowContext(ctx, `
-		SELECT id, title, author, isbn, description, genre, tags, cover_url, page_count, current_page, rating, status, notes, date_added, date_read, embedding, adaptations
-		FROM books WHERE id = ?
+		SELECT `+bookColumns+`
+		FROM `+bookTables+` WHERE books.id = ?
 	`, id)
 
 	return r.scanBook(row)
@@ -102,8 +499,8 @@ func (r *SQLiteRepository) GetByID(ctx context.Context, id int64) (*book.Book, e
 
 func (r *SQLiteRepository) GetAll(ctx context.Context) ([]book.Book, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, title, author, isbn, description, genre, tags, cover_url, page_count, current_page, rating, status, notes, date_added, date_read, embedding, adaptations
-		FROM books ORDER BY date_added DESC
+		SELECT `+bookColumns+`
+		FROM `+bookTables+` ORDER BY books.date_added DESC
 	`)
 	if err != nil {
 		return nil, fmt.Errorf("query: %w", err)
@@ -115,8 +512,8 @@ func (r *SQLiteRepository) GetAll(ctx context.Context) ([]book.Book, error) {
 
 func (r *SQLiteRepository) GetByStatus(ctx context.Context, status book.Status) ([]book.Book, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, title, author, isbn, description, genre, tags, cover_url, page_count, current_page, rating, status, notes, date_added, date_read, embedding, adaptations
-		FROM books WHERE status = ? ORDER BY date_added DESC
+		SELECT `+bookColumns+`
+		FROM `+bookTables+` WHERE books.status = ? ORDER BY books.date_added DESC
 	`, status)
 	if err != nil {
 		return nil, fmt.Errorf("query: %w", err)
@@ -126,21 +523,74 @@ func (r *SQLiteRepository) GetByStatus(ctx context.Context, status book.Status)
 	return r.scanBooks(rows)
 }
 
+// Update saves a book along with the edition it's read in, which is
+// created when EditionID is 0
 func (r *SQLiteRepository) Update(ctx context.Context, b *book.Book) error {
 	tags, _ := json.Marshal(b.Tags)
 	adaptations, _ := json.Marshal(b.Adaptations)
 
-	_, err := r.db.ExecContext(ctx, `
-		UPDATE books SET
-			title = ?, author = ?, isbn = ?, description = ?, genre = ?,
-			tags = ?, cover_url = ?, page_count = ?, current_page = ?, rating = ?, status = ?, notes = ?, date_read = ?, adaptations = ?
-		WHERE id = ?
-	`, b.Title, b.Author, b.ISBN, b.Description, b.Genre, string(tags), b.CoverURL, b.PageCount, b.CurrentPage, b.Rating, b.Status, b.Notes, nullTime(b.DateRead), string(adaptations), b.ID)
+	return r.inTx(ctx, func(tx *SQLiteRepository) error {
+		_, err := tx.db.ExecContext(ctx, `
+			UPDATE books SET
+				title = ?, author = ?, description = ?, genre = ?,
+				tags = ?, file_path = ?, current_page = ?, rating = ?, status = ?, notes = ?, date_read = ?, adaptations = ?, dnf_reason = ?, dnf_page = ?, series = ?, series_position = ?, listened_minutes = ?, title_key = ?
+			WHERE id = ?
+		`, b.Title, b.Author, b.Description, b.Genre, string(tags), b.FilePath, b.CurrentPage, b.Rating, b.Status, b.Notes, nullTime(b.DateRead), string(adaptations), b.DNFReason, b.DNFPage, b.Series, b.SeriesPosition, b.ListenedMinutes, book.TitleKey(b.Title, b.Author), b.ID)
+		if err != nil {
+			return err
+		}
+		return tx.saveEdition(ctx, b)
+	})
+}
 
+// saveEdition writes a book's edition details to the edition it's read in,
+// creating the edition and pointing the book at it when there is none yet
+func (r *SQLiteRepository) saveEdition(ctx context.Context, b *book.Book) error {
+	e := b.Edition()
+	if e.ID != 0 {
+		result, err := r.db.ExecContext(ctx, `
+			UPDATE editions SET isbn = ?, format = ?, publisher = ?, page_count = ?, total_minutes = ?, cover_url = ?, cover_hash = ?
+			WHERE id = ? AND book_id = ?
+		`, e.ISBN, e.Format, e.Publisher, e.PageCount, e.TotalMinutes, e.CoverURL, e.CoverHash, e.ID, e.BookID)
+		if err != nil {
+			return fmt.Errorf("update edition: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return fmt.Errorf("book %d has no edition %d", e.BookID, e.ID)
+		}
+	} else {
+		if e.DateAdded.IsZero() {
+			e.DateAdded = time.Now()
+		}
+		if err := r.CreateEdition(ctx, &e); err != nil {
+			return fmt.Errorf("create edition: %w", err)
+		}
+		b.EditionID = e.ID
+	}
+
+	_, err := r.db.ExecContext(ctx, "UPDATE books SET edition_id = ? WHERE id = ?", b.EditionID, b.ID)
 	return err
 }
 
 func (r *SQLiteRepository) Delete(ctx context.Context, id int64) error {
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM external_ids WHERE book_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM quotes WHERE book_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM reading_sessions WHERE book_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM read_throughs WHERE book_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM book_authors WHERE book_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM editions WHERE book_id = ?", id); err != nil {
+		return err
+	}
 	_, err := r.db.ExecContext(ctx, "DELETE FROM books WHERE id = ?", id)
 	return err
 }
@@ -155,10 +605,15 @@ func (r *SQLiteRepository) UpdateEmbedding(ctx context.Context, id int64, embedd
 	return err
 }
 
+func (r *SQLiteRepository) UpdateCoverHash(ctx context.Context, id int64, hash string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE editions SET cover_hash = ? WHERE id = (SELECT edition_id FROM books WHERE id = ?)", hash, id)
+	return err
+}
+
 func (r *SQLiteRepository) GetAllWithEmbeddings(ctx context.Context) ([]book.Book, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, title, author, isbn, description, genre, tags, cover_url, page_count, current_page, rating, status, notes, date_added, date_read, embedding, adaptations
-		FROM books WHERE embedding IS NOT NULL
+		SELECT `+bookColumns+`
+		FROM `+bookTables+` WHERE books.embedding IS NOT NULL
 	`)
 	if err != nil {
 		return nil, fmt.Errorf("query: %w", err)
@@ -174,8 +629,8 @@ func (r *SQLiteRepository) FindByISBN(ctx context.Context, isbn string) (*book.B
 	}
 
 	row := r.db.QueryRowContext(ctx, `
-		SELECT id, title, author, isbn, description, genre, tags, cover_url, page_count, current_page, rating, status, notes, date_added, date_read, embedding, adaptations
-		FROM books WHERE isbn = ? LIMIT 1
+		SELECT `+bookColumns+`
+		FROM `+bookTables+` WHERE books.id IN (SELECT book_id FROM editions WHERE isbn = ?) LIMIT 1
 	`, isbn)
 
 	b, err := r.scanBook(row)
@@ -193,11 +648,11 @@ func (r *SQLiteRepository) FindByTitleAuthor(ctx context.Context, title, author
 		return nil, nil
 	}
 
-	// Case-insensitive search using LOWER()
+	// Matched on the normalized key kept with each book, see book.TitleKey
 	row := r.db.QueryRowContext(ctx, `
-		SELECT id, title, author, isbn, description, genre, tags, cover_url, page_count, current_page, rating, status, notes, date_added, date_read, embedding, adaptations
-		FROM books WHERE LOWER(title) = LOWER(?) AND LOWER(author) = LOWER(?) LIMIT 1
-	`, title, author)
+		SELECT `+bookColumns+`
+		FROM `+bookTables+` WHERE books.title_key = ? ORDER BY books.id LIMIT 1
+	`, book.TitleKey(title, author))
 
 	b, err := r.scanBook(row)
 	if err != nil {
@@ -209,41 +664,801 @@ func (r *SQLiteRepository) FindByTitleAuthor(ctx context.Context, title, author
 	return b, nil
 }
 
-type scanner interface {
-	Scan(dest ...any) error
+// FindByExternalID returns the book linked to an ID in another service, or
+// nil if there is none
+func (r *SQLiteRepository) FindByExternalID(ctx context.Context, source, externalID string) (*book.Book, error) {
+	row := r.db.QueryRowContext(ctx, `
+		SELECT `+bookColumns+`
+		FROM `+bookTables+` WHERE books.id = (SELECT book_id FROM external_ids WHERE source = ? AND external_id = ?)
+	`, source, externalID)
+
+	b, err := r.scanBook(row)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return b, nil
 }
 
-func (r *SQLiteRepository) scanBook(s scanner) (*book.Book, error) {
-	var b book.Book
-	var tagsJSON string
-	var adaptationsJSON sql.NullString
-	var coverURL sql.NullString
-	var pageCount, currentPage sql.NullInt64
-	var dateRead sql.NullTime
-	var embeddingBlob []byte
+// SetExternalID links a book to its ID in another service, replacing any
+// earlier link for that ID
+func (r *SQLiteRepository) SetExternalID(ctx context.Context, bookID int64, source, externalID string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO external_ids (source, external_id, book_id) VALUES (?, ?, ?)
+		ON CONFLICT(source, external_id) DO UPDATE SET book_id = excluded.book_id
+	`, source, externalID, bookID)
+	return err
+}
 
-	err := s.Scan(
-		&b.ID, &b.Title, &b.Author, &b.ISBN, &b.Description, &b.Genre,
-		&tagsJSON, &coverURL, &pageCount, &currentPage, &b.Rating, &b.Status, &b.Notes, &b.DateAdded, &dateRead, &embeddingBlob, &adaptationsJSON,
-	)
+// GetExternalIDs returns a book's IDs in other services, keyed by source
+func (r *SQLiteRepository) GetExternalIDs(ctx context.Context, bookID int64) (map[string]string, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT source, external_id FROM external_ids WHERE book_id = ?", bookID)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("query: %w", err)
 	}
+	defer rows.Close()
 
-	if tagsJSON != "" {
-		json.Unmarshal([]byte(tagsJSON), &b.Tags)
+	ids := make(map[string]string)
+	for rows.Next() {
+		var source, id string
+		if err := rows.Scan(&source, &id); err != nil {
+			return nil, err
+		}
+		ids[source] = id
 	}
-	if adaptationsJSON.Valid && adaptationsJSON.String != "" {
-		json.Unmarshal([]byte(adaptationsJSON.String), &b.Adaptations)
+	return ids, rows.Err()
+}
+
+// MoveExternalIDs relinks everything linked to fromID to toID
+func (r *SQLiteRepository) MoveExternalIDs(ctx context.Context, fromID, toID int64) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE external_ids SET book_id = ? WHERE book_id = ?", toID, fromID)
+	return err
+}
+
+func (r *SQLiteRepository) GetSettings(ctx context.Context) (map[string]string, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT key, value FROM settings")
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
 	}
-	if coverURL.Valid {
-		b.CoverURL = coverURL.String
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		settings[key] = value
 	}
-	if pageCount.Valid {
-		b.PageCount = int(pageCount.Int64)
+	return settings, rows.Err()
+}
+
+func (r *SQLiteRepository) SetSetting(ctx context.Context, key, value string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO settings (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`, key, value)
+	return err
+}
+
+func (r *SQLiteRepository) CreateQuote(ctx context.Context, q *book.Quote) error {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO quotes (book_id, text, note, location, page, chapter, source, date_added)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, q.BookID, q.Text, q.Note, q.Location, q.Page, q.Chapter, q.Source, q.DateAdded)
+	if err != nil {
+		return fmt.Errorf("insert: %w", err)
 	}
-	if currentPage.Valid {
-		b.CurrentPage = int(currentPage.Int64)
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("get last insert id: %w", err)
+	}
+	q.ID = id
+	return nil
+}
+
+// UpdateQuote saves q and clears its embedding, which no longer matches the
+// text
+func (r *SQLiteRepository) UpdateQuote(ctx context.Context, q *book.Quote) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE quotes SET book_id = ?, text = ?, note = ?, location = ?, page = ?, chapter = ?, source = ?, date_added = ?, embedding = NULL
+		WHERE id = ?
+	`, q.BookID, q.Text, q.Note, q.Location, q.Page, q.Chapter, q.Source, q.DateAdded, q.ID)
+	return err
+}
+
+// GetQuotes returns a book's quotes by page, then location (a range such as
+// "1021-1024" sorts by its start)
+func (r *SQLiteRepository) GetQuotes(ctx context.Context, bookID int64) ([]book.Quote, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+quoteColumns+`
+		FROM quotes WHERE book_id = ?
+		ORDER BY COALESCE(page, 0), CAST(location AS INTEGER), date_added, id
+	`, bookID)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	return scanQuotes(rows)
+}
+
+func (r *SQLiteRepository) GetQuote(ctx context.Context, id int64) (*book.Quote, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+quoteColumns+`
+		FROM quotes WHERE id = ?
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	quotes, err := scanQuotes(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(quotes) == 0 {
+		return nil, fmt.Errorf("quote %d not found", id)
+	}
+	return &quotes[0], nil
+}
+
+// GetAllQuotes returns every quote, most recently added first
+func (r *SQLiteRepository) GetAllQuotes(ctx context.Context) ([]book.Quote, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+quoteColumns+`
+		FROM quotes ORDER BY date_added DESC, id DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	return scanQuotes(rows)
+}
+
+func (r *SQLiteRepository) GetQuotesWithEmbeddings(ctx context.Context) ([]book.Quote, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+quoteColumns+`
+		FROM quotes WHERE embedding IS NOT NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	return scanQuotes(rows)
+}
+
+func (r *SQLiteRepository) GetQuotesWithoutEmbedding(ctx context.Context) ([]book.Quote, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+quoteColumns+`
+		FROM quotes WHERE embedding IS NULL ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	return scanQuotes(rows)
+}
+
+func (r *SQLiteRepository) UpdateQuoteEmbedding(ctx context.Context, id int64, embedding []float32) error {
+	blob, err := encodeEmbedding(embedding)
+	if err != nil {
+		return fmt.Errorf("encode embedding: %w", err)
+	}
+
+	_, err = r.db.ExecContext(ctx, "UPDATE quotes SET embedding = ? WHERE id = ?", blob, id)
+	return err
+}
+
+func (r *SQLiteRepository) DeleteQuote(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM quotes WHERE id = ?", id)
+	return err
+}
+
+func scanQuotes(rows *sql.Rows) ([]book.Quote, error) {
+	var quotes []book.Quote
+	for rows.Next() {
+		var q book.Quote
+		var embeddingBlob []byte
+		if err := rows.Scan(&q.ID, &q.BookID, &q.Text, &q.Note, &q.Location, &q.Page, &q.Chapter, &q.Source, &q.DateAdded, &embeddingBlob); err != nil {
+			return nil, err
+		}
+		if len(embeddingBlob) > 0 {
+			q.Embedding, _ = decodeEmbedding(embeddingBlob)
+		}
+		quotes = append(quotes, q)
+	}
+	return quotes, rows.Err()
+}
+
+// MoveQuotes moves fromID's quotes to toID
+func (r *SQLiteRepository) MoveQuotes(ctx context.Context, fromID, toID int64) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE quotes SET book_id = ? WHERE book_id = ?", toID, fromID)
+	return err
+}
+
+func (r *SQLiteRepository) CreateSession(ctx context.Context, sess *book.Session) error {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO reading_sessions (book_id, started_at, ended_at, start_page, end_page, start_percent, end_percent, note, source)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, sess.BookID, sess.Start, nullTime(sess.End), sess.StartPage, sess.EndPage, sess.StartPercent, sess.EndPercent, sess.Note, sess.Source)
+	if err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("get last insert id: %w", err)
+	}
+	sess.ID = id
+	return nil
+}
+
+func (r *SQLiteRepository) UpdateSession(ctx context.Context, sess *book.Session) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE reading_sessions SET book_id = ?, started_at = ?, ended_at = ?, start_page = ?, end_page = ?, start_percent = ?, end_percent = ?, note = ?, source = ?
+		WHERE id = ?
+	`, sess.BookID, sess.Start, nullTime(sess.End), sess.StartPage, sess.EndPage, sess.StartPercent, sess.EndPercent, sess.Note, sess.Source, sess.ID)
+	return err
+}
+
+// GetSessions returns a book's reading sessions, oldest first
+func (r *SQLiteRepository) GetSessions(ctx context.Context, bookID int64) ([]book.Session, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+sessionColumns+`
+		FROM reading_sessions WHERE book_id = ?
+		ORDER BY started_at, id
+	`, bookID)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	return scanSessions(rows)
+}
+
+// GetActiveSession returns the session that hasn't ended, or nil
+func (r *SQLiteRepository) GetActiveSession(ctx context.Context) (*book.Session, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+sessionColumns+`
+		FROM reading_sessions WHERE ended_at IS NULL
+		ORDER BY started_at DESC LIMIT 1
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	sessions, err := scanSessions(rows)
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+	return &sessions[0], nil
+}
+
+func (r *SQLiteRepository) DeleteSession(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM reading_sessions WHERE id = ?", id)
+	return err
+}
+
+// MoveSessions moves fromID's reading sessions to toID
+func (r *SQLiteRepository) MoveSessions(ctx context.Context, fromID, toID int64) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE reading_sessions SET book_id = ? WHERE book_id = ?", toID, fromID)
+	return err
+}
+
+func (r *SQLiteRepository) CreateReadThrough(ctx context.Context, rt *book.ReadThrough) error {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO read_throughs (book_id, status, started_at, finished_at, rating, format, notes, dnf_reason, dnf_page)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, rt.BookID, rt.Status, nullTime(rt.Started), nullTime(rt.Finished), rt.Rating, rt.Format, rt.Notes, rt.DNFReason, rt.DNFPage)
+	if err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("get last insert id: %w", err)
+	}
+	rt.ID = id
+	return nil
+}
+
+func (r *SQLiteRepository) UpdateReadThrough(ctx context.Context, rt *book.ReadThrough) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE read_throughs SET book_id = ?, status = ?, started_at = ?, finished_at = ?, rating = ?, format = ?, notes = ?, dnf_reason = ?, dnf_page = ?
+		WHERE id = ?
+	`, rt.BookID, rt.Status, nullTime(rt.Started), nullTime(rt.Finished), rt.Rating, rt.Format, rt.Notes, rt.DNFReason, rt.DNFPage, rt.ID)
+	return err
+}
+
+func (r *SQLiteRepository) GetReadThrough(ctx context.Context, id int64) (*book.ReadThrough, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+readThroughColumns+`
+		FROM read_throughs WHERE id = ?
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	list, err := scanReadThroughs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("read-through %d not found", id)
+	}
+	return &list[0], nil
+}
+
+// GetReadThroughs returns a book's read-throughs, oldest first. Reads with
+// no dates sort before the rest.
+func (r *SQLiteRepository) GetReadThroughs(ctx context.Context, bookID int64) ([]book.ReadThrough, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+readThroughColumns+`
+		FROM read_throughs WHERE book_id = ?
+		ORDER BY COALESCE(started_at, finished_at), id
+	`, bookID)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	return scanReadThroughs(rows)
+}
+
+func (r *SQLiteRepository) GetAllReadThroughs(ctx context.Context) ([]book.ReadThrough, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+readThroughColumns+`
+		FROM read_throughs
+		ORDER BY COALESCE(started_at, finished_at), id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	return scanReadThroughs(rows)
+}
+
+func (r *SQLiteRepository) DeleteReadThrough(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM read_throughs WHERE id = ?", id)
+	return err
+}
+
+// MoveReadThroughs moves fromID's read-throughs to toID
+func (r *SQLiteRepository) MoveReadThroughs(ctx context.Context, fromID, toID int64) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE read_throughs SET book_id = ? WHERE book_id = ?", toID, fromID)
+	return err
+}
+
+// SetGoal saves a goal, replacing the target of any goal of the same kind
+// and period
+func (r *SQLiteRepository) SetGoal(ctx context.Context, g *book.Goal) error {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO goals (kind, year, month, target) VALUES (?, ?, ?, ?)
+		ON CONFLICT(kind, year, month) DO UPDATE SET target = excluded.target
+		RETURNING id
+	`, g.Kind, g.Year, g.Month, g.Target).Scan(&g.ID)
+	if err != nil {
+		return fmt.Errorf("upsert: %w", err)
+	}
+	return nil
+}
+
+// GetGoals returns a year's goals, the yearly ones first
+func (r *SQLiteRepository) GetGoals(ctx context.Context, year int) ([]book.Goal, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT id, kind, year, month, target FROM goals WHERE year = ? ORDER BY month, id", year)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	return scanGoals(rows)
+}
+
+func (r *SQLiteRepository) GetAllGoals(ctx context.Context) ([]book.Goal, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT id, kind, year, month, target FROM goals ORDER BY year, month, id")
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	return scanGoals(rows)
+}
+
+func (r *SQLiteRepository) DeleteGoal(ctx context.Context, kind book.GoalKind, year, month int) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM goals WHERE kind = ? AND year = ? AND month = ?", kind, year, month)
+	return err
+}
+
+func (r *SQLiteRepository) CreateAuthor(ctx context.Context, a *book.Author) error {
+	aliases, _ := json.Marshal(a.Aliases)
+	result, err := r.db.ExecContext(ctx, "INSERT INTO authors (name, aliases, ol_key) VALUES (?, ?, ?)", a.Name, string(aliases), a.OLKey)
+	if err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	a.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *SQLiteRepository) UpdateAuthor(ctx context.Context, a *book.Author) error {
+	aliases, _ := json.Marshal(a.Aliases)
+	_, err := r.db.ExecContext(ctx, "UPDATE authors SET name = ?, aliases = ?, ol_key = ? WHERE id = ?", a.Name, string(aliases), a.OLKey, a.ID)
+	return err
+}
+
+func (r *SQLiteRepository) GetAuthor(ctx context.Context, id int64) (*book.Author, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+authorColumns+" FROM authors WHERE id = ?", id)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	authors, err := scanAuthors(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(authors) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &authors[0], nil
+}
+
+func (r *SQLiteRepository) GetAllAuthors(ctx context.Context) ([]book.Author, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+authorColumns+" FROM authors ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	return scanAuthors(rows)
+}
+
+// DeleteAuthor deletes an author and their credits
+func (r *SQLiteRepository) DeleteAuthor(ctx context.Context, id int64) error {
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM book_authors WHERE author_id = ?", id); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, "DELETE FROM authors WHERE id = ?", id)
+	return err
+}
+
+// GetCredits returns the people credited on a book, in order within each role
+func (r *SQLiteRepository) GetCredits(ctx context.Context, bookID int64) ([]book.Credit, error) {
+	return r.queryCredits(ctx, "WHERE ba.book_id = ? ORDER BY ba.role, ba.position", bookID)
+}
+
+// GetAuthorCredits returns the books an author is credited on
+func (r *SQLiteRepository) GetAuthorCredits(ctx context.Context, authorID int64) ([]book.Credit, error) {
+	return r.queryCredits(ctx, "WHERE ba.author_id = ? ORDER BY ba.book_id, ba.role", authorID)
+}
+
+func (r *SQLiteRepository) GetAllCredits(ctx context.Context) ([]book.Credit, error) {
+	return r.queryCredits(ctx, "ORDER BY ba.book_id, ba.role, ba.position")
+}
+
+func (r *SQLiteRepository) queryCredits(ctx context.Context, where string, args ...any) ([]book.Credit, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT ba.book_id, ba.author_id, a.name, ba.role
+		FROM book_authors ba JOIN authors a ON a.id = ba.author_id
+	`+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	var credits []book.Credit
+	for rows.Next() {
+		var c book.Credit
+		if err := rows.Scan(&c.BookID, &c.AuthorID, &c.Name, &c.Role); err != nil {
+			return nil, err
+		}
+		credits = append(credits, c)
+	}
+	return credits, rows.Err()
+}
+
+// SetCredits replaces the people credited on a book in a role with
+// authorIDs, in order
+func (r *SQLiteRepository) SetCredits(ctx context.Context, bookID int64, role book.Role, authorIDs []int64) error {
+	return r.inTx(ctx, func(tx *SQLiteRepository) error {
+		if _, err := tx.db.ExecContext(ctx, "DELETE FROM book_authors WHERE book_id = ? AND role = ?", bookID, role); err != nil {
+			return err
+		}
+		for i, id := range authorIDs {
+			_, err := tx.db.ExecContext(ctx, "INSERT OR IGNORE INTO book_authors (book_id, author_id, role, position) VALUES (?, ?, ?, ?)", bookID, id, role, i)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AddCredit credits a person on a book, after anyone already credited in
+// that role
+func (r *SQLiteRepository) AddCredit(ctx context.Context, c book.Credit) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO book_authors (book_id, author_id, role, position)
+		VALUES (?, ?, ?, (SELECT COALESCE(MAX(position) + 1, 0) FROM book_authors WHERE book_id = ? AND role = ?))
+	`, c.BookID, c.AuthorID, c.Role, c.BookID, c.Role)
+	return err
+}
+
+func (r *SQLiteRepository) DeleteCredit(ctx context.Context, c book.Credit) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM book_authors WHERE book_id = ? AND author_id = ? AND role = ?", c.BookID, c.AuthorID, c.Role)
+	return err
+}
+
+// MoveCredits moves fromBookID's credits to toBookID. Credits toBookID
+// already has are dropped.
+func (r *SQLiteRepository) MoveCredits(ctx context.Context, fromBookID, toBookID int64) error {
+	if _, err := r.db.ExecContext(ctx, "UPDATE OR IGNORE book_authors SET book_id = ? WHERE book_id = ?", toBookID, fromBookID); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, "DELETE FROM book_authors WHERE book_id = ?", fromBookID)
+	return err
+}
+
+// MoveAuthorCredits credits fromAuthorID's books to toAuthorID instead
+func (r *SQLiteRepository) MoveAuthorCredits(ctx context.Context, fromAuthorID, toAuthorID int64) error {
+	if _, err := r.db.ExecContext(ctx, "UPDATE OR IGNORE book_authors SET author_id = ? WHERE author_id = ?", toAuthorID, fromAuthorID); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, "DELETE FROM book_authors WHERE author_id = ?", fromAuthorID)
+	return err
+}
+
+const authorColumns = "id, name, COALESCE(aliases, ''), COALESCE(ol_key, '')"
+
+func scanAuthors(rows *sql.Rows) ([]book.Author, error) {
+	var authors []book.Author
+	for rows.Next() {
+		var a book.Author
+		var aliases string
+		if err := rows.Scan(&a.ID, &a.Name, &aliases, &a.OLKey); err != nil {
+			return nil, err
+		}
+		if aliases != "" {
+			json.Unmarshal([]byte(aliases), &a.Aliases)
+		}
+		authors = append(authors, a)
+	}
+	return authors, rows.Err()
+}
+
+func (r *SQLiteRepository) CreateEdition(ctx context.Context, e *book.Edition) error {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO editions (book_id, isbn, format, publisher, page_count, total_minutes, cover_url, cover_hash, date_added)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.BookID, e.ISBN, e.Format, e.Publisher, e.PageCount, e.TotalMinutes, e.CoverURL, e.CoverHash, e.DateAdded)
+	if err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	e.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *SQLiteRepository) UpdateEdition(ctx context.Context, e *book.Edition) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE editions SET isbn = ?, format = ?, publisher = ?, page_count = ?, total_minutes = ?, cover_url = ?, cover_hash = ?
+		WHERE id = ?
+	`, e.ISBN, e.Format, e.Publisher, e.PageCount, e.TotalMinutes, e.CoverURL, e.CoverHash, e.ID)
+	return err
+}
+
+func (r *SQLiteRepository) GetEdition(ctx context.Context, id int64) (*book.Edition, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+editionColumns+" FROM editions WHERE id = ?", id)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	editions, err := scanEditions(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(editions) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &editions[0], nil
+}
+
+func (r *SQLiteRepository) GetEditions(ctx context.Context, bookID int64) ([]book.Edition, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+editionColumns+" FROM editions WHERE book_id = ? ORDER BY id", bookID)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	return scanEditions(rows)
+}
+
+func (r *SQLiteRepository) DeleteEdition(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM editions WHERE id = ?", id)
+	return err
+}
+
+// MoveEditions makes fromBookID's editions editions of toBookID
+func (r *SQLiteRepository) MoveEditions(ctx context.Context, fromBookID, toBookID int64) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE editions SET book_id = ? WHERE book_id = ?", toBookID, fromBookID)
+	return err
+}
+
+func scanEditions(rows *sql.Rows) ([]book.Edition, error) {
+	var editions []book.Edition
+	for rows.Next() {
+		var e book.Edition
+		if err := rows.Scan(&e.ID, &e.BookID, &e.ISBN, &e.Format, &e.Publisher, &e.PageCount, &e.TotalMinutes, &e.CoverURL, &e.CoverHash, &e.DateAdded); err != nil {
+			return nil, err
+		}
+		editions = append(editions, e)
+	}
+	return editions, rows.Err()
+}
+
+func scanGoals(rows *sql.Rows) ([]book.Goal, error) {
+	var goals []book.Goal
+	for rows.Next() {
+		var g book.Goal
+		if err := rows.Scan(&g.ID, &g.Kind, &g.Year, &g.Month, &g.Target); err != nil {
+			return nil, err
+		}
+		goals = append(goals, g)
+	}
+	return goals, rows.Err()
+}
+
+func scanReadThroughs(rows *sql.Rows) ([]book.ReadThrough, error) {
+	var list []book.ReadThrough
+	for rows.Next() {
+		var rt book.ReadThrough
+		var started, finished sql.NullTime
+		if err := rows.Scan(&rt.ID, &rt.BookID, &rt.Status, &started, &finished, &rt.Rating, &rt.Format, &rt.Notes, &rt.DNFReason, &rt.DNFPage); err != nil {
+			return nil, err
+		}
+		rt.Started, rt.Finished = started.Time, finished.Time
+		list = append(list, rt)
+	}
+	return list, rows.Err()
+}
+
+func scanSessions(rows *sql.Rows) ([]book.Session, error) {
+	var sessions []book.Session
+	for rows.Next() {
+		var sess book.Session
+		var end sql.NullTime
+		if err := rows.Scan(&sess.ID, &sess.BookID, &sess.Start, &end, &sess.StartPage, &sess.EndPage, &sess.StartPercent, &sess.EndPercent, &sess.Note, &sess.Source); err != nil {
+			return nil, err
+		}
+		sess.End = end.Time
+		sessions = append(sessions, sess)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *SQLiteRepository) CreateSyncUser(ctx context.Context, username, keyHash string) error {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO kosync_users (username, key_hash, created_at) VALUES (?, ?, ?)
+		ON CONFLICT(username) DO NOTHING
+	`, username, keyHash, time.Now())
+	if err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return kosync.ErrUserExists
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) GetSyncUserKey(ctx context.Context, username string) (string, error) {
+	var hash string
+	err := r.db.QueryRowContext(ctx, "SELECT key_hash FROM kosync_users WHERE username = ?", username).Scan(&hash)
+	if err != nil && err.Error() == "sql: no rows in result set" {
+		return "", nil
+	}
+	return hash, err
+}
+
+func (r *SQLiteRepository) SaveSyncProgress(ctx context.Context, p *kosync.Progress) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO kosync_progress (username, document, progress, percentage, device, device_id, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(username, document) DO UPDATE SET
+			progress = excluded.progress, percentage = excluded.percentage, device = excluded.device,
+			device_id = excluded.device_id, timestamp = excluded.timestamp
+	`, p.Username, p.Document, p.Progress, p.Percentage, p.Device, p.DeviceID, p.Timestamp)
+	return err
+}
+
+func (r *SQLiteRepository) GetSyncProgress(ctx context.Context, username, document string) (*kosync.Progress, error) {
+	row := r.db.QueryRowContext(ctx, `
+		SELECT username, document, progress, percentage, COALESCE(device, ''), COALESCE(device_id, ''), timestamp
+		FROM kosync_progress WHERE username = ? AND document = ?
+	`, username, document)
+
+	var p kosync.Progress
+	if err := row.Scan(&p.Username, &p.Document, &p.Progress, &p.Percentage, &p.Device, &p.DeviceID, &p.Timestamp); err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ListSyncProgress returns every synced position, most recent first
+func (r *SQLiteRepository) ListSyncProgress(ctx context.Context) ([]kosync.Progress, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT username, document, progress, percentage, COALESCE(device, ''), COALESCE(device_id, ''), timestamp
+		FROM kosync_progress ORDER BY timestamp DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	var list []kosync.Progress
+	for rows.Next() {
+		var p kosync.Progress
+		if err := rows.Scan(&p.Username, &p.Document, &p.Progress, &p.Percentage, &p.Device, &p.DeviceID, &p.Timestamp); err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func (r *SQLiteRepository) scanBook(s scanner) (*book.Book, error) {
+	var b book.Book
+	var tagsJSON string
+	var adaptationsJSON sql.NullString
+	var coverURL, coverHash, filePath sql.NullString
+	var pageCount, currentPage sql.NullInt64
+	var dateRead sql.NullTime
+	var embeddingBlob []byte
+	var authors sql.NullString
+
+	err := s.Scan(
+		&b.ID, &b.Title, &b.Author, &b.ISBN, &b.Description, &b.Genre,
+		&tagsJSON, &coverURL, &coverHash, &filePath, &pageCount, &currentPage, &b.Rating, &b.Status, &b.Notes, &b.DateAdded, &dateRead, &embeddingBlob, &adaptationsJSON, &b.DNFReason, &b.DNFPage, &b.Series, &b.SeriesPosition, &b.EditionID, &b.Format, &b.Publisher, &b.TotalMinutes, &b.ListenedMinutes, &authors,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if tagsJSON != "" {
+		json.Unmarshal([]byte(tagsJSON), &b.Tags)
+	}
+	if adaptationsJSON.Valid && adaptationsJSON.String != "" {
+		json.Unmarshal([]byte(adaptationsJSON.String), &b.Adaptations)
+	}
+	if coverURL.Valid {
+		b.CoverURL = coverURL.String
+	}
+	if coverHash.Valid {
+		b.CoverHash = coverHash.String
+	}
+	if filePath.Valid {
+		b.FilePath = filePath.String
+	}
+	if pageCount.Valid {
+		b.PageCount = int(pageCount.Int64)
+	}
+	if currentPage.Valid {
+		b.CurrentPage = int(currentPage.Int64)
 	}
 	if dateRead.Valid {
 		b.DateRead = dateRead.Time
@@ -251,6 +1466,9 @@ func (r *SQLiteRepository) scanBook(s scanner) (*book.Book, error) {
 	if len(embeddingBlob) > 0 {
 		b.Embedding, _ = decodeEmbedding(embeddingBlob)
 	}
+	if authors.Valid && authors.String != "" {
+		b.Authors = strings.Split(authors.String, authorSeparator)
+	}
 
 	return &b, nil
 }
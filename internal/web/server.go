@@ -3,20 +3,31 @@ package web
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"embed"
-	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"html/template"
-	"io"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/erwar/pka/internal/backup"
 	"github.com/erwar/pka/internal/book"
+	"github.com/erwar/pka/internal/covers"
+	"github.com/erwar/pka/internal/importer"
+	"github.com/erwar/pka/internal/report"
 	"github.com/erwar/pka/internal/scraper"
 	"github.com/erwar/pka/internal/search"
+	"github.com/erwar/pka/internal/snapshot"
+	"github.com/erwar/pka/internal/stats"
 )
 
 //go:embed templates/*.html
@@ -26,15 +37,57 @@ type Server struct {
 	bookService  *book.Service
 	searchEngine *search.Engine
 	tmdbClient   *scraper.TMDBClient
+	coverStore   *covers.Store
 	templates    *template.Template
 	mux          *http.ServeMux
+
+	importsMu sync.Mutex
+	imports   map[string]*pendingImport // by token
+
+	coverFailsMu sync.Mutex
+	coverFails   map[string]time.Time // cover URL -> when fetching it last failed
+
+	snapshots  *snapshot.Scheduler
+	adminToken string
+
+	fileDirs []string // linked ebook files are only served from these
 }
 
-func NewServer(bookService *book.Service, searchEngine *search.Engine, tmdbClient *scraper.TMDBClient) *Server {
+// pendingImport is an uploaded file waiting for the user's per-row decisions
+type pendingImport struct {
+	rows      []importer.PreviewRow
+	result    *importer.Result // set once committed
+	createdAt time.Time
+}
+
+// How long an unconfirmed import or its report stays available
+const pendingImportTTL = time.Hour
+
+// How long a cover URL that failed to download is left alone before it's
+// tried again
+const coverRetryAfter = time.Hour
+
+func NewServer(bookService *book.Service, searchEngine *search.Engine, tmdbClient *scraper.TMDBClient, coverStore *covers.Store) *Server {
 	// Parse templates with custom functions
 	funcMap := template.FuncMap{
-		"stars": func(n int) string {
-			return strings.Repeat("★", n) + strings.Repeat("☆", 5-n)
+		"stars": func(r float64) string {
+			n := book.WholeStars(r)
+			stars := strings.Repeat("★", n) + strings.Repeat("☆", 5-n)
+			if r != float64(n) {
+				stars += " " + book.FormatRating(r)
+			}
+			return stars
+		},
+		"starRating": book.FormatRating,
+		// ratingOptions lists the whole-star ratings a form offers, and
+		// the current rating if it's a fractional one from an import
+		"ratingOptions": func(current float64) []float64 {
+			options := []float64{1, 2, 3, 4, 5}
+			if current > 0 && current != float64(book.WholeStars(current)) {
+				options = append(options, current)
+				sort.Float64s(options)
+			}
+			return options
 		},
 		"formatDate": func(t time.Time) string {
 			if t.IsZero() {
@@ -42,6 +95,15 @@ func NewServer(bookService *book.Service, searchEngine *search.Engine, tmdbClien
 			}
 			return t.Format("Jan 2, 2006")
 		},
+		"base":    filepath.Base,
+		"minutes": book.FormatMinutes,
+		"duration": func(d time.Duration) string {
+			d = d.Round(time.Minute)
+			if d < time.Hour {
+				return fmt.Sprintf("%dm", int(d.Minutes()))
+			}
+			return fmt.Sprintf("%dh %02dm", int(d.Hours()), int(d.Minutes())%60)
+		},
 		"truncate": func(s string, n int) string {
 			if len(s) <= n {
 				return s
@@ -54,8 +116,14 @@ func NewServer(bookService *book.Service, searchEngine *search.Engine, tmdbClien
 				return "bg-yellow-100 text-yellow-800"
 			case book.StatusReading:
 				return "bg-blue-100 text-blue-800"
+			case book.StatusRereading:
+				return "bg-indigo-100 text-indigo-800"
+			case book.StatusPaused:
+				return "bg-orange-100 text-orange-800"
 			case book.StatusRead:
 				return "bg-green-100 text-green-800"
+			case book.StatusDNF:
+				return "bg-red-100 text-red-800"
 			default:
 				return "bg-gray-100 text-gray-800"
 			}
@@ -66,9 +134,19 @@ func NewServer(bookService *book.Service, searchEngine *search.Engine, tmdbClien
 		"join": func(s []string) string {
 			return strings.Join(s, ", ")
 		},
-		"atoi": func(s string) int {
-			i, _ := strconv.Atoi(s)
-			return i
+		"atof": func(s string) float64 {
+			f, _ := strconv.ParseFloat(s, 64)
+			return f
+		},
+		"add": func(a, b int) int {
+			return a + b
+		},
+		"sub": func(a, b int) int {
+			return a - b
+		},
+		"top": stats.Top,
+		"percent": func(f float64) string {
+			return fmt.Sprintf("%.0f%%", f*100)
 		},
 		"adaptationType": func(t book.AdaptationType) string {
 			return t.Display()
@@ -98,14 +176,48 @@ func NewServer(bookService *book.Service, searchEngine *search.Engine, tmdbClien
 		bookService:  bookService,
 		searchEngine: searchEngine,
 		tmdbClient:   tmdbClient,
+		coverStore:   coverStore,
 		templates:    tmpl,
 		mux:          http.NewServeMux(),
+		imports:      make(map[string]*pendingImport),
+		coverFails:   make(map[string]time.Time),
 	}
 
 	s.routes()
 	return s
 }
 
+// EnableSnapshots turns on the /admin/snapshot endpoints, authenticated
+// with a bearer token. They stay disabled if token is empty.
+func (s *Server) EnableSnapshots(scheduler *snapshot.Scheduler, token string) {
+	s.snapshots = scheduler
+	s.adminToken = token
+}
+
+// EnableFiles lets /files/{id} serve the ebook files books are linked to,
+// as long as they are inside one of dirs. Symlinks are resolved first, so
+// a link can't lead out of them.
+func (s *Server) EnableFiles(dirs []string) error {
+	for _, dir := range dirs {
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return fmt.Errorf("ebook directory: %w", err)
+		}
+		real, err = filepath.Abs(real)
+		if err != nil {
+			return fmt.Errorf("ebook directory: %w", err)
+		}
+		s.fileDirs = append(s.fileDirs, real)
+	}
+	return nil
+}
+
+// EnableKOSync serves the KOReader sync API under /kosync, the URL to give
+// KOReader as its custom sync server
+func (s *Server) EnableKOSync(h http.Handler) {
+	s.mux.Handle("/kosync/", http.StripPrefix("/kosync", h))
+}
+
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.mux.ServeHTTP(w, r)
 }
@@ -115,6 +227,14 @@ func (s *Server) routes() {
 	s.mux.HandleFunc("/books", s.handleBooks)
 	s.mux.HandleFunc("/books/", s.handleBookDetail)
 	s.mux.HandleFunc("/search", s.handleSearch)
+	s.mux.HandleFunc("/quotes", s.handleQuotes)
+	s.mux.HandleFunc("/quotes/add", s.handleQuoteAdd)
+	s.mux.HandleFunc("/quotes/delete/", s.handleQuoteDelete)
+	s.mux.HandleFunc("/sessions/add", s.handleSessionAdd)
+	s.mux.HandleFunc("/reads/add", s.handleReadAdd)
+	s.mux.HandleFunc("/reads/start", s.handleReadStart)
+	s.mux.HandleFunc("/reads/delete/", s.handleReadDelete)
+	s.mux.HandleFunc("/sessions/delete/", s.handleSessionDelete)
 	s.mux.HandleFunc("/discover", s.handleDiscover)
 	s.mux.HandleFunc("/discover/add", s.handleDiscoverAdd)
 	s.mux.HandleFunc("/scrape", s.handleScrape)
@@ -124,11 +244,30 @@ func (s *Server) routes() {
 	s.mux.HandleFunc("/delete/", s.handleDelete)
 	s.mux.HandleFunc("/export", s.handleExport)
 	s.mux.HandleFunc("/import", s.handleImport)
+	s.mux.HandleFunc("/import/commit", s.handleImportCommit)
+	s.mux.HandleFunc("/import/report/", s.handleImportReport)
+	s.mux.HandleFunc("/backup", s.handleBackup)
+	s.mux.HandleFunc("/backup/restore", s.handleRestore)
+	s.mux.HandleFunc("/admin/snapshot", s.handleAdminSnapshot)
+	s.mux.HandleFunc("/admin/snapshots", s.handleAdminSnapshots)
 	s.mux.HandleFunc("/stats", s.handleStats)
+	s.mux.HandleFunc("/stats/", s.handleWrapped)
+	s.mux.HandleFunc("/api/stats", s.handleStatsAPI)
+	s.mux.HandleFunc("/series", s.handleSeries)
+	s.mux.HandleFunc("/authors", s.handleAuthors)
+	s.mux.HandleFunc("/authors/", s.handleAuthor)
+	s.mux.HandleFunc("/authors/alias", s.handleAuthorAlias)
+	s.mux.HandleFunc("/credits/add", s.handleCreditAdd)
+	s.mux.HandleFunc("/credits/delete", s.handleCreditDelete)
+	s.mux.HandleFunc("/editions/add", s.handleEditionAdd)
+	s.mux.HandleFunc("/editions/use", s.handleEditionUse)
+	s.mux.HandleFunc("/editions/delete", s.handleEditionDelete)
 	s.mux.HandleFunc("/adaptations", s.handleAdaptations)
 	s.mux.HandleFunc("/adaptations/search", s.handleAdaptationsSearch)
 	s.mux.HandleFunc("/adaptations/add", s.handleAdaptationsAdd)
 	s.mux.HandleFunc("/adaptations/delete", s.handleAdaptationsDelete)
+	s.mux.HandleFunc("/covers/", s.handleCover)
+	s.mux.HandleFunc("/files/", s.handleFile)
 }
 
 func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
@@ -147,15 +286,24 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 		Reading     int
 		Read        int
 		RecentBooks []book.Book
+		Goals       []book.GoalProgress // this year's and this month's
 	}{
 		Total: len(books),
 	}
 
+	now := time.Now()
+	goals, _ := s.bookService.GoalProgress(ctx, now.Year(), now)
+	for _, g := range goals {
+		if g.Covers(now) {
+			stats.Goals = append(stats.Goals, g)
+		}
+	}
+
 	for _, b := range books {
 		switch b.Status {
 		case book.StatusWantToRead:
 			stats.WantToRead++
-		case book.StatusReading:
+		case book.StatusReading, book.StatusRereading:
 			stats.Reading++
 		case book.StatusRead:
 			stats.Read++
@@ -226,15 +374,19 @@ func (s *Server) handleBookDetail(w http.ResponseWriter, r *http.Request) {
 				b.DateRead = time.Now()
 			}
 		}
+		setDNF(r, b)
 		if rating := r.FormValue("rating"); rating != "" {
-			b.Rating, _ = strconv.Atoi(rating)
+			b.Rating, _ = book.ParseRating(rating)
 		}
+		was := *b
 		if currentPage := r.FormValue("current_page"); currentPage != "" {
 			b.CurrentPage, _ = strconv.Atoi(currentPage)
 		}
+		formMinutes(r, "listened", &b.ListenedMinutes)
 		b.Notes = r.FormValue("notes")
 
 		s.bookService.Update(ctx, b)
+		s.recordProgress(ctx, &was, b)
 		http.Redirect(w, r, "/books/"+idStr, http.StatusSeeOther)
 		return
 	}
@@ -245,7 +397,67 @@ func (s *Server) handleBookDetail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.render(w, "book_detail.html", b)
+	quotes, err := s.bookService.Quotes(ctx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sessions, err := s.bookService.Sessions(ctx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	reads, err := s.bookService.ReadThroughs(ctx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		*book.Book
+		Quotes   []book.Quote
+		Sessions []book.Session // newest first
+		Pace     book.Pace
+		Reads    []book.ReadThrough
+		Next     *book.Book    // to read after this one in its series, once it's read
+		Authors  []book.Credit // linked authors, in order
+		Credits  []book.Credit // translators, narrators and so on
+		Roles    []book.Role
+		Editions []book.Edition
+	}{
+		Book:   b,
+		Quotes: quotes,
+		Pace:   book.PaceOf(b, sessions, time.Now()),
+		Reads:  reads,
+		Roles:  book.Roles,
+	}
+	credits, err := s.bookService.Credits(ctx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, c := range credits {
+		if c.Role == book.RoleAuthor {
+			data.Authors = append(data.Authors, c)
+		} else {
+			data.Credits = append(data.Credits, c)
+		}
+	}
+	if data.Editions, err = s.bookService.Editions(ctx, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := len(sessions) - 1; i >= 0; i-- {
+		data.Sessions = append(data.Sessions, sessions[i])
+	}
+	if b.Status == book.StatusRead {
+		if data.Next, err = s.bookService.NextInSeries(ctx, b); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	s.render(w, "book_detail.html", data)
 }
 
 func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
@@ -270,6 +482,110 @@ func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 	s.render(w, "search.html", data)
 }
 
+// handleQuotes searches quotes by meaning, or lists the most recent ones
+func (s *Server) handleQuotes(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	ctx := r.Context()
+
+	data := struct {
+		Query   string
+		Results []book.QuoteSearchResult
+		Total   int
+	}{
+		Query: query,
+	}
+
+	if query != "" {
+		if _, err := s.bookService.EmbedMissingQuotes(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		results, err := s.searchEngine.SearchQuotes(ctx, query, 20)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.Results = results
+		s.render(w, "quotes.html", data)
+		return
+	}
+
+	quotes, err := s.bookService.AllQuotes(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Total = len(quotes)
+	if len(quotes) > 50 {
+		quotes = quotes[:50]
+	}
+
+	books := make(map[int64]*book.Book)
+	for _, q := range quotes {
+		if _, ok := books[q.BookID]; !ok {
+			books[q.BookID], _ = s.bookService.Get(ctx, q.BookID)
+		}
+		if b := books[q.BookID]; b != nil {
+			data.Results = append(data.Results, book.QuoteSearchResult{Quote: q, Book: *b})
+		}
+	}
+
+	s.render(w, "quotes.html", data)
+}
+
+func (s *Server) handleQuoteAdd(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/quotes", http.StatusSeeOther)
+		return
+	}
+
+	r.ParseForm()
+	bookID, err := strconv.ParseInt(r.FormValue("book_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid book ID", http.StatusBadRequest)
+		return
+	}
+	page, _ := strconv.Atoi(r.FormValue("page"))
+	q := &book.Quote{
+		BookID:  bookID,
+		Text:    strings.TrimSpace(r.FormValue("text")),
+		Note:    strings.TrimSpace(r.FormValue("note")),
+		Chapter: strings.TrimSpace(r.FormValue("chapter")),
+		Page:    page,
+	}
+
+	// A quote that couldn't be embedded is still saved, and embedded on the
+	// next search
+	if err := s.bookService.AddQuote(r.Context(), q); err != nil && q.ID == 0 {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/books/%d", bookID), http.StatusSeeOther)
+}
+
+func (s *Server) handleQuoteDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/quotes", http.StatusSeeOther)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/quotes/delete/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	q, err := s.bookService.GetQuote(ctx, id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.bookService.DeleteQuote(ctx, id)
+	http.Redirect(w, r, fmt.Sprintf("/books/%d", q.BookID), http.StatusSeeOther)
+}
+
 func (s *Server) handleDiscover(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
 	source := r.URL.Query().Get("source")
@@ -333,6 +649,7 @@ func (s *Server) handleDiscoverAdd(w http.ResponseWriter, r *http.Request) {
 		Status:      book.StatusWantToRead,
 		DateAdded:   time.Now(),
 	}
+	setSeries(r, b)
 
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
@@ -444,9 +761,10 @@ func (s *Server) handleAdd(w http.ResponseWriter, r *http.Request) {
 			Status:      book.Status(r.FormValue("status")),
 			DateAdded:   time.Now(),
 		}
+		setSeries(r, b)
 
 		if rating := r.FormValue("rating"); rating != "" {
-			b.Rating, _ = strconv.Atoi(rating)
+			b.Rating, _ = book.ParseRating(rating)
 		}
 
 		if tags := r.FormValue("tags"); tags != "" {
@@ -500,14 +818,24 @@ func (s *Server) handleEdit(w http.ResponseWriter, r *http.Request) {
 		b.Title = r.FormValue("title")
 		b.Author = r.FormValue("author")
 		b.ISBN = r.FormValue("isbn")
+		was := *b
+		if format, ok := book.ParseFormat(r.FormValue("format")); ok {
+			b.Format = format
+		}
+		b.Publisher = r.FormValue("publisher")
 		b.Genre = r.FormValue("genre")
+		setSeries(r, b)
 		b.Description = r.FormValue("description")
-		b.CoverURL = r.FormValue("cover_url")
+		if coverURL := r.FormValue("cover_url"); coverURL != b.CoverURL {
+			b.CoverURL = coverURL
+			b.CoverHash = "" // re-fetched on next view
+		}
 		b.Notes = r.FormValue("notes")
 		b.Status = book.Status(r.FormValue("status"))
+		setDNF(r, b)
 
 		if rating := r.FormValue("rating"); rating != "" {
-			b.Rating, _ = strconv.Atoi(rating)
+			b.Rating, _ = book.ParseRating(rating)
 		}
 		if pageCount := r.FormValue("page_count"); pageCount != "" {
 			b.PageCount, _ = strconv.Atoi(pageCount)
@@ -515,6 +843,8 @@ func (s *Server) handleEdit(w http.ResponseWriter, r *http.Request) {
 		if currentPage := r.FormValue("current_page"); currentPage != "" {
 			b.CurrentPage, _ = strconv.Atoi(currentPage)
 		}
+		formMinutes(r, "total_minutes", &b.TotalMinutes)
+		formMinutes(r, "listened", &b.ListenedMinutes)
 
 		if tags := r.FormValue("tags"); tags != "" {
 			b.Tags = strings.Split(tags, ",")
@@ -530,6 +860,7 @@ func (s *Server) handleEdit(w http.ResponseWriter, r *http.Request) {
 		}
 
 		s.bookService.Update(ctx, b)
+		s.recordProgress(ctx, &was, b)
 		http.Redirect(w, r, "/books/"+idStr, http.StatusSeeOther)
 		return
 	}
@@ -543,6 +874,181 @@ func (s *Server) handleEdit(w http.ResponseWriter, r *http.Request) {
 	s.render(w, "edit.html", b)
 }
 
+// setDNF takes why and where a book was abandoned from the form, if it is
+// marked did_not_finish
+func setDNF(r *http.Request, b *book.Book) {
+	if b.Status != book.StatusDNF {
+		return
+	}
+	b.DNFReason = strings.TrimSpace(r.FormValue("dnf_reason"))
+	b.DNFPage, _ = strconv.Atoi(r.FormValue("dnf_page"))
+}
+
+// setSeries sets b's series and position from the form
+func setSeries(r *http.Request, b *book.Book) {
+	b.Series = strings.TrimSpace(r.FormValue("series"))
+	b.SeriesPosition, _ = strconv.ParseFloat(r.FormValue("series_position"), 64)
+	if b.Series == "" || b.SeriesPosition < 0 {
+		b.SeriesPosition = 0
+	}
+}
+
+// formMinutes reads an hours:minutes field into dst, leaving it alone if
+// the field is empty or can't be read
+func formMinutes(r *http.Request, field string, dst *int) {
+	if v := r.FormValue(field); v != "" {
+		if m, err := book.ParseMinutes(v); err == nil {
+			*dst = m
+		}
+	}
+}
+
+// recordProgress logs a change of b's current page, or time listened, since
+// was as reading progress
+func (s *Server) recordProgress(ctx context.Context, was, b *book.Book) {
+	sess, ok := book.ProgressSession(was, b)
+	if !ok {
+		return
+	}
+	sess.End = time.Now()
+	sess.Source = "web"
+	s.bookService.RecordProgress(ctx, sess)
+}
+
+func (s *Server) handleSessionAdd(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/books", http.StatusSeeOther)
+		return
+	}
+
+	r.ParseForm()
+	bookID, err := strconv.ParseInt(r.FormValue("book_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid book ID", http.StatusBadRequest)
+		return
+	}
+
+	end := time.Now()
+	if date := r.FormValue("date"); date != "" {
+		day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+		if err != nil {
+			http.Error(w, "invalid date", http.StatusBadRequest)
+			return
+		}
+		if y, m, d := end.Date(); day.Year() != y || day.Month() != m || day.Day() != d {
+			end = day.Add(20 * time.Hour) // an evening's reading
+		}
+	}
+	minutes, _ := strconv.Atoi(r.FormValue("minutes"))
+	sess := &book.Session{
+		BookID: bookID,
+		Start:  end.Add(-time.Duration(minutes) * time.Minute),
+		End:    end,
+		Note:   strings.TrimSpace(r.FormValue("note")),
+		Source: "web",
+	}
+	sess.StartPage, _ = strconv.Atoi(r.FormValue("start_page"))
+	sess.EndPage, _ = strconv.Atoi(r.FormValue("end_page"))
+
+	if _, err := s.bookService.LogSession(r.Context(), sess); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/books/%d", bookID), http.StatusSeeOther)
+}
+
+func (s *Server) handleSessionDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/books", http.StatusSeeOther)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/sessions/delete/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.bookService.DeleteSession(r.Context(), id)
+	http.Redirect(w, r, "/books/"+r.FormValue("book_id"), http.StatusSeeOther)
+}
+
+// handleReadAdd records a past read of a book
+func (s *Server) handleReadAdd(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/books", http.StatusSeeOther)
+		return
+	}
+
+	r.ParseForm()
+	bookID, err := strconv.ParseInt(r.FormValue("book_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid book ID", http.StatusBadRequest)
+		return
+	}
+	rt := &book.ReadThrough{
+		BookID: bookID,
+		Format: strings.TrimSpace(r.FormValue("format")),
+		Notes:  strings.TrimSpace(r.FormValue("notes")),
+	}
+	rt.Rating, _ = book.ParseRating(r.FormValue("rating"))
+	if started := r.FormValue("started"); started != "" {
+		rt.Started, _ = time.ParseInLocation("2006-01-02", started, time.Local)
+	}
+	if finished := r.FormValue("finished"); finished != "" {
+		rt.Finished, _ = time.ParseInLocation("2006-01-02", finished, time.Local)
+	}
+
+	if err := s.bookService.AddReadThrough(r.Context(), rt); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/books/%d", bookID), http.StatusSeeOther)
+}
+
+// handleReadStart starts a re-read of a book
+func (s *Server) handleReadStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/books", http.StatusSeeOther)
+		return
+	}
+
+	r.ParseForm()
+	bookID, err := strconv.ParseInt(r.FormValue("book_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid book ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.bookService.StartReadThrough(r.Context(), bookID, time.Now(), strings.TrimSpace(r.FormValue("format"))); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/books/%d", bookID), http.StatusSeeOther)
+}
+
+func (s *Server) handleReadDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/books", http.StatusSeeOther)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/reads/delete/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	rt, err := s.bookService.DeleteReadThrough(r.Context(), id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/books/%d", rt.BookID), http.StatusSeeOther)
+}
+
 func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Redirect(w, r, "/books", http.StatusSeeOther)
@@ -577,32 +1083,7 @@ func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/csv")
 		w.Header().Set("Content-Disposition", "attachment; filename=pka-books.csv")
 
-		writer := csv.NewWriter(w)
-		writer.Write([]string{"ID", "Title", "Author", "ISBN", "Genre", "Description", "Tags", "Rating", "Status", "Notes", "CoverURL", "DateAdded", "DateRead"})
-
-		for _, b := range books {
-			tags := strings.Join(b.Tags, "|")
-			dateRead := ""
-			if !b.DateRead.IsZero() {
-				dateRead = b.DateRead.Format(time.RFC3339)
-			}
-			writer.Write([]string{
-				strconv.FormatInt(b.ID, 10),
-				b.Title,
-				b.Author,
-				b.ISBN,
-				b.Genre,
-				b.Description,
-				tags,
-				strconv.Itoa(b.Rating),
-				string(b.Status),
-				b.Notes,
-				b.CoverURL,
-				b.DateAdded.Format(time.RFC3339),
-				dateRead,
-			})
-		}
-		writer.Flush()
+		importer.WriteCSV(w, books)
 
 	default: // json
 		w.Header().Set("Content-Type", "application/json")
@@ -632,185 +1113,653 @@ func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
 	defer cancel()
 
-	var imported, skipped int
-	var importErr error
+	var records []importer.Record
+	var parseErr error
 
-	if strings.HasSuffix(header.Filename, ".json") {
-		imported, skipped, importErr = s.importJSON(ctx, file)
+	if parse, ok := importer.Parsers[r.FormValue("source")]; ok {
+		records, parseErr = parse(file)
+	} else if strings.HasSuffix(header.Filename, ".json") {
+		records, parseErr = importer.ParseJSON(file)
 	} else if strings.HasSuffix(header.Filename, ".csv") {
-		imported, skipped, importErr = s.importCSV(ctx, file)
+		mapping, err := parseColumnMapping(r.FormValue("mapping"))
+		if err != nil {
+			s.render(w, "import.html", map[string]string{"Error": err.Error()})
+			return
+		}
+		records, parseErr = importer.ParseCSV(file, mapping)
 	} else {
 		s.render(w, "import.html", map[string]string{"Error": "Unsupported file format. Please use .json or .csv"})
 		return
 	}
 
-	if importErr != nil {
-		s.render(w, "import.html", map[string]string{"Error": importErr.Error()})
+	if parseErr != nil {
+		s.render(w, "import.html", map[string]string{"Error": parseErr.Error()})
 		return
 	}
-
-	s.render(w, "import.html", map[string]any{
-		"Success":  true,
-		"Imported": imported,
-		"Skipped":  skipped,
-	})
-}
-
-func (s *Server) importJSON(ctx context.Context, r io.Reader) (imported, skipped int, err error) {
-	var books []book.Book
-	if err := json.NewDecoder(r).Decode(&books); err != nil {
-		return 0, 0, fmt.Errorf("invalid JSON: %w", err)
+	if len(records) == 0 {
+		s.render(w, "import.html", map[string]string{"Error": "No books found in file"})
+		return
 	}
 
-	for i := range books {
-		books[i].ID = 0 // Reset ID for new insert
-		books[i].DateAdded = time.Now()
-		if err := s.bookService.Add(ctx, &books[i]); err != nil {
-			if _, ok := err.(*book.DuplicateError); ok {
-				skipped++
-			}
-		} else {
-			imported++
-		}
+	rows, err := importer.Preview(ctx, s.bookService, records)
+	if err != nil {
+		s.render(w, "import.html", map[string]string{"Error": err.Error()})
+		return
 	}
 
-	return imported, skipped, nil
-}
-
-func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
-	books, err := s.bookService.List(r.Context())
+	token, err := s.addPendingImport(rows)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.render(w, "import.html", map[string]string{"Error": err.Error()})
 		return
 	}
 
-	stats := struct {
-		Total        int
-		WantToRead   int
-		Reading      int
-		Read         int
-		AvgRating    float64
-		RatedBooks   int
-		GenreCounts  map[string]int
-		TopRated     []book.Book
-		RecentlyRead []book.Book
-		ReadByMonth  map[string]int
-	}{
-		GenreCounts: make(map[string]int),
-		ReadByMonth: make(map[string]int),
+	s.renderImportPreview(w, token, header.Filename, rows, nil)
+}
+
+// handleImportCommit applies the per-row choices from the preview page
+func (s *Server) handleImportCommit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/import", http.StatusSeeOther)
+		return
 	}
 
-	var totalRating int
+	token := r.FormValue("token")
+	s.importsMu.Lock()
+	pending, ok := s.imports[token]
+	if ok && pending.result != nil {
+		// Already committed (e.g. the form was submitted twice)
+		rows, res := append([]importer.PreviewRow(nil), pending.rows...), *pending.result
+		s.importsMu.Unlock()
+		s.renderImportPreview(w, token, r.FormValue("filename"), rows, &res)
+		return
+	}
+	if ok {
+		// Claim the import so a second submit can't commit it again
+		pending.result = &importer.Result{}
+	}
+	s.importsMu.Unlock()
 
-	for _, b := range books {
-		stats.Total++
+	if !ok {
+		s.render(w, "import.html", map[string]string{"Error": "This import has expired. Please upload the file again."})
+		return
+	}
 
-		switch b.Status {
-		case book.StatusWantToRead:
-			stats.WantToRead++
-		case book.StatusReading:
-			stats.Reading++
-		case book.StatusRead:
-			stats.Read++
-			if !b.DateRead.IsZero() {
-				monthKey := b.DateRead.Format("2006-01")
-				stats.ReadByMonth[monthKey]++
+	s.importsMu.Lock()
+	rows := append([]importer.PreviewRow(nil), pending.rows...)
+	s.importsMu.Unlock()
+	for i := range rows {
+		if rows[i].Invalid != "" {
+			continue
+		}
+		switch action := importer.Action(r.FormValue(fmt.Sprintf("action-%d", i))); action {
+		case importer.ActionImport, importer.ActionSkip:
+			rows[i].Action = action
+		case importer.ActionMerge:
+			if rows[i].MergeTarget() != nil && !rows[i].Linked {
+				rows[i].Action = action
+			}
+		case importer.ActionUpdate:
+			if rows[i].Linked {
+				rows[i].Action = action
 			}
 		}
+	}
 
-		if b.Rating > 0 {
-			totalRating += b.Rating
-			stats.RatedBooks++
-		}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
+	defer cancel()
 
-		if b.Genre != "" {
-			stats.GenreCounts[b.Genre]++
-		}
+	res, err := importer.Commit(ctx, s.bookService, rows)
+
+	s.importsMu.Lock()
+	pending.rows = rows
+	*pending.result = res
+	s.importsMu.Unlock()
+
+	if err != nil {
+		s.render(w, "import.html", map[string]string{"Error": err.Error()})
+		return
 	}
+	s.renderImportPreview(w, token, r.FormValue("filename"), rows, &res)
+}
+
+// handleImportReport serves the per-row CSV report for a previewed or
+// committed import
+func (s *Server) handleImportReport(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, "/import/report/")
 
-	if stats.RatedBooks > 0 {
-		stats.AvgRating = float64(totalRating) / float64(stats.RatedBooks)
+	s.importsMu.Lock()
+	pending, ok := s.imports[token]
+	var rows []importer.PreviewRow
+	if ok {
+		rows = append(rows, pending.rows...)
 	}
+	s.importsMu.Unlock()
 
-	// Get top rated books (rating 4 or 5)
-	for _, b := range books {
-		if b.Rating >= 4 {
-			stats.TopRated = append(stats.TopRated, b)
-			if len(stats.TopRated) >= 5 {
-				break
-			}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=import-report.csv")
+	importer.WriteReport(w, rows)
+}
+
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	// Build the archive in memory so a failure can still be reported as an
+	// error page rather than a truncated download
+	var buf bytes.Buffer
+	if _, err := backup.Write(r.Context(), &buf, s.bookService, s.coverStore); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filename := "pka-backup-" + time.Now().Format("20060102-150405") + ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	buf.WriteTo(w)
+}
+
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/import", http.StatusSeeOther)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		s.render(w, "import.html", map[string]string{"Error": "Please select a backup file to restore"})
+		return
+	}
+	defer file.Close()
+
+	archive, err := backup.Open(file, header.Size)
+	if err != nil {
+		s.render(w, "import.html", map[string]string{"Error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Minute)
+	defer cancel()
+
+	opts := backup.Options{
+		Conflict: backup.Conflict(r.FormValue("conflict")),
+		Reembed:  r.FormValue("reembed") == "on",
+	}
+	res, err := archive.Restore(ctx, s.bookService, s.coverStore, opts)
+	if err != nil {
+		s.render(w, "import.html", map[string]any{"Error": err.Error(), "Restore": res})
+		return
+	}
+
+	s.render(w, "import.html", map[string]any{"Restore": res, "Manifest": archive.Manifest})
+}
+
+// handleAdminSnapshot takes a database snapshot on demand (POST)
+func (s *Server) handleAdminSnapshot(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	snap, err := s.snapshots.Take(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snap)
+}
+
+// handleAdminSnapshots lists the snapshots on disk, newest first
+func (s *Server) handleAdminSnapshots(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+
+	snaps, err := s.snapshots.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if snaps == nil {
+		snaps = []snapshot.Snapshot{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snaps)
+}
+
+// authorizeAdmin checks the request's bearer token, writing an error
+// response if it doesn't match
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if s.snapshots == nil || s.adminToken == "" {
+		http.NotFound(w, r)
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (s *Server) renderImportPreview(w http.ResponseWriter, token, filename string, rows []importer.PreviewRow, res *importer.Result) {
+	counts := map[string]int{}
+	for i := range rows {
+		switch {
+		case rows[i].Invalid != "":
+			counts["invalid"]++
+		case rows[i].Linked:
+			counts["linked"]++
+		case rows[i].IsDuplicate():
+			counts["duplicate"]++
+		default:
+			counts["new"]++
 		}
 	}
 
-	// Get recently read books
-	for _, b := range books {
-		if b.Status == book.StatusRead && !b.DateRead.IsZero() {
-			stats.RecentlyRead = append(stats.RecentlyRead, b)
-			if len(stats.RecentlyRead) >= 5 {
-				break
-			}
+	s.render(w, "import_preview.html", map[string]any{
+		"Token":    token,
+		"Filename": filename,
+		"Rows":     rows,
+		"Counts":   counts,
+		"Result":   res,
+	})
+}
+
+// addPendingImport stores previewed rows under a new random token, dropping
+// expired imports
+func (s *Server) addPendingImport(rows []importer.PreviewRow) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate import token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+
+	s.importsMu.Lock()
+	defer s.importsMu.Unlock()
+	for t, p := range s.imports {
+		if time.Since(p.createdAt) > pendingImportTTL {
+			delete(s.imports, t)
 		}
 	}
+	s.imports[token] = &pendingImport{rows: rows, createdAt: time.Now()}
+	return token, nil
+}
 
-	s.render(w, "stats.html", stats)
+// handleWrapped shows a year in review at /stats/{year}, or downloads it
+// with ?format=md or ?format=html
+func (s *Server) handleWrapped(w http.ResponseWriter, r *http.Request) {
+	year, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/stats/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	books, err := s.bookService.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	reads, err := s.bookService.AllReadThroughs(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	review := report.Build(year, books, reads)
+
+	filename := fmt.Sprintf("pka-%d-in-books", year)
+	switch r.URL.Query().Get("format") {
+	case "md":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("Content-Disposition", "attachment; filename="+filename+".md")
+		report.WriteMarkdown(w, review)
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Disposition", "attachment; filename="+filename+".html")
+		report.WriteHTML(w, review)
+	default:
+		s.render(w, "wrapped.html", review)
+	}
 }
 
-func (s *Server) importCSV(ctx context.Context, r io.Reader) (imported, skipped int, err error) {
-	reader := csv.NewReader(r)
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	rng, err := stats.ParseRange(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	st, err := stats.Of(r.Context(), s.bookService, rng, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	// Skip header
-	if _, err := reader.Read(); err != nil {
-		return 0, 0, fmt.Errorf("invalid CSV: %w", err)
+	data := struct {
+		*stats.Stats
+		Charts report.Charts
+		From   string
+		To     string
+		Goals  []book.GoalProgress // this year's
+		Year   int
+	}{
+		Stats:  st,
+		Charts: report.StatsCharts(st),
+		From:   r.URL.Query().Get("from"),
+		To:     r.URL.Query().Get("to"),
+		Year:   now.Year(),
+	}
+	if data.Goals, err = s.bookService.GoalProgress(r.Context(), now.Year(), now); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.render(w, "stats.html", data)
+}
+
+// handleStatsAPI returns the statistics as JSON, for the reads finished
+// between ?from= and ?to= (each YYYY, YYYY-MM or YYYY-MM-DD, both optional)
+func (s *Server) handleStatsAPI(w http.ResponseWriter, r *http.Request) {
+	rng, err := stats.ParseRange(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	st, err := stats.Of(r.Context(), s.bookService, rng, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+// parseColumnMapping reads "field=Column Name" pairs separated by commas
+// or newlines
+func parseColumnMapping(text string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, pair := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == '\n' }) {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
 		}
-		if err != nil {
-			return imported, skipped, fmt.Errorf("CSV read error: %w", err)
+		field, column, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid column mapping %q (use field=Column Name)", pair)
 		}
+		mapping[strings.TrimSpace(field)] = strings.TrimSpace(column)
+	}
+	return mapping, nil
+}
+
+// handleSeries lists every series with its books in order, or just the one
+// named by ?name=
+func (s *Server) handleSeries(w http.ResponseWriter, r *http.Request) {
+	all, err := s.bookService.AllSeries(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-		if len(record) < 9 {
-			continue // Skip invalid rows
+	name := r.URL.Query().Get("name")
+	if name != "" {
+		sr, err := s.bookService.Series(r.Context(), name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
 		}
+		all = []book.Series{*sr}
+	}
+
+	s.render(w, "series.html", struct {
+		Series []book.Series
+		Name   string
+	}{all, name})
+}
 
-		rating, _ := strconv.Atoi(record[7])
-		var tags []string
-		if record[6] != "" {
-			tags = strings.Split(record[6], "|")
+// handleAuthors lists every author, or sends ?name= to that author's page
+func (s *Server) handleAuthors(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if name := r.URL.Query().Get("name"); name != "" {
+		a, err := s.bookService.FindAuthor(ctx, name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
 		}
+		http.Redirect(w, r, fmt.Sprintf("/authors/%d", a.ID), http.StatusSeeOther)
+		return
+	}
 
-		b := &book.Book{
-			Title:       record[1],
-			Author:      record[2],
-			ISBN:        record[3],
-			Genre:       record[4],
-			Description: record[5],
-			Tags:        tags,
-			Rating:      rating,
-			Status:      book.Status(record[8]),
-			DateAdded:   time.Now(),
+	authors, err := s.bookService.Authors(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.render(w, "authors.html", authors)
+}
+
+// handleAuthor shows an author's books in the library and, with ?more=1,
+// their other books on Open Library
+func (s *Server) handleAuthor(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/authors/"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	a, err := s.bookService.Author(ctx, id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := struct {
+		*book.AuthorBooks
+		More      []book.Book // on Open Library and not in the library
+		MoreError string
+		Searched  bool
+	}{AuthorBooks: a}
+	if r.URL.Query().Get("more") != "" {
+		data.Searched = true
+		if data.More, err = s.moreByAuthor(ctx, a); err != nil {
+			data.MoreError = err.Error()
 		}
+	}
+	s.render(w, "author.html", data)
+}
 
-		if len(record) > 9 {
-			b.Notes = record[9]
+// moreByAuthor fetches an author's books from Open Library, leaving out
+// the ones in the library. An author found by name is linked to their Open
+// Library key for next time.
+func (s *Server) moreByAuthor(ctx context.Context, a *book.AuthorBooks) ([]book.Book, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	client := scraper.NewOpenLibraryClient()
+	if a.OLKey == "" {
+		key, _, err := client.SearchAuthor(ctx, a.Name)
+		if err != nil {
+			return nil, err
 		}
-		if len(record) > 10 {
-			b.CoverURL = record[10]
+		linked, err := s.bookService.SetAuthorKey(ctx, a.ID, key)
+		if err != nil {
+			return nil, err
 		}
+		a.OLKey = linked.OLKey
+	}
 
-		if err := s.bookService.Add(ctx, b); err != nil {
-			if _, ok := err.(*book.DuplicateError); ok {
-				skipped++
-			}
-		} else {
-			imported++
+	works, err := client.FetchAuthorWorks(ctx, a.OLKey, a.Name, 50)
+	if err != nil {
+		return nil, err
+	}
+	var more []book.Book
+	for _, b := range works {
+		if a.Find(b.Title) == nil {
+			more = append(more, b)
 		}
 	}
+	return more, nil
+}
 
-	return imported, skipped, nil
+// handleAuthorAlias records another spelling of an author's name, merging
+// in the author who goes by it, if any
+func (s *Server) handleAuthorAlias(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/authors", http.StatusSeeOther)
+		return
+	}
+
+	r.ParseForm()
+	id, err := strconv.ParseInt(r.FormValue("author_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid author ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.bookService.AddAlias(r.Context(), id, r.FormValue("alias")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/authors/%d", id), http.StatusSeeOther)
+}
+
+func (s *Server) handleCreditAdd(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/books", http.StatusSeeOther)
+		return
+	}
+
+	r.ParseForm()
+	bookID, err := strconv.ParseInt(r.FormValue("book_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid book ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.bookService.AddCredit(r.Context(), bookID, r.FormValue("name"), book.Role(r.FormValue("role"))); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/books/%d", bookID), http.StatusSeeOther)
+}
+
+func (s *Server) handleCreditDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/books", http.StatusSeeOther)
+		return
+	}
+
+	r.ParseForm()
+	bookID, err := strconv.ParseInt(r.FormValue("book_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid book ID", http.StatusBadRequest)
+		return
+	}
+	authorID, err := strconv.ParseInt(r.FormValue("author_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid author ID", http.StatusBadRequest)
+		return
+	}
+	if err := s.bookService.RemoveCredit(r.Context(), bookID, authorID, book.Role(r.FormValue("role"))); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/books/%d", bookID), http.StatusSeeOther)
+}
+
+func (s *Server) handleEditionAdd(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/books", http.StatusSeeOther)
+		return
+	}
+
+	r.ParseForm()
+	bookID, err := strconv.ParseInt(r.FormValue("book_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid book ID", http.StatusBadRequest)
+		return
+	}
+	e := &book.Edition{
+		ISBN:      r.FormValue("isbn"),
+		Format:    book.Format(r.FormValue("format")),
+		Publisher: r.FormValue("publisher"),
+		CoverURL:  r.FormValue("cover_url"),
+	}
+	if pages := r.FormValue("page_count"); pages != "" {
+		e.PageCount, _ = strconv.Atoi(pages)
+	}
+	formMinutes(r, "total_minutes", &e.TotalMinutes)
+
+	ctx := r.Context()
+	if err := s.bookService.AddEdition(ctx, bookID, e); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.FormValue("use") != "" {
+		if _, err := s.bookService.UseEdition(ctx, bookID, e.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	http.Redirect(w, r, fmt.Sprintf("/books/%d", bookID), http.StatusSeeOther)
+}
+
+// handleEditionUse switches the edition a book is read in
+func (s *Server) handleEditionUse(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/books", http.StatusSeeOther)
+		return
+	}
+
+	r.ParseForm()
+	bookID, err := strconv.ParseInt(r.FormValue("book_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid book ID", http.StatusBadRequest)
+		return
+	}
+	editionID, err := strconv.ParseInt(r.FormValue("edition_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid edition ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.bookService.UseEdition(r.Context(), bookID, editionID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/books/%d", bookID), http.StatusSeeOther)
+}
+
+func (s *Server) handleEditionDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/books", http.StatusSeeOther)
+		return
+	}
+
+	r.ParseForm()
+	bookID, err := strconv.ParseInt(r.FormValue("book_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid book ID", http.StatusBadRequest)
+		return
+	}
+	editionID, err := strconv.ParseInt(r.FormValue("edition_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid edition ID", http.StatusBadRequest)
+		return
+	}
+	if err := s.bookService.RemoveEdition(r.Context(), bookID, editionID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/books/%d", bookID), http.StatusSeeOther)
 }
 
 // handleAdaptations shows all books with adaptations
@@ -1019,6 +1968,131 @@ func (s *Server) handleAdaptationsDelete(w http.ResponseWriter, r *http.Request)
 	http.Redirect(w, r, fmt.Sprintf("/books/%d", bookID), http.StatusSeeOther)
 }
 
+// handleCover serves a book's locally cached cover, fetching it on first
+// use. ?size=sm|md|lg picks a thumbnail width, ?size=full the original.
+// Books without a usable cover get a generated placeholder. Browsers
+// revalidate every time, against an ETag of the cover's hash, so a
+// replaced cover shows up at once.
+func (s *Server) handleCover(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(r.URL.Path, "/covers/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	b, err := s.bookService.Get(ctx, id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if s.coverStore != nil {
+		hash := b.CoverHash
+		if hash == "" && b.CoverURL != "" && s.mayFetchCover(b.CoverURL) {
+			fetchCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			hash, err = s.coverStore.Fetch(fetchCtx, b.CoverURL)
+			cancel()
+			if err == nil {
+				s.bookService.SetCoverHash(ctx, b.ID, hash)
+			} else {
+				s.coverFailsMu.Lock()
+				s.coverFails[b.CoverURL] = time.Now()
+				s.coverFailsMu.Unlock()
+			}
+		}
+
+		if hash != "" && s.coverStore.Has(hash) {
+			var path string
+			size := r.URL.Query().Get("size")
+			if size == "full" {
+				path, err = s.coverStore.Original(hash)
+			} else {
+				width, ok := covers.Sizes[size]
+				if !ok {
+					size, width = "md", covers.Sizes["md"]
+				}
+				path, err = s.coverStore.Thumbnail(hash, width)
+			}
+			if err == nil {
+				w.Header().Set("Cache-Control", "no-cache")
+				w.Header().Set("ETag", fmt.Sprintf(`"%s-%s"`, hash, size))
+				http.ServeFile(w, r, path)
+				return
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(covers.Placeholder(b.Title, b.Author))
+}
+
+// mayFetchCover reports whether url should be downloaded: it hasn't failed
+// within coverRetryAfter
+func (s *Server) mayFetchCover(url string) bool {
+	s.coverFailsMu.Lock()
+	defer s.coverFailsMu.Unlock()
+
+	failed, ok := s.coverFails[url]
+	if !ok {
+		return true
+	}
+	if time.Since(failed) < coverRetryAfter {
+		return false
+	}
+	delete(s.coverFails, url)
+	return true
+}
+
+// handleFile serves the local ebook file a book is linked to
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(r.URL.Path, "/files/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	b, err := s.bookService.Get(r.Context(), id)
+	if err != nil || b.FilePath == "" {
+		http.NotFound(w, r)
+		return
+	}
+	path, ok := s.servableFile(b.FilePath)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+	http.ServeFile(w, r, path)
+}
+
+// servableFile resolves path, following symlinks, and reports whether the
+// file it names is a regular file inside one of the ebook directories
+func (s *Server) servableFile(path string) (string, bool) {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", false
+	}
+	real, err = filepath.Abs(real)
+	if err != nil {
+		return "", false
+	}
+	if info, err := os.Stat(real); err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	for _, dir := range s.fileDirs {
+		rel, err := filepath.Rel(dir, real)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel) {
+			return real, true
+		}
+	}
+	return "", false
+}
+
 func (s *Server) render(w http.ResponseWriter, name string, data any) {
 	var buf bytes.Buffer
 	if err := s.templates.ExecuteTemplate(&buf, name, data); err != nil {